@@ -0,0 +1,665 @@
+// Package ast declares the types used to represent the syntax tree of LXT source files.
+package ast
+
+import (
+	"fmt"
+
+	"github.com/puellanivis/lxt/tokenizer"
+	"github.com/puellanivis/lxt/xpath"
+)
+
+// Pos describes a position in an LXT source file.
+type Pos = tokenizer.Position
+
+// Node is implemented by all nodes of the syntax tree.
+type Node interface {
+	// Pos returns the position of the first character of the node.
+	Pos() Pos
+
+	// End returns the position immediately after the last character of the node.
+	End() Pos
+}
+
+// File is a parsed LXT source file.
+type File struct {
+	Filename string
+
+	Statements []Node
+
+	// Comments are the line and block comments of the file, in source order,
+	// if they were kept by the parser.
+	Comments []*PlainComment
+}
+
+// Comment is a doc comment: `/** text */`.
+type Comment struct {
+	Slash  Pos
+	Text   string
+	EndPos Pos
+}
+
+// PlainComment is a line comment, `# text` or `// text`, or a block comment, `/* text */`.
+// The Text includes the delimiters.
+//
+// Plain comments are not part of the syntax tree proper, and are discarded by the compiler.
+type PlainComment struct {
+	Slash  Pos
+	Text   string
+	EndPos Pos
+}
+
+// Ident is an identifier.
+type Ident struct {
+	NamePos Pos
+	Name    string
+	EndPos  Pos
+}
+
+// String is a quoted string literal.
+type String struct {
+	ValuePos Pos
+	Quote    rune // one of '"', '\'', or '`'
+	Value    string
+	EndPos   Pos
+}
+
+// Interpolated is a back-quoted string with XPaths interpolated into it: `Hello, {$name}!`.
+// Its Parts are each either a *String of literal text, or an *XPath, in order.
+type Interpolated struct {
+	ValuePos Pos
+	Parts    []Node
+	EndPos   Pos
+}
+
+// XPath is an XPath expression: `$var`, `@attr`, `<simple/xpath>`, or `<{ complex xpath }>`.
+//
+// ExprPos is the position of the start of Value in the source,
+// which is the base of the offsets in the parsed Expr.
+// If the Value could not be parsed, then Expr is nil.
+type XPath struct {
+	ValuePos Pos
+	Value    string
+	EndPos   Pos
+
+	ExprPos Pos
+	Expr    xpath.Expr
+}
+
+// Number is a numeric literal.
+type Number struct {
+	ValuePos Pos
+	Value    string
+	EndPos   Pos
+}
+
+// Empty is an empty statement or expression: `;`.
+type Empty struct {
+	Semicolon Pos
+}
+
+// Group is a sequence of expressions between a block-start and its corresponding block-end.
+// An implicit group has no delimiters, and is used to attach doc comments to a single expression.
+type Group struct {
+	Open  Pos
+	Delim string // one of "(", "[", "{", or "" for an implicit group
+	List  []Node
+	Close Pos
+}
+
+// Map is a grouping of `key => value` entries.
+type Map struct {
+	Open    Pos
+	Delim   string
+	Entries []*MapEntry
+	Close   Pos
+}
+
+// MapEntry is a single `key => value` entry of a Map.
+// The key and value are each either an *Ident or a *String.
+type MapEntry struct {
+	Key   Node
+	Arrow Pos
+	Value Node
+}
+
+// VarKind describes which kind of variable a Variable declares.
+type VarKind int
+
+// Variable kinds.
+const (
+	VarKindVar VarKind = iota
+	VarKindParam
+	VarKindArgument
+)
+
+func (k VarKind) String() string {
+	switch k {
+	case VarKindVar:
+		return "var"
+	case VarKindParam:
+		return "param"
+	case VarKindArgument:
+		return "argument"
+	}
+
+	return fmt.Sprintf("VarKind(%d)", int(k))
+}
+
+// Variable declares a variable, a parameter, or an argument to a call: `var name as type = value`.
+// A parameter or argument may be tunnelled: `tunnel name => value`.
+//
+// The Value is one of:
+// an *XPath or *Number, used as the select;
+// an empty *String, meaning no value;
+// any other expression, used as the body;
+// or nil for the parameters of a Func, which take no default value.
+type Variable struct {
+	Keyword Pos // invalid for variables in a VariableList
+	Tunnel  Pos // valid only for a tunnelled parameter or argument
+	Kind    VarKind
+	Name    *Ident
+	As      *As // or nil
+	Op      string
+	Assign  Pos
+	Value   Node
+}
+
+// As is a type annotation: `as xs:string`.
+// The Type is either an *Ident or a *String.
+type As struct {
+	Keyword Pos
+	Type    Node
+}
+
+// VariableList is a grouping of parameter or argument declarations: `( name => value, … )`.
+type VariableList struct {
+	Open  Pos
+	Delim string
+	List  []*Variable
+	Close Pos
+}
+
+// Output is the output directive: `output ( key => value, … )`.
+// It is also used for the output option of a ResultDocument.
+type Output struct {
+	Keyword    Pos
+	Attributes *Map // nil for `output;`
+}
+
+// Namespace is a namespace declaration: `namespace prefix => "uri"`,
+// or `namespace "uri"` for the default namespace.
+type Namespace struct {
+	Keyword Pos
+	Prefix  *Ident // or nil for the default namespace
+	Arrow   Pos
+	URI     *String
+}
+
+// Stylesheet is the stylesheet directive: `stylesheet ( key => value, … )`.
+type Stylesheet struct {
+	Keyword    Pos
+	Attributes *Map
+}
+
+// Import is an import directive: `import "href"`.
+type Import struct {
+	Keyword Pos
+	Href    *String
+}
+
+// Include is an include directive: `include "href"`.
+type Include struct {
+	Keyword Pos
+	Href    *String
+}
+
+// Use is a use directive: `use "module.lxt"`.
+type Use struct {
+	Keyword Pos
+	Href    *String
+
+	// File is the parsed module, or nil if the module has already been used elsewhere.
+	File *File
+}
+
+// Key is a key declaration, indexing the nodes matching the pattern by the value of the use XPath:
+// `key name <match> <use>`.
+type Key struct {
+	Keyword Pos
+	Name    *Ident
+	Match   *XPath
+	Use     *XPath
+}
+
+// Sub is a named template: `sub name ( params ) body`.
+type Sub struct {
+	Keyword Pos
+	Name    *Ident
+	Params  *VariableList // or nil
+	Body    Node
+}
+
+// Func is a stylesheet function, callable from XPath: `func prefix:name ( $param as type, … ) as type body`.
+// Its parameters have no values.
+type Func struct {
+	Keyword Pos
+	Name    *Ident
+	Params  *VariableList // or nil
+	As      *As           // or nil
+	Body    Node
+}
+
+// Return gives the result of a Func: `return <select>`.
+type Return struct {
+	Keyword Pos
+	Select  *XPath
+}
+
+// Template is a matching template: `template <match> mode name priority 1 ( params ) body`.
+type Template struct {
+	Keyword  Pos
+	Match    *XPath
+	Mode     *Mode         // or nil
+	Priority *Priority     // or nil
+	Params   *VariableList // or nil
+	Body     Node
+}
+
+// Mode is a mode option: `mode name`.
+type Mode struct {
+	Keyword Pos
+	Name    *Ident
+}
+
+// Priority is a priority option: `priority 1.5`.
+// The Value is either a *Number or a *String.
+type Priority struct {
+	Keyword Pos
+	Value   Node
+}
+
+// Sequence is a sequence expression: `sequence <select>`.
+type Sequence struct {
+	Keyword Pos
+	Select  *XPath
+}
+
+// AnalyzeString is a regular expression match:
+// `analyze-string <select> "regex" flags "i" matching body non-matching body`.
+// At least one of the Matching and NonMatching branches is given.
+type AnalyzeString struct {
+	Keyword     Pos
+	Select      *XPath
+	Regex       *String
+	Flags       *Flags     // or nil
+	Matching    *Substring // or nil
+	NonMatching *Substring // or nil
+}
+
+// Flags is the flags option of an AnalyzeString: `flags "i"`.
+type Flags struct {
+	Keyword Pos
+	Value   *String
+}
+
+// Substring is a branch of an AnalyzeString: `matching body` or `non-matching body`.
+type Substring struct {
+	Keyword Pos
+	Body    Node
+}
+
+// ResultDocument writes to a secondary result document: `result-document "href" output ( key => value, … ) body`.
+// The Href is either a *String or an *XPath.
+type ResultDocument struct {
+	Keyword Pos
+	Href    Node
+	Output  *Output // or nil
+	Body    Node
+}
+
+// Text is an explicit text expression: `text "value"`.
+type Text struct {
+	Keyword Pos
+	Value   *String
+}
+
+// CopyOf is a copy-of expression: `copy-of <xpath>`.
+type CopyOf struct {
+	Keyword Pos
+	Select  *XPath
+}
+
+// ForEach is a loop: `foreach <select> sort-by ( … ) body`.
+type ForEach struct {
+	Keyword Pos
+	Select  *XPath
+	SortBy  *SortBy // or nil
+	Body    Node
+}
+
+// GroupBy is a grouping loop: `group <select> by <key> sort-by ( … ) body`.
+// The body is evaluated once for each group of the selected items with the same key,
+// where current-group() and current-grouping-key() give the items of the group, and their key.
+type GroupBy struct {
+	Keyword Pos
+	Select  *XPath
+	By      Pos
+	Key     *XPath
+	SortBy  *SortBy // or nil
+	Body    Node
+}
+
+// SortBy is a list of sort keys: `sort-by ( <key> modifiers…, … )`.
+type SortBy struct {
+	Keyword Pos
+	Open    Pos
+	Delim   string
+	Keys    []*SortKey
+	Close   Pos
+}
+
+// SortKey is a single key of a SortBy.
+type SortKey struct {
+	Select    *XPath
+	Modifiers []*SortModifier
+}
+
+// SortModifier is a modifier of a SortKey: `desc`, `number`, `lang "en"`, etc.
+type SortModifier struct {
+	Name  *Ident
+	Value Node // the language code for `lang`, otherwise nil
+}
+
+// ApplyTemplates is an apply-templates expression: `apply-templates <select> mode name sort-by ( … ) ( args )`.
+type ApplyTemplates struct {
+	Keyword Pos
+	Select  *XPath        // or nil
+	Mode    *Mode         // or nil
+	SortBy  *SortBy       // or nil
+	Args    *VariableList // or nil
+}
+
+// Choose is a chain of `when` expressions, optionally terminated by an `otherwise`.
+type Choose struct {
+	Whens     []*When
+	Otherwise *Otherwise // or nil
+}
+
+// When is a conditional branch of a Choose: `when <test> body`.
+type When struct {
+	Keyword Pos
+	Test    *XPath
+	Body    Node
+}
+
+// Otherwise is the final branch of a Choose: `otherwise body`.
+type Otherwise struct {
+	Keyword Pos
+	Body    Node
+}
+
+// If is a conditional expression: `if <test> body`.
+type If struct {
+	Keyword Pos
+	Test    *XPath
+	Body    Node
+}
+
+// Call is a call of a named template: `call name ( args )`.
+type Call struct {
+	Keyword Pos
+	Name    *Ident
+	Args    *VariableList // or nil
+}
+
+// Tag is an element constructor: `tag name body`.
+// The Name is either an *Ident, or an *XPath for a computed name: `tag <{ local-name() }> body`.
+type Tag struct {
+	Keyword   Pos
+	Name      Node
+	Namespace *InNamespace // or nil
+	Body      Node
+}
+
+// Attribs is a list of attributes for the enclosing element: `attribs ( name => value, … )`.
+type Attribs struct {
+	Keyword Pos
+	Open    Pos
+	Delim   string
+	List    []*Attrib
+	Close   Pos
+}
+
+// Attrib is a single attribute of an Attribs.
+// The Name is either an *Ident, a *String, or an *XPath for a computed name.
+type Attrib struct {
+	Name      Node
+	Namespace *InNamespace // or nil
+	Arrow     Pos
+	Value     Node
+}
+
+// InNamespace is the namespace option of a Tag or Attrib: `namespace "uri"`.
+// The URI is either a *String, or an *XPath for a computed namespace.
+type InNamespace struct {
+	Keyword Pos
+	URI     Node
+}
+
+// HTMLElement is HTML sugar for an element, with an optional id and classes: `div#main.card.wide body`.
+// A div or span may instead be given a single class after the keyword: `div class body`,
+// where the Class is either an *Ident or a *String.
+type HTMLElement struct {
+	Keyword Pos
+	Tag     string
+	ID      string   // or empty
+	Classes []string // or nil
+	Class   Node     // or nil
+	Body    Node
+}
+
+func (n *Comment) Pos() Pos      { return n.Slash }
+func (n *PlainComment) Pos() Pos { return n.Slash }
+func (n *Ident) Pos() Pos        { return n.NamePos }
+func (n *String) Pos() Pos       { return n.ValuePos }
+func (n *Interpolated) Pos() Pos { return n.ValuePos }
+func (n *XPath) Pos() Pos        { return n.ValuePos }
+func (n *Number) Pos() Pos       { return n.ValuePos }
+func (n *Empty) Pos() Pos        { return n.Semicolon }
+func (n *Group) Pos() Pos        { return n.Open }
+func (n *Map) Pos() Pos          { return n.Open }
+func (n *MapEntry) Pos() Pos     { return n.Key.Pos() }
+func (n *Variable) Pos() Pos {
+	switch {
+	case n.Keyword.IsValid():
+		return n.Keyword
+	case n.Tunnel.IsValid():
+		return n.Tunnel
+	}
+	return n.Name.Pos()
+}
+func (n *As) Pos() Pos             { return n.Keyword }
+func (n *VariableList) Pos() Pos   { return n.Open }
+func (n *Output) Pos() Pos         { return n.Keyword }
+func (n *Namespace) Pos() Pos      { return n.Keyword }
+func (n *Stylesheet) Pos() Pos     { return n.Keyword }
+func (n *Import) Pos() Pos         { return n.Keyword }
+func (n *Include) Pos() Pos        { return n.Keyword }
+func (n *Use) Pos() Pos            { return n.Keyword }
+func (n *Key) Pos() Pos            { return n.Keyword }
+func (n *Sub) Pos() Pos            { return n.Keyword }
+func (n *Func) Pos() Pos           { return n.Keyword }
+func (n *Return) Pos() Pos         { return n.Keyword }
+func (n *Template) Pos() Pos       { return n.Keyword }
+func (n *Mode) Pos() Pos           { return n.Keyword }
+func (n *Priority) Pos() Pos       { return n.Keyword }
+func (n *Sequence) Pos() Pos       { return n.Keyword }
+func (n *AnalyzeString) Pos() Pos  { return n.Keyword }
+func (n *Flags) Pos() Pos          { return n.Keyword }
+func (n *Substring) Pos() Pos      { return n.Keyword }
+func (n *ResultDocument) Pos() Pos { return n.Keyword }
+func (n *Text) Pos() Pos           { return n.Keyword }
+func (n *CopyOf) Pos() Pos         { return n.Keyword }
+func (n *ForEach) Pos() Pos        { return n.Keyword }
+func (n *GroupBy) Pos() Pos        { return n.Keyword }
+func (n *SortBy) Pos() Pos         { return n.Keyword }
+func (n *SortKey) Pos() Pos        { return n.Select.Pos() }
+func (n *SortModifier) Pos() Pos   { return n.Name.Pos() }
+func (n *ApplyTemplates) Pos() Pos { return n.Keyword }
+func (n *Choose) Pos() Pos         { return n.Whens[0].Pos() }
+func (n *When) Pos() Pos           { return n.Keyword }
+func (n *Otherwise) Pos() Pos      { return n.Keyword }
+func (n *If) Pos() Pos             { return n.Keyword }
+func (n *Call) Pos() Pos           { return n.Keyword }
+func (n *Tag) Pos() Pos            { return n.Keyword }
+func (n *Attribs) Pos() Pos        { return n.Keyword }
+func (n *Attrib) Pos() Pos         { return n.Name.Pos() }
+func (n *InNamespace) Pos() Pos    { return n.Keyword }
+func (n *HTMLElement) Pos() Pos    { return n.Keyword }
+
+// after returns the position n bytes after the given position, which must not cross a line.
+func after(p Pos, n int) Pos {
+	p.Column += n
+	p.Offset += n
+	return p
+}
+
+// closeEnd returns the end of a grouping which closes at the given position.
+func closeEnd(close Pos) Pos {
+	return after(close, 1)
+}
+
+func (n *Comment) End() Pos      { return n.EndPos }
+func (n *PlainComment) End() Pos { return n.EndPos }
+func (n *Ident) End() Pos        { return n.EndPos }
+func (n *String) End() Pos       { return n.EndPos }
+func (n *Interpolated) End() Pos { return n.EndPos }
+func (n *XPath) End() Pos        { return n.EndPos }
+func (n *Number) End() Pos       { return n.EndPos }
+func (n *Empty) End() Pos        { return after(n.Semicolon, 1) }
+
+func (n *Group) End() Pos {
+	if n.Delim == "" {
+		return n.List[len(n.List)-1].End()
+	}
+	return closeEnd(n.Close)
+}
+
+func (n *Map) End() Pos      { return closeEnd(n.Close) }
+func (n *MapEntry) End() Pos { return n.Value.End() }
+
+func (n *Variable) End() Pos {
+	switch {
+	case n.Value != nil:
+		return n.Value.End()
+	case n.As != nil:
+		return n.As.End()
+	}
+	return n.Name.End()
+}
+
+func (n *As) End() Pos           { return n.Type.End() }
+func (n *VariableList) End() Pos { return closeEnd(n.Close) }
+
+func (n *Output) End() Pos {
+	if n.Attributes != nil {
+		return n.Attributes.End()
+	}
+	return after(n.Keyword, len("output"))
+}
+
+func (n *Namespace) End() Pos { return n.URI.End() }
+
+func (n *Stylesheet) End() Pos {
+	if n.Attributes != nil {
+		return n.Attributes.End()
+	}
+	return after(n.Keyword, len("stylesheet"))
+}
+
+func (n *Import) End() Pos   { return n.Href.End() }
+func (n *Include) End() Pos  { return n.Href.End() }
+func (n *Use) End() Pos      { return n.Href.End() }
+func (n *Key) End() Pos      { return n.Use.End() }
+func (n *Sub) End() Pos      { return n.Body.End() }
+func (n *Func) End() Pos     { return n.Body.End() }
+func (n *Return) End() Pos   { return n.Select.End() }
+func (n *Template) End() Pos { return n.Body.End() }
+func (n *Mode) End() Pos     { return n.Name.End() }
+func (n *Priority) End() Pos { return n.Value.End() }
+func (n *Sequence) End() Pos { return n.Select.End() }
+
+func (n *AnalyzeString) End() Pos {
+	if n.NonMatching != nil {
+		return n.NonMatching.End()
+	}
+	return n.Matching.End()
+}
+
+func (n *Flags) End() Pos          { return n.Value.End() }
+func (n *Substring) End() Pos      { return n.Body.End() }
+func (n *ResultDocument) End() Pos { return n.Body.End() }
+
+func (n *Text) End() Pos    { return n.Value.End() }
+func (n *CopyOf) End() Pos  { return n.Select.End() }
+func (n *ForEach) End() Pos { return n.Body.End() }
+func (n *GroupBy) End() Pos { return n.Body.End() }
+func (n *SortBy) End() Pos  { return closeEnd(n.Close) }
+
+func (n *SortKey) End() Pos {
+	if len(n.Modifiers) > 0 {
+		return n.Modifiers[len(n.Modifiers)-1].End()
+	}
+	return n.Select.End()
+}
+
+func (n *SortModifier) End() Pos {
+	if n.Value != nil {
+		return n.Value.End()
+	}
+	return n.Name.End()
+}
+
+func (n *ApplyTemplates) End() Pos {
+	switch {
+	case n.Args != nil:
+		return n.Args.End()
+	case n.SortBy != nil:
+		return n.SortBy.End()
+	case n.Mode != nil:
+		return n.Mode.End()
+	case n.Select != nil:
+		return n.Select.End()
+	}
+	return after(n.Keyword, len("apply-templates"))
+}
+
+func (n *Choose) End() Pos {
+	if n.Otherwise != nil {
+		return n.Otherwise.End()
+	}
+	return n.Whens[len(n.Whens)-1].End()
+}
+
+func (n *When) End() Pos      { return n.Body.End() }
+func (n *Otherwise) End() Pos { return n.Body.End() }
+func (n *If) End() Pos        { return n.Body.End() }
+
+func (n *Call) End() Pos {
+	if n.Args != nil {
+		return n.Args.End()
+	}
+	return n.Name.End()
+}
+
+func (n *Tag) End() Pos         { return n.Body.End() }
+func (n *Attribs) End() Pos     { return closeEnd(n.Close) }
+func (n *Attrib) End() Pos      { return n.Value.End() }
+func (n *InNamespace) End() Pos { return n.URI.End() }
+func (n *HTMLElement) End() Pos { return n.Body.End() }
+
+// Offset returns the position in the source of the given byte offset into the Value,
+// such as the offsets of the nodes of the parsed Expr.
+func (n *XPath) Offset(offset int) Pos {
+	return n.ExprPos.Advance([]byte(n.Value[:offset]))
+}
@@ -0,0 +1,217 @@
+package ast
+
+import (
+	"reflect"
+)
+
+// Inspect traverses the given node and all of its children depth-first, calling fn for each node.
+// If fn returns false, then the children of that node are not visited.
+func Inspect(node Node, fn func(node Node) bool) {
+	if isNil(node) || !fn(node) {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Group:
+		for _, child := range n.List {
+			Inspect(child, fn)
+		}
+
+	case *Interpolated:
+		for _, part := range n.Parts {
+			Inspect(part, fn)
+		}
+
+	case *Map:
+		for _, entry := range n.Entries {
+			Inspect(entry, fn)
+		}
+
+	case *MapEntry:
+		Inspect(n.Key, fn)
+		Inspect(n.Value, fn)
+
+	case *Variable:
+		Inspect(n.Name, fn)
+		Inspect(n.As, fn)
+		Inspect(n.Value, fn)
+
+	case *As:
+		Inspect(n.Type, fn)
+
+	case *VariableList:
+		for _, v := range n.List {
+			Inspect(v, fn)
+		}
+
+	case *Output:
+		Inspect(n.Attributes, fn)
+
+	case *Namespace:
+		Inspect(n.Prefix, fn)
+		Inspect(n.URI, fn)
+
+	case *Stylesheet:
+		Inspect(n.Attributes, fn)
+
+	case *Import:
+		Inspect(n.Href, fn)
+
+	case *Include:
+		Inspect(n.Href, fn)
+
+	case *Use:
+		Inspect(n.Href, fn)
+
+	case *Key:
+		Inspect(n.Name, fn)
+		Inspect(n.Match, fn)
+		Inspect(n.Use, fn)
+
+	case *Sub:
+		Inspect(n.Name, fn)
+		Inspect(n.Params, fn)
+		Inspect(n.Body, fn)
+
+	case *Func:
+		Inspect(n.Name, fn)
+		Inspect(n.Params, fn)
+		Inspect(n.As, fn)
+		Inspect(n.Body, fn)
+
+	case *Return:
+		Inspect(n.Select, fn)
+
+	case *Template:
+		Inspect(n.Match, fn)
+		Inspect(n.Mode, fn)
+		Inspect(n.Priority, fn)
+		Inspect(n.Params, fn)
+		Inspect(n.Body, fn)
+
+	case *Mode:
+		Inspect(n.Name, fn)
+
+	case *Priority:
+		Inspect(n.Value, fn)
+
+	case *Sequence:
+		Inspect(n.Select, fn)
+
+	case *AnalyzeString:
+		Inspect(n.Select, fn)
+		Inspect(n.Regex, fn)
+		Inspect(n.Flags, fn)
+		Inspect(n.Matching, fn)
+		Inspect(n.NonMatching, fn)
+
+	case *Flags:
+		Inspect(n.Value, fn)
+
+	case *Substring:
+		Inspect(n.Body, fn)
+
+	case *ResultDocument:
+		Inspect(n.Href, fn)
+		Inspect(n.Output, fn)
+		Inspect(n.Body, fn)
+
+	case *Text:
+		Inspect(n.Value, fn)
+
+	case *CopyOf:
+		Inspect(n.Select, fn)
+
+	case *ForEach:
+		Inspect(n.Select, fn)
+		Inspect(n.SortBy, fn)
+		Inspect(n.Body, fn)
+
+	case *GroupBy:
+		Inspect(n.Select, fn)
+		Inspect(n.Key, fn)
+		Inspect(n.SortBy, fn)
+		Inspect(n.Body, fn)
+
+	case *SortBy:
+		for _, key := range n.Keys {
+			Inspect(key, fn)
+		}
+
+	case *SortKey:
+		Inspect(n.Select, fn)
+		for _, mod := range n.Modifiers {
+			Inspect(mod, fn)
+		}
+
+	case *SortModifier:
+		Inspect(n.Name, fn)
+		Inspect(n.Value, fn)
+
+	case *ApplyTemplates:
+		Inspect(n.Select, fn)
+		Inspect(n.Mode, fn)
+		Inspect(n.SortBy, fn)
+		Inspect(n.Args, fn)
+
+	case *Choose:
+		for _, when := range n.Whens {
+			Inspect(when, fn)
+		}
+		Inspect(n.Otherwise, fn)
+
+	case *When:
+		Inspect(n.Test, fn)
+		Inspect(n.Body, fn)
+
+	case *Otherwise:
+		Inspect(n.Body, fn)
+
+	case *If:
+		Inspect(n.Test, fn)
+		Inspect(n.Body, fn)
+
+	case *Call:
+		Inspect(n.Name, fn)
+		Inspect(n.Args, fn)
+
+	case *Tag:
+		Inspect(n.Name, fn)
+		Inspect(n.Namespace, fn)
+		Inspect(n.Body, fn)
+
+	case *Attribs:
+		for _, attr := range n.List {
+			Inspect(attr, fn)
+		}
+
+	case *Attrib:
+		Inspect(n.Name, fn)
+		Inspect(n.Namespace, fn)
+		Inspect(n.Value, fn)
+
+	case *InNamespace:
+		Inspect(n.URI, fn)
+
+	case *HTMLElement:
+		Inspect(n.Class, fn)
+		Inspect(n.Body, fn)
+	}
+}
+
+// InspectFile calls Inspect for each statement of the given file.
+func InspectFile(file *File, fn func(node Node) bool) {
+	for _, stmt := range file.Statements {
+		Inspect(stmt, fn)
+	}
+}
+
+// isNil reports whether the node is nil, including a nil pointer stored in the interface.
+func isNil(node Node) bool {
+	if node == nil {
+		return true
+	}
+
+	v := reflect.ValueOf(node)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
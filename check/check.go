@@ -0,0 +1,857 @@
+// Package check implements the semantic analysis of LXT syntax trees.
+//
+// It resolves every call to its sub, every call within an XPath to its func, and every variable reference to its declaration,
+// following the scoping rules of XSLT:
+// global variables and parameters are visible everywhere,
+// the parameters of a sub, func, or template are visible within it,
+// and a local variable is visible to the expressions following it, and their descendants.
+package check
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/puellanivis/lxt/ast"
+	"github.com/puellanivis/lxt/parser"
+	"github.com/puellanivis/lxt/tokenizer"
+	"github.com/puellanivis/lxt/xpath"
+	"github.com/puellanivis/lxt/xslt"
+)
+
+// binding is a declared variable or parameter.
+type binding struct {
+	name *ast.Ident
+	kind ast.VarKind
+	used bool
+
+	// renamed is set if the variable rebinds a name already in scope,
+	// and so its name has been rewritten.
+	renamed bool
+}
+
+// scope is a sequence of sibling expressions, and the bindings declared within it so far.
+type scope struct {
+	parent *scope
+
+	names    map[string]*binding
+	bindings []*binding
+}
+
+func (s *scope) lookup(name string) *binding {
+	for ; s != nil; s = s.parent {
+		if b := s.names[name]; b != nil {
+			return b
+		}
+	}
+
+	return nil
+}
+
+type checker struct {
+	subs    map[string]*ast.Sub
+	globals map[string]*binding
+
+	// funcs are the funcs declared with each name, which may be overloaded by the number of their parameters.
+	// Calls within XPaths are only checked for the namespace prefixes of these names.
+	funcs    map[string][]*ast.Func
+	prefixes map[string]bool
+
+	// namespaces are the namespace prefixes declared on the stylesheet.
+	namespaces map[string]bool
+
+	// keys are the names of the declared keys.
+	// Several keys may be declared with the same name, which index the nodes matched by any of them.
+	keys map[string]bool
+
+	// external is set if the stylesheet imports or includes any XSLT,
+	// which may define further subs and global variables.
+	external bool
+
+	// target is the version of XSLT being targeted.
+	target xslt.Version
+
+	// groups is the number of group bodies enclosing the statement being checked,
+	// within which current-group() and current-grouping-key() may be called.
+	groups int
+
+	// rebind is set if a local variable may redefine a name already in scope, by renaming it.
+	rebind bool
+
+	// taken is the set of local names declared anywhere within the statement being checked,
+	// which a renamed variable must not collide with.
+	taken map[string]bool
+
+	// order is the names of the global variables, in the order they are declared.
+	order []string
+
+	// global is the name of the global variable whose value is being checked, if any,
+	// and refs are the references from the value of each global variable to the global variables.
+	global string
+	refs   map[string][]globalRef
+
+	errs     parser.ErrorList
+	warnings parser.ErrorList
+}
+
+func errorf(node ast.Node, f string, args ...interface{}) *tokenizer.Error {
+	return &tokenizer.Error{
+		Pos: node.Pos(),
+		End: node.End(),
+		Msg: fmt.Sprintf(f, args...),
+	}
+}
+
+func (c *checker) errorf(node ast.Node, f string, args ...interface{}) {
+	c.errs = append(c.errs, errorf(node, f, args...))
+}
+
+func (c *checker) warnf(node ast.Node, f string, args ...interface{}) {
+	c.warnings = append(c.warnings, errorf(node, f, args...))
+}
+
+// undefined reports a reference to an undefined name.
+// If the stylesheet imports or includes any XSLT, then the name may be defined there,
+// so it is only reported as a warning.
+func (c *checker) undefined(node ast.Node, f string, args ...interface{}) {
+	if c.external {
+		c.warnf(node, f, args...)
+		return
+	}
+
+	c.errorf(node, f, args...)
+}
+
+// Files checks the given syntax trees, and the modules they use, as a single stylesheet.
+//
+// It returns as errors any references to undefined subs or variables, any unknown arguments to a sub,
+// any calls to undefined funcs, or with the wrong number of arguments, any lookups of undeclared keys,
+// any duplicate definitions, any local variable that redefines a local name still in scope, as XSLT 1.0 forbids,
+// and any global variable defined in terms of itself, either directly, or through other global variables.
+// It returns as warnings any local variables that are never used, and any local names that shadow a global.
+func Files(target xslt.Version, files ...*ast.File) (errs, warnings parser.ErrorList) {
+	return newChecker(target, false).files(files)
+}
+
+// Rebind checks the given syntax trees as Files does,
+// except that a local `var` may redefine a local name still in scope.
+//
+// Each such variable is renamed in place, along with every reference to it,
+// so that the lowered XSLT is valid.
+// The XPaths that are rewritten are parsed again,
+// but the positions of their values are left unchanged.
+func Rebind(target xslt.Version, files ...*ast.File) (errs, warnings parser.ErrorList) {
+	return newChecker(target, true).files(files)
+}
+
+func newChecker(target xslt.Version, rebind bool) *checker {
+	return &checker{
+		subs:     make(map[string]*ast.Sub),
+		globals:  make(map[string]*binding),
+		funcs:    make(map[string][]*ast.Func),
+		prefixes: make(map[string]bool),
+		keys:     make(map[string]bool),
+		refs:     make(map[string][]globalRef),
+		target:   target,
+		rebind:   rebind,
+
+		namespaces: make(map[string]bool),
+	}
+}
+
+func (c *checker) files(files []*ast.File) (errs, warnings parser.ErrorList) {
+	for _, file := range files {
+		c.declare(file.Statements)
+	}
+
+	for _, file := range files {
+		c.statements(file.Statements)
+	}
+
+	c.cycles()
+
+	return c.errs, c.warnings
+}
+
+// declare collects the subs, funcs, keys, and global variables of the statements, and of any modules they use.
+func (c *checker) declare(stmts []ast.Node) {
+	for _, stmt := range stmts {
+		switch n := stmt.(type) {
+		case *ast.Import, *ast.Include:
+			c.external = true
+
+		case *ast.Namespace:
+			if n.Prefix != nil {
+				c.namespaces[n.Prefix.Name] = true
+			}
+
+		case *ast.Use:
+			if n.File != nil {
+				c.declare(n.File.Statements)
+			}
+
+		case *ast.Sub:
+			if prev := c.subs[n.Name.Name]; prev != nil {
+				c.errorf(n.Name, "duplicate sub: %q, previously defined at %s", n.Name.Name, prev.Name.Pos())
+				continue
+			}
+
+			c.subs[n.Name.Name] = n
+
+		case *ast.Key:
+			c.keys[n.Name.Name] = true
+
+		case *ast.Func:
+			name := n.Name.Name
+
+			if prev := c.funcOf(name, arity(n)); prev != nil {
+				c.errorf(n.Name, "duplicate func: %q with %d parameters, previously defined at %s", name, arity(n), prev.Name.Pos())
+				continue
+			}
+
+			c.funcs[name] = append(c.funcs[name], n)
+
+			prefix, _, _ := strings.Cut(name, ":")
+			c.prefixes[prefix] = true
+
+		case *ast.Variable:
+			if prev := c.globals[n.Name.Name]; prev != nil {
+				c.errorf(n.Name, "duplicate global %s: %q, previously defined at %s", n.Kind, n.Name.Name, prev.name.Pos())
+				continue
+			}
+
+			c.globals[n.Name.Name] = &binding{
+				name: n.Name,
+				kind: n.Kind,
+			}
+			c.order = append(c.order, n.Name.Name)
+		}
+	}
+}
+
+// statements checks the bodies of the statements, and of any modules they use.
+func (c *checker) statements(stmts []ast.Node) {
+	for _, stmt := range stmts {
+		c.taken = declared(stmt)
+
+		switch n := stmt.(type) {
+		case *ast.Use:
+			if n.File != nil {
+				c.statements(n.File.Statements)
+			}
+
+		case *ast.Sub:
+			c.body(n.Body, c.params(n.Params))
+
+		case *ast.Key:
+			c.xpath(n.Match, nil)
+			c.xpath(n.Use, nil)
+
+		case *ast.Func:
+			// The namespace of the name may be declared anywhere, even after the func.
+			if prefix, _, _ := strings.Cut(n.Name.Name, ":"); !c.namespaces[prefix] {
+				c.errorf(n.Name, "undeclared namespace prefix %q of func %q", prefix, n.Name.Name)
+			}
+
+			c.body(n.Body, c.params(n.Params))
+
+		case *ast.Template:
+			c.xpath(n.Match, nil)
+
+			c.body(n.Body, c.params(n.Params))
+
+		case *ast.Variable:
+			// Global variables are visible everywhere, including within each other,
+			// so long as none are defined in terms of themselves.
+			c.global = n.Name.Name
+			c.body(n.Value, nil)
+			c.global = ""
+		}
+	}
+}
+
+// declared returns the set of local names declared anywhere within the statement.
+func declared(stmt ast.Node) map[string]bool {
+	names := make(map[string]bool)
+
+	ast.Inspect(stmt, func(node ast.Node) bool {
+		if v, ok := node.(*ast.Variable); ok && v.Kind != ast.VarKindArgument {
+			names[v.Name.Name] = true
+		}
+
+		return true
+	})
+
+	return names
+}
+
+// params returns a new scope holding the given parameters.
+// As with local variables, each parameter is visible to the parameters that follow it.
+func (c *checker) params(list *ast.VariableList) *scope {
+	s := &scope{
+		names: make(map[string]*binding),
+	}
+
+	if list == nil {
+		return s
+	}
+
+	for _, v := range list.List {
+		c.body(v.Value, s)
+		c.bind(s, v)
+	}
+
+	return s
+}
+
+// bind declares the variable or parameter in the given scope.
+//
+// As in XSLT 1.0, a local name may not be redefined while it is still in scope,
+// though it may shadow a global.
+// XSLT 2.0 allows a local name to shadow another, though not one defined alongside it.
+// If rebinding is allowed, then a `var` that redefines a local name is renamed instead.
+func (c *checker) bind(s *scope, v *ast.Variable) {
+	name := v.Name.Name
+
+	prev := s.lookup(name)
+	var renamed bool
+
+	switch {
+	case prev == nil:
+		if global := c.globals[name]; global != nil {
+			c.warnf(v.Name, "%s %q shadows the global %s defined at %s", v.Kind, name, global.kind, global.name.Pos())
+		}
+
+	case c.rebind && v.Kind == ast.VarKindVar:
+		// The binding is still recorded in the scope under its original name,
+		// so that the references that follow are resolved to it.
+		c.rename(v)
+		renamed = true
+
+	case s.names[name] == prev:
+		c.errorf(v.Name, "duplicate %s: %q, previously defined at %s", v.Kind, name, prev.name.Pos())
+		return
+
+	case c.target >= xslt.XSLT20:
+		// The binding shadows the previous one, which is still recorded in its own scope.
+
+	default:
+		c.errorf(v.Name, "%s %q redefines the %s defined at %s, which is still in scope", v.Kind, name, prev.kind, prev.name.Pos())
+		return
+	}
+
+	b := &binding{
+		name:    v.Name,
+		kind:    v.Kind,
+		renamed: renamed,
+	}
+
+	s.names[name] = b
+	s.bindings = append(s.bindings, b)
+}
+
+// rename gives the variable a new name, that is not declared anywhere else in the statement.
+func (c *checker) rename(v *ast.Variable) {
+	for i := 2; ; i++ {
+		name := fmt.Sprintf("%s.%d", v.Name.Name, i)
+
+		if !c.taken[name] && c.globals[name] == nil {
+			c.taken[name] = true
+			v.Name.Name = name
+			return
+		}
+	}
+}
+
+// unused reports the local variables of the scope that were never referenced.
+// Unused parameters are not reported, as a caller may still pass them.
+func (c *checker) unused(s *scope) {
+	for _, b := range s.bindings {
+		if b.kind == ast.VarKindVar && !b.used {
+			c.warnf(b.name, "unused variable: %q", b.name.Name)
+		}
+	}
+}
+
+// body checks an expression that lowers to a new sequence of XSLT instructions,
+// such as the body of a template, or the value of a variable.
+func (c *checker) body(n ast.Node, parent *scope) {
+	s := &scope{
+		parent: parent,
+		names:  make(map[string]*binding),
+	}
+
+	c.sequence(n, s)
+	c.unused(s)
+}
+
+// sequence checks each expression of a sequence in order, within the given scope.
+// Groups are lowered into the sequence containing them, so their contents are siblings within it.
+func (c *checker) sequence(n ast.Node, s *scope) {
+	switch n := n.(type) {
+	case *ast.Group:
+		for _, child := range n.List {
+			c.sequence(child, s)
+		}
+
+	case *ast.Variable:
+		// A variable is not in scope within its own value.
+		c.body(n.Value, s)
+		c.bind(s, n)
+
+	default:
+		c.expr(n, s)
+	}
+}
+
+func (c *checker) expr(n ast.Node, s *scope) {
+	switch n := n.(type) {
+	case *ast.XPath:
+		c.xpath(n, s)
+
+	case *ast.Interpolated:
+		for _, part := range n.Parts {
+			c.expr(part, s)
+		}
+
+	case *ast.CopyOf:
+		c.xpath(n.Select, s)
+
+	case *ast.ForEach:
+		c.xpath(n.Select, s)
+		c.sortBy(n.SortBy, s)
+		c.body(n.Body, s)
+
+	case *ast.GroupBy:
+		c.xpath(n.Select, s)
+		c.xpath(n.Key, s)
+
+		c.groups++
+		c.sortBy(n.SortBy, s)
+		c.body(n.Body, s)
+		c.groups--
+
+	case *ast.ApplyTemplates:
+		c.xpath(n.Select, s)
+		c.sortBy(n.SortBy, s)
+		c.args(n.Args, nil, s)
+
+	case *ast.Choose:
+		for _, when := range n.Whens {
+			c.xpath(when.Test, s)
+			c.body(when.Body, s)
+		}
+
+		if n.Otherwise != nil {
+			c.body(n.Otherwise.Body, s)
+		}
+
+	case *ast.If:
+		c.xpath(n.Test, s)
+		c.body(n.Body, s)
+
+	case *ast.Call:
+		sub := c.subs[n.Name.Name]
+		if sub == nil {
+			c.undefined(n.Name, "undefined sub: %q", n.Name.Name)
+		}
+
+		c.args(n.Args, sub, s)
+
+	case *ast.Tag:
+		c.name(n.Name, n.Namespace, s)
+		c.body(n.Body, s)
+
+	case *ast.Attribs:
+		for _, attr := range n.List {
+			c.name(attr.Name, attr.Namespace, s)
+			c.body(attr.Value, s)
+		}
+
+	case *ast.HTMLElement:
+		c.body(n.Body, s)
+
+	case *ast.Sequence:
+		c.xpath(n.Select, s)
+
+	case *ast.Return:
+		c.xpath(n.Select, s)
+
+	case *ast.AnalyzeString:
+		c.xpath(n.Select, s)
+
+		if n.Matching != nil {
+			c.body(n.Matching.Body, s)
+		}
+
+		if n.NonMatching != nil {
+			c.body(n.NonMatching.Body, s)
+		}
+
+	case *ast.ResultDocument:
+		if href, ok := n.Href.(*ast.XPath); ok {
+			c.xpath(href, s)
+		}
+
+		c.body(n.Body, s)
+	}
+}
+
+// name checks the computed name and namespace of a tag or attribute.
+func (c *checker) name(name ast.Node, ns *ast.InNamespace, s *scope) {
+	if x, ok := name.(*ast.XPath); ok {
+		c.xpath(x, s)
+	}
+
+	if ns == nil {
+		return
+	}
+
+	if x, ok := ns.URI.(*ast.XPath); ok {
+		c.xpath(x, s)
+	}
+}
+
+func (c *checker) sortBy(n *ast.SortBy, s *scope) {
+	if n == nil {
+		return
+	}
+
+	for _, key := range n.Keys {
+		c.xpath(key.Select, s)
+	}
+}
+
+// args checks the arguments of a call to the given sub, or of an apply-templates if sub is nil.
+func (c *checker) args(list *ast.VariableList, sub *ast.Sub, s *scope) {
+	if list == nil {
+		return
+	}
+
+	seen := make(map[string]*ast.Ident)
+
+	for _, v := range list.List {
+		name := v.Name.Name
+
+		c.body(v.Value, s)
+
+		if prev := seen[name]; prev != nil {
+			c.errorf(v.Name, "duplicate argument: %q, previously given at %s", name, prev.Pos())
+			continue
+		}
+		seen[name] = v.Name
+
+		// A tunnelled argument is passed on through any templates that do not declare it.
+		if sub != nil && !v.Tunnel.IsValid() && !hasParam(sub.Params, name) {
+			c.errorf(v.Name, "unknown argument: sub %q has no parameter %q", sub.Name.Name, name)
+		}
+	}
+}
+
+func hasParam(params *ast.VariableList, name string) bool {
+	if params == nil {
+		return false
+	}
+
+	for _, v := range params.List {
+		if v.Name.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// arity returns the number of parameters of the func.
+func arity(fn *ast.Func) int {
+	if fn.Params == nil {
+		return 0
+	}
+
+	return len(fn.Params.List)
+}
+
+// funcOf returns the func with the given name and number of parameters, or nil if there is none.
+func (c *checker) funcOf(name string, n int) *ast.Func {
+	for _, fn := range c.funcs[name] {
+		if arity(fn) == n {
+			return fn
+		}
+	}
+
+	return nil
+}
+
+// call checks a function call within an XPath against the declared funcs.
+// Only calls with the namespace prefix of a declared func are checked,
+// as any others may be to the functions of XPath, or of an extension.
+// Of the unprefixed calls, only key(), current-group() and current-grouping-key() are checked.
+func (c *checker) call(x *ast.XPath, call *xpath.FunctionCall) {
+	if call.Name.Prefix == "" {
+		switch call.Name.Local {
+		case "key":
+			c.key(x, call)
+
+		case "current-group", "current-grouping-key":
+			// When targeting XSLT 1.0, these calls are only replaced within the body of a group.
+			if c.target < xslt.XSLT20 && c.groups == 0 {
+				c.errorf(&xpathRef{x, call}, "%s() may only be called within a group when targeting XSLT 1.0", call.Name.Local)
+			}
+		}
+
+		return
+	}
+
+	if !c.prefixes[call.Name.Prefix] {
+		return
+	}
+
+	name := call.Name.String()
+
+	funcs := c.funcs[name]
+	if len(funcs) == 0 {
+		c.undefined(&xpathRef{x, call}, "undefined func: %s()", name)
+		return
+	}
+
+	if c.funcOf(name, len(call.Args)) != nil {
+		return
+	}
+
+	var arities []string
+	for _, fn := range funcs {
+		arities = append(arities, fmt.Sprint(arity(fn)))
+	}
+
+	c.errorf(&xpathRef{x, call}, "func %s() takes %s arguments, but was given %d", name, strings.Join(arities, " or "), len(call.Args))
+}
+
+// key checks that a call to key() with a literal name refers to a declared key.
+func (c *checker) key(x *ast.XPath, call *xpath.FunctionCall) {
+	if len(call.Args) == 0 {
+		return
+	}
+
+	name, ok := call.Args[0].(*xpath.Literal)
+	if !ok || c.keys[name.Value] {
+		return
+	}
+
+	c.undefined(&xpathRef{x, name}, "undefined key: %q", name.Value)
+}
+
+// xpath resolves the variable references and func calls of the XPath within the given scope.
+// An XPath that could not be parsed, such as one using XPath 2.0 syntax,
+// has its variable references found lexically instead, and its func calls are not checked.
+func (c *checker) xpath(x *ast.XPath, s *scope) {
+	if x == nil {
+		return
+	}
+
+	var renames []*xpathRename
+
+	resolve := func(ref *xpath.VariableRef) {
+		if rename := c.variable(x, ref, s); rename != nil {
+			renames = append(renames, rename)
+		}
+	}
+
+	if x.Expr == nil {
+		for _, ref := range lexicalVariables(x.Value) {
+			resolve(ref)
+		}
+	} else {
+		xpath.Inspect(x.Expr, func(expr xpath.Expr) bool {
+			switch expr := expr.(type) {
+			case *xpath.FunctionCall:
+				c.call(x, expr)
+			case *xpath.VariableRef:
+				resolve(expr)
+			}
+
+			return true
+		})
+	}
+
+	if len(renames) > 0 {
+		c.rewrite(x, renames)
+	}
+}
+
+// variable resolves a variable reference within the XPath to its binding, and marks it as used.
+// If the variable has been renamed, it returns the rename of the reference.
+func (c *checker) variable(x *ast.XPath, ref *xpath.VariableRef, s *scope) *xpathRename {
+	name := ref.Name.String()
+
+	b := s.lookup(name)
+	if b == nil {
+		b = c.globals[name]
+
+		if b != nil && c.global != "" {
+			c.refs[c.global] = append(c.refs[c.global], globalRef{name, &xpathRef{x, ref}})
+		}
+	}
+
+	if b == nil {
+		c.undefined(&xpathRef{x, ref}, "undefined variable: $%s", name)
+		return nil
+	}
+
+	b.used = true
+
+	if b.renamed {
+		return &xpathRename{ref, b.name.Name}
+	}
+
+	return nil
+}
+
+var (
+	stringLiteral = regexp.MustCompile(`"[^"]*"|'[^']*'`)
+	variableRef   = regexp.MustCompile(`\$((?:[A-Za-z_][-.\w]*:)?[A-Za-z_][-.\w]*)(\s*(?:\bin\b|:=))?`)
+)
+
+// lexicalVariables returns the variable references outside of string literals within an XPath that could not be parsed.
+// The variables bound by the XPath itself, as with `for $x in`, `some $x in`, or `let $x :=`, are not included,
+// nor are any references to them.
+func lexicalVariables(s string) []*xpath.VariableRef {
+	// The string literals are blanked out, so that the offsets of the references are unchanged.
+	s = stringLiteral.ReplaceAllStringFunc(s, func(lit string) string {
+		return strings.Repeat(" ", len(lit))
+	})
+
+	matches := variableRef.FindAllStringSubmatchIndex(s, -1)
+
+	bound := make(map[string]bool)
+	for _, m := range matches {
+		if m[4] >= 0 {
+			bound[s[m[2]:m[3]]] = true
+		}
+	}
+
+	var refs []*xpath.VariableRef
+
+	for _, m := range matches {
+		name := s[m[2]:m[3]]
+		if bound[name] {
+			continue
+		}
+
+		var qname xpath.QName
+		if prefix, local, ok := strings.Cut(name, ":"); ok {
+			qname = xpath.QName{Prefix: prefix, Local: local}
+		} else {
+			qname = xpath.QName{Local: name}
+		}
+
+		refs = append(refs, &xpath.VariableRef{
+			Dollar: m[0],
+			Name:   qname,
+			EndPos: m[3],
+		})
+	}
+
+	return refs
+}
+
+// globalRef is a reference from the value of a global variable to a global variable.
+type globalRef struct {
+	name string
+	ref  ast.Node
+}
+
+// cycles reports the global variables that are defined in terms of themselves,
+// either directly, or through the values of other global variables.
+// Each cycle is reported once, at the reference that completes it.
+func (c *checker) cycles() {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+
+	state := make(map[string]int)
+	var stack []string
+
+	var visit func(name string)
+	visit = func(name string) {
+		state[name] = visiting
+		stack = append(stack, name)
+
+		for _, r := range c.refs[name] {
+			switch state[r.name] {
+			case visiting:
+				var path []string
+				for i := len(stack) - 1; i >= 0; i-- {
+					if stack[i] == r.name {
+						for _, name := range append(stack[i:len(stack):len(stack)], r.name) {
+							path = append(path, "$"+name)
+						}
+						break
+					}
+				}
+
+				c.errorf(r.ref, "global %s %q is defined in terms of itself: %s", c.globals[r.name].kind, r.name, strings.Join(path, " -> "))
+
+			case 0:
+				visit(r.name)
+			}
+		}
+
+		stack = stack[:len(stack)-1]
+		state[name] = visited
+	}
+
+	for _, name := range c.order {
+		if state[name] == 0 {
+			visit(name)
+		}
+	}
+}
+
+// xpathRename is a variable reference within an XPath to a variable that has been renamed.
+type xpathRename struct {
+	ref  *xpath.VariableRef
+	name string
+}
+
+// rewrite replaces the names of the given variable references within the XPath, and parses it again.
+func (c *checker) rewrite(x *ast.XPath, renames []*xpathRename) {
+	sort.Slice(renames, func(i, j int) bool {
+		return renames[i].ref.Pos() < renames[j].ref.Pos()
+	})
+
+	var b strings.Builder
+	var last int
+
+	for _, r := range renames {
+		b.WriteString(x.Value[last:r.ref.Pos()])
+		b.WriteString("$" + r.name)
+		last = r.ref.End()
+	}
+	b.WriteString(x.Value[last:])
+
+	if x.Expr == nil {
+		// The XPath could not be parsed before, so it cannot be parsed now either.
+		x.Value = b.String()
+		return
+	}
+
+	expr, err := xpath.Parse(b.String())
+	if err != nil {
+		c.errorf(x, "rebinding variables gave an invalid xpath: %v", err)
+		return
+	}
+
+	x.Value = b.String()
+	x.Expr = expr
+}
+
+// xpathRef is the node of a variable reference or function call within an XPath, used to position errors.
+type xpathRef struct {
+	x   *ast.XPath
+	ref xpath.Expr
+}
+
+func (n *xpathRef) Pos() ast.Pos { return n.x.Offset(n.ref.Pos()) }
+func (n *xpathRef) End() ast.Pos { return n.x.Offset(n.ref.End()) }
@@ -0,0 +1,457 @@
+package check
+
+import (
+	"context"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/puellanivis/lxt/lower"
+	"github.com/puellanivis/lxt/parser"
+	"github.com/puellanivis/lxt/xslt"
+)
+
+func messages(errs parser.ErrorList) []string {
+	var msgs []string
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	return msgs
+}
+
+func TestFiles(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		errs     []string
+		warnings []string
+	}{
+		{
+			name: "valid",
+			input: `param title = "Hi"
+
+sub header ( level => <1>, text => $title ) {
+	tag h1 { $text $level }
+}
+
+template </> {
+	var count = <{ count(item) }>
+	call header ( level => $count )
+	foreach <item> sort-by ( <$count> ) { var x = <.> if <{ $x > $count }> "many" }
+}
+`,
+		},
+		{
+			name: "undefined",
+			input: `sub a ( p => $q ) {
+	call b
+	copy-of <$x>
+	if <{ $p and $r }> ;
+}
+`,
+			errs: []string{
+				`1:14: undefined variable: $q`,
+				`2:7: undefined sub: "b"`,
+				`3:11: undefined variable: $x`,
+				`4:15: undefined variable: $r`,
+			},
+		},
+		{
+			name: "sibling scope",
+			input: `template </> {
+	$x
+	var x = <1>
+	tag p { var y = $x }
+	$y
+	{ var z = <1> }
+	$z
+	var self = <{ $self + 1 }>
+	$self
+}
+`,
+			errs: []string{
+				`2:2: undefined variable: $x`,
+				`5:2: undefined variable: $y`,
+				`8:16: undefined variable: $self`,
+			},
+			warnings: []string{
+				`4:14: unused variable: "y"`,
+			},
+		},
+		{
+			name: "duplicates",
+			input: `param a = <1>
+var a = <2>
+
+sub s ( p => <1>, p => <2> ) {
+	var v = <1>
+	var v = <2>
+	$v
+}
+
+sub s { "again" }
+
+template </> {
+	call s ( p => <1>, p => <2> )
+}
+`,
+			errs: []string{
+				`2:5: duplicate global var: "a", previously defined at 1:7`,
+				`10:5: duplicate sub: "s", previously defined at 4:5`,
+				`4:19: duplicate param: "p", previously defined at 4:9`,
+				`6:6: duplicate var: "v", previously defined at 5:6`,
+				`13:21: duplicate argument: "p", previously given at 13:11`,
+			},
+		},
+		{
+			name: "redefinitions",
+			input: `sub s ( p => <1> ) {
+	var x = <1>
+	foreach <item> {
+		var x = <{ $x + 1 }>
+		var p = $x
+		$p
+	}
+	var x = <3>
+	$x
+}
+`,
+			errs: []string{
+				`4:7: var "x" redefines the var defined at 2:6, which is still in scope`,
+				`5:7: var "p" redefines the param defined at 1:9, which is still in scope`,
+				`8:6: duplicate var: "x", previously defined at 2:6`,
+			},
+		},
+		{
+			name: "arguments",
+			input: `sub s ( p => <1> ) { $p }
+sub t { "t" }
+
+template </> {
+	call s ( p => <1>, q => <2> )
+	call t ( p => <1> )
+	apply-templates ( anything => <1> )
+}
+`,
+			errs: []string{
+				`5:21: unknown argument: sub "s" has no parameter "q"`,
+				`6:11: unknown argument: sub "t" has no parameter "p"`,
+			},
+		},
+		{
+			name: "warnings",
+			input: `param title = "Hi"
+
+template </> ( title => <1> ) {
+	var unused = <1>
+	$title
+}
+
+sub s {
+	foreach <item> { var title = <.> $title }
+}
+`,
+			warnings: []string{
+				`3:16: param "title" shadows the global param defined at 1:7`,
+				`4:6: unused variable: "unused"`,
+				`9:23: var "title" shadows the global param defined at 1:7`,
+			},
+		},
+		{
+			name: "funcs",
+			input: `func my:add ( $a, $b ) { return <{ $a + $b + $c }> }
+func my:add ( $x, $y ) { return <{ $x }> }
+func my:add ( $a ) { return <$a> }
+
+template </> {
+	<{ my:add(1, 2) + my:add(1) + my:add() + my:sub(1) + other:f() + count(.) }>
+}
+
+namespace my => "urn:my"
+`,
+			errs: []string{
+				`2:6: duplicate func: "my:add" with 2 parameters, previously defined at 1:6`,
+				`1:46: undefined variable: $c`,
+				`6:32: func my:add() takes 2 or 1 arguments, but was given 0`,
+				`6:43: undefined func: my:sub()`,
+			},
+		},
+		{
+			name: "func namespaces",
+			input: `namespace my => "urn:my"
+func my:f { return <1> }
+func other:g { return <2> }
+func xs:h { return <3> }
+`,
+			errs: []string{
+				`3:6: undeclared namespace prefix "other" of func "other:g"`,
+				`4:6: undeclared namespace prefix "xs" of func "xs:h"`,
+			},
+		},
+		{
+			name: "keys",
+			input: `key by-id <item> <@id>
+
+template </> {
+	<{ key('by-id', 'a') | key('by-name', 'b') | key(concat('by-', 'id'), 'c') }>
+}
+`,
+			errs: []string{
+				`4:29: undefined key: "by-name"`,
+			},
+		},
+		{
+			name: "computed names",
+			input: `template </> {
+	tag $n namespace <$ns> { attribs ( <{ $a }> => "x" ) }
+}
+`,
+			errs: []string{
+				`2:6: undefined variable: $n`,
+				`2:20: undefined variable: $ns`,
+				`2:40: undefined variable: $a`,
+			},
+		},
+		{
+			name:  "interpolated",
+			input: "template </> {\n\tvar name = <1>\n\t`{$name} and {$other}`\n}\n",
+			errs: []string{
+				`3:16: undefined variable: $other`,
+			},
+		},
+		{
+			name: "circular globals",
+			input: `var g = <{ $g + 1 }>
+var a = <{ $b * 2 }>
+param b = { var x = <1> <{ $x + $c }> }
+var c = <$a>
+var d = <{ $a + $e }>
+var e = <1>
+`,
+			errs: []string{
+				`1:12: global var "g" is defined in terms of itself: $g -> $g`,
+				`4:10: global var "a" is defined in terms of itself: $a -> $b -> $c -> $a`,
+			},
+		},
+		{
+			name: "external",
+			input: `import "base.xsl"
+
+template </> {
+	call base-header
+	$base-title
+}
+`,
+			warnings: []string{
+				`4:7: undefined sub: "base-header"`,
+				`5:2: undefined variable: $base-title`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		file, err := parser.Parse(context.Background(), strings.NewReader(tt.input), "")
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+
+		errs, warnings := Files(xslt.XSLT10, file)
+
+		if got, expect := strings.Join(messages(errs), "\n"), strings.Join(tt.errs, "\n"); got != expect {
+			t.Errorf("%s: errors were:\n%s\nexpected:\n%s", tt.name, got, expect)
+		}
+
+		if got, expect := strings.Join(messages(warnings), "\n"), strings.Join(tt.warnings, "\n"); got != expect {
+			t.Errorf("%s: warnings were:\n%s\nexpected:\n%s", tt.name, got, expect)
+		}
+	}
+}
+
+func TestTunnelArguments(t *testing.T) {
+	input := `sub inner ( tunnel depth => <0> ) { $depth }
+sub outer { call inner }
+
+template </> {
+	call outer ( tunnel depth => <1>, other => <2> )
+}
+`
+
+	file, err := parser.ParseTarget(context.Background(), strings.NewReader(input), "", xslt.XSLT20)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	errs, _ := Files(xslt.XSLT20, file)
+
+	expect := `5:36: unknown argument: sub "outer" has no parameter "other"`
+	if got := strings.Join(messages(errs), "\n"); got != expect {
+		t.Errorf("errors were:\n%s\nexpected:\n%s", got, expect)
+	}
+}
+
+func TestRebind(t *testing.T) {
+	input := `param x = <0>
+
+sub s ( p => <1> ) {
+	var x = $p
+	var x.2 = <2>
+	foreach <item> {
+		var x = <{ $x + $x.2 }>
+		var p = <{ $x * 2 }>
+		$p
+	}
+	var x = <{ $x + 1 }>
+	$x
+}
+`
+
+	expect := `<xsl:template name="s">
+  <xsl:param name="p" select="1"></xsl:param>
+  <xsl:variable name="x" select="$p"></xsl:variable>
+  <xsl:variable name="x.2" select="2"></xsl:variable>
+  <xsl:for-each select="item">
+    <xsl:variable name="x.3" select="$x + $x.2"></xsl:variable>
+    <xsl:variable name="p.2" select="$x.3 * 2"></xsl:variable>
+    <xsl:value-of select="$p.2"></xsl:value-of>
+  </xsl:for-each>
+  <xsl:variable name="x.4" select="$x + 1"></xsl:variable>
+  <xsl:value-of select="$x.4"></xsl:value-of>
+</xsl:template>`
+
+	file, err := parser.Parse(context.Background(), strings.NewReader(input), "")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	errs, _ := Rebind(xslt.XSLT10, file)
+	if len(errs) > 0 {
+		t.Fatal("unexpected error:", errs)
+	}
+
+	xsl := xslt.NewStylesheet()
+	if err := lower.File(file, xsl); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	data, err := xml.MarshalIndent(xsl.Body[1], "", "  ")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if got := string(data); got != expect {
+		t.Errorf("Rebind gave:\n%s\nexpected:\n%s", got, expect)
+	}
+}
+
+func TestRebindXPath20(t *testing.T) {
+	input := `template </> {
+	var n = <1>
+	var n = <{ $n + 1 }>
+	sequence <{ $n, 1 }>
+	sequence <{ for $i in 1 to $n return $i * $x, '$y' }>
+}
+`
+
+	expect := `<xsl:template match="/">
+  <xsl:variable name="n" select="1"></xsl:variable>
+  <xsl:variable name="n.2" select="$n + 1"></xsl:variable>
+  <xsl:sequence select="$n.2, 1"></xsl:sequence>
+  <xsl:sequence select="for $i in 1 to $n.2 return $i * $x, &#39;$y&#39;"></xsl:sequence>
+</xsl:template>`
+
+	file, err := parser.ParseTarget(context.Background(), strings.NewReader(input), "", xslt.XSLT20)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	errs, warnings := Rebind(xslt.XSLT20, file)
+
+	if got, expect := strings.Join(messages(errs), "\n"), "5:44: undefined variable: $x"; got != expect {
+		t.Errorf("errors were:\n%s\nexpected:\n%s", got, expect)
+	}
+
+	if len(warnings) > 0 {
+		t.Error("unexpected warnings:", warnings)
+	}
+
+	xsl := xslt.NewStylesheet()
+	xsl.SetAttr("version", xslt.XSLT20.String())
+	if err := lower.File(file, xsl); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	data, err := xml.MarshalIndent(xsl.Body[0], "", "  ")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if got := string(data); got != expect {
+		t.Errorf("Rebind gave:\n%s\nexpected:\n%s", got, expect)
+	}
+}
+
+func TestShadowing(t *testing.T) {
+	input := `template </> {
+	var a = "1"
+	tag p { var a = "2" $a }
+	$a
+}
+`
+
+	tests := []struct {
+		target xslt.Version
+		expect string
+	}{
+		{xslt.XSLT10, `3:14: var "a" redefines the var defined at 2:6, which is still in scope`},
+		{xslt.XSLT20, ""},
+	}
+
+	for _, tt := range tests {
+		file, err := parser.ParseTarget(context.Background(), strings.NewReader(input), "", tt.target)
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		errs, _ := Files(tt.target, file)
+
+		if got := strings.Join(messages(errs), "\n"); got != tt.expect {
+			t.Errorf("XSLT %s: errors were:\n%s\nexpected:\n%s", tt.target, got, tt.expect)
+		}
+	}
+}
+
+func TestCurrentGroup(t *testing.T) {
+	input := `template </> {
+	group <item> by <@type> sort-by ( <{ count(current-group()) }> ) {
+		foreach <{ current-group() }> { <{ current-grouping-key() }> }
+	}
+	<{ count(current-group()) }>
+	foreach <item> { <{ current-grouping-key() }> }
+}
+`
+
+	tests := []struct {
+		target xslt.Version
+		expect []string
+	}{
+		{xslt.XSLT10, []string{
+			`5:11: current-group() may only be called within a group when targeting XSLT 1.0`,
+			`6:22: current-grouping-key() may only be called within a group when targeting XSLT 1.0`,
+		}},
+		{xslt.XSLT20, nil},
+	}
+
+	for _, tt := range tests {
+		file, err := parser.ParseTarget(context.Background(), strings.NewReader(input), "", tt.target)
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		errs, _ := Files(tt.target, file)
+
+		if got, expect := strings.Join(messages(errs), "\n"), strings.Join(tt.expect, "\n"); got != expect {
+			t.Errorf("XSLT %s: errors were:\n%s\nexpected:\n%s", tt.target, got, expect)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/puellanivis/breton/lib/files"
+	flag "github.com/puellanivis/breton/lib/gnuflag"
+	"github.com/puellanivis/breton/lib/os/process"
+
+	"github.com/puellanivis/lxt/decompile"
+	"github.com/puellanivis/lxt/parser"
+	"github.com/puellanivis/lxt/printer"
+	"github.com/puellanivis/lxt/xslt"
+)
+
+// DecompileFlags are the flags of the `decompile` subcommand.
+var DecompileFlags struct {
+	Write bool `flag:",short=w" desc:"Write the LXT of each stylesheet to a file beside it, with a .lxt extension."`
+}
+
+// decompileXSLT translates the XSLT stylesheets given in args into LXT.
+// Constructs with no LXT equivalent are reported, and kept in the output as doc comments.
+//
+//	lxt decompile -o style.lxt style.xsl
+//	lxt decompile -w legacy/*.xsl
+func decompileXSLT(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("decompile", flag.ExitOnError)
+	fs.CopyFrom(flag.CommandLine, "output")
+	fs.CopyFrom(flag.CommandLine, "max-errors")
+
+	if err := fs.Struct("", &DecompileFlags); err != nil {
+		panic(err)
+	}
+
+	if err := fs.Parse(args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		process.Exit(2)
+	}
+
+	filenames := fs.Args()
+	if len(filenames) < 1 {
+		filenames = append(filenames, "-")
+	}
+
+	if len(filenames) > 1 && !DecompileFlags.Write {
+		fmt.Fprintln(os.Stderr, "decompile: more than one stylesheet requires -w")
+		process.Exit(2)
+	}
+
+	var errs parser.ErrorList
+
+	for _, filename := range filenames {
+		output := Flags.Output
+		if DecompileFlags.Write {
+			output = strings.TrimSuffix(filename, filepath.Ext(filename)) + ".lxt"
+		}
+
+		if err := decompileFile(ctx, filename, output, &errs); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", filename, err)
+			process.Exit(1)
+		}
+	}
+
+	if len(errs) > 0 {
+		printErrors(errs)
+		process.Exit(1)
+	}
+}
+
+// decompileFile translates a single XSLT stylesheet into LXT, written to the given output.
+// Any constructs with no LXT equivalent are added to the error list.
+func decompileFile(ctx context.Context, filename, output string, errs *parser.ErrorList) error {
+	in, err := files.Open(ctx, filename)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	dec := xslt.NewDecoder(in)
+
+	xsl, err := dec.Decode()
+	if err != nil {
+		return err
+	}
+
+	file, reports := decompile.Stylesheet(xsl, in.Name(), dec.Locations)
+	for _, report := range reports {
+		errs.Add(report)
+	}
+
+	out, err := getOutput(ctx, output)
+	if err != nil {
+		return err
+	}
+
+	if err := printer.Fprint(out, file); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.(io.Closer).Close()
+}
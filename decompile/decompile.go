@@ -0,0 +1,977 @@
+// Package decompile implements the translation of XSLT stylesheets into LXT syntax trees.
+package decompile
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/puellanivis/lxt/ast"
+	"github.com/puellanivis/lxt/parser"
+	"github.com/puellanivis/lxt/printer"
+	"github.com/puellanivis/lxt/tokenizer"
+	"github.com/puellanivis/lxt/xslt"
+)
+
+type decompiler struct {
+	filename string
+	locs     map[interface{}]xslt.Location
+
+	// loc is the location of the innermost element being translated that has a known location.
+	loc xslt.Location
+
+	errs []error
+}
+
+// Stylesheet translates the stylesheet into an LXT syntax tree.
+//
+// Any construct that has no equivalent in LXT is reported as an error,
+// positioned by the locations recorded by the xslt.Decoder, if any.
+// Such constructs are kept in the syntax tree as doc comments holding their XSLT source,
+// so that nothing is silently dropped.
+func Stylesheet(xsl *xslt.Stylesheet, filename string, locs map[interface{}]xslt.Location) (*ast.File, []error) {
+	d := &decompiler{
+		filename: filename,
+		locs:     locs,
+	}
+
+	file := &ast.File{
+		Filename: filename,
+	}
+
+	file.Statements = append(file.Statements, d.attrs(xsl.Attr)...)
+
+	for _, node := range xsl.Start {
+		file.Statements = append(file.Statements, d.exprs(node)...)
+	}
+
+	for _, node := range xsl.Imports {
+		switch n := node.(type) {
+		case *xslt.Import:
+			file.Statements = append(file.Statements, &ast.Import{
+				Href: str(n.Href),
+			})
+
+		default:
+			file.Statements = append(file.Statements, d.exprs(node)...)
+		}
+	}
+
+	file.Statements = append(file.Statements, d.output(xsl.Output))
+
+	for _, node := range xsl.Includes {
+		switch n := node.(type) {
+		case *xslt.Include:
+			file.Statements = append(file.Statements, &ast.Include{
+				Href: str(n.Href),
+			})
+
+		default:
+			file.Statements = append(file.Statements, d.exprs(node)...)
+		}
+	}
+
+	for _, node := range xsl.Keys {
+		file.Statements = append(file.Statements, d.statement(node)...)
+	}
+
+	for _, node := range xsl.Body {
+		file.Statements = append(file.Statements, d.statement(node)...)
+	}
+
+	return file, d.errs
+}
+
+// enter sets the current location to that of the given node, if it is known.
+// It returns a function that restores the previous location.
+func (d *decompiler) enter(node interface{}) func() {
+	prev := d.loc
+
+	if loc, ok := d.locs[node]; ok {
+		d.loc = loc
+	}
+
+	return func() { d.loc = prev }
+}
+
+func (d *decompiler) errorf(f string, args ...interface{}) {
+	d.errs = append(d.errs, &tokenizer.Error{
+		Pos: tokenizer.Position{
+			Filename: d.filename,
+			Line:     d.loc.Line,
+			Column:   d.loc.Column,
+		},
+		Msg: fmt.Sprintf(f, args...),
+	})
+}
+
+// unsupported reports that the node has no equivalent in LXT,
+// and returns a doc comment holding its XSLT source in its place.
+func (d *decompiler) unsupported(node interface{}, f string, args ...interface{}) ast.Node {
+	defer d.enter(node)()
+
+	d.errorf(f, args...)
+
+	src, err := xml.Marshal(node)
+	if err != nil {
+		src = []byte(fmt.Sprintf("%T", node))
+	}
+
+	return &ast.Comment{
+		Text: commentText("unsupported: " + string(src)),
+	}
+}
+
+// commentText cleans the text of an XML comment so that it can be a doc comment.
+func commentText(text string) string {
+	text = strings.ReplaceAll(text, "*/", "* /")
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRightFunc(line, unicode.IsSpace)
+	}
+
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// attrs translates the attributes of the stylesheet element into namespace and stylesheet directives.
+// Namespaces that LXT declares implicitly are left out.
+func (d *decompiler) attrs(attrs []xml.Attr) []ast.Node {
+	var stmts []ast.Node
+
+	m := &ast.Map{
+		Delim: "(",
+	}
+
+	for _, attr := range attrs {
+		name := attr.Name.Local
+
+		switch {
+		case name == "version":
+			if attr.Value != "1.0" {
+				m.Entries = append(m.Entries, &ast.MapEntry{
+					Key:   ident(name),
+					Value: str(attr.Value),
+				})
+			}
+
+		case name == "exclude-result-prefixes", name == "extension-element-prefixes":
+			m.Entries = append(m.Entries, &ast.MapEntry{
+				Key:   ident(name),
+				Value: str(attr.Value),
+			})
+
+		case name == "xmlns", strings.HasPrefix(name, "xmlns:"):
+			prefix := strings.TrimPrefix(strings.TrimPrefix(name, "xmlns"), ":")
+
+			if prefix == "xsl" && attr.Value == xslt.NamespaceXSL {
+				continue
+			}
+			if uri, ok := xslt.KnownNamespaces[prefix]; ok && uri == attr.Value {
+				continue
+			}
+
+			if prefix == "" && attr.Value == "" {
+				// Undeclaring the default namespace is already the default.
+				continue
+			}
+
+			ns := &ast.Namespace{
+				URI: str(attr.Value),
+			}
+			if prefix != "" {
+				ns.Prefix = ident(prefix)
+			}
+
+			stmts = append(stmts, ns)
+
+		default:
+			d.errorf("stylesheet attribute %s=%q has no LXT equivalent", name, attr.Value)
+		}
+	}
+
+	if len(m.Entries) > 0 {
+		stmts = append(stmts, &ast.Stylesheet{
+			Attributes: m,
+		})
+	}
+
+	return stmts
+}
+
+// literal returns the value as an identifier if it can be written as one, and otherwise as a string.
+func literal(s string) ast.Node {
+	if printer.IsIdent(s) {
+		return ident(s)
+	}
+
+	return str(s)
+}
+
+func ident(name string) *ast.Ident {
+	return &ast.Ident{
+		Name: name,
+	}
+}
+
+func str(s string) *ast.String {
+	return &ast.String{
+		Quote: '"',
+		Value: s,
+	}
+}
+
+// name returns the given name as an identifier, or reports an error if it cannot be written as one.
+func (d *decompiler) name(kind, name string) (*ast.Ident, bool) {
+	if !printer.IsIdent(name) {
+		d.errorf("%s name %q has no LXT equivalent", kind, name)
+		return nil, false
+	}
+
+	return ident(name), true
+}
+
+func (d *decompiler) xpath(s string) *ast.XPath {
+	if !printer.CanQuoteXPath(s) {
+		d.errorf("xpath %q cannot be written in LXT, as it contains \"}>\"", s)
+	}
+
+	return &ast.XPath{
+		Value: s,
+	}
+}
+
+func (d *decompiler) output(out *xslt.Output) *ast.Output {
+	m := &ast.Map{
+		Delim: "(",
+	}
+
+	add := func(key, value string) {
+		m.Entries = append(m.Entries, &ast.MapEntry{
+			Key:   ident(key),
+			Value: literal(value),
+		})
+	}
+
+	if out == nil {
+		// XSLT does not indent by default, but LXT does.
+		add("indent", "false")
+
+		return &ast.Output{
+			Attributes: m,
+		}
+	}
+
+	defer d.enter(out)()
+
+	if out.Method != "" && out.Method != "xml" {
+		add("method", out.Method)
+	}
+	if out.Version != "" && out.Version != "1.0" {
+		add("version", out.Version)
+	}
+	if out.Encoding != "" && !strings.EqualFold(out.Encoding, "UTF-8") {
+		add("encoding", out.Encoding)
+	}
+	if out.MediaType != "" {
+		add("media-type", out.MediaType)
+	}
+
+	if out.OmitXMLDeclaration != nil {
+		add("omit-xml-declaration", strconv.FormatBool(bool(*out.OmitXMLDeclaration)))
+	}
+	if out.Standalone != nil {
+		add("standalone", strconv.FormatBool(bool(*out.Standalone)))
+	}
+	if !out.Indent {
+		add("indent", "false")
+	}
+
+	if out.DoctypePublic != "" {
+		add("doctype-public", out.DoctypePublic)
+	}
+	if out.DoctypeSystem != "" {
+		add("doctype-system", out.DoctypeSystem)
+	}
+	if len(out.CDATASectionElements) > 0 {
+		add("cdata-section-elements", strings.Join(out.CDATASectionElements, " "))
+	}
+
+	return &ast.Output{
+		Attributes: m,
+	}
+}
+
+func (d *decompiler) statement(node interface{}) []ast.Node {
+	defer d.enter(node)()
+
+	switch n := node.(type) {
+	case *xslt.Template:
+		return d.template(n)
+
+	case *xslt.Key:
+		name, ok := d.name("key", n.Name)
+		if !ok {
+			return []ast.Node{d.unsupported(n, "key %q has no LXT equivalent", n.Name)}
+		}
+
+		return []ast.Node{&ast.Key{
+			Name:  name,
+			Match: d.xpath(n.Match),
+			Use:   d.xpath(n.Use),
+		}}
+
+	case *xslt.Param:
+		if v, ok := d.variable(ast.VarKindParam, (*xslt.Variable)(n)); ok {
+			return []ast.Node{v}
+		}
+		return []ast.Node{d.unsupported(n, "param %q has no LXT equivalent", n.Name)}
+
+	case *xslt.Variable:
+		if v, ok := d.variable(ast.VarKindVar, n); ok {
+			return []ast.Node{v}
+		}
+		return []ast.Node{d.unsupported(n, "variable %q has no LXT equivalent", n.Name)}
+
+	case *xslt.Comment, *xslt.Unsupported:
+		return d.exprs(n)
+	}
+
+	return []ast.Node{d.unsupported(node, "top-level %T has no LXT equivalent", node)}
+}
+
+func (d *decompiler) template(t *xslt.Template) []ast.Node {
+	params, ok := d.params(t.Params)
+	if !ok {
+		return []ast.Node{d.unsupported(t, "template has no LXT equivalent")}
+	}
+
+	if t.Match == "" {
+		name, ok := d.name("template", t.Name)
+		if !ok {
+			return []ast.Node{d.unsupported(t, "template has no LXT equivalent")}
+		}
+
+		return []ast.Node{&ast.Sub{
+			Name:   name,
+			Params: params,
+			Body:   d.body(t.Body),
+		}}
+	}
+
+	tmpl := &ast.Template{
+		Match:  d.xpath(t.Match),
+		Params: params,
+	}
+
+	if t.Mode != "" {
+		name, ok := d.name("mode", t.Mode)
+		if !ok {
+			return []ast.Node{d.unsupported(t, "template has no LXT equivalent")}
+		}
+
+		tmpl.Mode = &ast.Mode{
+			Name: name,
+		}
+	}
+
+	if t.Priority != "" {
+		if _, err := strconv.ParseFloat(t.Priority, 64); err != nil {
+			return []ast.Node{d.unsupported(t, "template priority %q has no LXT equivalent", t.Priority)}
+		}
+
+		tmpl.Priority = &ast.Priority{
+			Value: str(t.Priority),
+		}
+
+		if t.Priority[0] >= '0' && t.Priority[0] <= '9' {
+			tmpl.Priority.Value = &ast.Number{
+				Value: t.Priority,
+			}
+		}
+	}
+
+	if t.Name == "" {
+		tmpl.Body = d.body(t.Body)
+		return []ast.Node{tmpl}
+	}
+
+	// A template with both a name and a match becomes a `sub` holding the body,
+	// and a `template` that calls it, passing along all of its parameters.
+	name, ok := d.name("template", t.Name)
+	if !ok {
+		return []ast.Node{d.unsupported(t, "template has no LXT equivalent")}
+	}
+
+	call := &ast.Call{
+		Name: name,
+	}
+
+	if params != nil {
+		call.Args = &ast.VariableList{
+			Delim: "(",
+		}
+
+		for _, param := range params.List {
+			call.Args.List = append(call.Args.List, &ast.Variable{
+				Kind:  ast.VarKindArgument,
+				Name:  param.Name,
+				Op:    "=>",
+				Value: &ast.XPath{Value: "$" + param.Name.Name},
+			})
+		}
+	}
+
+	tmpl.Body = call
+
+	return []ast.Node{
+		&ast.Sub{
+			Name:   name,
+			Params: params,
+			Body:   d.body(t.Body),
+		},
+		tmpl,
+	}
+}
+
+func (d *decompiler) params(params []*xslt.Param) (*ast.VariableList, bool) {
+	if len(params) == 0 {
+		return nil, true
+	}
+
+	list := &ast.VariableList{
+		Delim: "(",
+	}
+
+	for _, param := range params {
+		v, ok := d.variable(ast.VarKindParam, (*xslt.Variable)(param))
+		if !ok {
+			return nil, false
+		}
+
+		v.Op = "=>"
+		list.List = append(list.List, v)
+	}
+
+	return list, true
+}
+
+func (d *decompiler) args(params []*xslt.WithParam) (*ast.VariableList, bool) {
+	if len(params) == 0 {
+		return nil, true
+	}
+
+	list := &ast.VariableList{
+		Delim: "(",
+	}
+
+	for _, param := range params {
+		v, ok := d.variable(ast.VarKindArgument, (*xslt.Variable)(param))
+		if !ok {
+			return nil, false
+		}
+
+		v.Op = "=>"
+		list.List = append(list.List, v)
+	}
+
+	return list, true
+}
+
+// variable translates a variable, parameter, or argument.
+func (d *decompiler) variable(kind ast.VarKind, v *xslt.Variable) (*ast.Variable, bool) {
+	defer d.enter(v)()
+
+	name, ok := d.name(kind.String(), v.Name)
+	if !ok {
+		return nil, false
+	}
+
+	if v.Select != "" && v.Value != nil {
+		d.errorf("%s %q cannot have both a select and a body", kind, v.Name)
+		return nil, false
+	}
+
+	variable := &ast.Variable{
+		Kind: kind,
+		Name: name,
+		Op:   "=",
+	}
+
+	switch {
+	case v.Select != "":
+		variable.Value = d.xpath(v.Select)
+
+	case v.Value != nil:
+		body := d.body(v.Value)
+
+		switch body.(type) {
+		case *ast.XPath, *ast.Number:
+			// A lone xpath would be taken as the select, rather than as the body.
+			body = &ast.Group{
+				Delim: "{",
+				List:  []ast.Node{body},
+			}
+		}
+
+		variable.Value = body
+
+	default:
+		variable.Value = str("")
+	}
+
+	return variable, true
+}
+
+// body translates the body of an instruction.
+func (d *decompiler) body(node interface{}) ast.Node {
+	return body(d.exprs(node))
+}
+
+// exprs translates the given instruction, or group of instructions, into a list of expressions.
+// Consecutive attributes are merged into a single `attribs`.
+func (d *decompiler) exprs(node interface{}) []ast.Node {
+	var list []ast.Node
+
+	add := func(expr ast.Node) {
+		if attribs, ok := expr.(*ast.Attribs); ok && len(list) > 0 {
+			if prev, ok := list[len(list)-1].(*ast.Attribs); ok {
+				prev.List = append(prev.List, attribs.List...)
+				return
+			}
+		}
+
+		list = append(list, expr)
+	}
+
+	switch n := node.(type) {
+	case nil:
+
+	case xslt.Group:
+		for _, child := range n {
+			for _, expr := range d.exprs(child) {
+				add(expr)
+			}
+		}
+
+	case []*xslt.Attribute:
+		for _, attr := range n {
+			add(d.expr(attr))
+		}
+
+	default:
+		add(d.expr(n))
+	}
+
+	return list
+}
+
+func (d *decompiler) expr(node interface{}) ast.Node {
+	defer d.enter(node)()
+
+	switch n := node.(type) {
+	case *xslt.Comment:
+		return &ast.Comment{
+			Text: commentText(n.Body),
+		}
+
+	case *xslt.Unsupported:
+		return d.unsupported(n, "%s has no LXT equivalent", n.Name)
+
+	case *xslt.Text:
+		if isYes(n.DisableOutputEscaping) {
+			return d.unsupported(n, "disable-output-escaping has no LXT equivalent")
+		}
+
+		return str(n.Body)
+
+	case *xslt.ValueOf:
+		if isYes(n.DisableOutputEscaping) {
+			return d.unsupported(n, "disable-output-escaping has no LXT equivalent")
+		}
+
+		return d.xpath(n.Select)
+
+	case *xslt.CopyOf:
+		return &ast.CopyOf{
+			Select: d.xpath(n.Select),
+		}
+
+	case *xslt.Variable:
+		if v, ok := d.variable(ast.VarKindVar, n); ok {
+			return v
+		}
+		return d.unsupported(n, "variable %q has no LXT equivalent", n.Name)
+
+	case *xslt.If:
+		return &ast.If{
+			Test: d.xpath(n.Test),
+			Body: d.body(n.Body),
+		}
+
+	case *xslt.Choose:
+		choose := new(ast.Choose)
+
+		for _, when := range n.Whens {
+			choose.Whens = append(choose.Whens, &ast.When{
+				Test: d.xpath(when.Test),
+				Body: d.body(when.Body),
+			})
+		}
+
+		if n.Otherwise != nil {
+			choose.Otherwise = &ast.Otherwise{
+				Body: d.body(n.Otherwise.Body),
+			}
+		}
+
+		return choose
+
+	case *xslt.ForEach:
+		sortBy, ok := d.sortBy(n.Sort)
+		if !ok {
+			return d.unsupported(n, "for-each has no LXT equivalent")
+		}
+
+		return &ast.ForEach{
+			Select: d.xpath(n.Select),
+			SortBy: sortBy,
+			Body:   d.body(n.Body),
+		}
+
+	case *xslt.ApplyTemplates:
+		return d.applyTemplates(n)
+
+	case *xslt.CallTemplate:
+		name, ok := d.name("template", n.Name)
+		if !ok {
+			return d.unsupported(n, "call-template has no LXT equivalent")
+		}
+
+		args, ok := d.args(n.WithParams)
+		if !ok {
+			return d.unsupported(n, "call-template has no LXT equivalent")
+		}
+
+		return &ast.Call{
+			Name: name,
+			Args: args,
+		}
+
+	case *xslt.Element:
+		return d.element(n)
+
+	case *xslt.Attribute:
+		name, ok := computed(n.Name)
+		if !ok {
+			return d.unsupported(n, "computed attribute name %q has no LXT equivalent", n.Name)
+		}
+
+		ns, ok := inNamespace(n.Namespace)
+		if !ok {
+			return d.unsupported(n, "computed attribute namespace %q has no LXT equivalent", n.Namespace)
+		}
+
+		return &ast.Attribs{
+			Delim: "(",
+			List: []*ast.Attrib{{
+				Name:      name,
+				Namespace: ns,
+				Value:     d.body(n.Value),
+			}},
+		}
+	}
+
+	return d.unsupported(node, "%T has no LXT equivalent", node)
+}
+
+func (d *decompiler) applyTemplates(n *xslt.ApplyTemplates) ast.Node {
+	apply := new(ast.ApplyTemplates)
+
+	if n.Select != "" {
+		apply.Select = d.xpath(n.Select)
+	}
+
+	if n.Mode != "" {
+		name, ok := d.name("mode", n.Mode)
+		if !ok {
+			return d.unsupported(n, "apply-templates has no LXT equivalent")
+		}
+
+		apply.Mode = &ast.Mode{
+			Name: name,
+		}
+	}
+
+	var ok bool
+	if apply.SortBy, ok = d.sortBy(n.Sort); !ok {
+		return d.unsupported(n, "apply-templates has no LXT equivalent")
+	}
+
+	if apply.Args, ok = d.args(n.WithParams); !ok {
+		return d.unsupported(n, "apply-templates has no LXT equivalent")
+	}
+
+	return apply
+}
+
+func (d *decompiler) sortBy(sorts []*xslt.Sort) (*ast.SortBy, bool) {
+	if len(sorts) == 0 {
+		return nil, true
+	}
+
+	sortBy := &ast.SortBy{
+		Delim: "(",
+	}
+
+	for _, sort := range sorts {
+		key, ok := d.sortKey(sort)
+		if !ok {
+			return nil, false
+		}
+
+		sortBy.Keys = append(sortBy.Keys, key)
+	}
+
+	return sortBy, true
+}
+
+func (d *decompiler) sortKey(sort *xslt.Sort) (*ast.SortKey, bool) {
+	defer d.enter(sort)()
+
+	sel := sort.Select
+	if sel == "" {
+		sel = "."
+	}
+
+	key := &ast.SortKey{
+		Select: d.xpath(sel),
+	}
+
+	modifier := func(name string) {
+		key.Modifiers = append(key.Modifiers, &ast.SortModifier{
+			Name: ident(name),
+		})
+	}
+
+	switch sort.Order {
+	case "", "ascending":
+	case "descending":
+		modifier("desc")
+	default:
+		d.errorf("sort order %q has no LXT equivalent", sort.Order)
+		return nil, false
+	}
+
+	switch sort.DataType {
+	case "", "text":
+	case "number":
+		modifier("number")
+	default:
+		d.errorf("sort data-type %q has no LXT equivalent", sort.DataType)
+		return nil, false
+	}
+
+	switch sort.CaseOrder {
+	case "":
+	case "upper-first", "lower-first":
+		modifier(sort.CaseOrder)
+	default:
+		d.errorf("sort case-order %q has no LXT equivalent", sort.CaseOrder)
+		return nil, false
+	}
+
+	if sort.Lang != "" {
+		if strings.ContainsAny(sort.Lang, "{}") {
+			d.errorf("sort lang %q has no LXT equivalent", sort.Lang)
+			return nil, false
+		}
+
+		key.Modifiers = append(key.Modifiers, &ast.SortModifier{
+			Name:  ident("lang"),
+			Value: literal(sort.Lang),
+		})
+	}
+
+	return key, true
+}
+
+// element translates an element, using the `div` or `span` sugar where it fits.
+func (d *decompiler) element(n *xslt.Element) ast.Node {
+	name, ok := computed(n.Name)
+	if _, isString := name.(*ast.String); !ok || isString {
+		return d.unsupported(n, "element name %q has no LXT equivalent", n.Name)
+	}
+
+	ns, ok := inNamespace(n.Namespace)
+	if !ok {
+		return d.unsupported(n, "element namespace %q has no LXT equivalent", n.Namespace)
+	}
+
+	list := d.exprs(n.Body)
+
+	if ns == nil {
+		if elem, ok := htmlElement(n.Name, list); ok {
+			return elem
+		}
+	}
+
+	return &ast.Tag{
+		Name:      name,
+		Namespace: ns,
+		Body:      body(list),
+	}
+}
+
+// computed returns the name of an element or attribute, which is an attribute value template.
+// A static name is a literal, and a name computed by a single expression is an XPath.
+// Any other attribute value template has no LXT equivalent.
+func computed(avt string) (ast.Node, bool) {
+	if !strings.ContainsAny(avt, "{}") {
+		return literal(avt), true
+	}
+
+	inner := strings.TrimSuffix(strings.TrimPrefix(avt, "{"), "}")
+	if len(inner) != len(avt)-2 || strings.ContainsAny(inner, "{}") || !printer.CanQuoteXPath(strings.TrimSpace(inner)) {
+		return nil, false
+	}
+
+	return &ast.XPath{
+		Value: strings.TrimSpace(inner),
+	}, true
+}
+
+// inNamespace returns the namespace option of an element or attribute, if it has a namespace.
+func inNamespace(avt string) (*ast.InNamespace, bool) {
+	if avt == "" {
+		return nil, true
+	}
+
+	if !strings.ContainsAny(avt, "{}") {
+		return &ast.InNamespace{URI: str(avt)}, true
+	}
+
+	uri, ok := computed(avt)
+	if !ok {
+		return nil, false
+	}
+
+	return &ast.InNamespace{URI: uri}, true
+}
+
+// htmlElement returns the HTML sugar for an element with the given name and body, if the element has sugar.
+// Any id and class attributes with literal values at the start of the body are written in the shorthand, where they can be.
+func htmlElement(name string, list []ast.Node) (*ast.HTMLElement, bool) {
+	if !parser.IsHTMLElement(name) {
+		return nil, false
+	}
+
+	elem := &ast.HTMLElement{
+		Tag: name,
+	}
+
+	if attribs, ok := first(list).(*ast.Attribs); ok {
+		var rest []*ast.Attrib
+
+		for _, attr := range attribs.List {
+			if !shorthand(elem, attr) {
+				rest = append(rest, attr)
+			}
+		}
+
+		list = list[1:]
+		if len(rest) > 0 {
+			list = append([]ast.Node{&ast.Attribs{
+				Delim: attribs.Delim,
+				List:  rest,
+			}}, list...)
+		}
+	}
+
+	if parser.IsVoidElement(name) {
+		for _, n := range list {
+			if _, ok := n.(*ast.Attribs); !ok {
+				// A void element cannot have content, so the sugar cannot be used for one that does.
+				return nil, false
+			}
+		}
+	}
+
+	elem.Body = body(list)
+	return elem, true
+}
+
+func first(list []ast.Node) ast.Node {
+	if len(list) == 0 {
+		return nil
+	}
+
+	return list[0]
+}
+
+// shorthand adds an id or class attribute to the shorthand of the element, and reports whether it could be added.
+func shorthand(elem *ast.HTMLElement, attr *ast.Attrib) bool {
+	name, ok := attr.Name.(*ast.Ident)
+	if !ok || attr.Namespace != nil {
+		return false
+	}
+
+	val, ok := attr.Value.(*ast.String)
+	if !ok {
+		return false
+	}
+
+	switch name.Name {
+	case "id":
+		if elem.ID != "" || !isShorthandName(val.Value) {
+			return false
+		}
+
+		elem.ID = val.Value
+		return true
+
+	case "class":
+		classes := strings.Fields(val.Value)
+		if elem.Classes != nil || len(classes) == 0 || strings.Join(classes, " ") != val.Value {
+			return false
+		}
+
+		for _, class := range classes {
+			if !isShorthandName(class) {
+				return false
+			}
+		}
+
+		elem.Classes = classes
+		return true
+	}
+
+	return false
+}
+
+// isShorthandName reports whether the id or class name can be written in the shorthand `tag#id.class`.
+func isShorthandName(s string) bool {
+	return printer.IsIdent(s) && !strings.ContainsAny(s, ".#")
+}
+
+// body returns the list of expressions as a body.
+// A body of a single value is written inline, and anything else is written as a block.
+func body(list []ast.Node) ast.Node {
+	if len(list) == 1 {
+		switch list[0].(type) {
+		case *ast.String, *ast.XPath:
+			return list[0]
+		}
+	}
+
+	return &ast.Group{
+		Delim: "{",
+		List:  list,
+	}
+}
+
+func isYes(b *xslt.BoolVal) bool {
+	return b != nil && bool(*b)
+}
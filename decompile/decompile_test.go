@@ -0,0 +1,203 @@
+package decompile
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/puellanivis/lxt/parser"
+	"github.com/puellanivis/lxt/printer"
+	"github.com/puellanivis/lxt/xslt"
+)
+
+func decompile(t *testing.T, input string) (string, []error) {
+	t.Helper()
+
+	dec := xslt.NewDecoder(strings.NewReader(input))
+
+	xsl, err := dec.Decode()
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	file, errs := Stylesheet(xsl, "test.xsl", dec.Locations)
+
+	return string(printer.Source(file)), errs
+}
+
+func TestStylesheet(t *testing.T) {
+	input := `<?xml version="1.0"?>
+<xsl:stylesheet version="1.0" xmlns:xsl="http://www.w3.org/1999/XSL/Transform">
+  <xsl:output method="html"/>
+  <xsl:key name="by-date" match="item" use="@date"/>
+  <!-- main entry -->
+  <xsl:template match="/">
+    <div class="page">
+      <xsl:for-each select="items/item">
+        <xsl:sort select="@date" order="descending"/>
+        <li id="i{@id}"><xsl:value-of select="name"/></li>
+      </xsl:for-each>
+      <xsl:choose>
+        <xsl:when test="count(items/item) &gt; 3">many</xsl:when>
+        <xsl:otherwise>few</xsl:otherwise>
+      </xsl:choose>
+      <xsl:call-template name="foot"/>
+    </div>
+  </xsl:template>
+  <xsl:template name="foot">
+    <p>footer</p>
+    <xsl:element name="{local-name()}" namespace="urn:x">
+      <xsl:attribute name="{@key}">value</xsl:attribute>
+    </xsl:element>
+  </xsl:template>
+</xsl:stylesheet>
+`
+
+	expect := `output ( method => html )
+
+key by-date <item> @date
+
+/** main entry */
+template </> {
+	div.page {
+		foreach <items/item> sort-by ( @date desc ) {
+			li {
+				attribs (
+					id => { "i" @id },
+				)
+				<name>
+			}
+		}
+		when <{ count(items/item) > 3 }> "many"
+		otherwise "few"
+		call foot
+	}
+}
+
+sub foot {
+	p "footer"
+	tag <{ local-name() }> namespace "urn:x" {
+		attribs ( @key => "value" )
+	}
+}
+`
+
+	got, errs := decompile(t, input)
+	if len(errs) > 0 {
+		t.Fatal("unexpected errors:", errs)
+	}
+
+	if got != expect {
+		t.Errorf("decompile gave:\n%s\nexpected:\n%s", got, expect)
+	}
+
+	if _, err := parser.Parse(context.Background(), strings.NewReader(got), "test.lxt"); err != nil {
+		t.Error("decompiled source does not parse:", err)
+	}
+}
+
+func TestStylesheetUnsupported(t *testing.T) {
+	input := `<xsl:stylesheet version="1.0" xmlns:xsl="http://www.w3.org/1999/XSL/Transform">
+  <xsl:template match="/">
+    <xsl:number/>
+    <xsl:value-of select="." disable-output-escaping="yes"/>
+  </xsl:template>
+</xsl:stylesheet>
+`
+
+	got, errs := decompile(t, input)
+
+	expect := []string{
+		"test.xsl:3:5: xsl:number has no LXT equivalent",
+		"test.xsl:4:5: disable-output-escaping has no LXT equivalent",
+	}
+
+	if len(errs) != len(expect) {
+		t.Fatalf("got %d errors, expected %d: %v", len(errs), len(expect), errs)
+	}
+
+	for i, err := range errs {
+		if err.Error() != expect[i] {
+			t.Errorf("error[%d] = %q, expected %q", i, err, expect[i])
+		}
+	}
+
+	if !strings.Contains(got, "/** unsupported: <xsl:number></xsl:number> */") {
+		t.Errorf("unsupported construct was not kept as a doc comment:\n%s", got)
+	}
+}
+
+func TestStylesheetNamespaces(t *testing.T) {
+	input := `<xsl:stylesheet version="2.0" exclude-result-prefixes="h"
+    xmlns:xsl="http://www.w3.org/1999/XSL/Transform"
+    xmlns:xs="http://www.w3.org/2001/XMLSchema"
+    xmlns:h="http://www.w3.org/1999/xhtml">
+  <xsl:template match="/">
+    <xsl:value-of select="xs:integer(h:p)"/>
+  </xsl:template>
+</xsl:stylesheet>
+`
+
+	expect := `namespace h => "http://www.w3.org/1999/xhtml"
+
+stylesheet ( version => "2.0", exclude-result-prefixes => "h" )
+
+output ( indent => false )
+
+template </> <{ xs:integer(h:p) }>
+`
+
+	got, errs := decompile(t, input)
+	if len(errs) > 0 {
+		t.Fatal("unexpected error:", errs)
+	}
+
+	if got != expect {
+		t.Errorf("decompile gave:\n%s\nexpected:\n%s", got, expect)
+	}
+}
+
+func TestStylesheetHTML(t *testing.T) {
+	input := `<xsl:stylesheet version="1.0" xmlns:xsl="http://www.w3.org/1999/XSL/Transform">
+  <xsl:template match="/">
+    <section id="main" class="card wide" title="x">
+      <div class="a  b"/>
+      <img src="{@src}"/>
+      <br/>
+      <hr>text</hr>
+      <p class="a.b">para</p>
+    </section>
+  </xsl:template>
+</xsl:stylesheet>
+`
+
+	expect := `output ( indent => false )
+
+template </> {
+	section#main.card.wide {
+		attribs ( title => "x" )
+		div {
+			attribs ( class => "a  b" )
+		}
+		img {
+			attribs ( src => @src )
+		}
+		br { }
+		tag hr "text"
+		p {
+			attribs ( class => "a.b" )
+			"para"
+		}
+	}
+}
+`
+
+	got, errs := decompile(t, input)
+	if len(errs) > 0 {
+		t.Fatal("unexpected error:", errs)
+	}
+
+	if got != expect {
+		t.Errorf("decompile gave:\n%s\nexpected:\n%s", got, expect)
+	}
+}
@@ -0,0 +1,627 @@
+// Package engine implements an XSLT 1.0 processor, which executes an xslt.Stylesheet against an XML document.
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/puellanivis/lxt/xpath"
+	"github.com/puellanivis/lxt/xslt"
+)
+
+// maxDepth limits the depth of template recursion, so that infinite recursion is reported as an error.
+const maxDepth = 5000
+
+// Processor executes a compiled Stylesheet.
+// A Processor may be used for any number of transformations, but they must not run concurrently.
+type Processor struct {
+	xsl *xslt.Stylesheet
+
+	rules   []*rule
+	named   map[string]*xslt.Template
+	globals map[string]interface{} // either *xslt.Variable or *xslt.Param
+	keys    map[string][]*key
+
+	// funcs are the EXSLT functions, keyed by their expanded name, `{uri}local`.
+	funcs map[string]*xslt.EXSLTFunction
+
+	// namespaces maps the prefixes declared on the stylesheet to their namespace URIs.
+	namespaces map[string]string
+
+	// params are the values of top-level parameters given to the transformation.
+	params map[string]string
+
+	mu    sync.Mutex
+	exprs map[string]xpath.Expr
+}
+
+// New returns a Processor for the given Stylesheet.
+func New(xsl *xslt.Stylesheet) (*Processor, error) {
+	p := &Processor{
+		xsl: xsl,
+
+		named:      make(map[string]*xslt.Template),
+		globals:    make(map[string]interface{}),
+		keys:       make(map[string][]*key),
+		funcs:      make(map[string]*xslt.EXSLTFunction),
+		namespaces: make(map[string]string),
+		params:     make(map[string]string),
+		exprs:      make(map[string]xpath.Expr),
+	}
+
+	if len(xsl.Imports) > 0 {
+		return nil, errors.New("xsl:import is not supported")
+	}
+
+	if len(xsl.Includes) > 0 {
+		return nil, errors.New("xsl:include is not supported")
+	}
+
+	for prefix, uri := range xsl.Namespaces() {
+		if prefix != "" {
+			p.namespaces[prefix] = uri
+		}
+	}
+
+	if err := p.declarations(xsl.Keys); err != nil {
+		return nil, err
+	}
+
+	if err := p.declarations(xsl.Body); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// declarations collects the templates and global variables of the top-level of the stylesheet.
+func (p *Processor) declarations(body interface{}) error {
+	switch decl := body.(type) {
+	case xslt.Group:
+		for _, child := range decl {
+			if err := p.declarations(child); err != nil {
+				return err
+			}
+		}
+
+	case *xslt.Template:
+		if decl.Name != "" {
+			if _, ok := p.named[decl.Name]; ok {
+				return fmt.Errorf("duplicate template named %q", decl.Name)
+			}
+
+			p.named[decl.Name] = decl
+		}
+
+		if decl.Match == "" {
+			return nil
+		}
+
+		pattern, err := xpath.ParsePattern(decl.Match)
+		if err != nil {
+			return fmt.Errorf("template match=%q: %w", decl.Match, err)
+		}
+
+		var priority float64
+		if decl.Priority != "" {
+			if priority, err = strconv.ParseFloat(decl.Priority, 64); err != nil {
+				return fmt.Errorf("template match=%q: bad priority %q", decl.Match, decl.Priority)
+			}
+		}
+
+		for _, alt := range alternatives(pattern) {
+			r := &rule{
+				tmpl:     decl,
+				pattern:  alt,
+				priority: priority,
+				order:    len(p.rules),
+			}
+
+			if decl.Priority == "" {
+				r.priority = defaultPriority(alt)
+			}
+
+			p.rules = append(p.rules, r)
+		}
+
+	case *xslt.Key:
+		return p.declareKey(decl)
+
+	case *xslt.EXSLTFunction:
+		return p.declareFunc(decl)
+
+	case *xslt.Variable:
+		return p.declareGlobal(decl.Name, decl)
+
+	case *xslt.Param:
+		return p.declareGlobal(decl.Name, decl)
+	}
+
+	return nil
+}
+
+func (p *Processor) declareGlobal(name string, decl interface{}) error {
+	if _, ok := p.globals[name]; ok {
+		return fmt.Errorf("duplicate global variable %q", name)
+	}
+
+	p.globals[name] = decl
+	return nil
+}
+
+// declareFunc declares an EXSLT function, which must be in a namespace, so that it is not mistaken for an XPath function.
+func (p *Processor) declareFunc(decl *xslt.EXSLTFunction) error {
+	if uri := p.namespaces[decl.Prefix]; uri != xslt.NamespaceEXSLTFunctions {
+		return fmt.Errorf("func:function %q: prefix %q is not declared for %q", decl.Name, decl.Prefix, xslt.NamespaceEXSLTFunctions)
+	}
+
+	prefix, local, ok := strings.Cut(decl.Name, ":")
+	if !ok {
+		return fmt.Errorf("func:function %q: the name must have a namespace prefix", decl.Name)
+	}
+
+	uri, ok := p.namespaces[prefix]
+	if !ok {
+		return fmt.Errorf("func:function %q: undeclared namespace prefix %q", decl.Name, prefix)
+	}
+
+	name := expandedName(uri, local)
+	if _, ok := p.funcs[name]; ok {
+		return fmt.Errorf("duplicate func:function %q", decl.Name)
+	}
+
+	p.funcs[name] = decl
+	return nil
+}
+
+func expandedName(uri, local string) string {
+	return "{" + uri + "}" + local
+}
+
+// SetParam sets the value of a top-level parameter of the stylesheet, as a string.
+func (p *Processor) SetParam(name, value string) {
+	p.params[name] = value
+}
+
+// compile returns the parsed XPath expression, caching the result.
+func (p *Processor) compile(src string) (xpath.Expr, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if expr, ok := p.exprs[src]; ok {
+		return expr, nil
+	}
+
+	expr, err := xpath.Parse(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p.exprs[src] = expr
+	return expr, nil
+}
+
+// global state of the evaluation of a global variable.
+type global struct {
+	val        value
+	evaluating bool
+}
+
+// transform holds the state of a single transformation.
+type transform struct {
+	*Processor
+
+	ctx  context.Context
+	root *Node
+
+	// order is the last document order assigned to a node.
+	order int
+	depth int
+
+	globalVals map[string]*global
+
+	// keyIndexes are the indexes of each key that has been used, by the root node of the document.
+	keyIndexes map[*Node]map[string]keyIndex
+}
+
+// Transform parses the XML document from the given io.Reader,
+// transforms it according to the stylesheet, and writes the result to the given io.Writer.
+func (p *Processor) Transform(ctx context.Context, in io.Reader, out io.Writer) error {
+	doc, err := Parse(in)
+	if err != nil {
+		return fmt.Errorf("parsing input: %w", err)
+	}
+
+	return p.TransformNode(ctx, doc, out)
+}
+
+// TransformNode transforms the document with the given root node according to the stylesheet,
+// and writes the result to the given io.Writer.
+func (p *Processor) TransformNode(ctx context.Context, doc *Node, out io.Writer) error {
+	t := &transform{
+		Processor: p,
+
+		ctx:  ctx,
+		root: doc,
+
+		globalVals: make(map[string]*global),
+		keyIndexes: make(map[*Node]map[string]keyIndex),
+	}
+
+	// Number the document again, so that the document order of any result tree fragments follows it.
+	numberTree(doc, &t.order)
+
+	result := &Node{
+		Type: RootNode,
+	}
+
+	if err := t.applyTemplates(nodeSet{doc}, "", nil, result); err != nil {
+		return err
+	}
+
+	return serialize(out, result, p.xsl.Output)
+}
+
+// global returns the value of the named global variable or parameter, evaluating it if necessary.
+func (t *transform) global(name string) (value, error) {
+	if g, ok := t.globalVals[name]; ok {
+		if g.evaluating {
+			return nil, fmt.Errorf("global variable $%s is defined in terms of itself", name)
+		}
+
+		return g.val, nil
+	}
+
+	decl, ok := t.globals[name]
+	if !ok {
+		return nil, fmt.Errorf("undefined variable: $%s", name)
+	}
+
+	g := &global{
+		evaluating: true,
+	}
+	t.globalVals[name] = g
+
+	f := &frame{
+		node: t.root,
+		pos:  1,
+		size: 1,
+	}
+
+	var err error
+
+	switch decl := decl.(type) {
+	case *xslt.Param:
+		if val, ok := t.params[name]; ok {
+			g.val = val
+			break
+		}
+
+		g.val, err = t.variableValue(f, decl.Select, decl.Value)
+
+	case *xslt.Variable:
+		g.val, err = t.variableValue(f, decl.Select, decl.Value)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("global variable $%s: %w", name, err)
+	}
+
+	g.evaluating = false
+	return g.val, nil
+}
+
+// frame is the context in which an instruction is executed.
+type frame struct {
+	node      *Node
+	pos, size int
+
+	mode string
+	vars *scope
+
+	// result is the result of the EXSLT function whose body is being executed, if any.
+	result *funcResult
+}
+
+func (t *transform) evalContext(f *frame) *evalContext {
+	return &evalContext{
+		node:    f.node,
+		pos:     f.pos,
+		size:    f.size,
+		vars:    f.vars,
+		current: f.node,
+	}
+}
+
+// evalXPath compiles and evaluates the XPath expression in the given frame.
+func (t *transform) evalXPath(f *frame, src string) (value, error) {
+	expr, err := t.compile(src)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.eval(t.evalContext(f), expr)
+}
+
+func (t *transform) evalString(f *frame, src string) (string, error) {
+	v, err := t.evalXPath(f, src)
+	if err != nil {
+		return "", err
+	}
+
+	return toString(v), nil
+}
+
+func (t *transform) evalNodes(f *frame, src string) (nodeSet, error) {
+	v, err := t.evalXPath(f, src)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes, ok := v.(nodeSet)
+	if !ok {
+		return nil, fmt.Errorf("%s: expected a node-set, found %s", src, typeName(v))
+	}
+
+	return nodes, nil
+}
+
+// variableValue returns the value of a variable or parameter, from either its select, or its body.
+func (t *transform) variableValue(f *frame, sel string, body interface{}) (value, error) {
+	if sel != "" {
+		return t.evalXPath(f, sel)
+	}
+
+	if body == nil {
+		return "", nil
+	}
+
+	return t.fragment(f, body)
+}
+
+// fragment executes the body into a new result tree fragment.
+// The fragment is returned as a node-set of its root node.
+func (t *transform) fragment(f *frame, body interface{}) (nodeSet, error) {
+	root := &Node{
+		Type: RootNode,
+	}
+
+	if err := t.execBody(*f, body, root); err != nil {
+		return nil, err
+	}
+
+	numberTree(root, &t.order)
+	return nodeSet{root}, nil
+}
+
+// resolvePrefix returns the namespace URI of a prefix declared on the stylesheet.
+func (t *transform) resolvePrefix(prefix string) (string, error) {
+	switch prefix {
+	case "xml":
+		return nsXML, nil
+	}
+
+	uri, ok := t.namespaces[prefix]
+	if !ok {
+		return "", fmt.Errorf("undeclared namespace prefix %q", prefix)
+	}
+
+	return uri, nil
+}
+
+// applyTemplates applies the best matching template to each of the nodes.
+func (t *transform) applyTemplates(nodes nodeSet, mode string, params map[string]value, out *Node) error {
+	if err := t.ctx.Err(); err != nil {
+		return err
+	}
+
+	t.depth++
+	defer func() { t.depth-- }()
+
+	if t.depth > maxDepth {
+		return errors.New("too many nested templates, possibly infinite recursion")
+	}
+
+	for i, n := range nodes {
+		f := &frame{
+			node: n,
+			pos:  i + 1,
+			size: len(nodes),
+			mode: mode,
+		}
+
+		r, err := t.findRule(t.evalContext(f), n, mode)
+		if err != nil {
+			return err
+		}
+
+		if r == nil {
+			if err := t.builtinTemplate(f, out); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := t.invoke(f, r.tmpl, params, out); err != nil {
+			return fmt.Errorf("template match=%q: %w", r.tmpl.Match, err)
+		}
+	}
+
+	return nil
+}
+
+// builtinTemplate applies the built-in template rules of XSLT 1.0, section 5.8.
+func (t *transform) builtinTemplate(f *frame, out *Node) error {
+	switch f.node.Type {
+	case RootNode, ElementNode:
+		return t.applyTemplates(f.node.Children, f.mode, nil, out)
+
+	case TextNode, AttributeNode:
+		out.appendChild(&Node{
+			Type: TextNode,
+			Data: f.node.Data,
+		})
+	}
+
+	return nil
+}
+
+// invoke executes the template in the given frame, with the given parameters.
+func (t *transform) invoke(f *frame, tmpl *xslt.Template, params map[string]value, out *Node) error {
+	// Templates only see global variables, and their own parameters.
+	f.vars = nil
+
+	for _, param := range tmpl.Params {
+		val, ok := params[param.Name]
+		if !ok {
+			var err error
+
+			val, err = t.variableValue(f, param.Select, param.Value)
+			if err != nil {
+				return fmt.Errorf("param $%s: %w", param.Name, err)
+			}
+		}
+
+		f.vars = f.vars.bind(param.Name, val)
+	}
+
+	return t.execBody(*f, tmpl.Body, out)
+}
+
+// withParams evaluates the parameters passed to a template.
+func (t *transform) withParams(f *frame, list []*xslt.WithParam) (map[string]value, error) {
+	if len(list) == 0 {
+		return nil, nil
+	}
+
+	params := make(map[string]value)
+
+	for _, param := range list {
+		if param.Tunnel != nil {
+			return nil, fmt.Errorf("with-param $%s: tunnel parameters are not supported", param.Name)
+		}
+
+		val, err := t.variableValue(f, param.Select, param.Value)
+		if err != nil {
+			return nil, fmt.Errorf("with-param $%s: %w", param.Name, err)
+		}
+
+		params[param.Name] = val
+	}
+
+	return params, nil
+}
+
+// sortNodes sorts the nodes according to the xsl:sort keys, which are evaluated with each node as the context.
+func (t *transform) sortNodes(f *frame, nodes nodeSet, sorts []*xslt.Sort) (nodeSet, error) {
+	if len(sorts) == 0 {
+		return nodes, nil
+	}
+
+	type sortKey struct {
+		text string
+		num  float64
+	}
+
+	keys := make([][]sortKey, len(nodes))
+
+	for i, n := range nodes {
+		sf := *f
+		sf.node, sf.pos, sf.size = n, i+1, len(nodes)
+
+		keys[i] = make([]sortKey, len(sorts))
+
+		for j, s := range sorts {
+			sel := s.Select
+			if sel == "" {
+				sel = "."
+			}
+
+			v, err := t.evalString(&sf, sel)
+			if err != nil {
+				return nil, fmt.Errorf("sort select=%q: %w", sel, err)
+			}
+
+			keys[i][j] = sortKey{
+				text: v,
+				num:  stringNumber(v),
+			}
+		}
+	}
+
+	index := make([]int, len(nodes))
+	for i := range index {
+		index[i] = i
+	}
+
+	sort.SliceStable(index, func(a, b int) bool {
+		ka, kb := keys[index[a]], keys[index[b]]
+
+		for j, s := range sorts {
+			var cmp int
+
+			if s.DataType == "number" {
+				cmp = compareNumbers(ka[j].num, kb[j].num)
+			} else {
+				cmp = compareText(ka[j].text, kb[j].text, s.CaseOrder)
+			}
+
+			if s.Order == "descending" {
+				cmp = -cmp
+			}
+
+			if cmp != 0 {
+				return cmp < 0
+			}
+		}
+
+		return false
+	})
+
+	sorted := make(nodeSet, len(nodes))
+	for i, j := range index {
+		sorted[i] = nodes[j]
+	}
+
+	return sorted, nil
+}
+
+// compareNumbers compares two sort keys as numbers, with NaN sorting before all other numbers.
+func compareNumbers(a, b float64) int {
+	aNaN, bNaN := a != a, b != b
+
+	switch {
+	case aNaN && bNaN:
+		return 0
+	case aNaN:
+		return -1
+	case bNaN:
+		return 1
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+
+	return 0
+}
+
+// compareText compares two sort keys as text, ignoring case unless the two keys differ only by case.
+func compareText(a, b, caseOrder string) int {
+	if cmp := strings.Compare(strings.ToLower(a), strings.ToLower(b)); cmp != 0 {
+		return cmp
+	}
+
+	cmp := strings.Compare(a, b)
+	if caseOrder == "upper-first" {
+		return cmp
+	}
+
+	return -cmp
+}
@@ -0,0 +1,356 @@
+package engine
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/puellanivis/lxt/parser"
+	"github.com/puellanivis/lxt/xpath"
+	"github.com/puellanivis/lxt/xslt"
+)
+
+const testDoc = `<?xml version="1.0"?>
+<catalog xmlns:x="urn:x" xml:lang="en-US">
+	<item id="a" price="10.5"><name>Widget</name></item>
+	<item id="b" price="3"><name>gadget</name></item>
+	<item id="c" price="7.25"><name>Bolt &amp; Nut</name></item>
+	<x:extra>ignored</x:extra>
+</catalog>`
+
+// run compiles the LXT source, and transforms the test document with it.
+func run(t *testing.T, src string) string {
+	t.Helper()
+
+	xsl := xslt.NewStylesheet()
+	if err := parser.ParseFile(context.Background(), strings.NewReader(src), "test.lxt", xsl); err != nil {
+		t.Fatal("unexpected parse error:", err)
+	}
+
+	p, err := New(xsl)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	var out strings.Builder
+	if err := p.Transform(context.Background(), strings.NewReader(testDoc), &out); err != nil {
+		t.Fatal("unexpected transform error:", err)
+	}
+
+	return out.String()
+}
+
+func TestEvaluate(t *testing.T) {
+	doc, err := Parse(strings.NewReader(testDoc))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := New(xslt.NewStylesheet())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.namespaces["x"] = "urn:x"
+
+	tr := &transform{
+		Processor:  p,
+		ctx:        context.Background(),
+		root:       doc,
+		globalVals: make(map[string]*global),
+	}
+
+	tests := map[string]string{
+		"count(//item)":                             "3",
+		"//item[2]/name":                            "gadget",
+		"//item[last()]/@id":                        "c",
+		"sum(//item/@price)":                        "20.75",
+		"//item[@price > 5][2]/@id":                 "c",
+		"string(//name[contains(., 'Nut')]/../@id)": "c",
+		"count(//x:extra)":                          "1",
+		"count(//extra)":                            "0",
+		"name(/*/*[last()])":                        "x:extra",
+		"local-name(/*/*[last()])":                  "extra",
+		"namespace-uri(/*/*[last()])":               "urn:x",
+		"//item[3]/preceding-sibling::item[1]/@id":  "b",
+		"//item[1]/following::name[last()]":         "Bolt & Nut",
+		"count(//name/ancestor::*)":                 "4",
+		"concat('a', 1 div 0, 0 div 0, -1 div 0)":   "aInfinityNaN-Infinity",
+		"substring('12345', 1.5, 2.6)":              "234",
+		"substring('12345', 0, 3)":                  "12",
+		"translate('bar', 'abc', 'ABC')":            "BAr",
+		"normalize-space('  a  b ')":                "a b",
+		"round(2.5) + round(-2.5)":                  "1",
+		"7 mod -3":                                  "1",
+		"1 = '1.0'":                                 "true",
+		"//item/@id = 'b'":                          "true",
+		"//item/@price < 4":                         "true",
+		"not(//item/@id != //item/@id)":             "false",
+		"lang('en')":                                "true",
+		"id('b c')[2]/name":                         "Bolt & Nut",
+		"format-number(1234.5, '#,##0.00')":         "1,234.50",
+		"format-number(0.256, '#%')":                "26%",
+		"format-number(-3, '0.0')":                  "-3.0",
+		"number(' 12 ') + number('1e3')":            "NaN",
+	}
+
+	for src, expect := range tests {
+		expr, err := xpath.Parse(src)
+		if err != nil {
+			t.Errorf("%s: parse error: %v", src, err)
+			continue
+		}
+
+		ctx := &evalContext{
+			node:    doc.Children[0],
+			pos:     1,
+			size:    1,
+			current: doc.Children[0],
+		}
+
+		v, err := tr.eval(ctx, expr)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", src, err)
+			continue
+		}
+
+		if got := toString(v); got != expect {
+			t.Errorf("%s = %q, expected %q", src, got, expect)
+		}
+	}
+}
+
+func TestStringNumber(t *testing.T) {
+	tests := map[string]float64{
+		"12":    12,
+		" -1.5": -1.5,
+		".5":    0.5,
+		"5.":    5,
+		"":      math.NaN(),
+		"1e3":   math.NaN(),
+		"+1":    math.NaN(),
+		"-":     math.NaN(),
+		"Inf":   math.NaN(),
+	}
+
+	for s, expect := range tests {
+		got := stringNumber(s)
+		if got != expect && !(math.IsNaN(got) && math.IsNaN(expect)) {
+			t.Errorf("stringNumber(%q) = %v, expected %v", s, got, expect)
+		}
+	}
+}
+
+func TestTemplates(t *testing.T) {
+	got := run(t, `
+output ( method => xml, omit-xml-declaration => true, indent => false )
+
+template </> {
+	tag list {
+		apply-templates <//item> sort-by ( <@price> number )
+	}
+}
+
+template <item> {
+	tag entry { <name> }
+}
+
+template <{ item[@id = 'b'] }> {
+	tag special { <name> }
+}
+
+template <*> priority 5 mode unused { "never" }
+`)
+
+	expect := "<list><special>gadget</special><entry>Bolt &amp; Nut</entry><entry>Widget</entry></list>\n"
+	if got != expect {
+		t.Errorf("got %q, expected %q", got, expect)
+	}
+}
+
+func TestBuiltinTemplates(t *testing.T) {
+	got := run(t, `
+output ( method => text )
+
+template <name> { "[" <{ . }> "]" }
+`)
+
+	expect := "\n\t[Widget]\n\t[gadget]\n\t[Bolt & Nut]\n\tignored\n"
+	if got != expect {
+		t.Errorf("got %q, expected %q", got, expect)
+	}
+}
+
+func TestVariablesAndParams(t *testing.T) {
+	got := run(t, `
+output ( method => text )
+
+var greeting = "Hello"
+var target = <{ /catalog/item[1]/name }>
+
+sub greet ( who => "nobody", punct => "!" ) {
+	$greeting ", " $who $punct
+}
+
+template </> {
+	call greet ( who => $target )
+	"\n"
+	foreach <//item> {
+		var n = <{ position() }>
+		if <{ $n > 1 }> { ", " }
+		$n ":" @id
+	}
+	"\n"
+	var frag = { tag b "bold" " text" }
+	$frag
+}
+`)
+
+	expect := "Hello, Widget!\n1:a, 2:b, 3:c\nbold text"
+	if got != expect {
+		t.Errorf("got %q, expected %q", got, expect)
+	}
+}
+
+func TestEXSLTFunctions(t *testing.T) {
+	got := run(t, `
+output ( method => text )
+namespace f => "http://exslt.org/functions"
+namespace my => "urn:my"
+
+func my:double ( $n ) { return <{ $n * 2 }> }
+
+func my:fact ( $n ) {
+	when <{ $n <= 1 }> { return <1> }
+	otherwise { return <{ $n * my:fact($n - 1) }> }
+}
+
+func my:first-name ( ) { return <{ name }> }
+
+template </> {
+	<{ my:double(21) }> " " <{ my:fact(5) }> " "
+	foreach <{ //item[2] }> <{ my:first-name() }> " "
+	<{ function-available('my:double') }> " " <{ function-available('my:nope') }>
+}
+`)
+
+	expect := "42 120 gadget true false"
+	if got != expect {
+		t.Errorf("got %q, expected %q", got, expect)
+	}
+}
+
+func TestOutputXML(t *testing.T) {
+	got := run(t, `
+output ( indent => true )
+
+template </> {
+	tag root {
+		attribs ( count => <{ count(//item) }>, note => "a \"quoted\" <value>" )
+		tag empty ""
+		copy-of <{ /catalog/item[2] }>
+		tag text { "x < y" }
+	}
+}
+`)
+
+	expect := `<?xml version="1.0" encoding="UTF-8"?>
+<root count="3" note="a &quot;quoted&quot; &lt;value>">
+  <empty/>
+  <item xmlns:x="urn:x" id="b" price="3">
+    <name>gadget</name>
+  </item>
+  <text>x &lt; y</text>
+</root>
+`
+	if got != expect {
+		t.Errorf("got:\n%s\nexpected:\n%s", got, expect)
+	}
+}
+
+func TestTransformErrors(t *testing.T) {
+	tests := map[string]string{
+		"undefined variable": `template </> { $nope }`,
+		"unknown template":   `template </> { call nope }`,
+		"unknown function":   `template </> { <{ nope() }> }`,
+		"unknown func":       "namespace my => \"urn:my\"\ntemplate </> { <{ my:nope() }> }",
+		"infinite recursion": `sub loop { call loop } template </> { call loop }`,
+		"undeclared prefix":  `template <{ x:* }> { }`,
+	}
+
+	for name, src := range tests {
+		xsl := xslt.NewStylesheet()
+		if err := parser.ParseFile(context.Background(), strings.NewReader(src), "test.lxt", xsl); err != nil {
+			t.Errorf("%s: unexpected parse error: %v", name, err)
+			continue
+		}
+
+		p, err := New(xsl)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+			continue
+		}
+
+		var out strings.Builder
+		if err := p.Transform(context.Background(), strings.NewReader(testDoc), &out); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	got := run(t, `
+namespace y => "urn:x"
+output ( omit-xml-declaration => true, indent => false )
+
+template </> <{ count(//y:extra) }>
+`)
+
+	if expect := "1\n"; got != expect {
+		t.Errorf("got %q, expected %q", got, expect)
+	}
+}
+
+func TestKeys(t *testing.T) {
+	got := run(t, `
+namespace x => "urn:x"
+output ( omit-xml-declaration => true, indent => false )
+
+key by-id <item> <@id>
+key by-id <{ x:extra }> <{ 'extra' }>
+
+template </> {
+	<{ key('by-id', 'b')/name }> ";"
+	<{ count(key('by-id', //item/@id)) }> ";"
+	<{ key('by-id', 'extra') }> ";"
+	group <//item> by <{ @price > 5 }> sort-by ( <{ current-grouping-key() }> ) {
+		<{ current-grouping-key() }> ":" foreach <{ current-group() }> <@id> ";"
+	}
+}
+`)
+
+	if expect := "gadget;3;ignored;false:b;true:ac;\n"; got != expect {
+		t.Errorf("got %q, expected %q", got, expect)
+	}
+}
+
+func TestComputedNames(t *testing.T) {
+	got := run(t, `
+namespace x => "urn:x"
+output ( omit-xml-declaration => true, indent => false )
+
+template </> {
+	foreach <{ //item[@price < 5] }> {
+		tag <{ concat('item-', @id) }> {
+			attribs ( <{ name(..) }> => <@price>, <{ 'ref' }> namespace "urn:r" => <@id> )
+		}
+	}
+	tag <{ name(//x:extra) }> namespace <{ namespace-uri(//x:extra) }> ;
+}
+`)
+
+	expect := `<item-b xmlns:ns0="urn:r" catalog="3" ns0:ref="b"/><x:extra xmlns:x="urn:x"/>` + "\n"
+	if got != expect {
+		t.Errorf("got %q, expected %q", got, expect)
+	}
+}
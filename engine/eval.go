@@ -0,0 +1,456 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/puellanivis/lxt/xpath"
+)
+
+// evalContext is the context in which an XPath expression is evaluated.
+type evalContext struct {
+	node      *Node
+	pos, size int
+
+	vars *scope
+
+	// current is the node returned by the XSLT current() function.
+	current *Node
+}
+
+// scope is a linked list of variable bindings, with the innermost binding first.
+type scope struct {
+	parent *scope
+	name   string
+	val    value
+}
+
+func (s *scope) bind(name string, val value) *scope {
+	return &scope{
+		parent: s,
+		name:   name,
+		val:    val,
+	}
+}
+
+func (t *transform) lookup(s *scope, name string) (value, error) {
+	for ; s != nil; s = s.parent {
+		if s.name == name {
+			return s.val, nil
+		}
+	}
+
+	return t.global(name)
+}
+
+func (t *transform) eval(ctx *evalContext, expr xpath.Expr) (value, error) {
+	switch x := expr.(type) {
+	case *xpath.Literal:
+		return x.Value, nil
+
+	case *xpath.Number:
+		return x.Value, nil
+
+	case *xpath.VariableRef:
+		return t.lookup(ctx.vars, x.Name.String())
+
+	case *xpath.ParenExpr:
+		return t.eval(ctx, x.X)
+
+	case *xpath.NegExpr:
+		v, err := t.eval(ctx, x.X)
+		if err != nil {
+			return nil, err
+		}
+
+		return -toNumber(v), nil
+
+	case *xpath.BinaryExpr:
+		return t.binary(ctx, x)
+
+	case *xpath.FunctionCall:
+		return t.call(ctx, x)
+
+	case *xpath.FilterExpr:
+		nodes, err := t.evalNodeSet(ctx, x.X)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, pred := range x.Predicates {
+			nodes, err = t.predicate(ctx, nodes, pred)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return nodes, nil
+
+	case *xpath.PathExpr:
+		nodes, err := t.evalNodeSet(ctx, x.Filter)
+		if err != nil {
+			return nil, err
+		}
+
+		return t.steps(ctx, nodes, x.Path.Steps)
+
+	case *xpath.LocationPath:
+		start := nodeSet{ctx.node}
+		if x.Absolute {
+			start = nodeSet{ctx.node.root()}
+		}
+
+		return t.steps(ctx, start, x.Steps)
+	}
+
+	return nil, fmt.Errorf("unsupported expression: %s", expr)
+}
+
+// evalNodeSet evaluates the expression, which must return a node-set.
+func (t *transform) evalNodeSet(ctx *evalContext, expr xpath.Expr) (nodeSet, error) {
+	v, err := t.eval(ctx, expr)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes, ok := v.(nodeSet)
+	if !ok {
+		return nil, fmt.Errorf("%s: expected a node-set, found %s", expr, typeName(v))
+	}
+
+	return nodes, nil
+}
+
+func typeName(v value) string {
+	switch v.(type) {
+	case nodeSet:
+		return "node-set"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	}
+
+	return fmt.Sprintf("%T", v)
+}
+
+func (t *transform) binary(ctx *evalContext, x *xpath.BinaryExpr) (value, error) {
+	lhs, err := t.eval(ctx, x.X)
+	if err != nil {
+		return nil, err
+	}
+
+	// The boolean operators do not evaluate their right operand if the result is already known.
+	switch x.Op {
+	case "or":
+		if toBool(lhs) {
+			return true, nil
+		}
+
+	case "and":
+		if !toBool(lhs) {
+			return false, nil
+		}
+	}
+
+	rhs, err := t.eval(ctx, x.Y)
+	if err != nil {
+		return nil, err
+	}
+
+	switch x.Op {
+	case "or", "and":
+		return toBool(rhs), nil
+
+	case "=", "!=", "<", "<=", ">", ">=":
+		return compare(x.Op, lhs, rhs), nil
+
+	case "+":
+		return toNumber(lhs) + toNumber(rhs), nil
+	case "-":
+		return toNumber(lhs) - toNumber(rhs), nil
+	case "*":
+		return toNumber(lhs) * toNumber(rhs), nil
+	case "div":
+		return toNumber(lhs) / toNumber(rhs), nil
+	case "mod":
+		return math.Mod(toNumber(lhs), toNumber(rhs)), nil
+
+	case "|":
+		xs, xok := lhs.(nodeSet)
+		ys, yok := rhs.(nodeSet)
+		if !xok || !yok {
+			return nil, fmt.Errorf("%s: the operands of | must be node-sets", x)
+		}
+
+		union := make(nodeSet, 0, len(xs)+len(ys))
+		union = append(union, xs...)
+		union = append(union, ys...)
+
+		return docOrder(union), nil
+	}
+
+	return nil, fmt.Errorf("unsupported operator: %s", x.Op)
+}
+
+// predicate filters the nodes, which are in the order of the axis they were selected from.
+func (t *transform) predicate(ctx *evalContext, nodes nodeSet, pred xpath.Expr) (nodeSet, error) {
+	var out nodeSet
+
+	for i, n := range nodes {
+		c := *ctx
+		c.node, c.pos, c.size = n, i+1, len(nodes)
+
+		v, err := t.eval(&c, pred)
+		if err != nil {
+			return nil, err
+		}
+
+		keep := toBool(v)
+		if f, ok := v.(float64); ok {
+			keep = f == float64(i+1)
+		}
+
+		if keep {
+			out = append(out, n)
+		}
+	}
+
+	return out, nil
+}
+
+func (t *transform) steps(ctx *evalContext, nodes nodeSet, steps []*xpath.Step) (nodeSet, error) {
+	for _, step := range steps {
+		var next nodeSet
+
+		for _, n := range nodes {
+			selected, err := t.step(ctx, n, step)
+			if err != nil {
+				return nil, err
+			}
+
+			next = append(next, selected...)
+		}
+
+		nodes = docOrder(next)
+	}
+
+	return nodes, nil
+}
+
+// step returns the nodes selected by the step from the context node n, in the order of the axis.
+func (t *transform) step(ctx *evalContext, n *Node, step *xpath.Step) (nodeSet, error) {
+	var nodes nodeSet
+
+	for _, candidate := range axisNodes(n, step.Axis) {
+		ok, err := t.nodeTest(candidate, step.Axis, step.Test)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			nodes = append(nodes, candidate)
+		}
+	}
+
+	for _, pred := range step.Predicates {
+		var err error
+
+		nodes, err = t.predicate(ctx, nodes, pred)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return nodes, nil
+}
+
+// axisNodes returns the nodes along the axis from the node n, in the order of the axis.
+// The reverse axes return their nodes in reverse document order.
+func axisNodes(n *Node, axis xpath.Axis) nodeSet {
+	switch axis {
+	case xpath.AxisSelf:
+		return nodeSet{n}
+
+	case xpath.AxisChild:
+		return n.Children
+
+	case xpath.AxisAttribute:
+		return n.Attrs
+
+	case xpath.AxisNamespace:
+		if n.Type != ElementNode {
+			return nil
+		}
+		return n.inScopeNamespaces()
+
+	case xpath.AxisParent:
+		if n.Parent == nil {
+			return nil
+		}
+		return nodeSet{n.Parent}
+
+	case xpath.AxisAncestor:
+		return ancestors(n.Parent)
+
+	case xpath.AxisAncestorOrSelf:
+		return ancestors(n)
+
+	case xpath.AxisDescendant:
+		return descendants(nil, n)
+
+	case xpath.AxisDescendantOrSelf:
+		return descendants(nodeSet{n}, n)
+
+	case xpath.AxisFollowingSibling:
+		if !isChild(n) {
+			return nil
+		}
+
+		siblings := n.Parent.Children
+		return siblings[indexOf(siblings, n)+1:]
+
+	case xpath.AxisPrecedingSibling:
+		if !isChild(n) {
+			return nil
+		}
+
+		siblings := n.Parent.Children
+		return reversed(siblings[:indexOf(siblings, n)])
+
+	case xpath.AxisFollowing:
+		var nodes nodeSet
+
+		if !isChild(n) && n.Parent != nil {
+			// The following nodes of an attribute or namespace node include the descendants of its element.
+			n = n.Parent
+			nodes = descendants(nodes, n)
+		}
+
+		for ; n != nil && n.Parent != nil; n = n.Parent {
+			siblings := n.Parent.Children
+			for _, sibling := range siblings[indexOf(siblings, n)+1:] {
+				nodes = append(nodes, sibling)
+				nodes = descendants(nodes, sibling)
+			}
+		}
+
+		return nodes
+
+	case xpath.AxisPreceding:
+		if !isChild(n) && n.Parent != nil {
+			n = n.Parent
+		}
+
+		var nodes nodeSet
+
+		for ; n != nil && n.Parent != nil; n = n.Parent {
+			siblings := n.Parent.Children
+			for _, sibling := range reversed(siblings[:indexOf(siblings, n)]) {
+				nodes = append(nodes, reversed(descendants(nil, sibling))...)
+				nodes = append(nodes, sibling)
+			}
+		}
+
+		return nodes
+	}
+
+	return nil
+}
+
+// isChild reports whether the node is a child of its parent, which attributes and namespace nodes are not.
+func isChild(n *Node) bool {
+	return n.Parent != nil && n.Type != AttributeNode && n.Type != NamespaceNode
+}
+
+func ancestors(n *Node) nodeSet {
+	var nodes nodeSet
+	for ; n != nil; n = n.Parent {
+		nodes = append(nodes, n)
+	}
+	return nodes
+}
+
+// descendants appends the descendants of the node n to the given nodes, in document order.
+func descendants(nodes nodeSet, n *Node) nodeSet {
+	for _, child := range n.Children {
+		nodes = append(nodes, child)
+		nodes = descendants(nodes, child)
+	}
+	return nodes
+}
+
+func reversed(nodes nodeSet) nodeSet {
+	out := make(nodeSet, len(nodes))
+	for i, n := range nodes {
+		out[len(nodes)-1-i] = n
+	}
+	return out
+}
+
+func indexOf(nodes nodeSet, n *Node) int {
+	for i, node := range nodes {
+		if node == n {
+			return i
+		}
+	}
+	return -1
+}
+
+func (t *transform) nodeTest(n *Node, axis xpath.Axis, test xpath.NodeTest) (bool, error) {
+	switch test := test.(type) {
+	case *xpath.TypeTest:
+		switch test.Type {
+		case "node":
+			return true, nil
+		case "text":
+			return n.Type == TextNode, nil
+		case "comment":
+			return n.Type == CommentNode, nil
+		case "processing-instruction":
+			if n.Type != ProcessingInstructionNode {
+				return false, nil
+			}
+			return test.Literal == nil || test.Literal.Value == n.Name.Local, nil
+		}
+
+		return false, fmt.Errorf("unknown node type test: %s", test)
+
+	case *xpath.NameTest:
+		principal := ElementNode
+		switch axis {
+		case xpath.AxisAttribute:
+			principal = AttributeNode
+		case xpath.AxisNamespace:
+			principal = NamespaceNode
+		}
+
+		if n.Type != principal {
+			return false, nil
+		}
+
+		name := test.Name
+		if name.Prefix == "" && name.Local == "*" {
+			return true, nil
+		}
+
+		var uri string
+		if name.Prefix != "" {
+			var err error
+			if uri, err = t.resolvePrefix(name.Prefix); err != nil {
+				return false, err
+			}
+		}
+
+		if principal == NamespaceNode {
+			// The expanded name of a namespace node has a null namespace URI.
+			return uri == "" && (name.Local == "*" || name.Local == n.Name.Local), nil
+		}
+
+		return n.Name.Space == uri && (name.Local == "*" || name.Local == n.Name.Local), nil
+	}
+
+	return false, fmt.Errorf("unknown node test: %v", test)
+}
@@ -0,0 +1,478 @@
+package engine
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/puellanivis/lxt/xslt"
+)
+
+// execBody executes the body of an instruction or template.
+// The frame is taken by value, so that any variables bound within the body are not visible outside of it.
+func (t *transform) execBody(f frame, body interface{}, out *Node) error {
+	return t.exec(&f, body, out)
+}
+
+// exec executes a single instruction, appending its result to the out node.
+// An xsl:variable binds its value into the given frame, to be seen by the following instructions.
+func (t *transform) exec(f *frame, instr interface{}, out *Node) error {
+	switch n := instr.(type) {
+	case nil:
+		return nil
+
+	case xslt.Group:
+		for _, child := range n {
+			if err := t.exec(f, child, out); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case *xslt.Comment:
+		// A comment in the stylesheet does not produce any output.
+		return nil
+
+	case *xslt.Text:
+		out.appendChild(&Node{
+			Type:     TextNode,
+			Data:     n.Body,
+			noEscape: isYes(n.DisableOutputEscaping),
+		})
+		return nil
+
+	case *xslt.ValueOf:
+		s, err := t.evalString(f, n.Select)
+		if err != nil {
+			return fmt.Errorf("value-of select=%q: %w", n.Select, err)
+		}
+
+		out.appendChild(&Node{
+			Type:     TextNode,
+			Data:     s,
+			noEscape: isYes(n.DisableOutputEscaping),
+		})
+		return nil
+
+	case *xslt.CopyOf:
+		v, err := t.evalXPath(f, n.Select)
+		if err != nil {
+			return fmt.Errorf("copy-of select=%q: %w", n.Select, err)
+		}
+
+		return copyOf(v, out)
+
+	case *xslt.Variable:
+		val, err := t.variableValue(f, n.Select, n.Value)
+		if err != nil {
+			return fmt.Errorf("variable $%s: %w", n.Name, err)
+		}
+
+		f.vars = f.vars.bind(n.Name, val)
+		return nil
+
+	case *xslt.Param:
+		val, err := t.variableValue(f, n.Select, n.Value)
+		if err != nil {
+			return fmt.Errorf("param $%s: %w", n.Name, err)
+		}
+
+		f.vars = f.vars.bind(n.Name, val)
+		return nil
+
+	case *xslt.EXSLTResult:
+		if f.result == nil {
+			return errors.New("func:result is only allowed within a func:function")
+		}
+
+		if f.result.set {
+			return errors.New("func:function has more than one func:result")
+		}
+
+		val, err := t.variableValue(f, n.Select, nil)
+		if err != nil {
+			return fmt.Errorf("func:result select=%q: %w", n.Select, err)
+		}
+
+		f.result.val, f.result.set = val, true
+		return nil
+
+	case *xslt.If:
+		v, err := t.evalXPath(f, n.Test)
+		if err != nil {
+			return fmt.Errorf("if test=%q: %w", n.Test, err)
+		}
+
+		if toBool(v) {
+			return t.execBody(*f, n.Body, out)
+		}
+		return nil
+
+	case *xslt.Choose:
+		for _, when := range n.Whens {
+			v, err := t.evalXPath(f, when.Test)
+			if err != nil {
+				return fmt.Errorf("when test=%q: %w", when.Test, err)
+			}
+
+			if toBool(v) {
+				return t.execBody(*f, when.Body, out)
+			}
+		}
+
+		if n.Otherwise != nil {
+			return t.execBody(*f, n.Otherwise.Body, out)
+		}
+		return nil
+
+	case *xslt.ForEach:
+		return t.forEach(f, n, out)
+
+	case *xslt.ApplyTemplates:
+		return t.execApplyTemplates(f, n, out)
+
+	case *xslt.CallTemplate:
+		tmpl, ok := t.named[n.Name]
+		if !ok {
+			return fmt.Errorf("call-template: no template named %q", n.Name)
+		}
+
+		params, err := t.withParams(f, n.WithParams)
+		if err != nil {
+			return fmt.Errorf("call-template name=%q: %w", n.Name, err)
+		}
+
+		t.depth++
+		defer func() { t.depth-- }()
+
+		if t.depth > maxDepth {
+			return fmt.Errorf("call-template name=%q: too many nested templates, possibly infinite recursion", n.Name)
+		}
+
+		if err := t.invoke(&frame{
+			node: f.node,
+			pos:  f.pos,
+			size: f.size,
+			mode: f.mode,
+		}, tmpl, params, out); err != nil {
+			return fmt.Errorf("template name=%q: %w", n.Name, err)
+		}
+		return nil
+
+	case *xslt.Element:
+		return t.element(f, n, out)
+
+	case *xslt.LiteralElement:
+		// The name of a literal result element contains no braces, so it is its own attribute value template.
+		return t.element(f, &xslt.Element{
+			Name: n.Name,
+			Body: xslt.Group{n.Attrs, n.Body},
+		}, out)
+
+	case *xslt.Attribute:
+		return t.attribute(f, n, out)
+
+	case []*xslt.Attribute:
+		for _, attr := range n {
+			if err := t.attribute(f, attr, out); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unsupported instruction: %T", instr)
+}
+
+func (t *transform) forEach(f *frame, n *xslt.ForEach, out *Node) error {
+	nodes, err := t.evalNodes(f, n.Select)
+	if err != nil {
+		return fmt.Errorf("for-each select=%q: %w", n.Select, err)
+	}
+
+	nodes, err = t.sortNodes(f, nodes, n.Sort)
+	if err != nil {
+		return fmt.Errorf("for-each select=%q: %w", n.Select, err)
+	}
+
+	for i, node := range nodes {
+		if err := t.ctx.Err(); err != nil {
+			return err
+		}
+
+		body := frame{
+			node: node,
+			pos:  i + 1,
+			size: len(nodes),
+			mode: f.mode,
+			vars: f.vars,
+		}
+
+		if err := t.execBody(body, n.Body, out); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (t *transform) execApplyTemplates(f *frame, n *xslt.ApplyTemplates, out *Node) error {
+	sel := n.Select
+	if sel == "" {
+		sel = "node()"
+	}
+
+	nodes, err := t.evalNodes(f, sel)
+	if err != nil {
+		return fmt.Errorf("apply-templates select=%q: %w", sel, err)
+	}
+
+	nodes, err = t.sortNodes(f, nodes, n.Sort)
+	if err != nil {
+		return fmt.Errorf("apply-templates select=%q: %w", sel, err)
+	}
+
+	params, err := t.withParams(f, n.WithParams)
+	if err != nil {
+		return fmt.Errorf("apply-templates select=%q: %w", sel, err)
+	}
+
+	return t.applyTemplates(nodes, n.Mode, params, out)
+}
+
+// splitQName splits the name into its prefix and local name.
+func splitQName(name string) (string, string, error) {
+	prefix, local := "", name
+	if i := strings.IndexByte(name, ':'); i >= 0 {
+		prefix, local = name[:i], name[i+1:]
+	}
+
+	if local == "" || strings.ContainsAny(local, ": \t\r\n") {
+		return "", "", fmt.Errorf("invalid name %q", name)
+	}
+
+	return prefix, local, nil
+}
+
+// qname resolves the QName of a result element or attribute, against the namespaces of the stylesheet.
+func (t *transform) qname(name string) (string, xml.Name, error) {
+	prefix, local, err := splitQName(name)
+	if err != nil {
+		return "", xml.Name{}, err
+	}
+
+	var uri string
+	if prefix != "" {
+		if uri, err = t.resolvePrefix(prefix); err != nil {
+			return "", xml.Name{}, err
+		}
+	}
+
+	return prefix, xml.Name{Space: uri, Local: local}, nil
+}
+
+// computedName evaluates the name and namespace of an xsl:element or xsl:attribute,
+// returning the name, and its prefix and expanded name.
+// Without a namespace, the prefix of the name is resolved against the namespaces of the stylesheet.
+func (t *transform) computedName(f *frame, name, namespace string, attr bool) (string, string, xml.Name, error) {
+	name, err := t.avt(f, name)
+	if err != nil {
+		return "", "", xml.Name{}, err
+	}
+
+	if namespace == "" {
+		prefix, qname, err := t.qname(name)
+		return name, prefix, qname, err
+	}
+
+	uri, err := t.avt(f, namespace)
+	if err != nil {
+		return "", "", xml.Name{}, err
+	}
+
+	prefix, local, err := splitQName(name)
+	if err != nil {
+		return "", "", xml.Name{}, err
+	}
+
+	switch {
+	case uri == "":
+		prefix = ""
+
+	case attr && prefix == "":
+		// An attribute is only in a namespace through a prefix, so one is made up.
+		prefix = "ns0"
+	}
+
+	return name, prefix, xml.Name{Space: uri, Local: local}, nil
+}
+
+func (t *transform) element(f *frame, n *xslt.Element, out *Node) error {
+	name, prefix, qname, err := t.computedName(f, n.Name, n.Namespace, false)
+	if err != nil {
+		return fmt.Errorf("element name=%q: %w", n.Name, err)
+	}
+
+	elem := &Node{
+		Type:   ElementNode,
+		Prefix: prefix,
+		Name:   qname,
+	}
+	out.appendChild(elem)
+
+	if err := t.execBody(*f, n.Body, elem); err != nil {
+		return fmt.Errorf("element %s: %w", name, err)
+	}
+
+	return nil
+}
+
+func (t *transform) attribute(f *frame, n *xslt.Attribute, out *Node) error {
+	name, prefix, qname, err := t.computedName(f, n.Name, n.Namespace, true)
+	if err != nil {
+		return fmt.Errorf("attribute name=%q: %w", n.Name, err)
+	}
+
+	if out.Type != ElementNode {
+		return fmt.Errorf("attribute %s: not within an element", name)
+	}
+
+	if len(out.Children) > 0 {
+		return fmt.Errorf("attribute %s: added after the children of element %s", name, out.QName())
+	}
+
+	val, err := t.fragment(f, n.Value)
+	if err != nil {
+		return fmt.Errorf("attribute %s: %w", name, err)
+	}
+
+	out.setAttr(&Node{
+		Type:   AttributeNode,
+		Prefix: prefix,
+		Name:   qname,
+		Data:   toString(val),
+	})
+	return nil
+}
+
+// isYes reports whether an optional yes/no attribute is set to yes.
+func isYes(b *xslt.BoolVal) bool {
+	return b != nil && bool(*b)
+}
+
+// copyOf copies the value into the out node, as by xsl:copy-of.
+func copyOf(v value, out *Node) error {
+	nodes, ok := v.(nodeSet)
+	if !ok {
+		out.appendChild(&Node{
+			Type: TextNode,
+			Data: toString(v),
+		})
+		return nil
+	}
+
+	for _, n := range nodes {
+		switch n.Type {
+		case RootNode:
+			for _, child := range n.Children {
+				out.appendChild(deepCopy(child))
+			}
+
+		case AttributeNode:
+			if out.Type != ElementNode {
+				return fmt.Errorf("copy-of: attribute %s is not within an element", n.QName())
+			}
+			out.setAttr(deepCopy(n))
+
+		case NamespaceNode:
+			if out.Type == ElementNode {
+				out.Namespaces = append(out.Namespaces, deepCopy(n))
+			}
+
+		default:
+			out.appendChild(deepCopy(n))
+		}
+	}
+
+	return nil
+}
+
+// deepCopy returns a copy of the node and all of its descendants, without a parent.
+func deepCopy(n *Node) *Node {
+	c := &Node{
+		Type:     n.Type,
+		Name:     n.Name,
+		Prefix:   n.Prefix,
+		Data:     n.Data,
+		noEscape: n.noEscape,
+	}
+
+	if n.Type == ElementNode {
+		// Copy the namespaces in scope, so that the copy keeps the same namespace declarations.
+		for _, ns := range n.inScopeNamespaces() {
+			c.Namespaces = append(c.Namespaces, &Node{
+				Type:   NamespaceNode,
+				Name:   ns.Name,
+				Data:   ns.Data,
+				Parent: c,
+			})
+		}
+	}
+
+	for _, attr := range n.Attrs {
+		c.setAttr(deepCopy(attr))
+	}
+
+	for _, child := range n.Children {
+		c.appendChild(deepCopy(child))
+	}
+
+	return c
+}
+
+// avt evaluates an attribute value template.
+func (t *transform) avt(f *frame, s string) (string, error) {
+	if !strings.ContainsAny(s, "{}") {
+		return s, nil
+	}
+
+	var b strings.Builder
+
+	for i := 0; i < len(s); {
+		c := s[i]
+
+		switch {
+		case c == '{' && strings.HasPrefix(s[i:], "{{"):
+			b.WriteByte('{')
+			i += 2
+
+		case c == '}' && strings.HasPrefix(s[i:], "}}"):
+			b.WriteByte('}')
+			i += 2
+
+		case c == '{':
+			end := xslt.AVTExprEnd(s, i+1)
+			if end < 0 {
+				return "", fmt.Errorf("unterminated expression in attribute value template %q", s)
+			}
+
+			v, err := t.evalString(f, s[i+1:end])
+			if err != nil {
+				return "", err
+			}
+
+			b.WriteString(v)
+			i = end + 1
+
+		case c == '}':
+			return "", fmt.Errorf("unmatched '}' in attribute value template %q", s)
+
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,565 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/puellanivis/lxt/xpath"
+)
+
+// function implements an XPath function, called with its evaluated arguments.
+type function struct {
+	minArgs, maxArgs int // maxArgs < 0 means no maximum.
+
+	fn func(t *transform, ctx *evalContext, args []value) (value, error)
+}
+
+// functions is the core function library of XPath 1.0, along with the additional functions of XSLT 1.0.
+var functions map[string]function
+
+func init() {
+	functions = map[string]function{
+		// Node-set functions.
+		"last": {0, 0, func(_ *transform, ctx *evalContext, _ []value) (value, error) {
+			return float64(ctx.size), nil
+		}},
+		"position": {0, 0, func(_ *transform, ctx *evalContext, _ []value) (value, error) {
+			return float64(ctx.pos), nil
+		}},
+		"count": {1, 1, func(_ *transform, _ *evalContext, args []value) (value, error) {
+			nodes, err := argNodeSet("count", args[0])
+			if err != nil {
+				return nil, err
+			}
+			return float64(len(nodes)), nil
+		}},
+		"id":            {1, 1, fnID},
+		"local-name":    {0, 1, nameFunction("local-name", func(n *Node) string { return n.Name.Local })},
+		"namespace-uri": {0, 1, nameFunction("namespace-uri", func(n *Node) string { return n.Name.Space })},
+		"name":          {0, 1, nameFunction("name", func(n *Node) string { return n.QName() })},
+
+		// String functions.
+		"string": {0, 1, func(_ *transform, ctx *evalContext, args []value) (value, error) {
+			return toString(contextArg(ctx, args)), nil
+		}},
+		"concat": {2, -1, func(_ *transform, _ *evalContext, args []value) (value, error) {
+			var b strings.Builder
+			for _, arg := range args {
+				b.WriteString(toString(arg))
+			}
+			return b.String(), nil
+		}},
+		"starts-with": {2, 2, func(_ *transform, _ *evalContext, args []value) (value, error) {
+			return strings.HasPrefix(toString(args[0]), toString(args[1])), nil
+		}},
+		"contains": {2, 2, func(_ *transform, _ *evalContext, args []value) (value, error) {
+			return strings.Contains(toString(args[0]), toString(args[1])), nil
+		}},
+		"substring-before": {2, 2, func(_ *transform, _ *evalContext, args []value) (value, error) {
+			s, sep := toString(args[0]), toString(args[1])
+			if i := strings.Index(s, sep); i >= 0 {
+				return s[:i], nil
+			}
+			return "", nil
+		}},
+		"substring-after": {2, 2, func(_ *transform, _ *evalContext, args []value) (value, error) {
+			s, sep := toString(args[0]), toString(args[1])
+			if i := strings.Index(s, sep); i >= 0 {
+				return s[i+len(sep):], nil
+			}
+			return "", nil
+		}},
+		"substring": {2, 3, fnSubstring},
+		"string-length": {0, 1, func(_ *transform, ctx *evalContext, args []value) (value, error) {
+			return float64(utf8.RuneCountInString(toString(contextArg(ctx, args)))), nil
+		}},
+		"normalize-space": {0, 1, func(_ *transform, ctx *evalContext, args []value) (value, error) {
+			return strings.Join(strings.Fields(toString(contextArg(ctx, args))), " "), nil
+		}},
+		"translate": {3, 3, fnTranslate},
+
+		// Boolean functions.
+		"boolean": {1, 1, func(_ *transform, _ *evalContext, args []value) (value, error) {
+			return toBool(args[0]), nil
+		}},
+		"not": {1, 1, func(_ *transform, _ *evalContext, args []value) (value, error) {
+			return !toBool(args[0]), nil
+		}},
+		"true": {0, 0, func(_ *transform, _ *evalContext, _ []value) (value, error) {
+			return true, nil
+		}},
+		"false": {0, 0, func(_ *transform, _ *evalContext, _ []value) (value, error) {
+			return false, nil
+		}},
+		"lang": {1, 1, fnLang},
+
+		// Number functions.
+		"number": {0, 1, func(_ *transform, ctx *evalContext, args []value) (value, error) {
+			return toNumber(contextArg(ctx, args)), nil
+		}},
+		"sum": {1, 1, func(_ *transform, _ *evalContext, args []value) (value, error) {
+			nodes, err := argNodeSet("sum", args[0])
+			if err != nil {
+				return nil, err
+			}
+
+			var sum float64
+			for _, n := range nodes {
+				sum += stringNumber(n.StringValue())
+			}
+			return sum, nil
+		}},
+		"floor": {1, 1, func(_ *transform, _ *evalContext, args []value) (value, error) {
+			return math.Floor(toNumber(args[0])), nil
+		}},
+		"ceiling": {1, 1, func(_ *transform, _ *evalContext, args []value) (value, error) {
+			return math.Ceil(toNumber(args[0])), nil
+		}},
+		"round": {1, 1, func(_ *transform, _ *evalContext, args []value) (value, error) {
+			return round(toNumber(args[0])), nil
+		}},
+
+		// XSLT functions.
+		"current": {0, 0, func(_ *transform, ctx *evalContext, _ []value) (value, error) {
+			return nodeSet{ctx.current}, nil
+		}},
+		"generate-id": {0, 1, func(_ *transform, ctx *evalContext, args []value) (value, error) {
+			n, err := firstNode("generate-id", ctx, args)
+			if err != nil || n == nil {
+				return "", err
+			}
+			return "id" + strconv.Itoa(n.order), nil
+		}},
+		"key": {2, 2, fnKey},
+		"format-number": {2, 3, func(_ *transform, _ *evalContext, args []value) (value, error) {
+			if len(args) > 2 {
+				return nil, fmt.Errorf("format-number(): named decimal formats are not supported")
+			}
+			return formatNumber(toNumber(args[0]), toString(args[1]))
+		}},
+		"unparsed-entity-uri": {1, 1, func(_ *transform, _ *evalContext, _ []value) (value, error) {
+			return "", nil
+		}},
+		"system-property":    {1, 1, fnSystemProperty},
+		"element-available":  {1, 1, fnElementAvailable},
+		"function-available": {1, 1, fnFunctionAvailable},
+		"document": {1, 2, func(_ *transform, _ *evalContext, _ []value) (value, error) {
+			return nil, fmt.Errorf("document() is not supported")
+		}},
+	}
+}
+
+func (t *transform) call(ctx *evalContext, x *xpath.FunctionCall) (value, error) {
+	name := x.Name.String()
+
+	if x.Name.Prefix != "" {
+		return t.callFunc(ctx, x)
+	}
+
+	f, ok := functions[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown function: %s()", name)
+	}
+
+	if len(x.Args) < f.minArgs || (f.maxArgs >= 0 && len(x.Args) > f.maxArgs) {
+		return nil, fmt.Errorf("%s(): wrong number of arguments: %d", name, len(x.Args))
+	}
+
+	args := make([]value, len(x.Args))
+	for i, arg := range x.Args {
+		v, err := t.eval(ctx, arg)
+		if err != nil {
+			return nil, err
+		}
+
+		args[i] = v
+	}
+
+	return f.fn(t, ctx, args)
+}
+
+// funcResult is the result of an EXSLT function, given by its func:result.
+type funcResult struct {
+	val value
+	set bool
+}
+
+// callFunc calls an EXSLT function declared by the stylesheet.
+//
+// The function is executed with the context of the call, but sees only global variables, and its own parameters.
+// Parameters without an argument take their default values, and the function returns its func:result,
+// or an empty string if it has none.
+func (t *transform) callFunc(ctx *evalContext, x *xpath.FunctionCall) (value, error) {
+	name := x.Name.String()
+
+	uri, ok := t.namespaces[x.Name.Prefix]
+	if !ok {
+		return nil, fmt.Errorf("%s(): undeclared namespace prefix %q", name, x.Name.Prefix)
+	}
+
+	fn, ok := t.funcs[expandedName(uri, x.Name.Local)]
+	if !ok {
+		return nil, fmt.Errorf("unknown function: %s()", name)
+	}
+
+	if len(x.Args) > len(fn.Params) {
+		return nil, fmt.Errorf("%s(): wrong number of arguments: %d", name, len(x.Args))
+	}
+
+	t.depth++
+	defer func() { t.depth-- }()
+
+	if t.depth > maxDepth {
+		return nil, errors.New("too many nested function calls, possibly infinite recursion")
+	}
+
+	result := new(funcResult)
+
+	f := &frame{
+		node:   ctx.node,
+		pos:    ctx.pos,
+		size:   ctx.size,
+		result: result,
+	}
+
+	for i, param := range fn.Params {
+		var val value
+
+		if i < len(x.Args) {
+			var err error
+			if val, err = t.eval(ctx, x.Args[i]); err != nil {
+				return nil, err
+			}
+		} else {
+			var err error
+			if val, err = t.variableValue(f, param.Select, param.Value); err != nil {
+				return nil, fmt.Errorf("%s(): param $%s: %w", name, param.Name, err)
+			}
+		}
+
+		f.vars = f.vars.bind(param.Name, val)
+	}
+
+	// Any output of the function outside of its func:result is discarded.
+	discard := &Node{
+		Type: RootNode,
+	}
+
+	if err := t.execBody(*f, fn.Body, discard); err != nil {
+		return nil, fmt.Errorf("%s(): %w", name, err)
+	}
+
+	if !result.set {
+		return "", nil
+	}
+
+	return result.val, nil
+}
+
+// contextArg returns the first argument, or else a node-set of the context node.
+func contextArg(ctx *evalContext, args []value) value {
+	if len(args) > 0 {
+		return args[0]
+	}
+
+	return nodeSet{ctx.node}
+}
+
+func argNodeSet(name string, arg value) (nodeSet, error) {
+	nodes, ok := arg.(nodeSet)
+	if !ok {
+		return nil, fmt.Errorf("%s(): expected a node-set argument, found %s", name, typeName(arg))
+	}
+
+	return nodes, nil
+}
+
+// firstNode returns the first node of the node-set argument, or the context node if there is no argument.
+// If the node-set is empty, it returns nil.
+func firstNode(name string, ctx *evalContext, args []value) (*Node, error) {
+	nodes, err := argNodeSet(name, contextArg(ctx, args))
+	if err != nil || len(nodes) == 0 {
+		return nil, err
+	}
+
+	return nodes[0], nil
+}
+
+func nameFunction(name string, fn func(n *Node) string) func(*transform, *evalContext, []value) (value, error) {
+	return func(_ *transform, ctx *evalContext, args []value) (value, error) {
+		n, err := firstNode(name, ctx, args)
+		if err != nil || n == nil {
+			return "", err
+		}
+
+		switch n.Type {
+		case ElementNode, AttributeNode, NamespaceNode, ProcessingInstructionNode:
+			return fn(n), nil
+		}
+
+		return "", nil
+	}
+}
+
+func fnID(_ *transform, ctx *evalContext, args []value) (value, error) {
+	var ids []string
+
+	if nodes, ok := args[0].(nodeSet); ok {
+		for _, n := range nodes {
+			ids = append(ids, strings.Fields(n.StringValue())...)
+		}
+	} else {
+		ids = strings.Fields(toString(args[0]))
+	}
+
+	want := make(map[string]bool)
+	for _, id := range ids {
+		want[id] = true
+	}
+
+	// Without a DTD, the attributes named `id` and `xml:id` are taken to be of type ID.
+	var found nodeSet
+	for _, n := range descendants(nil, ctx.node.root()) {
+		for _, attr := range n.Attrs {
+			if attr.Name.Local == "id" && (attr.Name.Space == "" || attr.Name.Space == nsXML) && want[attr.Data] {
+				found = append(found, n)
+				break
+			}
+		}
+	}
+
+	return found, nil
+}
+
+func fnSubstring(_ *transform, _ *evalContext, args []value) (value, error) {
+	runes := []rune(toString(args[0]))
+
+	start := round(toNumber(args[1]))
+	end := math.Inf(1)
+	if len(args) > 2 {
+		end = start + round(toNumber(args[2]))
+	}
+
+	var b strings.Builder
+	for i, r := range runes {
+		if pos := float64(i + 1); pos >= start && pos < end {
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String(), nil
+}
+
+func fnTranslate(_ *transform, _ *evalContext, args []value) (value, error) {
+	from, to := []rune(toString(args[1])), []rune(toString(args[2]))
+
+	mapping := make(map[rune]rune)
+	for i, r := range from {
+		if _, ok := mapping[r]; ok {
+			continue
+		}
+
+		if i < len(to) {
+			mapping[r] = to[i]
+		} else {
+			mapping[r] = -1
+		}
+	}
+
+	return strings.Map(func(r rune) rune {
+		if m, ok := mapping[r]; ok {
+			return m
+		}
+		return r
+	}, toString(args[0])), nil
+}
+
+func fnLang(_ *transform, ctx *evalContext, args []value) (value, error) {
+	want := strings.ToLower(toString(args[0]))
+
+	for n := ctx.node; n != nil; n = n.Parent {
+		for _, attr := range n.Attrs {
+			if attr.Name.Space != nsXML || attr.Name.Local != "lang" {
+				continue
+			}
+
+			lang := strings.ToLower(attr.Data)
+			return lang == want || strings.HasPrefix(lang, want+"-"), nil
+		}
+	}
+
+	return false, nil
+}
+
+func fnSystemProperty(_ *transform, _ *evalContext, args []value) (value, error) {
+	switch toString(args[0]) {
+	case "xsl:version":
+		return 1.0, nil
+	case "xsl:vendor":
+		return "lxt", nil
+	case "xsl:vendor-url":
+		return "https://github.com/puellanivis/lxt", nil
+	}
+
+	return "", nil
+}
+
+// instructions are the XSLT instructions supported by the processor.
+var instructions = map[string]bool{
+	"xsl:apply-templates": true,
+	"xsl:attribute":       true,
+	"xsl:call-template":   true,
+	"xsl:choose":          true,
+	"xsl:copy-of":         true,
+	"xsl:element":         true,
+	"xsl:for-each":        true,
+	"xsl:if":              true,
+	"xsl:text":            true,
+	"xsl:value-of":        true,
+	"xsl:variable":        true,
+}
+
+func fnElementAvailable(_ *transform, _ *evalContext, args []value) (value, error) {
+	return instructions[toString(args[0])], nil
+}
+
+func fnFunctionAvailable(t *transform, _ *evalContext, args []value) (value, error) {
+	name := toString(args[0])
+
+	if prefix, local, ok := strings.Cut(name, ":"); ok {
+		uri, ok := t.namespaces[prefix]
+		if !ok {
+			return false, nil
+		}
+
+		_, ok = t.funcs[expandedName(uri, local)]
+		return ok, nil
+	}
+
+	_, ok := functions[name]
+	return ok, nil
+}
+
+// round implements the XPath round() function, which rounds halves towards positive infinity.
+func round(f float64) float64 {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return f
+	}
+
+	if f < 0 && f >= -0.5 {
+		return math.Copysign(0, -1)
+	}
+
+	return math.Floor(f + 0.5)
+}
+
+// formatNumber implements a subset of the format-number() function,
+// supporting the default decimal format, grouping, minimum and maximum digits, percent, and per-mille.
+func formatNumber(f float64, pattern string) (string, error) {
+	if math.IsNaN(f) {
+		return "NaN", nil
+	}
+
+	sub := pattern
+	neg := ""
+	if i := strings.IndexByte(pattern, ';'); i >= 0 {
+		sub, neg = pattern[:i], pattern[i+1:]
+	}
+
+	if f < 0 || math.Signbit(f) {
+		f = -f
+
+		if neg == "" {
+			// The default negative subpattern is the positive subpattern preceded by a minus sign.
+			neg = "-" + sub
+		}
+
+		sub = neg
+	}
+
+	prefix, digits, suffix := splitPattern(sub)
+	if digits == "" {
+		return "", fmt.Errorf("format-number(): invalid pattern %q", pattern)
+	}
+
+	switch {
+	case strings.ContainsRune(prefix+suffix, '%'):
+		f *= 100
+	case strings.ContainsRune(prefix+suffix, '‰'):
+		f *= 1000
+	}
+
+	if math.IsInf(f, 0) {
+		return prefix + "Infinity" + suffix, nil
+	}
+
+	intPattern, fracPattern := digits, ""
+	if i := strings.IndexByte(digits, '.'); i >= 0 {
+		intPattern, fracPattern = digits[:i], digits[i+1:]
+	}
+
+	minInt := strings.Count(intPattern, "0")
+	minFrac := strings.Count(fracPattern, "0")
+	maxFrac := minFrac + strings.Count(fracPattern, "#")
+
+	grouping := 0
+	if i := strings.LastIndexByte(intPattern, ','); i >= 0 {
+		grouping = len(intPattern) - i - 1
+	}
+
+	s := strconv.FormatFloat(f, 'f', maxFrac, 64)
+
+	intPart, fracPart := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		intPart, fracPart = s[:i], s[i+1:]
+	}
+
+	for len(fracPart) > minFrac && strings.HasSuffix(fracPart, "0") {
+		fracPart = fracPart[:len(fracPart)-1]
+	}
+
+	intPart = strings.TrimLeft(intPart, "0")
+	for len(intPart) < minInt {
+		intPart = "0" + intPart
+	}
+
+	if grouping > 0 {
+		var b strings.Builder
+		for i, c := range intPart {
+			if i > 0 && (len(intPart)-i)%grouping == 0 {
+				b.WriteByte(',')
+			}
+			b.WriteRune(c)
+		}
+		intPart = b.String()
+	}
+
+	if fracPart != "" {
+		intPart += "." + fracPart
+	}
+
+	if intPart == "" {
+		intPart = "0"
+	}
+
+	return prefix + intPart + suffix, nil
+}
+
+// splitPattern splits a format-number() subpattern into its prefix, digits, and suffix.
+func splitPattern(pattern string) (prefix, digits, suffix string) {
+	start := strings.IndexAny(pattern, "#0,.")
+	if start < 0 {
+		return pattern, "", ""
+	}
+
+	end := start
+	for end < len(pattern) && strings.IndexByte("#0,.", pattern[end]) >= 0 {
+		end++
+	}
+
+	return pattern[:start], pattern[start:end], pattern[end:]
+}
@@ -0,0 +1,134 @@
+package engine
+
+import (
+	"fmt"
+
+	"github.com/puellanivis/lxt/xpath"
+	"github.com/puellanivis/lxt/xslt"
+)
+
+// key is a single xsl:key declaration.
+// Several declarations may share the same name, in which case key() looks up the nodes indexed by any of them.
+type key struct {
+	patterns []xpath.Expr // the alternatives of the match pattern
+	use      xpath.Expr
+}
+
+// declareKey compiles the key declaration.
+func (p *Processor) declareKey(decl *xslt.Key) error {
+	pattern, err := xpath.ParsePattern(decl.Match)
+	if err != nil {
+		return fmt.Errorf("key %q match=%q: %w", decl.Name, decl.Match, err)
+	}
+
+	use, err := xpath.Parse(decl.Use)
+	if err != nil {
+		return fmt.Errorf("key %q use=%q: %w", decl.Name, decl.Use, err)
+	}
+
+	p.keys[decl.Name] = append(p.keys[decl.Name], &key{
+		patterns: alternatives(pattern),
+		use:      use,
+	})
+	return nil
+}
+
+// keyIndex maps each value of the use expression of a key to the nodes of a document having that value.
+type keyIndex map[string]nodeSet
+
+// keyIndex returns the index of the named key for the document with the given root node, building it if necessary.
+func (t *transform) keyIndex(name string, root *Node) (keyIndex, error) {
+	if index, ok := t.keyIndexes[root][name]; ok {
+		return index, nil
+	}
+
+	keys, ok := t.keys[name]
+	if !ok {
+		return nil, fmt.Errorf("key(): no key named %q is declared", name)
+	}
+
+	index := make(keyIndex)
+
+	add := func(n *Node) error {
+		ctx := t.evalContext(&frame{
+			node: n,
+			pos:  1,
+			size: 1,
+		})
+
+		for _, k := range keys {
+			matched := false
+
+			for _, pattern := range k.patterns {
+				ok, err := t.matches(ctx, n, pattern)
+				if err != nil {
+					return fmt.Errorf("key %q: %w", name, err)
+				}
+
+				if ok {
+					matched = true
+					break
+				}
+			}
+
+			if !matched {
+				continue
+			}
+
+			val, err := t.eval(ctx, k.use)
+			if err != nil {
+				return fmt.Errorf("key %q: %w", name, err)
+			}
+
+			if nodes, ok := val.(nodeSet); ok {
+				for _, v := range nodes {
+					index[v.StringValue()] = append(index[v.StringValue()], n)
+				}
+				continue
+			}
+
+			index[toString(val)] = append(index[toString(val)], n)
+		}
+
+		return nil
+	}
+
+	for _, n := range append(nodeSet{root}, descendants(nil, root)...) {
+		if err := add(n); err != nil {
+			return nil, err
+		}
+
+		for _, attr := range n.Attrs {
+			if err := add(attr); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if t.keyIndexes[root] == nil {
+		t.keyIndexes[root] = make(map[string]keyIndex)
+	}
+	t.keyIndexes[root][name] = index
+
+	return index, nil
+}
+
+// fnKey implements the key() function of XSLT 1.0, which looks up nodes of the context document by a declared key.
+func fnKey(t *transform, ctx *evalContext, args []value) (value, error) {
+	index, err := t.keyIndex(toString(args[0]), ctx.node.root())
+	if err != nil {
+		return nil, err
+	}
+
+	var found nodeSet
+
+	if nodes, ok := args[1].(nodeSet); ok {
+		for _, n := range nodes {
+			found = append(found, index[n.StringValue()]...)
+		}
+	} else {
+		found = append(found, index[toString(args[1])]...)
+	}
+
+	return docOrder(found), nil
+}
@@ -0,0 +1,169 @@
+package engine
+
+import (
+	"github.com/puellanivis/lxt/xpath"
+	"github.com/puellanivis/lxt/xslt"
+)
+
+// rule is a single alternative of the match pattern of a template.
+type rule struct {
+	tmpl     *xslt.Template
+	pattern  xpath.Expr
+	priority float64
+
+	// order is the position of the template in the stylesheet, later templates take precedence.
+	order int
+}
+
+// alternatives splits a pattern into its alternatives, separated by `|`.
+func alternatives(pattern xpath.Expr) []xpath.Expr {
+	if x, ok := pattern.(*xpath.BinaryExpr); ok && x.Op == "|" {
+		return append(alternatives(x.X), alternatives(x.Y)...)
+	}
+
+	return []xpath.Expr{pattern}
+}
+
+// defaultPriority returns the default priority of a pattern alternative, as by XSLT 1.0, section 5.5.
+func defaultPriority(pattern xpath.Expr) float64 {
+	path, ok := pattern.(*xpath.LocationPath)
+	if !ok || path.Absolute || len(path.Steps) != 1 {
+		return 0.5
+	}
+
+	step := path.Steps[0]
+	if len(step.Predicates) > 0 {
+		return 0.5
+	}
+
+	switch test := step.Test.(type) {
+	case *xpath.NameTest:
+		switch {
+		case test.Name.Local != "*":
+			return 0
+		case test.Name.Prefix != "":
+			return -0.25
+		}
+
+	case *xpath.TypeTest:
+		if test.Literal != nil {
+			return 0
+		}
+	}
+
+	return -0.5
+}
+
+// matches reports whether the node matches the pattern alternative.
+func (t *transform) matches(ctx *evalContext, n *Node, pattern xpath.Expr) (bool, error) {
+	switch x := pattern.(type) {
+	case *xpath.LocationPath:
+		return t.matchSteps(ctx, n, x.Steps, func(n *Node) (bool, error) {
+			return !x.Absolute || n.Type == RootNode, nil
+		})
+
+	case *xpath.FunctionCall:
+		return t.inResult(ctx, n, x)
+
+	case *xpath.PathExpr:
+		return t.matchSteps(ctx, n, x.Path.Steps, func(n *Node) (bool, error) {
+			return t.inResult(ctx, n, x.Filter)
+		})
+	}
+
+	return false, nil
+}
+
+// inResult reports whether the node is in the node-set resulting from the expression.
+func (t *transform) inResult(ctx *evalContext, n *Node, expr xpath.Expr) (bool, error) {
+	c := *ctx
+	c.node, c.pos, c.size = n, 1, 1
+
+	nodes, err := t.evalNodeSet(&c, expr)
+	if err != nil {
+		return false, err
+	}
+
+	return indexOf(nodes, n) >= 0, nil
+}
+
+// matchSteps reports whether the node n would be selected by the steps,
+// from a context node for which start returns true.
+func (t *transform) matchSteps(ctx *evalContext, n *Node, steps []*xpath.Step, start func(*Node) (bool, error)) (bool, error) {
+	if len(steps) == 0 {
+		return start(n)
+	}
+
+	last, rest := steps[len(steps)-1], steps[:len(steps)-1]
+
+	if last.Axis == xpath.AxisDescendantOrSelf {
+		// This is a `//`, so the remaining steps must select the node, or any of its ancestors.
+		for a := n; a != nil; a = a.Parent {
+			ok, err := t.matchSteps(ctx, a, rest, start)
+			if ok || err != nil {
+				return ok, err
+			}
+		}
+
+		return false, nil
+	}
+
+	switch last.Axis {
+	case xpath.AxisChild:
+		if !isChild(n) {
+			return false, nil
+		}
+
+	case xpath.AxisAttribute:
+		if n.Type != AttributeNode {
+			return false, nil
+		}
+
+	default:
+		return false, nil
+	}
+
+	ok, err := t.nodeTest(n, last.Axis, last.Test)
+	if !ok || err != nil {
+		return false, err
+	}
+
+	if len(last.Predicates) > 0 {
+		selected, err := t.step(ctx, n.Parent, last)
+		if err != nil {
+			return false, err
+		}
+
+		if indexOf(selected, n) < 0 {
+			return false, nil
+		}
+	}
+
+	return t.matchSteps(ctx, n.Parent, rest, start)
+}
+
+// findRule returns the template rule that best matches the node in the given mode, if any.
+func (t *transform) findRule(ctx *evalContext, n *Node, mode string) (*rule, error) {
+	var best *rule
+
+	for _, r := range t.rules {
+		if r.tmpl.Mode != mode {
+			continue
+		}
+
+		if best != nil && (r.priority < best.priority || (r.priority == best.priority && r.order < best.order)) {
+			continue
+		}
+
+		ok, err := t.matches(ctx, n, r.pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			best = r
+		}
+	}
+
+	return best, nil
+}
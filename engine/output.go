@@ -0,0 +1,326 @@
+package engine
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/puellanivis/lxt/xslt"
+)
+
+// htmlVoidElements are the elements of HTML that have no end tag.
+var htmlVoidElements = map[string]bool{
+	"area":     true,
+	"base":     true,
+	"basefont": true,
+	"br":       true,
+	"col":      true,
+	"embed":    true,
+	"frame":    true,
+	"hr":       true,
+	"img":      true,
+	"input":    true,
+	"isindex":  true,
+	"link":     true,
+	"meta":     true,
+	"param":    true,
+	"source":   true,
+	"track":    true,
+	"wbr":      true,
+}
+
+// htmlRawElements are the elements of HTML whose content is not escaped.
+var htmlRawElements = map[string]bool{
+	"script": true,
+	"style":  true,
+}
+
+type serializer struct {
+	w *bufio.Writer
+
+	html   bool
+	indent bool
+
+	// ascii is set when the output encoding is not UTF-8,
+	// in which case all non-ASCII characters are written as character references.
+	ascii bool
+
+	// scope holds the namespace declarations in scope, with the innermost last.
+	scope []*Node
+}
+
+// serialize writes the result tree to the given io.Writer, according to the xsl:output settings.
+func serialize(w io.Writer, root *Node, out *xslt.Output) error {
+	if out == nil {
+		out = xslt.NewOutput()
+	}
+
+	bw := bufio.NewWriter(w)
+
+	s := &serializer{
+		w: bw,
+
+		html:   out.Method == "html",
+		indent: bool(out.Indent),
+	}
+
+	encoding := out.Encoding
+	if encoding == "" {
+		encoding = "UTF-8"
+	}
+	s.ascii = !strings.EqualFold(encoding, "UTF-8") && !strings.EqualFold(encoding, "UTF8")
+
+	switch out.Method {
+	case "text":
+		bw.WriteString(root.StringValue())
+		return bw.Flush()
+
+	case "", "xml":
+		if !isYes(out.OmitXMLDeclaration) {
+			version := out.Version
+			if version == "" {
+				version = "1.0"
+			}
+
+			fmt.Fprintf(bw, `<?xml version="%s" encoding="%s"`, version, encoding)
+			if out.Standalone != nil {
+				fmt.Fprintf(bw, ` standalone="%s"`, out.Standalone)
+			}
+			bw.WriteString("?>\n")
+		}
+
+		if out.DoctypeSystem != "" {
+			s.doctype(documentElementName(root), out.DoctypePublic, out.DoctypeSystem)
+		}
+
+	case "html":
+		if out.DoctypePublic != "" || out.DoctypeSystem != "" {
+			s.doctype("html", out.DoctypePublic, out.DoctypeSystem)
+		}
+
+	default:
+		return fmt.Errorf("unsupported output method: %q", out.Method)
+	}
+
+	s.children(root, 0)
+	bw.WriteString("\n")
+
+	return bw.Flush()
+}
+
+func documentElementName(root *Node) string {
+	for _, child := range root.Children {
+		if child.Type == ElementNode {
+			return child.QName()
+		}
+	}
+
+	return ""
+}
+
+func (s *serializer) doctype(name, public, system string) {
+	s.w.WriteString("<!DOCTYPE " + name)
+
+	switch {
+	case public != "":
+		fmt.Fprintf(s.w, ` PUBLIC "%s"`, public)
+		if system != "" {
+			fmt.Fprintf(s.w, ` "%s"`, system)
+		}
+
+	case system != "":
+		fmt.Fprintf(s.w, ` SYSTEM "%s"`, system)
+	}
+
+	s.w.WriteString(">\n")
+}
+
+// indented reports whether the children of the node should be written on separate lines.
+// Nodes with any text children are never indented, as that would change their content.
+func (s *serializer) indented(n *Node) bool {
+	if !s.indent {
+		return false
+	}
+
+	for _, child := range n.Children {
+		if child.Type == TextNode {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s *serializer) newline(depth int) {
+	s.w.WriteByte('\n')
+	for i := 0; i < depth; i++ {
+		s.w.WriteString("  ")
+	}
+}
+
+func (s *serializer) children(n *Node, depth int) {
+	indent := s.indented(n)
+
+	for i, child := range n.Children {
+		if indent && (i > 0 || n.Type != RootNode) {
+			s.newline(depth)
+		}
+
+		s.node(child, depth)
+	}
+
+	if indent && n.Type != RootNode && len(n.Children) > 0 {
+		s.newline(depth - 1)
+	}
+}
+
+func (s *serializer) node(n *Node, depth int) {
+	switch n.Type {
+	case TextNode:
+		raw := n.noEscape
+		if s.html && n.Parent != nil && htmlRawElements[strings.ToLower(n.Parent.Name.Local)] {
+			raw = true
+		}
+
+		if raw {
+			s.w.WriteString(n.Data)
+			return
+		}
+
+		s.escape(n.Data, false)
+
+	case CommentNode:
+		s.w.WriteString("<!--" + n.Data + "-->")
+
+	case ProcessingInstructionNode:
+		if s.html {
+			s.w.WriteString("<?" + n.Name.Local + " " + n.Data + ">")
+			return
+		}
+		s.w.WriteString("<?" + n.Name.Local + " " + n.Data + "?>")
+
+	case ElementNode:
+		s.element(n, depth)
+	}
+}
+
+func (s *serializer) element(n *Node, depth int) {
+	mark := len(s.scope)
+	defer func() { s.scope = s.scope[:mark] }()
+
+	name := n.QName()
+
+	s.w.WriteString("<" + name)
+
+	for _, ns := range n.Namespaces {
+		s.declare(ns.Name.Local, ns.Data)
+	}
+
+	s.declare(n.Prefix, n.Name.Space)
+
+	for _, attr := range n.Attrs {
+		if attr.Prefix != "" {
+			s.declare(attr.Prefix, attr.Name.Space)
+		}
+	}
+
+	for _, attr := range n.Attrs {
+		s.w.WriteString(" " + attr.QName() + `="`)
+		s.escape(attr.Data, true)
+		s.w.WriteString(`"`)
+	}
+
+	if s.html && n.Name.Space == "" {
+		s.w.WriteString(">")
+
+		if htmlVoidElements[strings.ToLower(n.Name.Local)] {
+			return
+		}
+
+		s.children(n, depth+1)
+		s.w.WriteString("</" + name + ">")
+		return
+	}
+
+	if len(n.Children) == 0 {
+		s.w.WriteString("/>")
+		return
+	}
+
+	s.w.WriteString(">")
+	s.children(n, depth+1)
+	s.w.WriteString("</" + name + ">")
+}
+
+// declare writes a namespace declaration for the prefix, unless it is already in scope.
+func (s *serializer) declare(prefix, uri string) {
+	if prefix == "xml" {
+		return
+	}
+
+	inScope := ""
+	for i := len(s.scope) - 1; i >= 0; i-- {
+		if s.scope[i].Name.Local == prefix {
+			inScope = s.scope[i].Data
+			break
+		}
+	}
+
+	if inScope == uri {
+		return
+	}
+
+	s.scope = append(s.scope, &Node{
+		Type: NamespaceNode,
+		Name: xml.Name{Local: prefix},
+		Data: uri,
+	})
+
+	attr := "xmlns"
+	if prefix != "" {
+		attr += ":" + prefix
+	}
+
+	s.w.WriteString(" " + attr + `="`)
+	s.escape(uri, true)
+	s.w.WriteString(`"`)
+}
+
+func (s *serializer) escape(text string, attr bool) {
+	for _, r := range text {
+		switch r {
+		case '&':
+			s.w.WriteString("&amp;")
+		case '<':
+			s.w.WriteString("&lt;")
+		case '>':
+			if attr {
+				s.w.WriteByte('>')
+				continue
+			}
+			s.w.WriteString("&gt;")
+		case '"':
+			if !attr {
+				s.w.WriteByte('"')
+				continue
+			}
+			s.w.WriteString("&quot;")
+		case '\n', '\r', '\t':
+			if !attr && r != '\r' {
+				s.w.WriteRune(r)
+				continue
+			}
+			fmt.Fprintf(s.w, "&#%d;", r)
+
+		default:
+			if s.ascii && r >= utf8.RuneSelf {
+				fmt.Fprintf(s.w, "&#%d;", r)
+				continue
+			}
+			s.w.WriteRune(r)
+		}
+	}
+}
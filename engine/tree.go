@@ -0,0 +1,324 @@
+package engine
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// NodeType is the type of a node in the XPath data model.
+type NodeType int
+
+// The types of node in the XPath data model.
+const (
+	RootNode NodeType = iota
+	ElementNode
+	AttributeNode
+	NamespaceNode
+	TextNode
+	CommentNode
+	ProcessingInstructionNode
+)
+
+const (
+	nsXML   = "http://www.w3.org/XML/1998/namespace"
+	nsXMLNS = "http://www.w3.org/2000/xmlns/"
+)
+
+// Node is a node of an XML document, as described by the XPath data model.
+//
+// For elements and attributes, the Name holds the namespace URI in Space, and the Prefix is as written.
+// For namespace nodes, the Name.Local is the prefix, and the Data is the namespace URI.
+// For processing instructions, the Name.Local is the target.
+type Node struct {
+	Type   NodeType
+	Name   xml.Name
+	Prefix string
+	Data   string
+
+	Parent     *Node
+	Children   []*Node
+	Attrs      []*Node
+	Namespaces []*Node
+
+	// noEscape is set on text nodes of a result tree that are output without escaping.
+	noEscape bool
+
+	// order is the position of the node in document order, across all documents of a transformation.
+	order int
+}
+
+// QName returns the name of the node as written, with its prefix.
+func (n *Node) QName() string {
+	if n.Prefix == "" {
+		return n.Name.Local
+	}
+
+	return n.Prefix + ":" + n.Name.Local
+}
+
+// StringValue returns the string-value of the node.
+func (n *Node) StringValue() string {
+	switch n.Type {
+	case RootNode, ElementNode:
+		var b strings.Builder
+		n.appendText(&b)
+		return b.String()
+	}
+
+	return n.Data
+}
+
+func (n *Node) appendText(b *strings.Builder) {
+	for _, child := range n.Children {
+		switch child.Type {
+		case TextNode:
+			b.WriteString(child.Data)
+		case ElementNode:
+			child.appendText(b)
+		}
+	}
+}
+
+// root returns the root node of the tree containing the node.
+func (n *Node) root() *Node {
+	for n.Parent != nil {
+		n = n.Parent
+	}
+
+	return n
+}
+
+// appendChild appends a child to the node, merging adjacent text nodes.
+func (n *Node) appendChild(child *Node) {
+	if child.Type == TextNode {
+		if child.Data == "" {
+			return
+		}
+
+		if last := len(n.Children) - 1; last >= 0 && n.Children[last].Type == TextNode && n.Children[last].noEscape == child.noEscape {
+			n.Children[last].Data += child.Data
+			return
+		}
+	}
+
+	child.Parent = n
+	n.Children = append(n.Children, child)
+}
+
+// setAttr sets an attribute of the node, replacing any attribute of the same name.
+func (n *Node) setAttr(attr *Node) {
+	attr.Parent = n
+
+	for i, a := range n.Attrs {
+		if a.Name == attr.Name {
+			n.Attrs[i] = attr
+			return
+		}
+	}
+
+	n.Attrs = append(n.Attrs, attr)
+}
+
+// lookupPrefix returns the namespace URI bound to the given prefix in the scope of the node.
+func (n *Node) lookupPrefix(prefix string) (string, bool) {
+	switch prefix {
+	case "xml":
+		return nsXML, true
+	case "xmlns":
+		return nsXMLNS, true
+	}
+
+	for ; n != nil; n = n.Parent {
+		for _, ns := range n.Namespaces {
+			if ns.Name.Local == prefix {
+				return ns.Data, true
+			}
+		}
+	}
+
+	return "", prefix == ""
+}
+
+// inScopeNamespaces returns the namespace nodes for the namespaces in scope of the element.
+func (n *Node) inScopeNamespaces() []*Node {
+	seen := map[string]bool{
+		"xml": true,
+	}
+
+	var nodes []*Node
+	for e := n; e != nil; e = e.Parent {
+		for _, ns := range e.Namespaces {
+			if seen[ns.Name.Local] {
+				continue
+			}
+			seen[ns.Name.Local] = true
+
+			if ns.Data == "" {
+				// An undeclaration of the default namespace.
+				continue
+			}
+
+			nodes = append(nodes, &Node{
+				Type:   NamespaceNode,
+				Name:   ns.Name,
+				Data:   ns.Data,
+				Parent: n,
+				order:  ns.order,
+			})
+		}
+	}
+
+	return nodes
+}
+
+// numberTree assigns document order to the tree rooted at n, starting from *next.
+func numberTree(n *Node, next *int) {
+	*next++
+	n.order = *next
+
+	for _, ns := range n.Namespaces {
+		*next++
+		ns.order = *next
+	}
+
+	for _, attr := range n.Attrs {
+		*next++
+		attr.order = *next
+	}
+
+	for _, child := range n.Children {
+		numberTree(child, next)
+	}
+}
+
+// Parse parses an XML document into a tree of nodes, returning the root node.
+func Parse(in io.Reader) (*Node, error) {
+	d := xml.NewDecoder(in)
+	d.Strict = true
+
+	root := &Node{
+		Type: RootNode,
+	}
+
+	cur := root
+
+	for {
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			elem := &Node{
+				Type:   ElementNode,
+				Prefix: tok.Name.Space,
+				Name: xml.Name{
+					Local: tok.Name.Local,
+				},
+			}
+
+			var attrs []xml.Attr
+			for _, attr := range tok.Attr {
+				switch {
+				case attr.Name.Space == "" && attr.Name.Local == "xmlns":
+					elem.Namespaces = append(elem.Namespaces, &Node{
+						Type: NamespaceNode,
+						Data: attr.Value,
+					})
+
+				case attr.Name.Space == "xmlns":
+					elem.Namespaces = append(elem.Namespaces, &Node{
+						Type: NamespaceNode,
+						Name: xml.Name{
+							Local: attr.Name.Local,
+						},
+						Data: attr.Value,
+					})
+
+				default:
+					attrs = append(attrs, attr)
+				}
+			}
+
+			for _, ns := range elem.Namespaces {
+				ns.Parent = elem
+			}
+
+			// The element must be attached before resolving prefixes, so that its parent's namespaces are in scope.
+			cur.appendChild(elem)
+			cur = elem
+
+			uri, ok := elem.lookupPrefix(elem.Prefix)
+			if !ok {
+				return nil, fmt.Errorf("element <%s>: undeclared namespace prefix %q", elem.QName(), elem.Prefix)
+			}
+			elem.Name.Space = uri
+
+			for _, attr := range attrs {
+				a := &Node{
+					Type:   AttributeNode,
+					Prefix: attr.Name.Space,
+					Name: xml.Name{
+						Local: attr.Name.Local,
+					},
+					Data: attr.Value,
+				}
+
+				if a.Prefix != "" {
+					uri, ok := elem.lookupPrefix(a.Prefix)
+					if !ok {
+						return nil, fmt.Errorf("attribute %s: undeclared namespace prefix %q", a.QName(), a.Prefix)
+					}
+					a.Name.Space = uri
+				}
+
+				elem.setAttr(a)
+			}
+
+		case xml.EndElement:
+			cur = cur.Parent
+
+		case xml.CharData:
+			if cur == root {
+				// Text outside of the document element is not part of the data model.
+				continue
+			}
+
+			cur.appendChild(&Node{
+				Type: TextNode,
+				Data: string(tok),
+			})
+
+		case xml.Comment:
+			cur.appendChild(&Node{
+				Type: CommentNode,
+				Data: string(tok),
+			})
+
+		case xml.ProcInst:
+			if tok.Target == "xml" {
+				// The XML declaration is not a processing instruction in the data model.
+				continue
+			}
+
+			cur.appendChild(&Node{
+				Type: ProcessingInstructionNode,
+				Name: xml.Name{
+					Local: tok.Target,
+				},
+				Data: string(tok.Inst),
+			})
+		}
+	}
+
+	var next int
+	numberTree(root, &next)
+
+	return root, nil
+}
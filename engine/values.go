@@ -0,0 +1,240 @@
+package engine
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A value is the result of evaluating an XPath expression:
+// one of nodeSet, string, float64, or bool.
+type value interface{}
+
+// nodeSet is a set of nodes.
+// Unless stated otherwise, a nodeSet is kept in document order, without duplicates.
+type nodeSet []*Node
+
+// docOrder sorts the nodes into document order, and removes any duplicates.
+func docOrder(nodes nodeSet) nodeSet {
+	if len(nodes) < 2 {
+		return nodes
+	}
+
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return nodes[i].order < nodes[j].order
+	})
+
+	out := nodes[:1]
+	for _, n := range nodes[1:] {
+		if n != out[len(out)-1] {
+			out = append(out, n)
+		}
+	}
+
+	return out
+}
+
+func toString(v value) string {
+	switch v := v.(type) {
+	case nodeSet:
+		if len(v) == 0 {
+			return ""
+		}
+		return v[0].StringValue()
+
+	case string:
+		return v
+
+	case float64:
+		return numberString(v)
+
+	case bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	}
+
+	return ""
+}
+
+func toNumber(v value) float64 {
+	switch v := v.(type) {
+	case nodeSet:
+		return stringNumber(toString(v))
+
+	case string:
+		return stringNumber(v)
+
+	case float64:
+		return v
+
+	case bool:
+		if v {
+			return 1
+		}
+		return 0
+	}
+
+	return math.NaN()
+}
+
+func toBool(v value) bool {
+	switch v := v.(type) {
+	case nodeSet:
+		return len(v) > 0
+
+	case string:
+		return v != ""
+
+	case float64:
+		return v != 0 && !math.IsNaN(v)
+
+	case bool:
+		return v
+	}
+
+	return false
+}
+
+// numberString converts a number to a string, as by the XPath string() function.
+func numberString(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	case f == 0:
+		return "0"
+	}
+
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// stringNumber converts a string to a number, as by the XPath number() function.
+// Any string that is not an XPath Number, optionally preceded by a minus sign, is NaN.
+func stringNumber(s string) float64 {
+	s = strings.Trim(s, " \t\r\n")
+
+	digits := strings.TrimPrefix(s, "-")
+	if digits == "" || digits == "." {
+		return math.NaN()
+	}
+
+	var seenDot bool
+	for _, c := range digits {
+		switch {
+		case c == '.' && !seenDot:
+			seenDot = true
+		case '0' <= c && c <= '9':
+		default:
+			return math.NaN()
+		}
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return math.NaN()
+	}
+
+	return f
+}
+
+// compare implements the comparison operators of XPath 1.0, section 3.4.
+func compare(op string, x, y value) bool {
+	xs, xok := x.(nodeSet)
+	ys, yok := y.(nodeSet)
+
+	switch {
+	case xok && yok:
+		for _, xn := range xs {
+			xv := xn.StringValue()
+
+			for _, yn := range ys {
+				if compareAtoms(op, xv, yn.StringValue()) {
+					return true
+				}
+			}
+		}
+		return false
+
+	case xok:
+		return compareNodeSet(op, xs, y, false)
+
+	case yok:
+		return compareNodeSet(op, ys, x, true)
+	}
+
+	return compareAtoms(op, x, y)
+}
+
+// compareNodeSet compares each node of the node-set to the value.
+// If swapped is set, then the node-set is the right operand.
+func compareNodeSet(op string, nodes nodeSet, v value, swapped bool) bool {
+	if b, ok := v.(bool); ok {
+		if swapped {
+			return compareAtoms(op, b, toBool(nodes))
+		}
+		return compareAtoms(op, toBool(nodes), b)
+	}
+
+	for _, n := range nodes {
+		var nv value = n.StringValue()
+		if _, ok := v.(float64); ok {
+			nv = stringNumber(n.StringValue())
+		}
+
+		x, y := nv, v
+		if swapped {
+			x, y = y, x
+		}
+
+		if compareAtoms(op, x, y) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// compareAtoms compares two values, neither of which are node-sets.
+func compareAtoms(op string, x, y value) bool {
+	switch op {
+	case "=", "!=":
+		var eq bool
+
+		_, xb := x.(bool)
+		_, yb := y.(bool)
+		_, xn := x.(float64)
+		_, yn := y.(float64)
+
+		switch {
+		case xb || yb:
+			eq = toBool(x) == toBool(y)
+		case xn || yn:
+			eq = toNumber(x) == toNumber(y)
+		default:
+			eq = toString(x) == toString(y)
+		}
+
+		return eq == (op == "=")
+	}
+
+	a, b := toNumber(x), toNumber(y)
+
+	switch op {
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	}
+
+	return false
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/puellanivis/breton/lib/files"
+	flag "github.com/puellanivis/breton/lib/gnuflag"
+	"github.com/puellanivis/breton/lib/os/process"
+
+	"github.com/puellanivis/lxt/parser"
+	"github.com/puellanivis/lxt/printer"
+)
+
+// FmtFlags are the flags of the `fmt` subcommand.
+var FmtFlags struct {
+	Write bool `flag:",short=w" desc:"Write the result to each source file, rather than to stdout."`
+	Diff  bool `flag:",short=d" desc:"Display a diff of the changes, rather than the formatted source."`
+	List  bool `flag:",short=l" desc:"List the files whose formatting differs from the canonical style."`
+}
+
+// format rewrites the LXT files given in args in the canonical style.
+//
+//	lxt fmt -l *.lxt
+//	lxt fmt -w style.lxt
+func format(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("fmt", flag.ExitOnError)
+	fs.CopyFrom(flag.CommandLine, "max-errors")
+
+	if err := fs.Struct("", &FmtFlags); err != nil {
+		panic(err)
+	}
+
+	if err := fs.Parse(args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		process.Exit(2)
+	}
+
+	filenames := fs.Args()
+	if len(filenames) < 1 {
+		if FmtFlags.Write {
+			fmt.Fprintln(os.Stderr, "fmt: cannot use -w with standard input")
+			process.Exit(2)
+		}
+
+		filenames = append(filenames, "-")
+	}
+
+	var errs parser.ErrorList
+
+	for _, filename := range filenames {
+		if err := formatFile(ctx, filename); err != nil {
+			errs.Add(err)
+		}
+	}
+
+	if len(errs) > 0 {
+		printErrors(errs)
+		process.Exit(1)
+	}
+}
+
+// formatFile formats a single LXT source file, and writes or reports the result according to the FmtFlags.
+// Nothing is written if the file has any errors.
+func formatFile(ctx context.Context, filename string) error {
+	src, err := files.Read(ctx, filename)
+	if err != nil {
+		return err
+	}
+
+	file, err := parser.ParseSource(ctx, bytes.NewReader(src), filename)
+	if err != nil {
+		return err
+	}
+
+	res := printer.Source(file)
+	if bytes.Equal(src, res) {
+		if !FmtFlags.List && !FmtFlags.Write && !FmtFlags.Diff {
+			_, err := os.Stdout.Write(res)
+			return err
+		}
+
+		return nil
+	}
+
+	if FmtFlags.List {
+		fmt.Println(filename)
+	}
+
+	if FmtFlags.Write {
+		if err := files.Write(ctx, filename, res); err != nil {
+			return err
+		}
+	}
+
+	if FmtFlags.Diff {
+		data, err := diff(filename, src, res)
+		if err != nil {
+			return fmt.Errorf("computing diff: %w", err)
+		}
+
+		fmt.Printf("diff -u %s.orig %s\n", filename, filename)
+		os.Stdout.Write(data)
+	}
+
+	if !FmtFlags.List && !FmtFlags.Write && !FmtFlags.Diff {
+		_, err := os.Stdout.Write(res)
+		return err
+	}
+
+	return nil
+}
+
+// diff returns a unified diff of the two versions of the file, as produced by diff(1).
+func diff(filename string, a, b []byte) ([]byte, error) {
+	fa, err := writeTemp(a)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(fa)
+
+	fb, err := writeTemp(b)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(fb)
+
+	data, err := exec.Command("diff", "-u", "--label", filename+".orig", "--label", filename, fa, fb).CombinedOutput()
+	if len(data) > 0 {
+		// diff exits with a non-zero status when the files differ.
+		return data, nil
+	}
+
+	return nil, err
+}
+
+func writeTemp(data []byte) (string, error) {
+	f, err := os.CreateTemp("", "lxt-fmt")
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+
+	return f.Name(), nil
+}
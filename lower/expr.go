@@ -0,0 +1,236 @@
+package lower
+
+import (
+	"strings"
+
+	"github.com/puellanivis/lxt/ast"
+	"github.com/puellanivis/lxt/xslt"
+)
+
+func (l *lowerer) expr(expr ast.Node) (interface{}, error) {
+	switch n := expr.(type) {
+	case nil, *ast.Empty:
+		return nil, nil
+
+	case *ast.Comment:
+		return comment(n), nil
+
+	case *ast.Group:
+		var group xslt.Group
+
+		for _, child := range n.List {
+			thing, err := l.expr(child)
+			if err != nil {
+				return nil, err
+			}
+
+			if thing != nil {
+				group = append(group, thing)
+			}
+		}
+
+		return group, nil
+
+	case *ast.String:
+		return &xslt.Text{
+			Body: n.Value,
+		}, nil
+
+	case *ast.XPath:
+		return &xslt.ValueOf{
+			Select: n.Value,
+		}, nil
+
+	case *ast.Interpolated:
+		var group xslt.Group
+
+		for _, part := range n.Parts {
+			thing, err := l.expr(part)
+			if err != nil {
+				return nil, err
+			}
+
+			group = append(group, thing)
+		}
+
+		return group, nil
+
+	case *ast.Number:
+		return &xslt.ValueOf{
+			Select: n.Value,
+		}, nil
+
+	case *ast.Text:
+		return &xslt.Text{
+			Body: n.Value.Value,
+		}, nil
+
+	case *ast.CopyOf:
+		return &xslt.CopyOf{
+			Select: n.Select.Value,
+		}, nil
+
+	case *ast.Variable:
+		return l.variable(n)
+
+	case *ast.GroupBy:
+		return l.groupBy(n)
+
+	case *ast.ForEach:
+		return l.forEach(n)
+
+	case *ast.ApplyTemplates:
+		return l.applyTemplates(n)
+
+	case *ast.Choose:
+		return l.choose(n)
+
+	case *ast.If:
+		body, err := l.expr(n.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		return &xslt.If{
+			Test: n.Test.Value,
+			Body: body,
+		}, nil
+
+	case *ast.Call:
+		args, err := l.args(n.Args)
+		if err != nil {
+			return nil, err
+		}
+
+		return &xslt.CallTemplate{
+			Name:       n.Name.Name,
+			WithParams: args,
+		}, nil
+
+	case *ast.Tag:
+		body, err := l.expr(n.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		el := &xslt.Element{
+			Name: avt(n.Name),
+			Body: body,
+		}
+
+		if n.Namespace != nil {
+			el.Namespace = avt(n.Namespace.URI)
+		}
+
+		return l.literalElement(el), nil
+
+	case *ast.Attribs:
+		return l.attribs(n)
+
+	case *ast.Sequence:
+		return &xslt.Sequence{
+			Select: n.Select.Value,
+		}, nil
+
+	case *ast.Return:
+		return l.result(n), nil
+
+	case *ast.AnalyzeString:
+		return l.analyzeString(n)
+
+	case *ast.ResultDocument:
+		return l.resultDocument(n)
+
+	case *ast.HTMLElement:
+		body, err := l.expr(n.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		return l.literalElement(&xslt.Element{
+			Name: n.Tag,
+			Body: xslt.Group{htmlAttributes(n), body},
+		}), nil
+	}
+
+	return nil, errorf(expr, "unexpected expression: %T", expr)
+}
+
+func (l *lowerer) choose(n *ast.Choose) (*xslt.Choose, error) {
+	choose := new(xslt.Choose)
+
+	for _, when := range n.Whens {
+		body, err := l.expr(when.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		choose.Whens = append(choose.Whens, &xslt.When{
+			Test: when.Test.Value,
+			Body: body,
+		})
+	}
+
+	if n.Otherwise != nil {
+		body, err := l.expr(n.Otherwise.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		choose.Otherwise = &xslt.Otherwise{
+			Body: body,
+		}
+	}
+
+	return choose, nil
+}
+
+// htmlAttributes returns the id and class attributes of the HTML sugar for an element.
+func htmlAttributes(n *ast.HTMLElement) []*xslt.Attribute {
+	var attrs []*xslt.Attribute
+
+	if n.ID != "" {
+		attrs = append(attrs, &xslt.Attribute{
+			Name:  "id",
+			Value: &xslt.Text{Body: n.ID},
+		})
+	}
+
+	classes := n.Classes
+	if n.Class != nil {
+		classes = append(classes, literal(n.Class))
+	}
+
+	if len(classes) > 0 {
+		attrs = append(attrs, &xslt.Attribute{
+			Name:  "class",
+			Value: &xslt.Text{Body: strings.Join(classes, " ")},
+		})
+	}
+
+	return attrs
+}
+
+func (l *lowerer) attribs(n *ast.Attribs) ([]*xslt.Attribute, error) {
+	var attribs []*xslt.Attribute
+
+	for _, attr := range n.List {
+		val, err := l.expr(attr.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		attrib := &xslt.Attribute{
+			Name:  avt(attr.Name),
+			Value: val,
+		}
+
+		if attr.Namespace != nil {
+			attrib.Namespace = avt(attr.Namespace.URI)
+		}
+
+		attribs = append(attribs, attrib)
+	}
+
+	return attribs, nil
+}
@@ -0,0 +1,88 @@
+package lower
+
+import (
+	"github.com/puellanivis/lxt/ast"
+	"github.com/puellanivis/lxt/xslt"
+)
+
+// function lowers a func into an xsl:function when targeting XSLT 2.0 or later.
+// When targeting XSLT 1.0, it is lowered into an EXSLT func:function instead,
+// which requires a namespace to have been declared for the EXSLT functions module.
+func (l *lowerer) function(n *ast.Func) error {
+	var params []*xslt.Param
+
+	if n.Params != nil {
+		for _, p := range n.Params.List {
+			param := &xslt.Param{
+				Name: p.Name.Name,
+			}
+
+			if p.As != nil {
+				param.As = literal(p.As.Type)
+			}
+
+			params = append(params, param)
+		}
+	}
+
+	if l.target >= xslt.XSLT20 {
+		body, err := l.expr(n.Body)
+		if err != nil {
+			return err
+		}
+
+		fn := &xslt.Function{
+			Name:   n.Name.Name,
+			Params: params,
+			Body:   body,
+		}
+
+		if n.As != nil {
+			fn.As = literal(n.As.Type)
+		}
+
+		l.xsl.Body = append(l.xsl.Body, fn)
+		return nil
+	}
+
+	prefix, ok := l.xsl.PrefixOf(xslt.NamespaceEXSLTFunctions)
+	if !ok {
+		return errorf(n, "func requires XSLT 2.0 or later, or a namespace declared for %q", xslt.NamespaceEXSLTFunctions)
+	}
+
+	sub := &lowerer{
+		xsl:           l.xsl,
+		target:        l.target,
+		seenStatement: l.seenStatement,
+		exslt:         prefix,
+	}
+
+	body, err := sub.expr(n.Body)
+	if err != nil {
+		return err
+	}
+
+	l.xsl.AddPrefix("extension-element-prefixes", prefix)
+
+	l.xsl.Body = append(l.xsl.Body, &xslt.EXSLTFunction{
+		Prefix: prefix,
+		Name:   n.Name.Name,
+		Params: params,
+		Body:   body,
+	})
+	return nil
+}
+
+// result lowers the return of a func into an xsl:sequence, or an EXSLT func:result.
+func (l *lowerer) result(n *ast.Return) interface{} {
+	if l.exslt != "" {
+		return &xslt.EXSLTResult{
+			Prefix: l.exslt,
+			Select: n.Select.Value,
+		}
+	}
+
+	return &xslt.Sequence{
+		Select: n.Select.Value,
+	}
+}
@@ -0,0 +1,264 @@
+package lower
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/puellanivis/lxt/ast"
+	"github.com/puellanivis/lxt/tokenizer"
+	"github.com/puellanivis/lxt/xpath"
+	"github.com/puellanivis/lxt/xslt"
+)
+
+// groupBy lowers a grouping loop into an xsl:for-each-group when targeting XSLT 2.0 or later.
+//
+// When targeting XSLT 1.0, it is lowered into Muenchian grouping instead:
+// an xsl:key is declared matching the items by their key,
+// and an xsl:for-each selects only the first item of each group.
+// The calls to current-group() and current-grouping-key() are then replaced with variables declared within the loop.
+func (l *lowerer) groupBy(n *ast.GroupBy) (interface{}, error) {
+	sorts, err := l.sortBy(n.SortBy)
+	if err != nil {
+		return nil, err
+	}
+
+	if l.target >= xslt.XSLT20 {
+		body, err := l.expr(n.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		return &xslt.ForEachGroup{
+			Select:  n.Select.Value,
+			GroupBy: n.Key.Value,
+			Sort:    sorts,
+			Body:    body,
+		}, nil
+	}
+
+	// The key is declared on the stylesheet, where no variables are in scope.
+	for _, x := range []*ast.XPath{n.Select, n.Key} {
+		if ref := variableRef(x); ref != nil {
+			return nil, &tokenizer.Error{
+				Pos: x.Offset(ref.Pos()),
+				End: x.Offset(ref.End()),
+				Msg: fmt.Sprintf("group cannot refer to variable %s when targeting XSLT 1.0, as its key is declared outside of any template", ref),
+			}
+		}
+	}
+
+	// The key matches every item of the document, so the items must be selected by a pattern.
+	if _, err := xpath.ParsePattern(n.Select.Value); err != nil {
+		return nil, errorf(n.Select, "group items must be a pattern when targeting XSLT 1.0: %v", err)
+	}
+
+	// The key is declared before lowering the body, so that any groups nested within it are numbered after it.
+	name := l.groupKeyName()
+	lookup := fmt.Sprintf("key('%s', %s)", name, n.Key.Value)
+
+	l.xsl.Keys = append(l.xsl.Keys, &xslt.Key{
+		Name:  name,
+		Match: n.Select.Value,
+		Use:   n.Key.Value,
+	})
+
+	body, err := l.expr(n.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// The context of a sort key is the first item of the group, so the group can be looked up directly.
+	for _, sort := range sorts {
+		sort.Select = replaceCalls(sort.Select, map[string]string{
+			"current-group":        lookup,
+			"current-grouping-key": "(" + n.Key.Value + ")",
+		}, nil)
+	}
+
+	// Within the body, the context may change, so the group and its key are bound to variables.
+	groupVar, keyVar := name, name+"-key"
+
+	used := make(map[string]bool)
+	rewriteXPaths(body, func(s string) string {
+		return replaceCalls(s, map[string]string{
+			"current-group":        "$" + groupVar,
+			"current-grouping-key": "$" + keyVar,
+		}, used)
+	})
+
+	var vars xslt.Group
+
+	if used["current-group"] {
+		vars = append(vars, &xslt.Variable{
+			Name:   groupVar,
+			Select: lookup,
+		})
+	}
+
+	if used["current-grouping-key"] {
+		vars = append(vars, &xslt.Variable{
+			Name:   keyVar,
+			Select: n.Key.Value,
+		})
+	}
+
+	if len(vars) > 0 {
+		switch b := body.(type) {
+		case nil:
+			body = vars
+		case xslt.Group:
+			body = append(vars, b...)
+		default:
+			body = append(vars, b)
+		}
+	}
+
+	return &xslt.ForEach{
+		Select: firstOfGroup(n.Select.Value, lookup),
+		Sort:   sorts,
+		Body:   body,
+	}, nil
+}
+
+// groupKeyName returns a name for the key of a Muenchian grouping, which is not already declared.
+// The groups are numbered from one, in order, regardless of any other keys.
+func (l *lowerer) groupKeyName() string {
+	declared := make(map[string]bool)
+	for _, key := range l.xsl.Keys {
+		if key, ok := key.(*xslt.Key); ok {
+			declared[key.Name] = true
+		}
+	}
+
+	for i := 1; ; i++ {
+		name := fmt.Sprintf("lxt-group-%d", i)
+
+		if !declared[name] {
+			return name
+		}
+	}
+}
+
+// variableRef returns the first variable reference within the XPath, if there is one.
+func variableRef(x *ast.XPath) *xpath.VariableRef {
+	expr := x.Expr
+	if expr == nil {
+		var err error
+		if expr, err = xpath.Parse(x.Value); err != nil {
+			return nil
+		}
+	}
+
+	var ref *xpath.VariableRef
+
+	xpath.Inspect(expr, func(expr xpath.Expr) bool {
+		if ref == nil {
+			ref, _ = expr.(*xpath.VariableRef)
+		}
+
+		return ref == nil
+	})
+
+	return ref
+}
+
+// firstOfGroup returns an XPath selecting only those items that are the first of the group looked up by their key.
+func firstOfGroup(items, lookup string) string {
+	pred := fmt.Sprintf("[generate-id() = generate-id(%s[1])]", lookup)
+
+	// A predicate on a location path applies to its last step, but anything else must be parenthesized.
+	if expr, err := xpath.Parse(items); err == nil {
+		if _, ok := expr.(*xpath.LocationPath); ok {
+			return items + pred
+		}
+	}
+
+	return "(" + items + ")" + pred
+}
+
+// replaceCalls replaces the calls without arguments to the given functions within the XPath,
+// and records the names of the functions that were replaced into used, if it is not nil.
+// An XPath that cannot be parsed is returned unchanged.
+func replaceCalls(s string, repl map[string]string, used map[string]bool) string {
+	expr, err := xpath.Parse(s)
+	if err != nil {
+		return s
+	}
+
+	var calls []*xpath.FunctionCall
+
+	xpath.Inspect(expr, func(expr xpath.Expr) bool {
+		call, ok := expr.(*xpath.FunctionCall)
+		if ok && call.Name.Prefix == "" && len(call.Args) == 0 {
+			if _, ok := repl[call.Name.Local]; ok {
+				calls = append(calls, call)
+			}
+		}
+
+		return true
+	})
+
+	if len(calls) == 0 {
+		return s
+	}
+
+	sort.Slice(calls, func(i, j int) bool {
+		return calls[i].Pos() < calls[j].Pos()
+	})
+
+	var b strings.Builder
+	var last int
+
+	for _, call := range calls {
+		b.WriteString(s[last:call.Pos()])
+		b.WriteString(repl[call.Name.Local])
+		last = call.End()
+
+		if used != nil {
+			used[call.Name.Local] = true
+		}
+	}
+	b.WriteString(s[last:])
+
+	return b.String()
+}
+
+// rewriteXPaths replaces each of the XPath expressions of the lowered instructions with the result of fn.
+// Patterns and attribute value templates are left unchanged.
+func rewriteXPaths(body interface{}, fn func(string) string) {
+	set := func(s *string) {
+		if *s != "" {
+			*s = fn(*s)
+		}
+	}
+
+	xslt.Walk(body, func(node interface{}) bool {
+		switch n := node.(type) {
+		case *xslt.ApplyTemplates:
+			set(&n.Select)
+		case *xslt.ForEach:
+			set(&n.Select)
+		case *xslt.Sort:
+			set(&n.Select)
+		case *xslt.If:
+			set(&n.Test)
+		case *xslt.When:
+			set(&n.Test)
+		case *xslt.ValueOf:
+			set(&n.Select)
+		case *xslt.CopyOf:
+			set(&n.Select)
+		case *xslt.Param:
+			set(&n.Select)
+		case *xslt.Variable:
+			set(&n.Select)
+		case *xslt.WithParam:
+			set(&n.Select)
+		case *xslt.EXSLTResult:
+			set(&n.Select)
+		}
+
+		return true
+	})
+}
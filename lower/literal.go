@@ -0,0 +1,167 @@
+package lower
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/puellanivis/lxt/tokenizer"
+	"github.com/puellanivis/lxt/xslt"
+)
+
+// literalElement returns the element as a literal result element, if it can be one.
+//
+// Its name must be a static QName, with a declared prefix, and in no explicit namespace.
+// Any attributes at the start of its body that have such names, no explicit namespace,
+// and values that can be written as attribute value templates, become attributes of the literal result element.
+// Otherwise, the element is returned as is.
+func (l *lowerer) literalElement(el *xslt.Element) interface{} {
+	if !l.isLiteralName(el.Name) || el.Namespace != "" {
+		return el
+	}
+
+	items := flatten(nil, el.Body)
+
+	var attrs []*xslt.Attribute
+	seen := make(map[string]bool)
+
+	for len(items) > 0 {
+		attr, ok := items[0].(*xslt.Attribute)
+		if !ok || seen[attr.Name] || !l.isLiteralName(attr.Name) || isNamespaceAttr(attr.Name) || attr.Namespace != "" {
+			break
+		}
+
+		if _, ok := xslt.AVT(attr.Value); !ok {
+			break
+		}
+
+		seen[attr.Name] = true
+		attrs = append(attrs, attr)
+		items = items[1:]
+	}
+
+	lit := &xslt.LiteralElement{
+		Name:  el.Name,
+		Attrs: attrs,
+	}
+
+	if len(items) > 0 {
+		lit.Body = xslt.Group(items)
+	}
+
+	return lit
+}
+
+// isLiteralName reports whether the name of an element or attribute can be written as is, rather than being computed.
+// It must be a QName outside of the xsl namespace, and its prefix, if any, must be declared on the stylesheet.
+// As the namespaces are declared by the time the stylesheet is written, a known namespace may be used without declaring it.
+func (l *lowerer) isLiteralName(name string) bool {
+	prefix, local, ok := strings.Cut(name, ":")
+	if !ok {
+		return isNCName(name)
+	}
+
+	if !isNCName(prefix) || !isNCName(local) || prefix == "xsl" {
+		return false
+	}
+
+	if _, ok := xslt.KnownNamespaces[prefix]; ok {
+		return true
+	}
+
+	_, ok = l.xsl.Namespaces()[prefix]
+	return ok
+}
+
+// isNCName reports whether the name is a valid XML name without a prefix.
+func isNCName(name string) bool {
+	switch {
+	case name == "", strings.ContainsAny(name, ":$@"):
+		return false
+	}
+
+	return tokenizer.IsIdent(name)
+}
+
+func isNamespaceAttr(name string) bool {
+	return name == "xmlns" || strings.HasPrefix(name, "xmlns:")
+}
+
+// flatten appends the instructions of the body to the list, flattening any groups and lists of attributes.
+func flatten(list []interface{}, body interface{}) []interface{} {
+	switch body := body.(type) {
+	case nil:
+	case xslt.Group:
+		for _, child := range body {
+			list = flatten(list, child)
+		}
+	case []*xslt.Attribute:
+		for _, attr := range body {
+			list = append(list, attr)
+		}
+	default:
+		list = append(list, body)
+	}
+
+	return list
+}
+
+// excludeResultPrefixes excludes the namespaces declared on the stylesheet from its output,
+// unless they are used by the name of a literal result element or its attributes.
+//
+// Otherwise, every namespace in scope on a literal result element is copied into the output with it,
+// while the namespaces of the stylesheet are only needed to interpret its names and XPaths.
+func (l *lowerer) excludeResultPrefixes() {
+	literals := make(map[string]bool)
+	found := false
+
+	xslt.Walk(l.xsl, func(node interface{}) bool {
+		if n, ok := node.(*xslt.LiteralElement); ok {
+			found = true
+
+			for _, name := range append([]string{n.Name}, attrNames(n.Attrs)...) {
+				if prefix, _, ok := strings.Cut(name, ":"); ok {
+					literals[prefix] = true
+				}
+			}
+		}
+
+		return true
+	})
+
+	if !found {
+		// There are no literal result elements, so there is nothing to copy namespaces onto.
+		return
+	}
+
+	extensions, _ := l.xsl.AttrValue("extension-element-prefixes")
+	for _, prefix := range strings.Fields(extensions) {
+		literals[prefix] = true
+	}
+
+	// Every declared namespace is copied, whether or not it is used, except for the default namespace,
+	// which the unprefixed names of literal result elements are in.
+	var prefixes []string
+	for prefix := range l.xsl.Namespaces() {
+		if prefix == "" || prefix == "xsl" || literals[prefix] {
+			continue
+		}
+
+		prefixes = append(prefixes, prefix)
+	}
+
+	sort.Strings(prefixes)
+
+	for _, prefix := range prefixes {
+		l.xsl.AddPrefix("exclude-result-prefixes", prefix)
+	}
+}
+
+func attrNames(attrs []*xslt.Attribute) []string {
+	var names []string
+
+	for _, attr := range attrs {
+		names = append(names, attr.Name)
+	}
+
+	return names
+}
@@ -0,0 +1,65 @@
+package lower
+
+import (
+	"testing"
+
+	"github.com/puellanivis/lxt/xslt"
+)
+
+func TestIsLiteralName(t *testing.T) {
+	xsl := xslt.NewStylesheet()
+	if err := xsl.Declare("my", "urn:my"); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	l := &lowerer{
+		xsl: xsl,
+	}
+
+	tests := map[string]bool{
+		"p":          true,
+		"data-x.y_z": true,
+		"my:p":       true,
+		"xs:type":    true,
+		"h:p":        false,
+		"xsl:text":   false,
+		"quoted key": false,
+		"1bad":       false,
+		"{@name}":    false,
+		"a:b:c":      false,
+		":p":         false,
+		"my:":        false,
+		"":           false,
+	}
+
+	for name, expect := range tests {
+		if got := l.isLiteralName(name); got != expect {
+			t.Errorf("isLiteralName(%q) = %t, expected %t", name, got, expect)
+		}
+	}
+}
+
+func TestExcludeResultPrefixes(t *testing.T) {
+	xsl := xslt.NewStylesheet()
+	for prefix, uri := range map[string]string{"": "urn:default", "h": "urn:h", "unused": "urn:unused", "x": "urn:x"} {
+		if err := xsl.Declare(prefix, uri); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	xsl.Body = append(xsl.Body, &xslt.Template{
+		Match: "x:item",
+		Body:  &xslt.LiteralElement{Name: "h:p"},
+	})
+
+	l := &lowerer{
+		xsl: xsl,
+	}
+	l.excludeResultPrefixes()
+
+	// Only the prefixes of the literal result elements are copied into the output.
+	expect := "unused x"
+	if got, _ := xsl.AttrValue("exclude-result-prefixes"); got != expect {
+		t.Errorf("exclude-result-prefixes was %q, expected %q", got, expect)
+	}
+}
@@ -0,0 +1,108 @@
+package lower
+
+import (
+	"github.com/puellanivis/lxt/ast"
+	"github.com/puellanivis/lxt/xslt"
+)
+
+func (l *lowerer) forEach(n *ast.ForEach) (*xslt.ForEach, error) {
+	sorts, err := l.sortBy(n.SortBy)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := l.expr(n.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &xslt.ForEach{
+		Select: n.Select.Value,
+		Sort:   sorts,
+		Body:   body,
+	}, nil
+}
+
+func (l *lowerer) applyTemplates(n *ast.ApplyTemplates) (*xslt.ApplyTemplates, error) {
+	sorts, err := l.sortBy(n.SortBy)
+	if err != nil {
+		return nil, err
+	}
+
+	args, err := l.args(n.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	apply := &xslt.ApplyTemplates{
+		Sort:       sorts,
+		WithParams: args,
+	}
+
+	if n.Select != nil {
+		apply.Select = n.Select.Value
+	}
+
+	if n.Mode != nil {
+		apply.Mode = n.Mode.Name.Name
+	}
+
+	return apply, nil
+}
+
+func (l *lowerer) sortBy(n *ast.SortBy) ([]*xslt.Sort, error) {
+	if n == nil {
+		return nil, nil
+	}
+
+	var sorts []*xslt.Sort
+
+	for _, key := range n.Keys {
+		sort := &xslt.Sort{
+			Select: key.Select.Value,
+		}
+
+		for _, mod := range key.Modifiers {
+			if err := sortModifier(sort, mod); err != nil {
+				return nil, err
+			}
+		}
+
+		sorts = append(sorts, sort)
+	}
+
+	return sorts, nil
+}
+
+func sortModifier(sort *xslt.Sort, mod *ast.SortModifier) error {
+	set := func(field *string, val string) error {
+		if *field != "" && *field != val {
+			return errorf(mod, "conflicting sort modifier, already %q", *field)
+		}
+
+		*field = val
+		return nil
+	}
+
+	switch mod.Name.Name {
+	case "asc", "ascending":
+		return set(&sort.Order, "ascending")
+	case "desc", "descending":
+		return set(&sort.Order, "descending")
+
+	case "text":
+		return set(&sort.DataType, "text")
+	case "number":
+		return set(&sort.DataType, "number")
+
+	case "upper-first":
+		return set(&sort.CaseOrder, "upper-first")
+	case "lower-first":
+		return set(&sort.CaseOrder, "lower-first")
+
+	case "lang":
+		return set(&sort.Lang, literal(mod.Value))
+	}
+
+	return errorf(mod, "unknown sort modifier: %q", mod.Name.Name)
+}
@@ -0,0 +1,80 @@
+package lower
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/puellanivis/lxt/ast"
+	"github.com/puellanivis/lxt/xslt"
+)
+
+func sortKey(selector string, modifiers ...string) *ast.SortKey {
+	key := &ast.SortKey{
+		Select: &ast.XPath{Value: selector},
+	}
+
+	for _, name := range modifiers {
+		key.Modifiers = append(key.Modifiers, &ast.SortModifier{
+			Name: &ast.Ident{Name: name},
+		})
+	}
+
+	return key
+}
+
+func TestSortBy(t *testing.T) {
+	l := &lowerer{
+		xsl: xslt.NewStylesheet(),
+	}
+
+	lang := sortKey("name", "desc", "lower-first", "lang")
+	lang.Modifiers[2].Value = &ast.String{Value: "de"}
+
+	got, err := l.sortBy(&ast.SortBy{
+		Keys: []*ast.SortKey{
+			sortKey("@date"),
+			sortKey("@price", "number", "descending", "desc"),
+			lang,
+		},
+	})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	expect := []*xslt.Sort{
+		{Select: "@date"},
+		{Select: "@price", DataType: "number", Order: "descending"},
+		{Select: "name", Order: "descending", CaseOrder: "lower-first", Lang: "de"},
+	}
+
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("sortBy gave %+v, expected %+v", got, expect)
+	}
+
+	if sorts, err := l.sortBy(nil); sorts != nil || err != nil {
+		t.Errorf("sortBy(nil) gave %v, %v, expected nil, nil", sorts, err)
+	}
+}
+
+func TestSortByConflicts(t *testing.T) {
+	tests := map[string][]string{
+		`conflicting sort modifier, already "ascending"`:   {"asc", "descending"},
+		`conflicting sort modifier, already "text"`:        {"text", "number"},
+		`conflicting sort modifier, already "upper-first"`: {"upper-first", "lower-first"},
+		`unknown sort modifier: "sideways"`:                {"sideways"},
+	}
+
+	for expect, modifiers := range tests {
+		l := &lowerer{
+			xsl: xslt.NewStylesheet(),
+		}
+
+		_, err := l.sortBy(&ast.SortBy{
+			Keys: []*ast.SortKey{sortKey("@a", modifiers...)},
+		})
+
+		if err == nil || err.Error() != expect {
+			t.Errorf("sortBy %v gave error: %v\nexpected: %s", modifiers, err, expect)
+		}
+	}
+}
@@ -0,0 +1,460 @@
+// Package lower implements the lowering of an LXT syntax tree into an XSLT stylesheet.
+package lower
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/puellanivis/lxt/ast"
+	"github.com/puellanivis/lxt/tokenizer"
+	"github.com/puellanivis/lxt/xslt"
+)
+
+type lowerer struct {
+	xsl *xslt.Stylesheet
+
+	// target is the version of XSLT being lowered to, which is the version of the Stylesheet given to lower into.
+	target xslt.Version
+
+	// seenStatement is set once any statement other than an import or comment has been lowered.
+	// Comments preceding that statement are placed at the very start of the stylesheet.
+	seenStatement bool
+
+	// exslt is the prefix of the EXSLT functions namespace, while lowering the body of an EXSLT function.
+	exslt string
+
+	// prefixLists are the lists of namespace prefixes given by the stylesheet directive,
+	// which are checked once all of the namespaces have been declared.
+	prefixLists []*ast.MapEntry
+}
+
+func errorf(node ast.Node, f string, args ...interface{}) error {
+	return &tokenizer.Error{
+		Pos: node.Pos(),
+		End: node.End(),
+		Msg: fmt.Sprintf(f, args...),
+	}
+}
+
+// File lowers the statements of the given syntax tree into the given Stylesheet,
+// targeting the version of XSLT of the Stylesheet.
+func File(file *ast.File, xsl *xslt.Stylesheet) error {
+	l := &lowerer{
+		xsl:    xsl,
+		target: xsl.Version(),
+	}
+
+	err := l.file(file)
+	err = errors.Join(err, l.checkPrefixLists())
+	l.excludeResultPrefixes()
+
+	return err
+}
+
+// Expr lowers a single expression of a syntax tree into the corresponding XSLT instructions,
+// targeting the version of XSLT of the given Stylesheet.
+// Any declarations that the expression requires, such as the key of a group, are added to the Stylesheet.
+func Expr(expr ast.Node, xsl *xslt.Stylesheet) (interface{}, error) {
+	l := &lowerer{
+		xsl:    xsl,
+		target: xsl.Version(),
+	}
+
+	return l.expr(expr)
+}
+
+// file lowers each statement of the file.
+// It continues after any errors, and returns all of the errors joined together.
+func (l *lowerer) file(file *ast.File) error {
+	var errs []error
+
+	for _, stmt := range file.Statements {
+		if err := l.statement(stmt); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (l *lowerer) statement(stmt ast.Node) error {
+	switch n := stmt.(type) {
+	case *ast.Comment:
+		if l.seenStatement {
+			l.xsl.Body = append(l.xsl.Body, comment(n))
+		} else {
+			l.xsl.Start = append(l.xsl.Start, comment(n))
+		}
+		return nil
+
+	case *ast.Import:
+		l.xsl.Imports = append(l.xsl.Imports, &xslt.Import{
+			Href: n.Href.Value,
+		})
+		return nil
+
+	case *ast.Namespace:
+		return l.namespace(n)
+
+	case *ast.Stylesheet:
+		return l.stylesheet(n)
+	}
+
+	l.seenStatement = true
+
+	switch n := stmt.(type) {
+	case *ast.Use:
+		if n.File == nil {
+			// This module has already been used elsewhere.
+			return nil
+		}
+
+		sub := &lowerer{
+			xsl:    l.xsl,
+			target: l.target,
+		}
+
+		err := sub.file(n.File)
+		l.prefixLists = append(l.prefixLists, sub.prefixLists...)
+
+		return err
+
+	case *ast.Include:
+		l.xsl.Includes = append(l.xsl.Includes, &xslt.Include{
+			Href: n.Href.Value,
+		})
+		return nil
+
+	case *ast.Output:
+		return l.output(n.Attributes, l.xsl.Output)
+
+	case *ast.Key:
+		l.xsl.Keys = append(l.xsl.Keys, &xslt.Key{
+			Name:  n.Name.Name,
+			Match: n.Match.Value,
+			Use:   n.Use.Value,
+		})
+		return nil
+
+	case *ast.Sub:
+		params, err := l.params(n.Params)
+		if err != nil {
+			return err
+		}
+
+		body, err := l.expr(n.Body)
+		if err != nil {
+			return err
+		}
+
+		l.xsl.Body = append(l.xsl.Body, &xslt.Template{
+			Name:   n.Name.Name,
+			Params: params,
+			Body:   body,
+		})
+		return nil
+
+	case *ast.Func:
+		return l.function(n)
+
+	case *ast.Template:
+		params, err := l.params(n.Params)
+		if err != nil {
+			return err
+		}
+
+		body, err := l.expr(n.Body)
+		if err != nil {
+			return err
+		}
+
+		template := &xslt.Template{
+			Match:  n.Match.Value,
+			Params: params,
+			Body:   body,
+		}
+
+		if n.Mode != nil {
+			template.Mode = n.Mode.Name.Name
+		}
+
+		if n.Priority != nil {
+			template.Priority = literal(n.Priority.Value)
+		}
+
+		l.xsl.Body = append(l.xsl.Body, template)
+		return nil
+
+	case *ast.Variable:
+		v, err := l.variable(n)
+		if err != nil {
+			return err
+		}
+
+		if n.Kind == ast.VarKindParam {
+			l.xsl.Body = append(l.xsl.Body, (*xslt.Param)(v))
+			return nil
+		}
+
+		l.xsl.Body = append(l.xsl.Body, v)
+		return nil
+	}
+
+	return errorf(stmt, "unexpected top-level statement: %T", stmt)
+}
+
+func comment(n *ast.Comment) *xslt.Comment {
+	return &xslt.Comment{
+		Body: n.Text,
+	}
+}
+
+// literal returns the value of an *ast.Ident, *ast.String, or *ast.Number.
+func literal(n ast.Node) string {
+	switch n := n.(type) {
+	case *ast.Ident:
+		return n.Name
+	case *ast.String:
+		return n.Value
+	case *ast.Number:
+		return n.Value
+	}
+
+	return ""
+}
+
+func (l *lowerer) output(m *ast.Map, out *xslt.Output) error {
+	if m == nil {
+		return nil
+	}
+
+	for _, entry := range m.Entries {
+		k, v := literal(entry.Key), literal(entry.Value)
+
+		switch k {
+		case "method":
+			out.Method = v
+		case "version":
+			out.Version = v
+		case "encoding":
+			out.Encoding = v
+		case "media-type":
+			out.MediaType = v
+
+		case "doctype-public":
+			out.DoctypePublic = v
+		case "doctype-system":
+			out.DoctypeSystem = v
+
+		case "cdata-section-elements":
+			var qnames xslt.QNames
+
+			elems := strings.Split(v, " ")
+			for _, elem := range elems {
+				if elem == "" {
+					continue
+				}
+
+				qnames = append(qnames, elem)
+			}
+
+			out.CDATASectionElements = qnames
+
+		case "omit-xml-declaration":
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return errorf(entry.Value, "bad boolean value: %v", err)
+			}
+			out.OmitXMLDeclaration = xslt.Bool(b)
+
+		case "standalone":
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return errorf(entry.Value, "bad boolean value: %v", err)
+			}
+			out.Standalone = xslt.Bool(b)
+
+		case "indent":
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return errorf(entry.Value, "bad boolean value: %v", err)
+			}
+			out.Indent = xslt.BoolVal(b)
+
+		default:
+			return errorf(entry.Key, "unknown output attribute: %q", k)
+		}
+	}
+
+	return nil
+}
+
+func (l *lowerer) namespace(n *ast.Namespace) error {
+	var prefix string
+	if n.Prefix != nil {
+		prefix = n.Prefix.Name
+	}
+
+	switch {
+	case prefix == "xml", prefix == "xmlns", strings.HasPrefix(prefix, "xmlns:"):
+		return errorf(n.Prefix, "reserved namespace prefix: %q", prefix)
+
+	case strings.Contains(prefix, ":"):
+		return errorf(n.Prefix, "invalid namespace prefix: %q", prefix)
+	}
+
+	if err := l.xsl.Declare(prefix, n.URI.Value); err != nil {
+		return errorf(n, "%v", err)
+	}
+
+	return nil
+}
+
+func (l *lowerer) stylesheet(n *ast.Stylesheet) error {
+	if n.Attributes == nil {
+		return errorf(n, "stylesheet requires a map of attributes")
+	}
+
+	for _, entry := range n.Attributes.Entries {
+		k, v := literal(entry.Key), literal(entry.Value)
+
+		switch k {
+		case "version":
+			version, err := xslt.ParseVersion(v)
+			if err != nil {
+				return errorf(entry.Value, "unsupported stylesheet version: %q", v)
+			}
+
+			// The source has already been checked against the target, and is lowered for it.
+			if version != l.target {
+				return errorf(entry.Value, "stylesheet version %q differs from the target, XSLT %s", v, l.target)
+			}
+
+		case "exclude-result-prefixes", "extension-element-prefixes":
+			l.prefixLists = append(l.prefixLists, entry)
+
+		default:
+			return errorf(entry.Key, "unknown stylesheet attribute: %q", k)
+		}
+
+		l.xsl.SetAttr(k, v)
+	}
+
+	return nil
+}
+
+// checkPrefixLists checks that each of the prefixes listed by the stylesheet directive is declared.
+// The known namespaces are declared whenever they are listed, so they need not be declared explicitly.
+func (l *lowerer) checkPrefixLists() error {
+	namespaces := l.xsl.Namespaces()
+
+	var errs []error
+
+	for _, entry := range l.prefixLists {
+		k, v := literal(entry.Key), literal(entry.Value)
+
+		for _, prefix := range strings.Fields(v) {
+			switch prefix {
+			case "#default":
+				if _, ok := namespaces[""]; !ok {
+					errs = append(errs, errorf(entry.Value, "%s lists #default, but no default namespace is declared", k))
+				}
+				continue
+
+			case "#all":
+				if k == "exclude-result-prefixes" && l.target >= xslt.XSLT20 {
+					continue
+				}
+			}
+
+			if _, ok := namespaces[prefix]; ok {
+				continue
+			}
+
+			if _, ok := xslt.KnownNamespaces[prefix]; ok {
+				continue
+			}
+
+			errs = append(errs, errorf(entry.Value, "%s lists the undeclared namespace prefix %q", k, prefix))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (l *lowerer) params(list *ast.VariableList) ([]*xslt.Param, error) {
+	if list == nil {
+		return nil, nil
+	}
+
+	var params []*xslt.Param
+
+	for _, v := range list.List {
+		param, err := l.variable(v)
+		if err != nil {
+			return nil, err
+		}
+
+		params = append(params, (*xslt.Param)(param))
+	}
+
+	return params, nil
+}
+
+func (l *lowerer) args(list *ast.VariableList) ([]*xslt.WithParam, error) {
+	if list == nil {
+		return nil, nil
+	}
+
+	var args []*xslt.WithParam
+
+	for _, v := range list.List {
+		arg, err := l.variable(v)
+		if err != nil {
+			return nil, err
+		}
+
+		args = append(args, (*xslt.WithParam)(arg))
+	}
+
+	return args, nil
+}
+
+func (l *lowerer) variable(n *ast.Variable) (*xslt.Variable, error) {
+	v := &xslt.Variable{
+		Name: n.Name.Name,
+	}
+
+	if n.As != nil {
+		v.As = literal(n.As.Type)
+	}
+
+	if n.Tunnel.IsValid() {
+		v.Tunnel = xslt.Bool(true)
+	}
+
+	switch val := n.Value.(type) {
+	case *ast.XPath:
+		v.Select = val.Value
+		return v, nil
+
+	case *ast.Number:
+		v.Select = val.Value
+		return v, nil
+
+	case *ast.String:
+		if val.Value == "" {
+			return v, nil
+		}
+	}
+
+	value, err := l.expr(n.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	v.Value = value
+	return v, nil
+}
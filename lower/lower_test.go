@@ -0,0 +1,113 @@
+package lower
+
+import (
+	"testing"
+
+	"github.com/puellanivis/lxt/ast"
+	"github.com/puellanivis/lxt/xslt"
+)
+
+func TestStylesheetWithoutAttributes(t *testing.T) {
+	file := &ast.File{
+		Statements: []ast.Node{
+			&ast.Stylesheet{
+				Keyword: ast.Pos{Line: 1, Column: 1},
+			},
+		},
+	}
+
+	err := File(file, xslt.NewStylesheet())
+
+	expect := "1:1: stylesheet requires a map of attributes"
+	if err == nil || err.Error() != expect {
+		t.Errorf("File gave error: %v\nexpected: %s", err, expect)
+	}
+}
+
+func stylesheetPrefixes(name, prefixes string) *ast.Stylesheet {
+	return &ast.Stylesheet{
+		Attributes: &ast.Map{
+			Entries: []*ast.MapEntry{{
+				Key:   &ast.Ident{Name: name},
+				Value: &ast.String{Value: prefixes},
+			}},
+		},
+	}
+}
+
+func namespace(prefix, uri string) *ast.Namespace {
+	return &ast.Namespace{
+		Prefix: &ast.Ident{Name: prefix},
+		URI:    &ast.String{Value: uri},
+	}
+}
+
+func TestStylesheetPrefixes(t *testing.T) {
+	tests := []struct {
+		target  string
+		stmts   []ast.Node
+		expect  string
+		exclude string
+	}{
+		{
+			// The namespaces may be declared after the stylesheet directive.
+			stmts: []ast.Node{
+				stylesheetPrefixes("exclude-result-prefixes", "my xs"),
+				namespace("my", "urn:my"),
+			},
+			exclude: "my xs",
+		},
+		{
+			stmts: []ast.Node{
+				stylesheetPrefixes("exclude-result-prefixes", "my nope"),
+				namespace("my", "urn:my"),
+			},
+			expect: `exclude-result-prefixes lists the undeclared namespace prefix "nope"`,
+		},
+		{
+			stmts: []ast.Node{
+				stylesheetPrefixes("extension-element-prefixes", "#default"),
+			},
+			expect: `extension-element-prefixes lists #default, but no default namespace is declared`,
+		},
+		{
+			stmts: []ast.Node{
+				stylesheetPrefixes("exclude-result-prefixes", "#all"),
+			},
+			expect: `exclude-result-prefixes lists the undeclared namespace prefix "#all"`,
+		},
+		{
+			target: "2.0",
+			stmts: []ast.Node{
+				stylesheetPrefixes("exclude-result-prefixes", "#all"),
+			},
+			exclude: "#all",
+		},
+	}
+
+	for _, tt := range tests {
+		xsl := xslt.NewStylesheet()
+		if tt.target != "" {
+			xsl.SetAttr("version", tt.target)
+		}
+
+		err := File(&ast.File{Statements: tt.stmts}, xsl)
+
+		var got string
+		if err != nil {
+			got = err.Error()
+		}
+
+		if got != tt.expect {
+			t.Errorf("File gave error: %v\nexpected: %s", err, tt.expect)
+		}
+
+		if tt.expect != "" {
+			continue
+		}
+
+		if exclude, _ := xsl.AttrValue("exclude-result-prefixes"); exclude != tt.exclude {
+			t.Errorf("exclude-result-prefixes was %q, expected %q", exclude, tt.exclude)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package lower
+
+import (
+	"strconv"
+
+	"github.com/puellanivis/lxt/ast"
+	"github.com/puellanivis/lxt/xslt"
+)
+
+// avt returns the attribute value template for an *ast.String or *ast.XPath.
+func avt(n ast.Node) string {
+	if x, ok := n.(*ast.XPath); ok {
+		return "{" + x.Value + "}"
+	}
+
+	return xslt.EscapeAVT(literal(n))
+}
+
+func (l *lowerer) analyzeString(n *ast.AnalyzeString) (*xslt.AnalyzeString, error) {
+	analyze := &xslt.AnalyzeString{
+		Select: n.Select.Value,
+		Regex:  avt(n.Regex),
+	}
+
+	if n.Flags != nil {
+		analyze.Flags = avt(n.Flags.Value)
+	}
+
+	if n.Matching != nil {
+		body, err := l.expr(n.Matching.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		// An empty branch is still given, as it discards the substrings rather than copying them.
+		if body == nil {
+			body = xslt.Group{}
+		}
+		analyze.Matching = body
+	}
+
+	if n.NonMatching != nil {
+		body, err := l.expr(n.NonMatching.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		if body == nil {
+			body = xslt.Group{}
+		}
+		analyze.NonMatching = body
+	}
+
+	return analyze, nil
+}
+
+func (l *lowerer) resultDocument(n *ast.ResultDocument) (*xslt.ResultDocument, error) {
+	body, err := l.expr(n.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &xslt.ResultDocument{
+		Href: avt(n.Href),
+		Body: body,
+	}
+
+	if n.Output == nil {
+		return doc, nil
+	}
+
+	for _, entry := range n.Output.Attributes.Entries {
+		k, v := literal(entry.Key), xslt.EscapeAVT(literal(entry.Value))
+
+		switch k {
+		case "format":
+			doc.Format = v
+		case "method":
+			doc.Method = v
+		case "version":
+			doc.Version = v
+		case "encoding":
+			doc.Encoding = v
+		case "media-type":
+			doc.MediaType = v
+
+		case "doctype-public":
+			doc.DoctypePublic = v
+		case "doctype-system":
+			doc.DoctypeSystem = v
+
+		case "omit-xml-declaration", "standalone", "indent":
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, errorf(entry.Value, "bad boolean value: %v", err)
+			}
+
+			switch k {
+			case "omit-xml-declaration":
+				doc.OmitXMLDeclaration = xslt.Bool(b)
+			case "standalone":
+				doc.Standalone = xslt.Bool(b)
+			case "indent":
+				doc.Indent = xslt.Bool(b)
+			}
+
+		default:
+			return nil, errorf(entry.Key, "unknown result-document output attribute: %q", k)
+		}
+	}
+
+	return doc, nil
+}
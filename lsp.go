@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	flag "github.com/puellanivis/breton/lib/gnuflag"
+	"github.com/puellanivis/breton/lib/os/process"
+
+	"github.com/puellanivis/lxt/lsp"
+)
+
+// serveLSP runs a language server over stdin and stdout, until the client exits.
+//
+//	lxt lsp
+func serveLSP(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("lsp", flag.ExitOnError)
+	fs.CopyFrom(flag.CommandLine, "target")
+	fs.CopyFrom(flag.CommandLine, "rebind")
+
+	if err := fs.Parse(args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		process.Exit(2)
+	}
+
+	server := &lsp.Server{
+		Version: process.Version(),
+		Target:  targetVersion(),
+		Rebind:  Flags.Rebind,
+	}
+
+	if err := server.Serve(ctx, os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "lsp:", err)
+		process.Exit(1)
+	}
+}
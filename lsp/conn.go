@@ -0,0 +1,114 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// conn reads and writes JSON-RPC messages framed by the headers of the LSP base protocol.
+type conn struct {
+	r *textproto.Reader
+	w io.Writer
+}
+
+func newConn(r io.Reader, w io.Writer) *conn {
+	return &conn{
+		r: textproto.NewReader(bufio.NewReader(r)),
+		w: w,
+	}
+}
+
+// read reads the next message.
+func (c *conn) read() (*message, error) {
+	header, err := c.r.ReadMIMEHeader()
+	if err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+
+	length, err := strconv.Atoi(strings.TrimSpace(header.Get("Content-Length")))
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("bad Content-Length: %q", header.Get("Content-Length"))
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.r.R, body); err != nil {
+		return nil, fmt.Errorf("reading body: %w", err)
+	}
+
+	msg := new(message)
+	if err := json.Unmarshal(body, msg); err != nil {
+		return nil, &ResponseError{
+			Code:    CodeParseError,
+			Message: err.Error(),
+		}
+	}
+
+	return msg, nil
+}
+
+// write writes the given message.
+func (c *conn) write(msg *message) error {
+	msg.JSONRPC = "2.0"
+
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return err
+	}
+
+	_, err = c.w.Write(body)
+	return err
+}
+
+// reply writes the response to the request with the given id.
+func (c *conn) reply(id *json.RawMessage, result interface{}, err error) error {
+	msg := &message{
+		ID: id,
+	}
+
+	if err != nil {
+		rerr, ok := err.(*ResponseError)
+		if !ok {
+			rerr = &ResponseError{
+				Code:    CodeInternalError,
+				Message: err.Error(),
+			}
+		}
+
+		msg.Error = rerr
+		return c.write(msg)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	msg.Result = data
+
+	return c.write(msg)
+}
+
+// notify writes a notification with the given method and parameters.
+func (c *conn) notify(method string, params interface{}) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	return c.write(&message{
+		Method: method,
+		Params: data,
+	})
+}
@@ -0,0 +1,479 @@
+package lsp
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"net/url"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/puellanivis/lxt/ast"
+	"github.com/puellanivis/lxt/check"
+	"github.com/puellanivis/lxt/lower"
+	"github.com/puellanivis/lxt/parser"
+	"github.com/puellanivis/lxt/tokenizer"
+	"github.com/puellanivis/lxt/xpath"
+	"github.com/puellanivis/lxt/xslt"
+)
+
+// document is an open text document, and the result of parsing it.
+type document struct {
+	uri      string
+	filename string
+
+	lines []string
+
+	// target is the version of XSLT that the document is compiled to.
+	target xslt.Version
+
+	file     *ast.File
+	errs     parser.ErrorList
+	warnings parser.ErrorList
+}
+
+// filenameOf returns the filename used in the positions of a document with the given URI.
+func filenameOf(uri string) string {
+	if u, err := url.Parse(uri); err == nil && u.Scheme == "file" {
+		return u.Path
+	}
+
+	return uri
+}
+
+func newDocument(ctx context.Context, uri, text string, target xslt.Version, rebind bool) *document {
+	d := &document{
+		uri:      uri,
+		filename: filenameOf(uri),
+		lines:    strings.Split(text, "\n"),
+		target:   target,
+	}
+
+	// Modules referenced by `use` are read from disk, so any unsaved changes to them are not seen.
+	file, err := parser.ParseTarget(ctx, strings.NewReader(text), d.filename, target)
+	d.file = file
+	d.errs.Add(err)
+
+	if err == nil {
+		checkFile := check.Files
+		if rebind {
+			// Rebinding renames variables within the syntax tree,
+			// so a separate copy is checked, leaving this one as it was written.
+			file, _ = parser.ParseTarget(ctx, strings.NewReader(text), d.filename, target)
+			checkFile = check.Rebind
+		}
+
+		errs, warnings := checkFile(target, file)
+		d.errs = append(d.errs, errs...)
+		d.warnings = warnings
+
+		d.errs.Add(lower.File(file, d.stylesheet()))
+	}
+
+	return d
+}
+
+// stylesheet returns a new stylesheet for lowering the document into.
+func (d *document) stylesheet() *xslt.Stylesheet {
+	xsl := xslt.NewStylesheet()
+	xsl.SetAttr("version", d.target.String())
+	return xsl
+}
+
+// diagnostics returns the errors and warnings of the document as diagnostics.
+func (d *document) diagnostics() []Diagnostic {
+	diags := []Diagnostic{}
+
+	diags = d.appendDiagnostics(diags, d.errs, SeverityError)
+	diags = d.appendDiagnostics(diags, d.warnings, SeverityWarning)
+
+	return diags
+}
+
+func (d *document) appendDiagnostics(diags []Diagnostic, errs parser.ErrorList, severity int) []Diagnostic {
+	for _, err := range errs {
+		if err.Pos.Filename != "" && err.Pos.Filename != d.filename {
+			continue
+		}
+
+		end := err.End
+		if !end.IsValid() || end.Before(err.Pos) {
+			end = err.Pos
+		}
+
+		diags = append(diags, Diagnostic{
+			Range:    Range{Start: d.position(err.Pos), End: d.position(end)},
+			Severity: severity,
+			Source:   "lxt",
+			Message:  err.Msg + errSuffix(err),
+		})
+	}
+
+	return diags
+}
+
+func errSuffix(err *tokenizer.Error) string {
+	if err.Err == nil {
+		return ""
+	}
+
+	return ": " + err.Err.Error()
+}
+
+// position converts a source position into an LSP position.
+func (d *document) position(pos tokenizer.Position) Position {
+	if !pos.IsValid() {
+		return Position{}
+	}
+
+	line := pos.Line - 1
+	if line >= len(d.lines) {
+		return Position{Line: line}
+	}
+
+	text := d.lines[line]
+
+	col := pos.Column - 1
+	if col > len(text) {
+		col = len(text)
+	}
+
+	return Position{
+		Line:      line,
+		Character: utf16Len(text[:col]),
+	}
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += len(utf16.Encode([]rune{r}))
+	}
+	return n
+}
+
+// sourcePos converts an LSP position into a source position, without an offset.
+func (d *document) sourcePos(pos Position) tokenizer.Position {
+	col := 0
+
+	if pos.Line < len(d.lines) {
+		text := d.lines[pos.Line]
+
+		for units := 0; col < len(text) && units < pos.Character; {
+			r, sz := utf8.DecodeRuneInString(text[col:])
+			units += len(utf16.Encode([]rune{r}))
+			col += sz
+		}
+	}
+
+	return tokenizer.Position{
+		Filename: d.filename,
+		Line:     pos.Line + 1,
+		Column:   col + 1,
+	}
+}
+
+func (d *document) rangeOf(n ast.Node) Range {
+	return Range{
+		Start: d.position(n.Pos()),
+		End:   d.position(n.End()),
+	}
+}
+
+// before reports whether the position p is before the position q, comparing lines and columns.
+func before(p, q tokenizer.Position) bool {
+	if p.Line != q.Line {
+		return p.Line < q.Line
+	}
+
+	return p.Column < q.Column
+}
+
+// contains reports whether the node spans the position, including the position immediately after its end.
+func contains(n ast.Node, pos tokenizer.Position) bool {
+	return !before(pos, n.Pos()) && !before(n.End(), pos)
+}
+
+// path returns the nodes spanning the position, from the top-level statement to the innermost node.
+func (d *document) path(pos tokenizer.Position) []ast.Node {
+	var path []ast.Node
+
+	if d.file == nil {
+		return nil
+	}
+
+	ast.InspectFile(d.file, func(n ast.Node) bool {
+		if !contains(n, pos) {
+			return false
+		}
+
+		path = append(path, n)
+		return true
+	})
+
+	return path
+}
+
+// variableAt returns the name of the variable referenced within the XPath at the position, if there is one.
+func variableAt(x *ast.XPath, pos tokenizer.Position) (string, bool) {
+	var name string
+
+	xpath.Inspect(x.Expr, func(expr xpath.Expr) bool {
+		ref, ok := expr.(*xpath.VariableRef)
+		if !ok {
+			return name == ""
+		}
+
+		start := x.Offset(ref.Pos())
+		end := x.Offset(ref.End())
+
+		if !before(pos, start) && !before(end, pos) {
+			name = ref.Name.String()
+		}
+
+		return name == ""
+	})
+
+	return name, name != ""
+}
+
+// definition returns the declaration of the sub or variable referenced at the position.
+func (d *document) definition(pos tokenizer.Position) (ast.Node, error) {
+	path := d.path(pos)
+	if len(path) == 0 {
+		return nil, nil
+	}
+
+	switch n := path[len(path)-1].(type) {
+	case *ast.Ident:
+		if len(path) < 2 {
+			return nil, nil
+		}
+
+		switch parent := path[len(path)-2].(type) {
+		case *ast.Call:
+			if sub := d.sub(n.Name); sub != nil {
+				return sub.Name, nil
+			}
+
+		case *ast.Variable:
+			if parent.Kind != ast.VarKindArgument || len(path) < 4 {
+				return parent.Name, nil
+			}
+
+			// An argument of a call refers to the parameter of the sub being called.
+			call, ok := path[len(path)-4].(*ast.Call)
+			if !ok {
+				return nil, nil
+			}
+
+			if sub := d.sub(call.Name.Name); sub != nil {
+				if param := findParam(sub.Params, n.Name); param != nil {
+					return param, nil
+				}
+			}
+
+		case *ast.Sub:
+			return parent.Name, nil
+		}
+
+	case *ast.XPath:
+		if n.Expr == nil {
+			return nil, errors.New("invalid xpath")
+		}
+
+		name, ok := variableAt(n, pos)
+		if !ok {
+			return nil, nil
+		}
+
+		return d.lookup(path, name), nil
+	}
+
+	return nil, nil
+}
+
+// sub returns the sub with the given name, if it is defined in the document.
+func (d *document) sub(name string) *ast.Sub {
+	for _, stmt := range d.file.Statements {
+		if sub, ok := stmt.(*ast.Sub); ok && sub.Name.Name == name {
+			return sub
+		}
+	}
+
+	return nil
+}
+
+// lookup returns the name of the declaration of the variable or parameter with the given name,
+// that is in scope at the innermost node of the path.
+//
+// As in XSLT, a variable is in scope for the siblings that follow it, and their descendants.
+func (d *document) lookup(path []ast.Node, name string) ast.Node {
+	for i := len(path) - 2; i >= 0; i-- {
+		switch n := path[i].(type) {
+		case *ast.Group:
+			inner := path[i+1]
+
+			var found ast.Node
+			for _, child := range n.List {
+				if child == inner {
+					break
+				}
+
+				if g, ok := child.(*ast.Group); ok && g.Delim == "" {
+					// A variable with doc comments attached.
+					child = g.List[len(g.List)-1]
+				}
+
+				if v, ok := child.(*ast.Variable); ok && v.Name.Name == name {
+					found = v.Name
+				}
+			}
+
+			if found != nil {
+				return found
+			}
+
+		case *ast.Sub:
+			if v := findParam(n.Params, name); v != nil {
+				return v
+			}
+
+		case *ast.Template:
+			if v := findParam(n.Params, name); v != nil {
+				return v
+			}
+		}
+	}
+
+	for _, stmt := range d.file.Statements {
+		if v, ok := stmt.(*ast.Variable); ok && v.Name.Name == name {
+			return v.Name
+		}
+	}
+
+	return nil
+}
+
+func findParam(params *ast.VariableList, name string) ast.Node {
+	if params == nil {
+		return nil
+	}
+
+	for _, v := range params.List {
+		if v.Name.Name == name {
+			return v.Name
+		}
+	}
+
+	return nil
+}
+
+// hover returns the XSLT emitted for the innermost construct at the position.
+func (d *document) hover(pos tokenizer.Position) (string, ast.Node, error) {
+	path := d.path(pos)
+
+	for i := len(path) - 1; i >= 0; i-- {
+		n := path[i]
+
+		if i == 0 {
+			xsl := d.stylesheet()
+
+			// Namespaces are declared first, as a func may depend upon them.
+			var stmts []ast.Node
+			for _, stmt := range d.file.Statements {
+				if ns, ok := stmt.(*ast.Namespace); ok && ns != n {
+					stmts = append(stmts, ns)
+				}
+			}
+
+			if err := lower.File(&ast.File{Statements: append(stmts, n)}, xsl); err != nil {
+				return "", nil, err
+			}
+
+			var out interface{} = xsl.Body
+			switch n.(type) {
+			case *ast.Import:
+				out = xsl.Imports
+			case *ast.Include:
+				out = xsl.Includes
+			case *ast.Output:
+				out = xsl.Output
+			case *ast.Key:
+				out = xsl.Keys
+			}
+
+			s, err := marshal(out)
+			return s, n, err
+		}
+
+		if !isExpr(n, path[i-1]) {
+			continue
+		}
+
+		out, err := lower.Expr(n, d.stylesheet())
+		if err != nil {
+			return "", nil, err
+		}
+
+		s, err := marshal(out)
+		return s, n, err
+	}
+
+	return "", nil, nil
+}
+
+// isExpr reports whether the node, with the given parent, is an expression that lowers to XSLT on its own.
+func isExpr(n, parent ast.Node) bool {
+	switch n := n.(type) {
+	case *ast.Variable:
+		return n.Kind == ast.VarKindVar
+
+	case *ast.String, *ast.Interpolated, *ast.XPath, *ast.Number:
+		// These are only output on their own when used as a body,
+		// rather than as the select of a loop, the test of a condition, and so on.
+		return isBody(n, parent)
+
+	case *ast.Text, *ast.CopyOf, *ast.ForEach, *ast.GroupBy, *ast.ApplyTemplates, *ast.Choose,
+		*ast.If, *ast.Call, *ast.Tag, *ast.Attribs, *ast.HTMLElement:
+		return true
+	}
+
+	return false
+}
+
+// isBody reports whether the node is a body of its parent.
+func isBody(n, parent ast.Node) bool {
+	switch p := parent.(type) {
+	case *ast.Group:
+		return true
+	case *ast.Attrib:
+		return p.Value == n
+	case *ast.When:
+		return p.Body == n
+	case *ast.Otherwise:
+		return p.Body == n
+	case *ast.If:
+		return p.Body == n
+	case *ast.ForEach:
+		return p.Body == n
+	case *ast.GroupBy:
+		return p.Body == n
+	case *ast.Tag:
+		return p.Body == n
+	case *ast.HTMLElement:
+		return p.Body == n
+	}
+
+	return false
+}
+
+func marshal(v interface{}) (string, error) {
+	data, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
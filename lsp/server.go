@@ -0,0 +1,267 @@
+// Package lsp implements a Language Server Protocol server for LXT, communicating over a stream such as stdio.
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/puellanivis/lxt/parser"
+	"github.com/puellanivis/lxt/xslt"
+)
+
+// Server is a language server for LXT source files.
+type Server struct {
+	// Version is reported to the client as the version of the server.
+	Version string
+
+	// Target is the version of XSLT that documents are compiled to, or XSLT 1.0 if it is zero.
+	Target xslt.Version
+
+	// Rebind allows a local var to redefine a name already in scope, as with check.Rebind.
+	Rebind bool
+
+	conn *conn
+	docs map[string]*document
+
+	shutdown bool
+}
+
+// Serve runs a language server reading requests from r, and writing responses to w,
+// until the client exits, or the input is closed.
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	s.conn = newConn(r, w)
+	s.docs = make(map[string]*document)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		msg, err := s.conn.read()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+
+			if rerr, ok := err.(*ResponseError); ok {
+				// A malformed message has no usable id, so the error is sent with a null id.
+				null := json.RawMessage("null")
+				if err := s.conn.reply(&null, nil, rerr); err != nil {
+					return err
+				}
+				continue
+			}
+
+			return err
+		}
+
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return fmt.Errorf("exit without shutdown")
+			}
+
+			return nil
+		}
+
+		result, err := s.handle(ctx, msg)
+
+		if msg.ID == nil {
+			// Notifications have no response, even on error.
+			continue
+		}
+
+		if err := s.conn.reply(msg.ID, result, err); err != nil {
+			return err
+		}
+	}
+}
+
+// handle dispatches the message to the handler of its method.
+func (s *Server) handle(ctx context.Context, msg *message) (interface{}, error) {
+	if s.shutdown && msg.Method != "exit" {
+		return nil, &ResponseError{
+			Code:    CodeInvalidRequest,
+			Message: "server is shut down",
+		}
+	}
+
+	switch msg.Method {
+	case "initialize":
+		return s.initialize()
+
+	case "initialized":
+		return nil, nil
+
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+
+	case "textDocument/didOpen":
+		var params DidOpenTextDocumentParams
+		if err := unmarshal(msg.Params, &params); err != nil {
+			return nil, err
+		}
+
+		return nil, s.update(ctx, params.TextDocument.URI, params.TextDocument.Text)
+
+	case "textDocument/didChange":
+		var params DidChangeTextDocumentParams
+		if err := unmarshal(msg.Params, &params); err != nil {
+			return nil, err
+		}
+
+		if len(params.ContentChanges) == 0 {
+			return nil, nil
+		}
+
+		// Only full document sync is offered, so the last change holds the whole document.
+		text := params.ContentChanges[len(params.ContentChanges)-1].Text
+		return nil, s.update(ctx, params.TextDocument.URI, text)
+
+	case "textDocument/didClose":
+		var params DidCloseTextDocumentParams
+		if err := unmarshal(msg.Params, &params); err != nil {
+			return nil, err
+		}
+
+		delete(s.docs, params.TextDocument.URI)
+
+		return nil, s.conn.notify("textDocument/publishDiagnostics", &PublishDiagnosticsParams{
+			URI:         params.TextDocument.URI,
+			Diagnostics: []Diagnostic{},
+		})
+
+	case "textDocument/definition":
+		return s.positionRequest(msg, s.definition)
+
+	case "textDocument/hover":
+		return s.positionRequest(msg, s.hover)
+
+	case "textDocument/completion":
+		return s.positionRequest(msg, s.completion)
+	}
+
+	return nil, &ResponseError{
+		Code:    CodeMethodNotFound,
+		Message: fmt.Sprintf("method not found: %s", msg.Method),
+	}
+}
+
+func unmarshal(data json.RawMessage, v interface{}) error {
+	if err := json.Unmarshal(data, v); err != nil {
+		return &ResponseError{
+			Code:    CodeInvalidParams,
+			Message: err.Error(),
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) initialize() (interface{}, error) {
+	return &InitializeResult{
+		Capabilities: ServerCapabilities{
+			TextDocumentSync:   TextDocumentSyncFull,
+			DefinitionProvider: true,
+			HoverProvider:      true,
+			CompletionProvider: &CompletionOptions{},
+		},
+		ServerInfo: &ServerInfo{
+			Name:    "lxt",
+			Version: s.Version,
+		},
+	}, nil
+}
+
+// update parses the new text of the document, and publishes its diagnostics.
+func (s *Server) update(ctx context.Context, uri, text string) error {
+	target := s.Target
+	if target == 0 {
+		target = xslt.XSLT10
+	}
+
+	doc := newDocument(ctx, uri, text, target, s.Rebind)
+	s.docs[uri] = doc
+
+	return s.conn.notify("textDocument/publishDiagnostics", &PublishDiagnosticsParams{
+		URI:         uri,
+		Diagnostics: doc.diagnostics(),
+	})
+}
+
+// positionRequest decodes the parameters of a request made at a position in a document,
+// and calls the given handler with that document and position.
+func (s *Server) positionRequest(msg *message, fn func(*document, Position) (interface{}, error)) (interface{}, error) {
+	var params TextDocumentPositionParams
+	if err := unmarshal(msg.Params, &params); err != nil {
+		return nil, err
+	}
+
+	doc := s.docs[params.TextDocument.URI]
+	if doc == nil {
+		return nil, &ResponseError{
+			Code:    CodeInvalidParams,
+			Message: fmt.Sprintf("document not open: %s", params.TextDocument.URI),
+		}
+	}
+
+	return fn(doc, params.Position)
+}
+
+func (s *Server) definition(doc *document, pos Position) (interface{}, error) {
+	def, err := doc.definition(doc.sourcePos(pos))
+	if err != nil || def == nil {
+		return nil, nil
+	}
+
+	return &Location{
+		URI:   doc.uri,
+		Range: doc.rangeOf(def),
+	}, nil
+}
+
+func (s *Server) hover(doc *document, pos Position) (interface{}, error) {
+	out, n, err := doc.hover(doc.sourcePos(pos))
+	if err != nil || out == "" {
+		return nil, nil
+	}
+
+	r := doc.rangeOf(n)
+
+	return &Hover{
+		Contents: MarkupContent{
+			Kind:  "markdown",
+			Value: "```xml\n" + out + "\n```",
+		},
+		Range: &r,
+	}, nil
+}
+
+// completion offers the keywords that may begin an expression, and the HTML elements that have sugar,
+// as well as the keywords that may begin a statement, if the position is not within any statement.
+func (s *Server) completion(doc *document, pos Position) (interface{}, error) {
+	keywords := append(append([]string{}, parser.ExpressionKeywords...), parser.HTMLElements()...)
+
+	if len(doc.path(doc.sourcePos(pos))) == 0 {
+		keywords = append(parser.StatementKeywords(), keywords...)
+	}
+
+	items := []CompletionItem{}
+	seen := make(map[string]bool)
+
+	for _, keyword := range keywords {
+		if seen[keyword] {
+			continue
+		}
+		seen[keyword] = true
+
+		items = append(items, CompletionItem{
+			Label: keyword,
+			Kind:  CompletionItemKindKeyword,
+		})
+	}
+
+	return items, nil
+}
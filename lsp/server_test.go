@@ -0,0 +1,248 @@
+package lsp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const testURI = "file:///test.lxt"
+
+const testSource = `param title = "Hi"
+
+sub header ( level => <1> ) {
+	tag h1 { $title $level }
+}
+
+template </> {
+	var x = <{ count(item) }>
+	call header ( level => $x )
+	foreach <item> { if <{ $x > 1 }> "many" }
+}
+`
+
+// session runs the server over the given requests, and returns the messages it wrote.
+func session(t *testing.T, requests ...interface{}) []*message {
+	t.Helper()
+
+	var in bytes.Buffer
+	for _, req := range requests {
+		data, err := json.Marshal(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(data), data)
+	}
+
+	var out bytes.Buffer
+	if err := new(Server).Serve(context.Background(), &in, &out); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	c := newConn(&out, nil)
+
+	var msgs []*message
+	for {
+		msg, err := c.read()
+		if err != nil {
+			break
+		}
+
+		msgs = append(msgs, msg)
+	}
+
+	return msgs
+}
+
+func request(id int, method string, params interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"method":  method,
+		"params":  params,
+	}
+}
+
+func notification(method string, params interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  method,
+		"params":  params,
+	}
+}
+
+func open(text string) map[string]interface{} {
+	return notification("textDocument/didOpen", &DidOpenTextDocumentParams{
+		TextDocument: TextDocumentItem{
+			URI:        testURI,
+			LanguageID: "lxt",
+			Text:       text,
+		},
+	})
+}
+
+func at(id int, method string, line, char int) map[string]interface{} {
+	return request(id, method, &TextDocumentPositionParams{
+		TextDocument: TextDocumentIdentifier{URI: testURI},
+		Position:     Position{Line: line, Character: char},
+	})
+}
+
+// response returns the result of the response with the given id, decoded into v.
+func response(t *testing.T, msgs []*message, id int, v interface{}) {
+	t.Helper()
+
+	for _, msg := range msgs {
+		if msg.ID == nil || string(*msg.ID) != fmt.Sprint(id) {
+			continue
+		}
+
+		if msg.Error != nil {
+			t.Fatalf("request %d: unexpected error: %v", id, msg.Error)
+		}
+
+		if err := json.Unmarshal(msg.Result, v); err != nil {
+			t.Fatalf("request %d: %v", id, err)
+		}
+		return
+	}
+
+	t.Fatalf("no response to request %d", id)
+}
+
+func TestDiagnostics(t *testing.T) {
+	msgs := session(t,
+		request(1, "initialize", struct{}{}),
+		open("sub a {\n\tif <{ count( }> \"x\"\n}\n"),
+		request(2, "shutdown", nil),
+		notification("exit", nil),
+	)
+
+	var diags *PublishDiagnosticsParams
+	for _, msg := range msgs {
+		if msg.Method == "textDocument/publishDiagnostics" {
+			diags = new(PublishDiagnosticsParams)
+			if err := json.Unmarshal(msg.Params, diags); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if diags == nil {
+		t.Fatal("no diagnostics were published")
+	}
+
+	if len(diags.Diagnostics) != 1 {
+		t.Fatalf("got %d diagnostics, expected 1: %v", len(diags.Diagnostics), diags.Diagnostics)
+	}
+
+	if diag := diags.Diagnostics[0]; diag.Range.Start.Line != 1 || !strings.Contains(diag.Message, "invalid xpath") {
+		t.Errorf("unexpected diagnostic: %+v", diag)
+	}
+}
+
+func TestDefinition(t *testing.T) {
+	msgs := session(t,
+		request(1, "initialize", struct{}{}),
+		open(testSource),
+		at(2, "textDocument/definition", 8, 8),  // call header
+		at(3, "textDocument/definition", 3, 11), // $title
+		at(4, "textDocument/definition", 3, 18), // $level
+		at(5, "textDocument/definition", 8, 25), // $x
+		at(6, "textDocument/definition", 9, 25), // $x in a complex xpath
+		at(7, "textDocument/definition", 8, 17), // level =>
+		at(8, "textDocument/definition", 6, 3),  // template
+		request(9, "shutdown", nil),
+		notification("exit", nil),
+	)
+
+	expect := map[int]*Position{
+		2: {Line: 2, Character: 4},
+		3: {Line: 0, Character: 6},
+		4: {Line: 2, Character: 13},
+		5: {Line: 7, Character: 5},
+		6: {Line: 7, Character: 5},
+		7: {Line: 2, Character: 13},
+		8: nil,
+	}
+
+	for id, pos := range expect {
+		var loc *Location
+		response(t, msgs, id, &loc)
+
+		switch {
+		case pos == nil && loc != nil:
+			t.Errorf("request %d: got %+v, expected no location", id, loc.Range.Start)
+
+		case pos != nil && loc == nil:
+			t.Errorf("request %d: got no location, expected %+v", id, *pos)
+
+		case pos != nil && loc.Range.Start != *pos:
+			t.Errorf("request %d: got %+v, expected %+v", id, loc.Range.Start, *pos)
+		}
+	}
+}
+
+func TestHover(t *testing.T) {
+	msgs := session(t,
+		request(1, "initialize", struct{}{}),
+		open(testSource),
+		at(2, "textDocument/hover", 9, 36), // "many"
+		at(3, "textDocument/hover", 8, 3),  // call header
+		request(4, "shutdown", nil),
+		notification("exit", nil),
+	)
+
+	expect := map[int]string{
+		2: `<xsl:text>many</xsl:text>`,
+		3: `<xsl:call-template name="header">`,
+	}
+
+	for id, want := range expect {
+		var hover *Hover
+		response(t, msgs, id, &hover)
+
+		if hover == nil {
+			t.Errorf("request %d: no hover", id)
+			continue
+		}
+
+		if !strings.Contains(hover.Contents.Value, want) {
+			t.Errorf("request %d: hover was %q, expected it to contain %q", id, hover.Contents.Value, want)
+		}
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	msgs := session(t,
+		request(1, "initialize", struct{}{}),
+		open(testSource),
+		at(2, "textDocument/completion", 9, 1),
+		at(3, "textDocument/completion", 11, 0),
+		request(4, "shutdown", nil),
+		notification("exit", nil),
+	)
+
+	labels := func(id int) map[string]bool {
+		var items []CompletionItem
+		response(t, msgs, id, &items)
+
+		m := make(map[string]bool)
+		for _, item := range items {
+			m[item.Label] = true
+		}
+		return m
+	}
+
+	if got := labels(2); !got["foreach"] || !got["div"] || got["sub"] {
+		t.Errorf("completion within a template gave %v", got)
+	}
+
+	if got := labels(3); !got["foreach"] || !got["sub"] {
+		t.Errorf("completion at the top-level gave %v", got)
+	}
+}
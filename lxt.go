@@ -14,6 +14,9 @@ import (
 	flag "github.com/puellanivis/breton/lib/gnuflag"
 	"github.com/puellanivis/breton/lib/os/process"
 
+	"github.com/puellanivis/lxt/ast"
+	"github.com/puellanivis/lxt/check"
+	"github.com/puellanivis/lxt/lower"
 	"github.com/puellanivis/lxt/parser"
 	"github.com/puellanivis/lxt/xslt"
 )
@@ -24,7 +27,10 @@ var (
 )
 
 var Flags struct {
-	Output string `flag:",short=o" desc:"Specifies which URI to write the output to."`
+	Output    string `flag:",short=o" desc:"Specifies which URI to write the output to."`
+	MaxErrors int    `flag:",default=10" desc:"Specifies the maximum number of errors to report, or 0 to report all errors."`
+	Target    string `flag:",default=1.0" desc:"Specifies the version of XSLT to compile to: 1.0, 2.0, or 3.0."`
+	Rebind    bool   `desc:"Allows a local var to redefine a name already in scope, by renaming it in the XSLT."`
 }
 
 func init() {
@@ -48,10 +54,21 @@ func getOutput(ctx context.Context, filename string) (io.WriteCloser, error) {
 	return out, nil
 }
 
-func parseFile(ctx context.Context, filename string, xsl *xslt.Stylesheet) error {
+// targetVersion returns the version of XSLT given by the --target flag, exiting the process if it is not valid.
+func targetVersion() xslt.Version {
+	v, err := xslt.ParseVersion(Flags.Target)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "--target:", err)
+		process.Exit(2)
+	}
+
+	return v
+}
+
+func parseFile(ctx context.Context, filename string, target xslt.Version, uses *parser.Uses) (*ast.File, error) {
 	in, err := files.Open(ctx, filename)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer in.Close()
 
@@ -63,26 +80,70 @@ func parseFile(ctx context.Context, filename string, xsl *xslt.Stylesheet) error
 		}
 	}
 
-	return parser.ParseFile(ctx, in, in.Name(), xsl)
+	return parser.ParseUses(ctx, in, in.Name(), target, uses)
 }
 
-func main() {
-	ctx, finish := process.Init("lxt", Version, Buildstamp)
-	defer finish()
+func printErrors(errs parser.ErrorList) {
+	for i, err := range errs {
+		if Flags.MaxErrors > 0 && i >= Flags.MaxErrors {
+			fmt.Fprintf(os.Stderr, "too many errors (%d more)\n", len(errs)-i)
+			return
+		}
 
-	filenames := flag.Args()
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
 
+// compile parses the given LXT files into a single Stylesheet, printing any errors and warnings.
+// If any errors are found, then it exits the process.
+func compile(ctx context.Context, filenames []string) *xslt.Stylesheet {
 	if len(filenames) < 1 {
 		filenames = append(filenames, "-")
 	}
 
+	target := targetVersion()
+
 	xsl := xslt.NewStylesheet()
+	xsl.SetAttr("version", target.String())
+
+	var errs parser.ErrorList
+	var parsed []*ast.File
+
+	// The files share the modules they use, so that a module used by more than one file is only inlined once.
+	uses := parser.NewUses()
 
 	for _, filename := range filenames {
-		if err := parseFile(ctx, filename, xsl); err != nil {
-			fmt.Fprintln(os.Stderr, "parseFile:", err)
-			process.Exit(1)
+		file, err := parseFile(ctx, filename, target, uses)
+		if err != nil {
+			errs.Add(err)
+			continue
 		}
+
+		parsed = append(parsed, file)
+	}
+
+	var warnings parser.ErrorList
+
+	if len(errs) == 0 {
+		// The files are only checked once they all parse, as any erroneous statements are missing.
+		checkFiles := check.Files
+		if Flags.Rebind {
+			checkFiles = check.Rebind
+		}
+
+		var checkErrs parser.ErrorList
+		checkErrs, warnings = checkFiles(target, parsed...)
+		errs = append(errs, checkErrs...)
+	}
+
+	// Rebinding renames variables within the syntax tree, so the files are lowered only after checking.
+	for _, file := range parsed {
+		errs.Add(lower.File(file, xsl))
+	}
+
+	if len(errs) > 0 {
+		printErrors(errs)
+		process.Exit(1)
 	}
 
 	select {
@@ -91,6 +152,45 @@ func main() {
 	default:
 	}
 
+	for _, warning := range warnings {
+		fmt.Fprintln(os.Stderr, "warning:", warning)
+	}
+
+	for _, warning := range parser.Check(parsed...) {
+		fmt.Fprintln(os.Stderr, "warning:", warning)
+	}
+
+	return xsl
+}
+
+func main() {
+	ctx, finish := process.Init("lxt", Version, Buildstamp)
+	defer finish()
+
+	args := flag.Args()
+
+	if len(args) > 0 {
+		switch args[0] {
+		case "run":
+			run(ctx, args[1:])
+			return
+
+		case "decompile":
+			decompileXSLT(ctx, args[1:])
+			return
+
+		case "fmt":
+			format(ctx, args[1:])
+			return
+
+		case "lsp":
+			serveLSP(ctx, args[1:])
+			return
+		}
+	}
+
+	xsl := compile(ctx, args)
+
 	data, err := xml.MarshalIndent(xsl, "", "\t")
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "xml.MarshalIndent:", err)
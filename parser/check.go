@@ -0,0 +1,62 @@
+package parser
+
+import (
+	"fmt"
+
+	"github.com/puellanivis/lxt/ast"
+	"github.com/puellanivis/lxt/tokenizer"
+)
+
+// Check inspects the parsed syntax trees, and the modules they use, for constructs that are valid XSLT,
+// but which are likely to be mistakes. It returns a warning for each one found, at its position.
+func Check(files ...*ast.File) ErrorList {
+	modes := make(map[string]bool)
+	var applies []*ast.ApplyTemplates
+
+	var inspect func(file *ast.File)
+	inspect = func(file *ast.File) {
+		ast.InspectFile(file, func(node ast.Node) bool {
+			switch n := node.(type) {
+			case *ast.Use:
+				if n.File != nil {
+					inspect(n.File)
+				}
+
+			case *ast.Template:
+				if n.Mode != nil {
+					modes[n.Mode.Name.Name] = true
+				}
+
+			case *ast.ApplyTemplates:
+				if n.Mode != nil {
+					applies = append(applies, n)
+				}
+			}
+
+			return true
+		})
+	}
+
+	for _, file := range files {
+		inspect(file)
+	}
+
+	var warnings ErrorList
+	reported := make(map[string]bool)
+
+	for _, apply := range applies {
+		name := apply.Mode.Name
+		if modes[name.Name] || reported[name.Name] {
+			continue
+		}
+		reported[name.Name] = true
+
+		warnings.Add(&tokenizer.Error{
+			Pos: name.Pos(),
+			End: name.End(),
+			Msg: fmt.Sprintf("apply-templates mode %q has no matching template", name.Name),
+		})
+	}
+
+	return warnings
+}
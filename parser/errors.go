@@ -0,0 +1,192 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/puellanivis/lxt/tokenizer"
+)
+
+// ErrorList is a list of errors found while parsing, in the order in which they were found.
+type ErrorList []*tokenizer.Error
+
+// Add appends the given error to the list.
+// Any ErrorList, or errors joined with errors.Join, are flattened into the list.
+func (l *ErrorList) Add(err error) {
+	switch err := err.(type) {
+	case nil:
+		return
+
+	case *tokenizer.Error:
+		*l = append(*l, err)
+
+	case ErrorList:
+		*l = append(*l, err...)
+
+	case interface{ Unwrap() []error }:
+		for _, err := range err.Unwrap() {
+			l.Add(err)
+		}
+
+	default:
+		if errors.Is(err, errRecovered) {
+			// This error has already been added.
+			return
+		}
+
+		*l = append(*l, &tokenizer.Error{
+			Msg: err.Error(),
+		})
+	}
+}
+
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+
+	return fmt.Sprintf("%s (and %d more errors)", l[0], len(l)-1)
+}
+
+// Unwrap returns the errors in the list, so that errors.Is and errors.As inspect each of them.
+func (l ErrorList) Unwrap() []error {
+	errs := make([]error, len(l))
+	for i, err := range l {
+		errs[i] = err
+	}
+	return errs
+}
+
+// Err returns an error equivalent to this error list.
+// If the list is empty, Err returns nil.
+func (l ErrorList) Err() error {
+	if len(l) == 0 {
+		return nil
+	}
+
+	return l
+}
+
+// errRecovered is returned when a parse error has already been added to the error list,
+// but recovery must continue at an enclosing level.
+var errRecovered = errors.New("recovered from parse error")
+
+// topLevelKeywords are the keywords that may begin a top-level statement.
+// The boolean value reports whether the keyword may only begin a top-level statement.
+var topLevelKeywords = map[string]bool{
+	"output":     true,
+	"namespace":  true,
+	"stylesheet": true,
+	"import":     true,
+	"include":    true,
+	"use":        true,
+	"key":        true,
+	"sub":        true,
+	"func":       true,
+	"template":   true,
+	"param":      true,
+	"var":        false,
+}
+
+// StatementKeywords returns the keywords that may begin a top-level statement, in sorted order.
+func StatementKeywords() []string {
+	var keywords []string
+	for keyword := range topLevelKeywords {
+		keywords = append(keywords, keyword)
+	}
+
+	sort.Strings(keywords)
+	return keywords
+}
+
+// syncStatement skips tokens until the start of the next top-level statement,
+// where start is the token at which the failed statement began.
+func (r *Reader) syncStatement(ctx context.Context, start tokenizer.Token) {
+	var depth int
+
+	for ctx.Err() == nil {
+		tok, _ := r.peak(ctx)
+
+		switch tok.Type {
+		case tokenizer.TokenTypeEOF:
+			return
+
+		case tokenizer.TokenTypeBeginGroup:
+			depth++
+
+		case tokenizer.TokenTypeEndGroup:
+			if depth > 0 {
+				depth--
+			}
+
+		case tokenizer.TokenTypeOperator:
+			if depth == 0 && tok.Value == ";" {
+				r.consume()
+				return
+			}
+
+		case tokenizer.TokenTypeIdentifier:
+			_, isKeyword := topLevelKeywords[tok.Value]
+
+			// Never stop at the start token, so that we always make progress.
+			if depth == 0 && isKeyword && tok.Pos != start.Pos {
+				return
+			}
+		}
+
+		r.consume()
+	}
+}
+
+// syncGroup skips tokens until the start of the next expression in the current group,
+// or the end of the current group.
+// If the group cannot be recovered, then errRecovered is returned.
+func (r *Reader) syncGroup(ctx context.Context) error {
+	var depth int
+
+	for ctx.Err() == nil {
+		tok, _ := r.peak(ctx)
+
+		switch tok.Type {
+		case tokenizer.TokenTypeEOF:
+			return errRecovered
+
+		case tokenizer.TokenTypeBeginGroup:
+			depth++
+
+		case tokenizer.TokenTypeEndGroup:
+			if depth == 0 {
+				// Whether this matches the group is checked by the caller.
+				return nil
+			}
+
+			depth--
+			if depth == 0 {
+				// The body of the failed expression most likely ends here.
+				r.consume()
+				return nil
+			}
+
+		case tokenizer.TokenTypeOperator:
+			if depth == 0 && tok.Value == ";" {
+				r.consume()
+				return nil
+			}
+
+		case tokenizer.TokenTypeIdentifier:
+			if topLevelKeywords[tok.Value] {
+				// The group is most likely missing its end.
+				return errRecovered
+			}
+		}
+
+		r.consume()
+	}
+
+	return errRecovered
+}
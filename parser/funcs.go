@@ -0,0 +1,174 @@
+package parser
+
+import (
+	"context"
+	"strings"
+
+	"github.com/puellanivis/lxt/ast"
+	"github.com/puellanivis/lxt/tokenizer"
+	"github.com/puellanivis/lxt/xslt"
+)
+
+// parseFunc parses a stylesheet function: `func prefix:name ( $param as type, … ) as type body`.
+// The current token is expected to be the `func` keyword.
+func (r *Reader) parseFunc(ctx context.Context) (*ast.Func, error) {
+	fn := &ast.Func{
+		Keyword: r.pos,
+	}
+
+	name, err := r.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if name.Type != tokenizer.TokenTypeIdentifier {
+		return nil, r.parseError("expected identifier")
+	}
+
+	if !strings.Contains(name.Value, ":") {
+		return nil, r.parseError("function name must have a namespace prefix")
+	}
+
+	fn.Name = r.ident(name)
+	r.consume()
+
+	tok, err := r.peak(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if tok.Type == tokenizer.TokenTypeBeginGroup && tok.Value == "(" {
+		fn.Params, err = r.parseFuncParams(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		tok, err = r.peak(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if tok.Type == tokenizer.TokenTypeIdentifier && tok.Value == "as" {
+		fn.As, err = r.parseAs(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		r.require(xslt.XSLT20, "type annotations", fn.As)
+	}
+
+	r.inFunc = true
+	defer func() {
+		r.inFunc = false
+	}()
+
+	fn.Body, err = r.parseExpression(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return fn, nil
+}
+
+// parseFuncParams parses the parameters of a stylesheet function: `( $param as type, … )`.
+// Unlike the parameters of a sub or template, these cannot have default values.
+func (r *Reader) parseFuncParams(ctx context.Context) (*ast.VariableList, error) {
+	tok, err := r.peak(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	end := endTokenFromStart(tok)
+
+	list := &ast.VariableList{
+		Open:  r.pos,
+		Delim: tok.Value,
+	}
+	r.consume()
+
+	for {
+		tok, err := r.peakSkipComma(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if tok.Type == tokenizer.TokenTypeEndGroup {
+			if !tok.Is(end) {
+				return nil, r.parseErrorf("unexpected end param list token, was expecting: %s", end)
+			}
+
+			list.Close = r.pos
+			r.consume()
+			return list, nil
+		}
+
+		name := tok.Value
+		if tok.Type != tokenizer.TokenTypeIdentifier {
+			if tok.Type != tokenizer.TokenTypeXPath || !strings.HasPrefix(tok.Value, "$") || !tokenizer.IsIdent(tok.Value) {
+				return nil, r.parseError("expected identifier")
+			}
+			name = tok.Value[1:]
+		}
+
+		param := &ast.Variable{
+			Kind: ast.VarKindParam,
+			Name: &ast.Ident{
+				NamePos: r.pos,
+				Name:    name,
+				EndPos:  r.last.End,
+			},
+		}
+
+		tok, err = r.read(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if tok.Type == tokenizer.TokenTypeIdentifier && tok.Value == "as" {
+			param.As, err = r.parseAs(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			r.require(xslt.XSLT20, "type annotations", param.As)
+
+			tok, err = r.peak(ctx)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if tok.Is(tokenizer.OperatorArrow) {
+			return nil, r.parseError("function parameters cannot have default values")
+		}
+
+		list.List = append(list.List, param)
+	}
+}
+
+// parseReturn parses the result of a stylesheet function: `return <select>`.
+// The current token is expected to be the `return` keyword.
+func (r *Reader) parseReturn(ctx context.Context) (*ast.Return, error) {
+	if !r.inFunc {
+		return nil, r.parseError("return outside of a func")
+	}
+
+	ret := &ast.Return{
+		Keyword: r.pos,
+	}
+
+	sel, err := r.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if sel.Type != tokenizer.TokenTypeXPath {
+		return nil, r.parseError("expected xpath")
+	}
+
+	ret.Select = r.xpath(sel)
+	r.consume()
+
+	return ret, nil
+}
@@ -2,77 +2,274 @@ package parser
 
 import (
 	"context"
+	"fmt"
+	"sort"
+	"strings"
 
+	"github.com/puellanivis/lxt/ast"
 	"github.com/puellanivis/lxt/tokenizer"
-	"github.com/puellanivis/lxt/xslt"
 )
 
-func (r *Reader) parseSpan(ctx context.Context) (*xslt.Element, error) {
-	className, err := r.read(ctx)
-	if err != nil {
-		return nil, err
+// htmlElements are the elements of HTML5 that have sugar, and whether each is a void element, which has no content.
+//
+// The var, template, sub, and output elements are not included, as these are LXT keywords,
+// and so these elements must be written with `tag`.
+var htmlElements = map[string]bool{
+	"a":          false,
+	"abbr":       false,
+	"address":    false,
+	"area":       true,
+	"article":    false,
+	"aside":      false,
+	"audio":      false,
+	"b":          false,
+	"base":       true,
+	"bdi":        false,
+	"bdo":        false,
+	"blockquote": false,
+	"body":       false,
+	"br":         true,
+	"button":     false,
+	"canvas":     false,
+	"caption":    false,
+	"cite":       false,
+	"code":       false,
+	"col":        true,
+	"colgroup":   false,
+	"data":       false,
+	"datalist":   false,
+	"dd":         false,
+	"del":        false,
+	"details":    false,
+	"dfn":        false,
+	"dialog":     false,
+	"div":        false,
+	"dl":         false,
+	"dt":         false,
+	"em":         false,
+	"embed":      true,
+	"fieldset":   false,
+	"figcaption": false,
+	"figure":     false,
+	"footer":     false,
+	"form":       false,
+	"h1":         false,
+	"h2":         false,
+	"h3":         false,
+	"h4":         false,
+	"h5":         false,
+	"h6":         false,
+	"head":       false,
+	"header":     false,
+	"hgroup":     false,
+	"hr":         true,
+	"html":       false,
+	"i":          false,
+	"iframe":     false,
+	"img":        true,
+	"input":      true,
+	"ins":        false,
+	"kbd":        false,
+	"label":      false,
+	"legend":     false,
+	"li":         false,
+	"link":       true,
+	"main":       false,
+	"map":        false,
+	"mark":       false,
+	"menu":       false,
+	"meta":       true,
+	"meter":      false,
+	"nav":        false,
+	"noscript":   false,
+	"object":     false,
+	"ol":         false,
+	"optgroup":   false,
+	"option":     false,
+	"p":          false,
+	"picture":    false,
+	"pre":        false,
+	"progress":   false,
+	"q":          false,
+	"rp":         false,
+	"rt":         false,
+	"ruby":       false,
+	"s":          false,
+	"samp":       false,
+	"script":     false,
+	"search":     false,
+	"section":    false,
+	"select":     false,
+	"slot":       false,
+	"small":      false,
+	"source":     true,
+	"span":       false,
+	"strong":     false,
+	"style":      false,
+	"summary":    false,
+	"sup":        false,
+	"table":      false,
+	"tbody":      false,
+	"td":         false,
+	"textarea":   false,
+	"tfoot":      false,
+	"th":         false,
+	"thead":      false,
+	"time":       false,
+	"title":      false,
+	"tr":         false,
+	"track":      true,
+	"u":          false,
+	"ul":         false,
+	"video":      false,
+	"wbr":        true,
+}
+
+// HTMLElements returns the names of the HTML elements that have sugar, in sorted order.
+func HTMLElements() []string {
+	var names []string
+	for name := range htmlElements {
+		names = append(names, name)
 	}
 
-	switch className.Type {
-	case tokenizer.TokenTypeIdentifier:
-	case tokenizer.TokenTypeDoubleQuote, tokenizer.TokenTypeSingleQuote:
-	default:
-		return nil, r.parseError("expected a class name")
+	sort.Strings(names)
+	return names
+}
+
+// IsHTMLElement reports whether the HTML element with the given name has sugar.
+func IsHTMLElement(name string) bool {
+	_, ok := htmlElements[name]
+	return ok
+}
+
+// htmlTag returns the name of the element of an HTML sugar keyword, such as `div` for `div#main.card`,
+// and whether the keyword is HTML sugar.
+func htmlTag(keyword string) (string, bool) {
+	tag := keyword
+	if i := strings.IndexAny(keyword, "#."); i >= 0 {
+		tag = keyword[:i]
 	}
-	r.consume()
 
-	if className.Value == "" {
-		return nil, r.parseError("span cannot have an empty class name")
+	return tag, IsHTMLElement(tag)
+}
+
+// parseHTMLElement parses the sugar for an HTML element: `div#id.class body`, or `div class body` for a div or span.
+// The current token is expected to be the keyword.
+func (r *Reader) parseHTMLElement(ctx context.Context, keyword tokenizer.Token) (*ast.HTMLElement, error) {
+	elem := &ast.HTMLElement{
+		Keyword: r.pos,
 	}
 
-	body, err := r.parseExpression(ctx)
+	if err := r.parseSelector(elem, keyword.Value); err != nil {
+		return nil, err
+	}
+
+	tok, err := r.read(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	return &xslt.Element{
-		Name: "span",
-		Body: xslt.Group{
-			&xslt.Attribute{
-				Name:  "class",
-				Value: className.Value,
-			},
-			body,
-		},
-	}, nil
-}
+	// Without the shorthand, a div or span may be given a class name first, as in `div class body`.
+	if (elem.Tag == "div" || elem.Tag == "span") && elem.Tag == keyword.Value {
+		switch tok.Type {
+		case tokenizer.TokenTypeIdentifier, tokenizer.TokenTypeDoubleQuote, tokenizer.TokenTypeSingleQuote:
+			if tok.Value == "" {
+				return nil, r.parseErrorf("%s cannot have an empty class name", elem.Tag)
+			}
+
+			elem.Class = r.literal(tok)
+			r.consume()
+		}
+	}
 
-func (r *Reader) parseDiv(ctx context.Context) (*xslt.Element, error) {
-	className, err := r.read(ctx)
+	elem.Body, err = r.parseExpression(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	switch className.Type {
-	case tokenizer.TokenTypeIdentifier:
-	case tokenizer.TokenTypeDoubleQuote, tokenizer.TokenTypeSingleQuote:
-	default:
-		return nil, r.parseError("expected a class name")
+	if htmlElements[elem.Tag] {
+		r.checkVoid(elem.Tag, elem.Body)
 	}
-	r.consume()
 
-	if className.Value == "" {
-		return nil, r.parseError("div cannot have an empty class name")
+	return elem, nil
+}
+
+// parseSelector sets the tag, id, and classes of the element from the shorthand `tag#id.class.class`.
+func (r *Reader) parseSelector(elem *ast.HTMLElement, selector string) error {
+	i := strings.IndexAny(selector, "#.")
+	if i < 0 {
+		elem.Tag = selector
+		return nil
 	}
 
-	body, err := r.parseExpression(ctx)
-	if err != nil {
-		return nil, err
+	elem.Tag = selector[:i]
+
+	for rest := selector[i:]; rest != ""; {
+		kind := rest[0]
+		rest = rest[1:]
+
+		end := strings.IndexAny(rest, "#.")
+		if end < 0 {
+			end = len(rest)
+		}
+
+		name := rest[:end]
+		rest = rest[end:]
+
+		switch {
+		case kind == '#' && name == "":
+			return r.parseErrorf("%s cannot have an empty id", elem.Tag)
+
+		case kind == '#' && elem.ID != "":
+			return r.parseErrorf("%s cannot have more than one id", elem.Tag)
+
+		case kind == '#':
+			elem.ID = name
+
+		case name == "":
+			return r.parseErrorf("%s cannot have an empty class name", elem.Tag)
+
+		default:
+			elem.Classes = append(elem.Classes, name)
+		}
+	}
+
+	return nil
+}
+
+// checkVoid reports any content within the body of a void element, which may only give it attributes.
+// The errors do not affect the structure of the LXT source, so parsing may continue.
+func (r *Reader) checkVoid(tag string, body ast.Node) {
+	switch n := body.(type) {
+	case nil, *ast.Empty, *ast.Attribs, *ast.Variable:
+
+	case *ast.Group:
+		for _, child := range n.List {
+			r.checkVoid(tag, child)
+		}
+
+	case *ast.If:
+		r.checkVoid(tag, n.Body)
+
+	case *ast.Choose:
+		for _, when := range n.Whens {
+			r.checkVoid(tag, when.Body)
+		}
+
+		if n.Otherwise != nil {
+			r.checkVoid(tag, n.Otherwise.Body)
+		}
+
+	default:
+		r.errs.Add(&tokenizer.Error{
+			Pos: n.Pos(),
+			End: n.End(),
+			Msg: fmt.Sprintf("void element %s cannot have content", tag),
+		})
 	}
+}
 
-	return &xslt.Element{
-		Name: "div",
-		Body: xslt.Group{
-			&xslt.Attribute{
-				Name:  "class",
-				Value: className.Value,
-			},
-			body,
-		},
-	}, nil
+// IsVoidElement reports whether the HTML element with the given name is a void element, which has no content.
+func IsVoidElement(name string) bool {
+	return htmlElements[name]
 }
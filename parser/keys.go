@@ -0,0 +1,49 @@
+package parser
+
+import (
+	"context"
+
+	"github.com/puellanivis/lxt/ast"
+	"github.com/puellanivis/lxt/tokenizer"
+)
+
+// parseKey parses a key declaration: `key name <match> <use>`.
+// The current token is expected to be the `key` keyword.
+func (r *Reader) parseKey(ctx context.Context) (*ast.Key, error) {
+	key := &ast.Key{
+		Keyword: r.pos,
+	}
+
+	name, err := r.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if name.Type != tokenizer.TokenTypeIdentifier {
+		return nil, r.parseError("expected identifier")
+	}
+	key.Name = r.ident(name)
+
+	match, err := r.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if match.Type != tokenizer.TokenTypeXPath {
+		return nil, r.parseError("expected xpath")
+	}
+	key.Match = r.pattern(match)
+
+	use, err := r.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if use.Type != tokenizer.TokenTypeXPath {
+		return nil, r.parseError("expected xpath")
+	}
+	key.Use = r.keyUse(use)
+	r.consume()
+
+	return key, nil
+}
@@ -3,41 +3,61 @@ package parser
 import (
 	"context"
 
+	"github.com/puellanivis/lxt/ast"
 	"github.com/puellanivis/lxt/tokenizer"
-	"github.com/puellanivis/lxt/xslt"
 )
 
-func (r *Reader) parseApplyTemplates(ctx context.Context) (*xslt.ApplyTemplates, error) {
+func (r *Reader) parseApplyTemplates(ctx context.Context) (*ast.ApplyTemplates, error) {
+	apply := &ast.ApplyTemplates{
+		Keyword: r.pos,
+	}
+
 	tok, err := r.read(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	var xpath string
 	if tok.Type == tokenizer.TokenTypeXPath {
-		xpath = tok.Value
+		apply.Select = r.xpath(tok)
 
 		tok, err = r.read(ctx)
 	}
 
+	if tok.Type == tokenizer.TokenTypeIdentifier && tok.Value == "mode" {
+		apply.Mode, err = r.parseMode(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		tok, err = r.peak(ctx)
+	}
+
+	if tok.Type == tokenizer.TokenTypeIdentifier && tok.Value == "sort-by" {
+		apply.SortBy, err = r.parseSortBy(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		tok, err = r.peak(ctx)
+	}
+
 	if tok.Type != tokenizer.TokenTypeBeginGroup || tok.Value != "(" {
-		return &xslt.ApplyTemplates{
-			Select: xpath,
-		}, nil
+		return apply, nil
 	}
 
-	args, err := r.parseArgumentList(ctx)
+	apply.Args, err = r.parseArgumentList(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	return &xslt.ApplyTemplates{
-		Select:     xpath,
-		WithParams: args,
-	}, nil
+	return apply, nil
 }
 
-func (r *Reader) parseForEach(ctx context.Context) (*xslt.ForEach, error) {
+func (r *Reader) parseForEach(ctx context.Context) (*ast.ForEach, error) {
+	loop := &ast.ForEach{
+		Keyword: r.pos,
+	}
+
 	set, err := r.read(ctx)
 	if err != nil {
 		return nil, err
@@ -46,19 +66,189 @@ func (r *Reader) parseForEach(ctx context.Context) (*xslt.ForEach, error) {
 	if set.Type != tokenizer.TokenTypeXPath {
 		return nil, r.parseError("expected xpath")
 	}
-	r.consume()
 
 	if set.Value == "" {
 		return nil, r.parseError("for-each cannot have empty name")
 	}
 
-	body, err := r.parseExpression(ctx)
+	loop.Select = r.xpath(set)
+	r.consume()
+
+	if tok, _ := r.peak(ctx); tok.Type == tokenizer.TokenTypeIdentifier && tok.Value == "sort-by" {
+		loop.SortBy, err = r.parseSortBy(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	loop.Body, err = r.parseExpression(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return loop, nil
+}
+
+// parseGroupBy parses a grouping loop: `group <select> by <key> sort-by ( … ) body`.
+// The current token is expected to be the `group` keyword.
+func (r *Reader) parseGroupBy(ctx context.Context) (*ast.GroupBy, error) {
+	group := &ast.GroupBy{
+		Keyword: r.pos,
+	}
+
+	set, err := r.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if set.Type != tokenizer.TokenTypeXPath {
+		return nil, r.parseError("expected xpath")
+	}
+
+	group.Select = r.xpath(set)
+
+	by, err := r.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if by.Type != tokenizer.TokenTypeIdentifier || by.Value != "by" {
+		return nil, r.parseError("expected by")
+	}
+	group.By = r.pos
+
+	key, err := r.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if key.Type != tokenizer.TokenTypeXPath {
+		return nil, r.parseError("expected xpath")
+	}
+
+	group.Key = r.xpath(key)
+	r.consume()
+
+	if tok, _ := r.peak(ctx); tok.Type == tokenizer.TokenTypeIdentifier && tok.Value == "sort-by" {
+		group.SortBy, err = r.parseSortBy(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	group.Body, err = r.parseExpression(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return group, nil
+}
+
+// parseSortBy parses a `sort-by ( <key> modifiers…, … )` clause.
+// The current token is expected to be the `sort-by` keyword.
+func (r *Reader) parseSortBy(ctx context.Context) (*ast.SortBy, error) {
+	sortBy := &ast.SortBy{
+		Keyword: r.pos,
+	}
+
+	tok, err := r.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if tok.Type != tokenizer.TokenTypeBeginGroup {
+		return nil, r.parseError("expected start of grouping")
+	}
+	sortBy.Open = r.pos
+	sortBy.Delim = tok.Value
+	r.consume()
+	end := endTokenFromStart(tok)
+
+	var key *ast.SortKey
+
+	for {
+		tok, err := r.peakSkipComma(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		switch tok.Type {
+		case tokenizer.TokenTypeEndGroup:
+			if !tok.Is(end) {
+				return nil, r.parseErrorf("unexpected end sort-by token, was expecting: %s", end)
+			}
+
+			if len(sortBy.Keys) < 1 {
+				return nil, r.parseError("sort-by must have at least one sort key")
+			}
+
+			sortBy.Close = r.pos
+			r.consume()
+			return sortBy, nil
+
+		case tokenizer.TokenTypeXPath:
+			key = &ast.SortKey{
+				Select: r.xpath(tok),
+			}
+			sortBy.Keys = append(sortBy.Keys, key)
+
+			r.consume()
+			continue
+
+		case tokenizer.TokenTypeIdentifier:
+			if key == nil {
+				return nil, r.parseError("expected xpath")
+			}
+
+		default:
+			return nil, r.parseError("expected xpath or sort modifier")
+		}
+
+		mod, err := r.parseSortModifier(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		key.Modifiers = append(key.Modifiers, mod)
+	}
+}
+
+func (r *Reader) parseSortModifier(ctx context.Context) (*ast.SortModifier, error) {
+	tok, err := r.peak(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	return &xslt.ForEach{
-		Select: set.Value,
-		Body:   body,
-	}, nil
+	mod := &ast.SortModifier{
+		Name: r.ident(tok),
+	}
+	r.consume()
+
+	switch tok.Value {
+	case "asc", "ascending":
+	case "desc", "descending":
+	case "text", "number":
+	case "upper-first", "lower-first":
+
+	case "lang":
+		lang, err := r.peak(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		switch lang.Type {
+		case tokenizer.TokenTypeIdentifier:
+		case tokenizer.TokenTypeDoubleQuote, tokenizer.TokenTypeSingleQuote:
+		default:
+			return nil, r.parseError("expected a language code")
+		}
+
+		mod.Value = r.literal(lang)
+		r.consume()
+
+	default:
+		return nil, r.parseErrorf("unknown sort modifier: %q", tok.Value)
+	}
+
+	return mod, nil
 }
@@ -8,6 +8,8 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/puellanivis/lxt/ast"
+	"github.com/puellanivis/lxt/lower"
 	"github.com/puellanivis/lxt/tokenizer"
 	"github.com/puellanivis/lxt/xslt"
 )
@@ -16,8 +18,29 @@ type Reader struct {
 	filename string
 	r        *tokenizer.Reader
 
+	// target is the version of XSLT being compiled to, and constructs requiring a later version are rejected.
+	target xslt.Version
+
 	tok tokenizer.Token
 	err error
+
+	// last is the most recently read token, and pos is its position.
+	last tokenizer.Token
+	pos  ast.Pos
+
+	comments []ast.Node
+
+	// seenStatement is set once any statement other than an import has been parsed,
+	// after which imports are no longer allowed.
+	seenStatement bool
+
+	// inFunc is set while parsing the body of a func, where return is allowed.
+	inFunc bool
+
+	uses *Uses
+
+	// errs collects every error found, and is shared with the readers of any used modules.
+	errs *ErrorList
 }
 
 func (r *Reader) read(ctx context.Context) (tokenizer.Token, error) {
@@ -28,9 +51,22 @@ func (r *Reader) read(ctx context.Context) (tokenizer.Token, error) {
 	}
 
 	tok, err := r.r.ReadToken()
+	for err == nil && tok.Type == tokenizer.TokenTypeComment {
+		r.comments = append(r.comments, &ast.Comment{
+			Slash:  tok.Pos,
+			Text:   tok.Value,
+			EndPos: tok.End,
+		})
+
+		tok, err = r.r.ReadToken()
+	}
 
 	r.tok = tok
-	if err != nil {
+	r.last, r.pos = tok, tok.Pos
+
+	// Reaching the end of the file is not an error here, callers should check for an EOF token.
+	r.err = nil
+	if err != nil && err != io.EOF {
 		r.err = r.parseError("tokenize error", err)
 	}
 
@@ -38,7 +74,7 @@ func (r *Reader) read(ctx context.Context) (tokenizer.Token, error) {
 }
 
 func (r *Reader) peak(ctx context.Context) (tokenizer.Token, error) {
-	if r.tok == tokenizer.Empty {
+	if r.tok.Is(tokenizer.Empty) {
 		return r.read(ctx)
 	}
 
@@ -66,18 +102,25 @@ func (r *Reader) peakSkipComma(ctx context.Context) (tokenizer.Token, error) {
 	return tok, err
 }
 
+// takeComments returns all the doc comments read since the last call, and clears them.
+func (r *Reader) takeComments() []ast.Node {
+	comments := r.comments
+	r.comments = nil
+	return comments
+}
+
 func (r *Reader) consume() {
 	r.tok = tokenizer.Empty
 }
 
 func (r *Reader) tokenIs(ctx context.Context, match tokenizer.Token) bool {
 	tok, _ := r.peak(ctx)
-	return tok == match
+	return tok.Is(match)
 }
 
 func (r *Reader) nextIs(ctx context.Context, match tokenizer.Token) bool {
 	tok, _ := r.read(ctx)
-	return tok == match
+	return tok.Is(match)
 }
 
 func (r *Reader) mustBe(ctx context.Context, match tokenizer.Token) error {
@@ -86,7 +129,7 @@ func (r *Reader) mustBe(ctx context.Context, match tokenizer.Token) error {
 		return err
 	}
 
-	if tok != match {
+	if !tok.Is(match) {
 		return r.parseErrorf("unexpected token: expecting %s", match)
 	}
 
@@ -109,11 +152,66 @@ func (r *Reader) parseError(msg string, errs ...error) error {
 		panic("too many errors passed to parseError")
 	}
 
+	// If the current token has already been consumed, then report the last token read.
+	tok := r.tok
+	if tok.Is(tokenizer.Empty) {
+		tok = r.last
+	}
+
+	err := &tokenizer.Error{
+		Pos: tok.Pos,
+		End: tok.End,
+		Msg: fmt.Sprintf("%s: %s", msg, tok),
+	}
+
 	if len(errs) > 0 && errs[0] != nil {
-		return fmt.Errorf("%s: %s:%d: %s: %w", msg, r.filename, r.r.CurrentLine(), r.tok, errs[0])
+		err.Err = errs[0]
 	}
 
-	return fmt.Errorf("%s: %s:%d: %s", msg, r.filename, r.r.CurrentLine(), r.tok)
+	return err
+}
+
+// ident returns the current token as an *ast.Ident.
+func (r *Reader) ident(tok tokenizer.Token) *ast.Ident {
+	id := &ast.Ident{
+		NamePos: r.pos,
+		Name:    tok.Value,
+		EndPos:  r.last.End,
+	}
+
+	r.checkName(id)
+	return id
+}
+
+// checkName reports a name that contains the id shorthand of an HTML element, which is not a valid name anywhere else.
+// The error does not affect the structure of the LXT source, so parsing may continue.
+func (r *Reader) checkName(id *ast.Ident) {
+	if strings.Contains(id.Name, "#") {
+		r.errs.Add(&tokenizer.Error{
+			Pos: id.Pos(),
+			End: id.End(),
+			Msg: fmt.Sprintf("invalid name %q: an id shorthand may only follow the name of an HTML element", id.Name),
+		})
+	}
+}
+
+// str returns the current token as an *ast.String.
+func (r *Reader) str(tok tokenizer.Token) *ast.String {
+	return &ast.String{
+		ValuePos: r.pos,
+		Quote:    rune(tok.Type),
+		Value:    tok.Value,
+		EndPos:   r.last.End,
+	}
+}
+
+// literal returns the current token as either an *ast.Ident, or an *ast.String.
+func (r *Reader) literal(tok tokenizer.Token) ast.Node {
+	if tok.Type == tokenizer.TokenTypeIdentifier {
+		return r.ident(tok)
+	}
+
+	return r.str(tok)
 }
 
 var endGroupFromStart = map[string]string{
@@ -129,72 +227,26 @@ func endTokenFromStart(start tokenizer.Token) tokenizer.Token {
 	}
 }
 
-func (r *Reader) parseOutput(ctx context.Context, out *xslt.Output) error {
+func (r *Reader) parseOutput(ctx context.Context) (*ast.Output, error) {
+	out := &ast.Output{
+		Keyword: r.pos,
+	}
+	r.consume()
+
 	m, err := r.parseMap(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	for k, v := range m {
-		switch k {
-		case "method":
-			out.Method = v
-		case "version":
-			out.Version = v
-		case "encoding":
-			out.Encoding = v
-		case "media-type":
-			out.MediaType = v
-
-		case "doctype-public":
-			out.DoctypePublic = v
-		case "doctype-system":
-			out.DoctypeSystem = v
-
-		case "cdata-section-elements":
-			var qnames xslt.QNames
-
-			elems := strings.Split(v, " ")
-			for _, elem := range elems {
-				if elem == "" {
-					continue
-				}
-
-				qnames = append(qnames, elem)
-			}
-
-			out.CDATASectionElements = qnames
-
-		case "omit-xml-declaration":
-			b, err := strconv.ParseBool(v)
-			if err != nil {
-				return r.parseError("bad boolean value", err)
-			}
-			out.OmitXMLDeclaration = xslt.Bool(b)
-
-		case "standalone":
-			b, err := strconv.ParseBool(v)
-			if err != nil {
-				return r.parseError("bad boolean value", err)
-			}
-			out.Standalone = xslt.Bool(b)
-
-		case "indent":
-			b, err := strconv.ParseBool(v)
-			if err != nil {
-				return r.parseError("bad boolean value", err)
-			}
-			out.Indent = xslt.BoolVal(b)
+	out.Attributes = m
+	return out, nil
+}
 
-		default:
-			return r.parseErrorf("unknown output attribute: %q", k)
-		}
+func (r *Reader) parseCall(ctx context.Context) (*ast.Call, error) {
+	call := &ast.Call{
+		Keyword: r.pos,
 	}
 
-	return nil
-}
-
-func (r *Reader) parseCall(ctx context.Context) (interface{}, error) {
 	name, err := r.read(ctx)
 	if err != nil {
 		return nil, err
@@ -203,6 +255,7 @@ func (r *Reader) parseCall(ctx context.Context) (interface{}, error) {
 	if name.Type != tokenizer.TokenTypeIdentifier {
 		return nil, r.parseError("expected idenitifer")
 	}
+	call.Name = r.ident(name)
 	r.consume()
 
 	tok, err := r.peak(ctx)
@@ -211,23 +264,22 @@ func (r *Reader) parseCall(ctx context.Context) (interface{}, error) {
 	}
 
 	if tok.Type != tokenizer.TokenTypeBeginGroup || tok.Value != "(" {
-		return &xslt.CallTemplate{
-			Name: name.Value,
-		}, nil
+		return call, nil
 	}
 
-	args, err := r.parseArgumentList(ctx)
+	call.Args, err = r.parseArgumentList(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	return &xslt.CallTemplate{
-		Name:       name.Value,
-		WithParams: args,
-	}, nil
+	return call, nil
 }
 
-func (r *Reader) parseTemplate(ctx context.Context) (interface{}, error) {
+func (r *Reader) parseTemplate(ctx context.Context) (*ast.Template, error) {
+	template := &ast.Template{
+		Keyword: r.pos,
+	}
+
 	match, err := r.read(ctx)
 	if err != nil {
 		return nil, err
@@ -236,36 +288,132 @@ func (r *Reader) parseTemplate(ctx context.Context) (interface{}, error) {
 	if match.Type != tokenizer.TokenTypeXPath {
 		return nil, r.parseError("expected xpath")
 	}
+	template.Match = r.pattern(match)
 	r.consume()
 
+	if err := r.parseTemplateOptions(ctx, template); err != nil {
+		return nil, err
+	}
+
 	tok, err := r.peak(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	var params []*xslt.Param
-
 	if tok.Type == tokenizer.TokenTypeBeginGroup && tok.Value == "(" {
 		var err error
-		params, err = r.parseParamList(ctx)
+		template.Params, err = r.parseParamList(ctx)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	body, err := r.parseExpression(ctx)
+	template.Body, err = r.parseExpression(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return template, nil
+}
+
+// parseTemplateOptions parses any `mode name` and `priority number` options following a template match.
+func (r *Reader) parseTemplateOptions(ctx context.Context, template *ast.Template) error {
+	for {
+		tok, err := r.peak(ctx)
+		if err != nil {
+			return err
+		}
+
+		if tok.Type != tokenizer.TokenTypeIdentifier {
+			return nil
+		}
+
+		switch tok.Value {
+		case "mode":
+			if template.Mode != nil {
+				return r.parseError("template mode already specified")
+			}
+
+			template.Mode, err = r.parseMode(ctx)
+			if err != nil {
+				return err
+			}
+
+		case "priority":
+			if template.Priority != nil {
+				return r.parseError("template priority already specified")
+			}
+
+			template.Priority, err = r.parsePriority(ctx)
+			if err != nil {
+				return err
+			}
+
+		default:
+			return nil
+		}
+	}
+}
+
+// parseMode parses a `mode name` option, where the `mode` keyword is expected to be the current token.
+func (r *Reader) parseMode(ctx context.Context) (*ast.Mode, error) {
+	mode := &ast.Mode{
+		Keyword: r.pos,
+	}
+
+	name, err := r.read(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	return &xslt.Template{
-		Match:  match.Value,
-		Params: params,
-		Body:   body,
-	}, nil
+	if name.Type != tokenizer.TokenTypeIdentifier {
+		return nil, r.parseError("expected identifier")
+	}
+	mode.Name = r.ident(name)
+	r.consume()
+
+	return mode, nil
 }
 
-func (r *Reader) parseSubfunction(ctx context.Context) (interface{}, error) {
+// parsePriority parses a `priority number` option, where the `priority` keyword is expected to be the current token.
+func (r *Reader) parsePriority(ctx context.Context) (*ast.Priority, error) {
+	prio := &ast.Priority{
+		Keyword: r.pos,
+	}
+
+	val, err := r.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	switch val.Type {
+	case tokenizer.TokenTypeNumber:
+		prio.Value = &ast.Number{
+			ValuePos: r.pos,
+			Value:    val.Value,
+			EndPos:   r.last.End,
+		}
+
+	case tokenizer.TokenTypeDoubleQuote, tokenizer.TokenTypeSingleQuote:
+		prio.Value = r.str(val)
+
+	default:
+		return nil, r.parseError("expected a number")
+	}
+
+	if _, err := strconv.ParseFloat(val.Value, 64); err != nil {
+		return nil, r.parseError("bad priority value", err)
+	}
+	r.consume()
+
+	return prio, nil
+}
+
+func (r *Reader) parseSubfunction(ctx context.Context) (*ast.Sub, error) {
+	sub := &ast.Sub{
+		Keyword: r.pos,
+	}
+
 	name, err := r.read(ctx)
 	if err != nil {
 		return nil, err
@@ -274,6 +422,7 @@ func (r *Reader) parseSubfunction(ctx context.Context) (interface{}, error) {
 	if name.Type != tokenizer.TokenTypeIdentifier {
 		return nil, r.parseError("expected idenitifer")
 	}
+	sub.Name = r.ident(name)
 	r.consume()
 
 	tok, err := r.peak(ctx)
@@ -281,34 +430,52 @@ func (r *Reader) parseSubfunction(ctx context.Context) (interface{}, error) {
 		return nil, err
 	}
 
-	var params []*xslt.Param
-
 	if tok.Type == tokenizer.TokenTypeBeginGroup && tok.Value == "(" {
 		var err error
-		params, err = r.parseParamList(ctx)
+		sub.Params, err = r.parseParamList(ctx)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	body, err := r.parseExpression(ctx)
+	sub.Body, err = r.parseExpression(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	return &xslt.Template{
-		Name:   name.Value,
-		Params: params,
-		Body:   body,
-	}, nil
+	return sub, nil
 }
 
-func (r *Reader) parseStatement(ctx context.Context, xsl *xslt.Stylesheet) error {
+func (r *Reader) parseHref(ctx context.Context) (*ast.String, error) {
+	href, err := r.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	switch href.Type {
+	case tokenizer.TokenTypeDoubleQuote, tokenizer.TokenTypeSingleQuote:
+	default:
+		return nil, r.parseError("expected a string")
+	}
+
+	if href.Value == "" {
+		return nil, r.parseError("href cannot be empty")
+	}
+
+	s := r.str(href)
+	r.consume()
+
+	return s, nil
+}
+
+func (r *Reader) parseStatement(ctx context.Context, file *ast.File) error {
 	tok, err := r.peakSkipComma(ctx)
 	if err != nil {
 		return err
 	}
 
+	file.Statements = append(file.Statements, r.takeComments()...)
+
 	switch tok.Type {
 	case tokenizer.TokenTypeOperator:
 		switch tok.Value {
@@ -318,63 +485,148 @@ func (r *Reader) parseStatement(ctx context.Context, xsl *xslt.Stylesheet) error
 		}
 
 	case tokenizer.TokenTypeIdentifier:
-		switch tok.Value {
-		case "output":
-			r.consume()
-			return r.parseOutput(ctx, xsl.Output)
+		keyword := r.pos
 
-		case "sub":
-			sub, err := r.parseSubfunction(ctx)
+		if tok.Value == "import" {
+			if r.seenStatement {
+				return r.parseError("import must precede all other statements")
+			}
+
+			href, err := r.parseHref(ctx)
 			if err != nil {
 				return err
 			}
 
-			xsl.Body = append(xsl.Body, sub)
+			file.Statements = append(file.Statements, &ast.Import{
+				Keyword: keyword,
+				Href:    href,
+			})
 			return nil
+		}
+
+		if tok.Value == "namespace" || tok.Value == "stylesheet" {
+			// These only set attributes of the stylesheet element, so they may also precede any imports.
+			var stmt ast.Node
+
+			if tok.Value == "namespace" {
+				stmt, err = r.parseNamespace(ctx)
+			} else {
+				stmt, err = r.parseStylesheet(ctx)
+			}
 
-		case "template":
-			template, err := r.parseTemplate(ctx)
 			if err != nil {
 				return err
 			}
 
-			xsl.Body = append(xsl.Body, template)
+			file.Statements = append(file.Statements, stmt)
 			return nil
+		}
+
+		r.seenStatement = true
+
+		var stmt ast.Node
+
+		switch tok.Value {
+		case "use":
+			stmt, err = r.parseUse(ctx)
+
+		case "include":
+			var href *ast.String
+			href, err = r.parseHref(ctx)
+
+			stmt = &ast.Include{
+				Keyword: keyword,
+				Href:    href,
+			}
+
+		case "output":
+			stmt, err = r.parseOutput(ctx)
+
+		case "key":
+			stmt, err = r.parseKey(ctx)
+
+		case "sub":
+			stmt, err = r.parseSubfunction(ctx)
+
+		case "func":
+			stmt, err = r.parseFunc(ctx)
+
+		case "template":
+			stmt, err = r.parseTemplate(ctx)
 
 		case "param":
 			r.consume()
 
-			param, err := r.parseParam(ctx, tokenizer.OperatorEquals)
-			if err != nil {
-				return err
+			var param *ast.Variable
+			param, err = r.parseVariable(ctx, tokenizer.OperatorEquals, ast.VarKindParam)
+			if param != nil {
+				param.Keyword = keyword
 			}
-
-			xsl.Body = append(xsl.Body, param)
-			return nil
+			stmt = param
 
 		case "var":
 			r.consume()
 
-			param, err := r.parseVariable(ctx, tokenizer.OperatorEquals)
-			if err != nil {
-				return err
+			var param *ast.Variable
+			param, err = r.parseVariable(ctx, tokenizer.OperatorEquals, ast.VarKindVar)
+			if param != nil {
+				param.Keyword = keyword
 			}
+			stmt = param
 
-			xsl.Body = append(xsl.Body, param)
-			return nil
+		default:
+			return r.parseError("unexpected top-level token")
+		}
 
+		if err != nil {
+			return err
 		}
+
+		file.Statements = append(file.Statements, stmt)
+		return nil
 	}
 
 	return r.parseError("unexpected top-level token")
 }
 
-func (r *Reader) parseExpression(ctx context.Context) (interface{}, error) {
+// ExpressionKeywords are the keywords that may begin an expression, as parsed by parseExpression.
+// Along with these, the name of any element of HTMLElements begins the HTML sugar for that element.
+var ExpressionKeywords = []string{
+	"text",
+	"copy-of",
+	"var",
+	"foreach",
+	"group",
+	"apply-templates",
+	"when",
+	"if",
+	"call",
+	"tag",
+	"attribs",
+	"sequence",
+	"analyze-string",
+	"result-document",
+	"return",
+}
+
+func (r *Reader) parseExpression(ctx context.Context) (ast.Node, error) {
 	tok, err := r.peakSkipComma(ctx)
 	if err != nil {
 		return nil, err
 	}
 
+	if comments := r.takeComments(); len(comments) > 0 {
+		expr, err := r.parseExpression(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		return &ast.Group{
+			Open: comments[0].Pos(),
+			List: append(comments, expr),
+		}, nil
+	}
+
 	switch tok.Type {
 	case tokenizer.TokenTypeEOF:
 		return nil, r.parseError("unexpected EOF")
@@ -382,8 +634,11 @@ func (r *Reader) parseExpression(ctx context.Context) (interface{}, error) {
 	case tokenizer.TokenTypeOperator:
 		switch tok.Value {
 		case ";":
+			empty := &ast.Empty{
+				Semicolon: r.pos,
+			}
 			r.consume()
-			return nil, nil
+			return empty, nil
 		}
 
 	case tokenizer.TokenTypeError:
@@ -392,21 +647,38 @@ func (r *Reader) parseExpression(ctx context.Context) (interface{}, error) {
 		return nil, r.parseError("unknown token")
 
 	case tokenizer.TokenTypeBeginGroup:
+		open := r.pos
 		r.consume()
 
-		return r.parseGroup(ctx, endTokenFromStart(tok))
+		return r.parseGroup(ctx, open, tok)
 
 	case tokenizer.TokenTypeDoubleQuote, tokenizer.TokenTypeSingleQuote:
+		s := r.str(tok)
 		r.consume()
-		return &xslt.Text{
-			Body: tok.Value,
-		}, nil
+		return s, nil
+
+	case tokenizer.TokenTypeBackQuote:
+		s, err := r.interpolated(tok)
+		if err != nil {
+			return nil, err
+		}
 
-	case tokenizer.TokenTypeXPath, tokenizer.TokenTypeNumber:
 		r.consume()
-		return &xslt.ValueOf{
-			Select: tok.Value,
-		}, nil
+		return s, nil
+
+	case tokenizer.TokenTypeXPath:
+		xpath := r.xpath(tok)
+		r.consume()
+		return xpath, nil
+
+	case tokenizer.TokenTypeNumber:
+		num := &ast.Number{
+			ValuePos: r.pos,
+			Value:    tok.Value,
+			EndPos:   r.last.End,
+		}
+		r.consume()
+		return num, nil
 
 	case tokenizer.TokenTypeIdentifier:
 		switch tok.Value {
@@ -416,11 +688,21 @@ func (r *Reader) parseExpression(ctx context.Context) (interface{}, error) {
 			return r.parseCopyOf(ctx)
 
 		case "var":
+			keyword := r.pos
 			r.consume()
-			return r.parseVariable(ctx, tokenizer.OperatorEquals)
+
+			v, err := r.parseVariable(ctx, tokenizer.OperatorEquals, ast.VarKindVar)
+			if err != nil {
+				return nil, err
+			}
+
+			v.Keyword = keyword
+			return v, nil
 
 		case "foreach":
 			return r.parseForEach(ctx)
+		case "group":
+			return r.parseGroupBy(ctx)
 		case "apply-templates":
 			return r.parseApplyTemplates(ctx)
 
@@ -436,10 +718,18 @@ func (r *Reader) parseExpression(ctx context.Context) (interface{}, error) {
 		case "attribs":
 			return r.parseAttribs(ctx)
 
-		case "span":
-			return r.parseSpan(ctx)
-		case "div":
-			return r.parseDiv(ctx)
+		case "sequence":
+			return r.parseSequence(ctx)
+		case "analyze-string":
+			return r.parseAnalyzeString(ctx)
+		case "result-document":
+			return r.parseResultDocument(ctx)
+		case "return":
+			return r.parseReturn(ctx)
+		}
+
+		if _, ok := htmlTag(tok.Value); ok {
+			return r.parseHTMLElement(ctx, tok)
 		}
 	}
 
@@ -449,7 +739,11 @@ func (r *Reader) parseExpression(ctx context.Context) (interface{}, error) {
 		return nil, nil //*/
 }
 
-func (r *Reader) parseIf(ctx context.Context) (*xslt.If, error) {
+func (r *Reader) parseIf(ctx context.Context) (*ast.If, error) {
+	node := &ast.If{
+		Keyword: r.pos,
+	}
+
 	cond, err := r.read(ctx)
 	if err != nil {
 		return nil, err
@@ -458,21 +752,19 @@ func (r *Reader) parseIf(ctx context.Context) (*xslt.If, error) {
 	if cond.Type != tokenizer.TokenTypeXPath {
 		return nil, r.parseError("expected xpath")
 	}
+	node.Test = r.xpath(cond)
 	r.consume()
 
-	body, err := r.parseExpression(ctx)
+	node.Body, err = r.parseExpression(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	return &xslt.If{
-		Test: cond.Value,
-		Body: body,
-	}, nil
+	return node, nil
 }
 
-func (r *Reader) parseChoose(ctx context.Context) (*xslt.Choose, error) {
-	var whens []*xslt.When
+func (r *Reader) parseChoose(ctx context.Context) (*ast.Choose, error) {
+	choose := new(ast.Choose)
 
 	for {
 		tok, err := r.peak(ctx)
@@ -481,33 +773,31 @@ func (r *Reader) parseChoose(ctx context.Context) (*xslt.Choose, error) {
 		}
 
 		if tok.Type != tokenizer.TokenTypeIdentifier {
-			return &xslt.Choose{
-				Whens: whens,
-			}, nil
+			return choose, nil
 		}
 
-		var cond tokenizer.Token
+		keyword := r.pos
+
+		var cond *ast.XPath
 
 		switch tok.Value {
 		case "when":
-			var err error
-			cond, err = r.read(ctx)
+			tok, err := r.read(ctx)
 			if err != nil {
 				return nil, err
 			}
 
-			if cond.Type != tokenizer.TokenTypeXPath {
+			if tok.Type != tokenizer.TokenTypeXPath {
 				return nil, r.parseError("expected xpath")
 			}
+			cond = r.xpath(tok)
 			r.consume()
 
 		case "otherwise":
 			r.consume()
 
 		default:
-			return &xslt.Choose{
-				Whens: whens,
-			}, nil
+			return choose, nil
 		}
 
 		body, err := r.parseExpression(ctx)
@@ -515,23 +805,24 @@ func (r *Reader) parseChoose(ctx context.Context) (*xslt.Choose, error) {
 			return nil, err
 		}
 
-		if tok.Value == "otherwise" {
-			return &xslt.Choose{
-				Whens: whens,
-				Otherwise: &xslt.Otherwise{
-					Body: body,
-				},
-			}, nil
+		if cond == nil {
+			choose.Otherwise = &ast.Otherwise{
+				Keyword: keyword,
+				Body:    body,
+			}
+
+			return choose, nil
 		}
 
-		whens = append(whens, &xslt.When{
-			Test: cond.Value,
-			Body: body,
+		choose.Whens = append(choose.Whens, &ast.When{
+			Keyword: keyword,
+			Test:    cond,
+			Body:    body,
 		})
 	}
 }
 
-func (r *Reader) parseMap(ctx context.Context) (map[string]string, error) {
+func (r *Reader) parseMap(ctx context.Context) (*ast.Map, error) {
 	tok, err := r.peak(ctx)
 	if err != nil {
 		return nil, err
@@ -552,7 +843,10 @@ func (r *Reader) parseMap(ctx context.Context) (map[string]string, error) {
 		return nil, r.parseError("expected start of grouping")
 	}
 
-	m := make(map[string]string)
+	m := &ast.Map{
+		Open:  r.pos,
+		Delim: tok.Value,
+	}
 
 	for {
 		key, err := r.readSkipComma(ctx)
@@ -562,10 +856,11 @@ func (r *Reader) parseMap(ctx context.Context) (map[string]string, error) {
 
 		switch key.Type {
 		case tokenizer.TokenTypeEndGroup:
-			if key != end {
+			if !key.Is(end) {
 				return nil, r.parseErrorf("unexpected end map token, was expecting: %s", end)
 			}
 
+			m.Close = r.pos
 			r.consume()
 			return m, nil
 
@@ -576,9 +871,14 @@ func (r *Reader) parseMap(ctx context.Context) (map[string]string, error) {
 			return nil, r.parseError("expected ident or string")
 		}
 
+		entry := &ast.MapEntry{
+			Key: r.literal(key),
+		}
+
 		if err := r.nextMustBe(ctx, tokenizer.OperatorArrow); err != nil {
 			return nil, err
 		}
+		entry.Arrow = r.pos
 
 		val, err := r.read(ctx)
 		if err != nil {
@@ -592,44 +892,60 @@ func (r *Reader) parseMap(ctx context.Context) (map[string]string, error) {
 			return nil, r.parseError("expected ident or string")
 		}
 
-		m[key.Value] = val.Value
+		entry.Value = r.literal(val)
+		m.Entries = append(m.Entries, entry)
 	}
 }
 
-func (r *Reader) parseGroup(ctx context.Context, end tokenizer.Token) (xslt.Group, error) {
-	var group xslt.Group
+func (r *Reader) parseGroup(ctx context.Context, open ast.Pos, start tokenizer.Token) (*ast.Group, error) {
+	end := endTokenFromStart(start)
+
+	group := &ast.Group{
+		Open:  open,
+		Delim: start.Value,
+	}
 
 	for {
 		tok, err := r.peakSkipComma(ctx)
 		if err != nil {
-			if err == io.EOF {
-				return nil, r.parseError("unexpected EOF")
-			}
-
 			return nil, err
 		}
 
 		if tok.Type == tokenizer.TokenTypeEndGroup {
-			if tok != end {
+			if !tok.Is(end) {
 				return nil, r.parseErrorf("unexpected end group token, was expecting: %s", end)
 			}
 
+			group.List = append(group.List, r.takeComments()...)
+			group.Close = r.pos
 			r.consume()
 			return group, nil
 		}
 
 		thing, err := r.parseExpression(ctx)
 		if err != nil {
-			return nil, err
-		}
+			if err == errRecovered || ctx.Err() != nil {
+				return nil, err
+			}
+
+			r.errs.Add(err)
 
-		if thing != nil {
-			group = append(group, thing)
+			if err := r.syncGroup(ctx); err != nil {
+				return nil, err
+			}
+
+			continue
 		}
+
+		group.List = append(group.List, thing)
 	}
 }
 
-func (r *Reader) parseText(ctx context.Context) (*xslt.Text, error) {
+func (r *Reader) parseText(ctx context.Context) (*ast.Text, error) {
+	text := &ast.Text{
+		Keyword: r.pos,
+	}
+
 	val, err := r.read(ctx)
 	if err != nil {
 		return nil, err
@@ -643,14 +959,17 @@ func (r *Reader) parseText(ctx context.Context) (*xslt.Text, error) {
 		return nil, r.parseError("expected a string")
 	}
 
+	text.Value = r.str(val)
 	r.consume()
 
-	return &xslt.Text{
-		Body: val.Value,
-	}, nil
+	return text, nil
 }
 
-func (r *Reader) parseCopyOf(ctx context.Context) (*xslt.CopyOf, error) {
+func (r *Reader) parseCopyOf(ctx context.Context) (*ast.CopyOf, error) {
+	copyOf := &ast.CopyOf{
+		Keyword: r.pos,
+	}
+
 	val, err := r.read(ctx)
 	if err != nil {
 		return nil, err
@@ -662,39 +981,137 @@ func (r *Reader) parseCopyOf(ctx context.Context) (*xslt.CopyOf, error) {
 		return nil, r.parseError("expected an xpath")
 	}
 
+	copyOf.Select = r.xpath(val)
 	r.consume()
 
-	return &xslt.CopyOf{
-		Select: val.Value,
-	}, nil
+	return copyOf, nil
 }
 
-func ParseFile(ctx context.Context, in io.Reader, filename string, xsl *xslt.Stylesheet) error {
-	r := &Reader{
+func newReader(filename string, in io.Reader, target xslt.Version, uses *Uses, errs *ErrorList) *Reader {
+	return &Reader{
 		filename: filename,
+		target:   target,
 
 		r: &tokenizer.Reader{
-			S: bufio.NewScanner(in),
+			S:        bufio.NewScanner(in),
+			Filename: filename,
+
+			IDShorthand: func(name string) bool {
+				_, ok := htmlTag(name)
+				return ok
+			},
 		},
+
+		uses: uses,
+		errs: errs,
+	}
+}
+
+// ParseFile parses the LXT source from the given io.Reader into the given Stylesheet.
+// Any modules referenced by a `use` directive are also parsed into the Stylesheet,
+// with relative filenames resolved against the filename of the module using them.
+//
+// If any errors are found, then the returned error is an ErrorList,
+// and nothing is added to the Stylesheet.
+func ParseFile(ctx context.Context, in io.Reader, filename string, xsl *xslt.Stylesheet) error {
+	file, err := Parse(ctx, in, filename)
+	if err != nil {
+		return err
+	}
+
+	var errs ErrorList
+	errs.Add(lower.File(file, xsl))
+	return errs.Err()
+}
+
+// Parse parses the LXT source from the given io.Reader into a syntax tree, targeting XSLT 1.0.
+// Any modules referenced by a `use` directive are also parsed, and attached to the `use` directive.
+//
+// Parsing recovers from errors, so that as many errors as possible are reported.
+// If any errors are found, then the returned error is an ErrorList,
+// and the returned syntax tree omits the erroneous statements and expressions.
+func Parse(ctx context.Context, in io.Reader, filename string) (*ast.File, error) {
+	return ParseTarget(ctx, in, filename, xslt.XSLT10)
+}
+
+// ParseTarget parses the LXT source like Parse, but targeting the given version of XSLT.
+// Constructs that require a later version of XSLT are reported as errors.
+func ParseTarget(ctx context.Context, in io.Reader, filename string, target xslt.Version) (*ast.File, error) {
+	return ParseUses(ctx, in, filename, target, NewUses())
+}
+
+// ParseUses parses the LXT source like ParseTarget, sharing the given Uses with the other files of the same compilation.
+// If the file has already been inlined by a `use` directive of another of the files,
+// then its statements are already part of the compilation, and an empty File is returned.
+func ParseUses(ctx context.Context, in io.Reader, filename string, target xslt.Version, uses *Uses) (*ast.File, error) {
+	name := cleanFilename(filename)
+	if uses.done[name] {
+		return &ast.File{
+			Filename: filename,
+		}, nil
+	}
+	uses.done[name] = true
+
+	uses.stack = append(uses.stack, name)
+	defer func() {
+		uses.stack = uses.stack[:len(uses.stack)-1]
+	}()
+
+	errs := new(ErrorList)
+	r := newReader(filename, in, target, uses, errs)
+
+	file := r.parse(ctx)
+	return file, errs.Err()
+}
+
+// ParseSource parses a single LXT source file into a syntax tree, for tools that work on the source itself.
+// Unlike Parse, any modules referenced by a `use` directive are not parsed,
+// the line and block comments of the source are kept in the File.Comments,
+// and the constructs of every version of XSLT are accepted.
+func ParseSource(ctx context.Context, in io.Reader, filename string) (*ast.File, error) {
+	errs := new(ErrorList)
+	r := newReader(filename, in, xslt.LatestVersion, nil, errs)
+	r.r.KeepComments = true
+
+	file := r.parse(ctx)
+
+	for _, c := range r.r.Comments {
+		file.Comments = append(file.Comments, &ast.PlainComment{
+			Slash:  c.Pos,
+			Text:   c.Text,
+			EndPos: c.End,
+		})
+	}
+
+	return file, errs.Err()
+}
+
+// parse parses statements until the end of the file, adding any errors to the error list.
+func (r *Reader) parse(ctx context.Context) *ast.File {
+	file := &ast.File{
+		Filename: r.filename,
 	}
 
 	for {
+		if err := ctx.Err(); err != nil {
+			r.errs.Add(r.parseError("parsing cancelled", err))
+			return file
+		}
+
 		tok, err := r.peakSkipComma(ctx)
 
-		if tok == tokenizer.EOF {
-			return nil
+		if tok.Is(tokenizer.EOF) {
+			file.Statements = append(file.Statements, r.takeComments()...)
+			return file
 		}
 
-		if err != nil {
-			if err == io.EOF {
-				return r.parseError("unexpected EOF")
-			}
-
-			return err
+		if err == nil {
+			err = r.parseStatement(ctx, file)
 		}
 
-		if err := r.parseStatement(ctx, xsl); err != nil {
-			return err
+		if err != nil {
+			r.errs.Add(err)
+			r.syncStatement(ctx, tok)
 		}
 	}
 }
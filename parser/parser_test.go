@@ -0,0 +1,931 @@
+package parser
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/puellanivis/lxt/ast"
+	"github.com/puellanivis/lxt/tokenizer"
+	"github.com/puellanivis/lxt/xslt"
+)
+
+func TestParsePositions(t *testing.T) {
+	input := `output ( method => html )
+
+/** header */
+sub header ( level => <1> ) {
+	tag h1 $title
+}
+
+template </> mode body {
+	foreach <//item> sort-by ( <@date> desc ) {
+		call header
+	}
+}
+`
+
+	file, err := Parse(context.Background(), strings.NewReader(input), "test.lxt")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	type found struct {
+		kind string
+		line int
+	}
+
+	var got []found
+	ast.InspectFile(file, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.Output, *ast.Comment, *ast.Sub, *ast.Template, *ast.Tag, *ast.ForEach, *ast.SortBy, *ast.Call:
+			if n.Pos().Filename != "test.lxt" {
+				t.Errorf("%T has filename %q, expected %q", n, n.Pos().Filename, "test.lxt")
+			}
+
+			got = append(got, found{typeName(n), n.Pos().Line})
+		}
+		return true
+	})
+
+	expect := []found{
+		{"Output", 1},
+		{"Comment", 3},
+		{"Sub", 4},
+		{"Tag", 5},
+		{"Template", 8},
+		{"ForEach", 9},
+		{"SortBy", 9},
+		{"Call", 10},
+	}
+
+	if len(got) != len(expect) {
+		t.Fatalf("found %v, expected %v", got, expect)
+	}
+
+	for i := range expect {
+		if got[i] != expect[i] {
+			t.Errorf("node %d was %v, expected %v", i, got[i], expect[i])
+		}
+	}
+}
+
+func typeName(node ast.Node) string {
+	return strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast.")
+}
+
+func TestParseErrorPosition(t *testing.T) {
+	input := "sub x {\n\tif \"str\" x\n}\n"
+
+	_, err := Parse(context.Background(), strings.NewReader(input), "test.lxt")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	var perr *tokenizer.Error
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected a *tokenizer.Error, got %T: %v", err, err)
+	}
+
+	if perr.Pos.Line != 2 || perr.Pos.Column != 5 || perr.End.Column != 10 {
+		t.Errorf("error was at %d:%d-%d, expected 2:5-10", perr.Pos.Line, perr.Pos.Column, perr.End.Column)
+	}
+
+	if got := input[perr.Pos.Offset:perr.End.Offset]; got != `"str"` {
+		t.Errorf("error spans %q, expected %q", got, `"str"`)
+	}
+}
+
+func TestParseErrorRecovery(t *testing.T) {
+	input := `sub a {
+	if "bad" { "x" }
+	"ok"
+	foreach <x> { call }
+}
+
+template </> {
+	tag div { "unterminated"
+
+sub b ( x => <1> ) { "y" }
+
+template "q" { }
+template <y> { $ok }
+`
+
+	file, err := Parse(context.Background(), strings.NewReader(input), "test.lxt")
+
+	var errs ErrorList
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected an ErrorList, got %T: %v", err, err)
+	}
+
+	expectLines := []int{2, 4, 10, 12}
+
+	if len(errs) != len(expectLines) {
+		t.Fatalf("got %d errors, expected %d: %v", len(errs), len(expectLines), errs)
+	}
+
+	for i, line := range expectLines {
+		if errs[i].Pos.Line != line {
+			t.Errorf("error %d was on line %d, expected %d: %v", i, errs[i].Pos.Line, line, errs[i])
+		}
+	}
+
+	var subs, templates int
+	ast.InspectFile(file, func(node ast.Node) bool {
+		switch node.(type) {
+		case *ast.Sub:
+			subs++
+		case *ast.Template:
+			templates++
+		}
+		return true
+	})
+
+	if subs != 2 || templates != 1 {
+		t.Errorf("recovered %d subs and %d templates, expected 2 and 1", subs, templates)
+	}
+}
+
+func TestParseXPathErrors(t *testing.T) {
+	input := "template <a/b> {\n\t<{ count(item }>\n\tif <{\n  concat(a,\n     b c) }> { $ok }\n}\ntemplate <ancestor::x> { }\n"
+
+	_, err := Parse(context.Background(), strings.NewReader(input), "test.lxt")
+
+	var errs ErrorList
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected an ErrorList, got %T: %v", err, err)
+	}
+
+	type pos struct {
+		line, col int
+	}
+
+	expect := []pos{
+		{2, 15},
+		{5, 8},
+		{7, 11},
+	}
+
+	if len(errs) != len(expect) {
+		t.Fatalf("got %d errors, expected %d: %v", len(errs), len(expect), errs)
+	}
+
+	for i, p := range expect {
+		if got := (pos{errs[i].Pos.Line, errs[i].Pos.Column}); got != p {
+			t.Errorf("error %d was at %v, expected %v: %v", i, got, p, errs[i])
+		}
+	}
+}
+
+func TestParseXPathVariables(t *testing.T) {
+	input := `key k <{ item[$x] }> <{ $x }>
+template <{ a/b[@id = $y] }> { }
+`
+
+	expect := []string{
+		"test.lxt:1:15: invalid xpath: variable $x is not allowed in a pattern",
+		"test.lxt:1:25: invalid xpath: variable $x is not allowed in the use of a key",
+		"test.lxt:2:23: invalid xpath: variable $y is not allowed in a pattern",
+	}
+
+	_, err := Parse(context.Background(), strings.NewReader(input), "test.lxt")
+
+	var errs ErrorList
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected an ErrorList, got %T: %v", err, err)
+	}
+
+	if got, expect := strings.Join(messages(errs), "\n"), strings.Join(expect, "\n"); got != expect {
+		t.Errorf("errors were:\n%s\nexpected:\n%s", got, expect)
+	}
+}
+
+func TestParseTarget(t *testing.T) {
+	input := `sub row ( tunnel depth as xs:integer => <0>, tunnel => <1> ) {
+	var total as "xs:integer*" = <{ for $i in item return xs:integer($i) }>
+	sequence <{ sum($total) }>
+	analyze-string <title> "[0-9]+" matching <{ regex-group(0) }>
+	result-document "out.html" output ( method => html ) <.>
+}
+`
+
+	if _, err := ParseTarget(context.Background(), strings.NewReader(input), "test.lxt", xslt.XSLT20); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	_, err := Parse(context.Background(), strings.NewReader(input), "test.lxt")
+
+	var errs ErrorList
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected an ErrorList, got %T: %v", err, err)
+	}
+
+	expect := []string{
+		"test.lxt:1:11: tunnel parameters require XSLT 2.0 or later, but the target is XSLT 1.0",
+		"test.lxt:1:24: type annotations require XSLT 2.0 or later, but the target is XSLT 1.0",
+		"test.lxt:2:12: type annotations require XSLT 2.0 or later, but the target is XSLT 1.0",
+		"test.lxt:2:41: invalid xpath: expected operator, found \"in\"",
+		"test.lxt:3:2: sequence expressions require XSLT 2.0 or later, but the target is XSLT 1.0",
+		"test.lxt:4:2: analyze-string expressions require XSLT 2.0 or later, but the target is XSLT 1.0",
+		"test.lxt:5:2: result-document expressions require XSLT 2.0 or later, but the target is XSLT 1.0",
+	}
+
+	if got, expect := strings.Join(messages(errs), "\n"), strings.Join(expect, "\n"); got != expect {
+		t.Errorf("errors were:\n%s\nexpected:\n%s", got, expect)
+	}
+}
+
+func messages(errs ErrorList) []string {
+	var msgs []string
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	return msgs
+}
+
+func TestParseFunc(t *testing.T) {
+	input := `namespace f => "http://exslt.org/functions"
+namespace my => "urn:my"
+
+func my:double ( $n ) { return <{ $n * 2 }> }
+
+template </> { <{ my:double(2) }> }
+`
+
+	expect := `<xsl:stylesheet version="1.0" extension-element-prefixes="f" xmlns:f="http://exslt.org/functions" xmlns:my="urn:my" xmlns:xsl="http://www.w3.org/1999/XSL/Transform">
+  <f:function name="my:double">
+    <xsl:param name="n"></xsl:param>
+    <f:result select="$n * 2"></f:result>
+  </f:function>
+  <xsl:template match="/">
+    <xsl:value-of select="my:double(2)"></xsl:value-of>
+  </xsl:template>
+</xsl:stylesheet>`
+
+	xsl := xslt.NewStylesheet()
+	xsl.Output = nil
+	if err := ParseFile(context.Background(), strings.NewReader(input), "test.lxt", xsl); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	data, err := xml.MarshalIndent(xsl, "", "  ")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if got := string(data); got != expect {
+		t.Errorf("ParseFile gave:\n%s\nexpected:\n%s", got, expect)
+	}
+
+	input = `func double ( $n ) { return <{ $n * 2 }> }
+sub s { return <1> }
+func my:f ( $n => <1> ) { return <$n> }
+func my:g ( $n ) { return <$n> }
+`
+
+	_, err = Parse(context.Background(), strings.NewReader(input), "test.lxt")
+
+	var errs ErrorList
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected an ErrorList, got %T: %v", err, err)
+	}
+
+	expectErrs := []string{
+		`test.lxt:1:6: function name must have a namespace prefix: IDENT("double")`,
+		`test.lxt:2:9: return outside of a func: IDENT("return")`,
+		`test.lxt:3:16: function parameters cannot have default values: OP("=>")`,
+	}
+
+	if got, expect := strings.Join(messages(errs), "\n"), strings.Join(expectErrs, "\n"); got != expect {
+		t.Errorf("errors were:\n%s\nexpected:\n%s", got, expect)
+	}
+
+	xsl = xslt.NewStylesheet()
+	err = ParseFile(context.Background(), strings.NewReader(`func my:g ( $n ) { return <$n> }`), "test.lxt", xsl)
+
+	expectErr := `test.lxt:1:1: func requires XSLT 2.0 or later, or a namespace declared for "http://exslt.org/functions"`
+	if err == nil || err.Error() != expectErr {
+		t.Errorf("ParseFile gave error: %v\nexpected: %s", err, expectErr)
+	}
+}
+
+func TestParseGroupBy(t *testing.T) {
+	input := `template </> {
+	group <item> by <@cat> sort-by ( <{ count(current-group()) }> ) {
+		tag cat { <{ current-grouping-key() }> }
+		foreach <{ current-group() }> <name>
+	}
+}
+`
+
+	tests := []struct {
+		target xslt.Version
+		expect string
+	}{
+		{
+			target: xslt.XSLT10,
+			expect: `<xsl:key name="lxt-group-1" match="item" use="@cat"></xsl:key>
+<xsl:template match="/">
+  <xsl:for-each select="item[generate-id() = generate-id(key(&#39;lxt-group-1&#39;, @cat)[1])]">
+    <xsl:sort select="count(key(&#39;lxt-group-1&#39;, @cat))"></xsl:sort>
+    <xsl:variable name="lxt-group-1" select="key(&#39;lxt-group-1&#39;, @cat)"></xsl:variable>
+    <xsl:variable name="lxt-group-1-key" select="@cat"></xsl:variable>
+    <cat>
+      <xsl:value-of select="$lxt-group-1-key"></xsl:value-of>
+    </cat>
+    <xsl:for-each select="$lxt-group-1">
+      <xsl:value-of select="name"></xsl:value-of>
+    </xsl:for-each>
+  </xsl:for-each>
+</xsl:template>`,
+		},
+		{
+			target: xslt.XSLT20,
+			expect: `<xsl:template match="/">
+  <xsl:for-each-group select="item" group-by="@cat">
+    <xsl:sort select="count(current-group())"></xsl:sort>
+    <cat>
+      <xsl:value-of select="current-grouping-key()"></xsl:value-of>
+    </cat>
+    <xsl:for-each select="current-group()">
+      <xsl:value-of select="name"></xsl:value-of>
+    </xsl:for-each>
+  </xsl:for-each-group>
+</xsl:template>`,
+		},
+	}
+
+	for _, tt := range tests {
+		xsl := xslt.NewStylesheet()
+		xsl.SetAttr("version", tt.target.String())
+
+		if err := ParseFile(context.Background(), strings.NewReader(input), "test.lxt", xsl); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		data, err := xml.MarshalIndent(append(xsl.Keys, xsl.Body...), "", "  ")
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		if got := string(data); got != tt.expect {
+			t.Errorf("XSLT %s: ParseFile gave:\n%s\nexpected:\n%s", tt.target, got, tt.expect)
+		}
+	}
+}
+
+func TestParseGroupByKeys(t *testing.T) {
+	input := `key k <a> <@b>
+template </> {
+	group <item> by <@cat> { <name> }
+}
+`
+
+	expect := `<xsl:key name="k" match="a" use="@b"></xsl:key>
+<xsl:key name="lxt-group-1" match="item" use="@cat"></xsl:key>`
+
+	xsl := xslt.NewStylesheet()
+	if err := ParseFile(context.Background(), strings.NewReader(input), "test.lxt", xsl); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	data, err := xml.MarshalIndent(xsl.Keys, "", "  ")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if got := string(data); got != expect {
+		t.Errorf("ParseFile gave:\n%s\nexpected:\n%s", got, expect)
+	}
+
+	errTests := []struct {
+		input  string
+		expect string
+	}{
+		{
+			input:  `template </> { var x = "a" group <//item> by <{ $x }> { <name> } }`,
+			expect: `test.lxt:1:49: group cannot refer to variable $x when targeting XSLT 1.0, as its key is declared outside of any template`,
+		},
+		{
+			input:  `template </> { var x = "a" group <{ item[@cat = $x] }> by <@cat> { <name> } }`,
+			expect: `test.lxt:1:49: group cannot refer to variable $x when targeting XSLT 1.0, as its key is declared outside of any template`,
+		},
+	}
+
+	for _, tt := range errTests {
+		xsl := xslt.NewStylesheet()
+
+		err := ParseFile(context.Background(), strings.NewReader(tt.input), "test.lxt", xsl)
+		if err == nil || err.Error() != tt.expect {
+			t.Errorf("ParseFile(%q) gave error: %v\nexpected: %s", tt.input, err, tt.expect)
+		}
+	}
+
+	// Variables are in scope of an xsl:for-each-group.
+	xsl = xslt.NewStylesheet()
+	xsl.SetAttr("version", xslt.XSLT20.String())
+
+	if err := ParseFile(context.Background(), strings.NewReader(errTests[0].input), "test.lxt", xsl); err != nil {
+		t.Error("unexpected error:", err)
+	}
+}
+
+func TestParseLiteralElements(t *testing.T) {
+	input := `namespace my => "urn:my"
+namespace h => "http://www.w3.org/1999/xhtml"
+
+template </> {
+	tag h:a {
+		attribs ( href => <{ my:url(.) }>, title => "a {b}" )
+		div note "text"
+		attribs ( id => <@id> )
+	}
+	tag p {
+		attribs ( rel => { "x" copy-of <y> } )
+	}
+	tag xsl:fallback ;
+}
+`
+
+	expect := `<xsl:stylesheet version="1.0" exclude-result-prefixes="my" xmlns:h="http://www.w3.org/1999/xhtml" xmlns:my="urn:my" xmlns:xsl="http://www.w3.org/1999/XSL/Transform">
+  <xsl:template match="/">
+    <h:a href="{my:url(.)}" title="a {{b}}">
+      <div class="note">
+        <xsl:text>text</xsl:text>
+      </div>
+      <xsl:attribute name="id">
+        <xsl:value-of select="@id"></xsl:value-of>
+      </xsl:attribute>
+    </h:a>
+    <p>
+      <xsl:attribute name="rel">
+        <xsl:text>x</xsl:text>
+        <xsl:copy-of select="y"></xsl:copy-of>
+      </xsl:attribute>
+    </p>
+    <xsl:element name="xsl:fallback"></xsl:element>
+  </xsl:template>
+</xsl:stylesheet>`
+
+	xsl := xslt.NewStylesheet()
+	xsl.Output = nil
+	if err := ParseFile(context.Background(), strings.NewReader(input), "test.lxt", xsl); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	data, err := xml.MarshalIndent(xsl, "", "  ")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if got := string(data); got != expect {
+		t.Errorf("ParseFile gave:\n%s\nexpected:\n%s", got, expect)
+	}
+}
+
+func TestParseComputedNames(t *testing.T) {
+	input := `template </> {
+	tag <{ local-name() }> namespace <{ namespace-uri() }> {
+		attribs ( <{ name(@*[1]) }> => "a", id namespace "urn:x" => <@id>, "b" => "{b}" )
+	}
+}
+`
+
+	expect := `<xsl:template match="/">
+  <xsl:element name="{local-name()}" namespace="{namespace-uri()}">
+    <xsl:attribute name="{name(@*[1])}">
+      <xsl:text>a</xsl:text>
+    </xsl:attribute>
+    <xsl:attribute name="id" namespace="urn:x">
+      <xsl:value-of select="@id"></xsl:value-of>
+    </xsl:attribute>
+    <xsl:attribute name="b">
+      <xsl:text>{b}</xsl:text>
+    </xsl:attribute>
+  </xsl:element>
+</xsl:template>`
+
+	xsl := xslt.NewStylesheet()
+	if err := ParseFile(context.Background(), strings.NewReader(input), "test.lxt", xsl); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	data, err := xml.MarshalIndent(xsl.Body, "", "  ")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if got := string(data); got != expect {
+		t.Errorf("ParseFile gave:\n%s\nexpected:\n%s", got, expect)
+	}
+
+	_, err = Parse(context.Background(), strings.NewReader(`template </> { tag 1 "x" }`), "test.lxt")
+
+	expectErr := `test.lxt:1:20: expected identifier or xpath: NUM("1")`
+	if err == nil || err.Error() != expectErr {
+		t.Errorf("Parse gave error: %v\nexpected: %s", err, expectErr)
+	}
+}
+
+func TestParseInterpolated(t *testing.T) {
+	input := "template </> {\n" +
+		"\t`Hello, {name}! {{literal}} {concat('}', $x)}`\n" +
+		"\ttag a { attribs ( href => `/items/{@id}.html`, title => `{ name }` ) `item {@id}` }\n" +
+		"}\n"
+
+	expect := `<xsl:template match="/">
+  <xsl:text>Hello, </xsl:text>
+  <xsl:value-of select="name"></xsl:value-of>
+  <xsl:text>! {literal} </xsl:text>
+  <xsl:value-of select="concat(&#39;}&#39;, $x)"></xsl:value-of>
+  <a href="/items/{@id}.html" title="{name}">
+    <xsl:text>item </xsl:text>
+    <xsl:value-of select="@id"></xsl:value-of>
+  </a>
+</xsl:template>`
+
+	xsl := xslt.NewStylesheet()
+	if err := ParseFile(context.Background(), strings.NewReader(input), "test.lxt", xsl); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	data, err := xml.MarshalIndent(xsl.Body, "", "  ")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if got := string(data); got != expect {
+		t.Errorf("ParseFile gave:\n%s\nexpected:\n%s", got, expect)
+	}
+
+	tests := map[string]string{
+		"template </> `{name`":      "test.lxt:1:14: unterminated xpath in interpolated string: BQ(\"{name\")",
+		"template </> `a {} b`":     "test.lxt:1:14: empty xpath in interpolated string: BQ(\"a {} b\")",
+		"template </> `a } b`":      "test.lxt:1:14: unmatched '}' in interpolated string, literal braces are written as '{{' and '}}': BQ(\"a } b\")",
+		"template </> `ok {1 +}`":   "test.lxt:1:22: invalid xpath: unexpected end of expression",
+		"template </>\n`{\n  @a[}`": "test.lxt:3:6: invalid xpath: unexpected end of expression",
+	}
+
+	for input, expect := range tests {
+		_, err := Parse(context.Background(), strings.NewReader(input), "test.lxt")
+		if err == nil || err.Error() != expect {
+			t.Errorf("Parse(%q) gave error: %v\nexpected: %s", input, err, expect)
+		}
+	}
+}
+
+func TestParseHTMLElements(t *testing.T) {
+	input := `template </> {
+	div#main.card.wide {
+		p "text"
+		ul { foreach <item> { li <name> } }
+		span note "aside"
+		img { attribs ( src => <@src> ) }
+		br ;
+		a.link { attribs ( href => "/" ) "home" }
+	}
+}
+`
+
+	expect := `<xsl:template match="/">
+  <div id="main" class="card wide">
+    <p>
+      <xsl:text>text</xsl:text>
+    </p>
+    <ul>
+      <xsl:for-each select="item">
+        <li>
+          <xsl:value-of select="name"></xsl:value-of>
+        </li>
+      </xsl:for-each>
+    </ul>
+    <span class="note">
+      <xsl:text>aside</xsl:text>
+    </span>
+    <img src="{@src}"></img>
+    <br></br>
+    <a class="link" href="/">
+      <xsl:text>home</xsl:text>
+    </a>
+  </div>
+</xsl:template>`
+
+	xsl := xslt.NewStylesheet()
+	if err := ParseFile(context.Background(), strings.NewReader(input), "test.lxt", xsl); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	data, err := xml.MarshalIndent(xsl.Body, "", "  ")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if got := string(data); got != expect {
+		t.Errorf("ParseFile gave:\n%s\nexpected:\n%s", got, expect)
+	}
+
+	tests := map[string]string{
+		`template </> br "text"`:                      `test.lxt:1:17: void element br cannot have content`,
+		`template </> img { attribs ( a => 1 ) <x> }`: `test.lxt:1:39: void element img cannot have content`,
+		`template </> div.#a ;`:                       `test.lxt:1:14: div cannot have an empty class name: IDENT("div.#a")`,
+		`template </> div#a#b ;`:                      `test.lxt:1:14: div cannot have more than one id: IDENT("div#a#b")`,
+		`template </> p.a..b ;`:                       `test.lxt:1:14: p cannot have an empty class name: IDENT("p.a..b")`,
+		`template </> span "" ;`:                      `test.lxt:1:19: span cannot have an empty class name: DQ("")`,
+		`template </> li#2 "x"`:                       `test.lxt:1:14: tokenize error: IDENT("li#2"): malformed id shorthand: an id must begin with a letter or underscore`,
+		`template </> tag div#x "x"`:                  `test.lxt:1:18: invalid name "div#x": an id shorthand may only follow the name of an HTML element`,
+		`template </> var div#x = "a"`:                `test.lxt:1:18: invalid name "div#x": an id shorthand may only follow the name of an HTML element`,
+		`sub li#x { "x" }`:                            `test.lxt:1:5: invalid name "li#x": an id shorthand may only follow the name of an HTML element`,
+		`template </> p { attribs ( p#x => "a" ) }`:   `test.lxt:1:28: invalid name "p#x": an id shorthand may only follow the name of an HTML element`,
+	}
+
+	for input, expect := range tests {
+		_, err := Parse(context.Background(), strings.NewReader(input), "test.lxt")
+		if err == nil || err.Error() != expect {
+			t.Errorf("Parse(%q) gave error: %v\nexpected: %s", input, err, expect)
+		}
+	}
+}
+
+func TestParseSortBy(t *testing.T) {
+	input := `template </> {
+	foreach <item> sort-by ( <@date> desc number, <name> ascending text upper-first lang "en" ) <name>
+	apply-templates <item> sort-by [ <@price> descending ]
+}
+`
+
+	expect := `<xsl:template match="/">
+  <xsl:for-each select="item">
+    <xsl:sort select="@date" data-type="number" order="descending"></xsl:sort>
+    <xsl:sort select="name" lang="en" data-type="text" order="ascending" case-order="upper-first"></xsl:sort>
+    <xsl:value-of select="name"></xsl:value-of>
+  </xsl:for-each>
+  <xsl:apply-templates select="item">
+    <xsl:sort select="@price" order="descending"></xsl:sort>
+  </xsl:apply-templates>
+</xsl:template>`
+
+	xsl := xslt.NewStylesheet()
+	if err := ParseFile(context.Background(), strings.NewReader(input), "test.lxt", xsl); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	data, err := xml.MarshalIndent(xsl.Body, "", "  ")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if got := string(data); got != expect {
+		t.Errorf("ParseFile gave:\n%s\nexpected:\n%s", got, expect)
+	}
+
+	tests := map[string]string{
+		`template </> foreach <x> sort-by ( ) $x`:                  `test.lxt:1:36: sort-by must have at least one sort key: END(")")`,
+		`template </> foreach <x> sort-by ( desc <@a> ) $x`:        `test.lxt:1:36: expected xpath: IDENT("desc")`,
+		`template </> foreach <x> sort-by ( <@a> backwards ) $x`:   `test.lxt:1:41: unknown sort modifier: "backwards": IDENT("backwards")`,
+		`template </> foreach <x> sort-by ( <@a> lang ) $x`:        `test.lxt:1:46: expected a language code: END(")")`,
+		`template </> foreach <x> sort-by ( <@a> ] $x`:             `test.lxt:1:41: unexpected end sort-by token, was expecting: END(")"): END("]")`,
+		`template </> foreach <x> sort-by <@a> $x`:                 `test.lxt:1:34: expected start of grouping: XP("@a")`,
+		`template </> foreach <x> sort-by ( <@a> asc desc ) $x`:    `test.lxt:1:45: conflicting sort modifier, already "ascending"`,
+		`template </> foreach <x> sort-by ( <@a> number text ) $x`: `test.lxt:1:48: conflicting sort modifier, already "number"`,
+	}
+
+	for input, expect := range tests {
+		err := ParseFile(context.Background(), strings.NewReader(input), "test.lxt", xslt.NewStylesheet())
+		if err == nil || err.Error() != expect {
+			t.Errorf("ParseFile(%q) gave error: %v\nexpected: %s", input, err, expect)
+		}
+	}
+}
+
+func TestParseImportInclude(t *testing.T) {
+	input := `import "base.xsl"
+namespace h => "http://www.w3.org/1999/xhtml"
+import 'more.xsl'
+
+template </> "x"
+include "late.xsl"
+include 'other.xsl'
+`
+
+	expect := `<xsl:stylesheet version="1.0" xmlns:h="http://www.w3.org/1999/xhtml" xmlns:xsl="http://www.w3.org/1999/XSL/Transform">
+  <xsl:import href="base.xsl"></xsl:import>
+  <xsl:import href="more.xsl"></xsl:import>
+  <xsl:include href="late.xsl"></xsl:include>
+  <xsl:include href="other.xsl"></xsl:include>
+  <xsl:template match="/">
+    <xsl:text>x</xsl:text>
+  </xsl:template>
+</xsl:stylesheet>`
+
+	xsl := xslt.NewStylesheet()
+	xsl.Output = nil
+	if err := ParseFile(context.Background(), strings.NewReader(input), "test.lxt", xsl); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	data, err := xml.MarshalIndent(xsl, "", "  ")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if got := string(data); got != expect {
+		t.Errorf("ParseFile gave:\n%s\nexpected:\n%s", got, expect)
+	}
+
+	tests := map[string]string{
+		"template </> \"x\"\nimport \"a.xsl\"": `test.lxt:2:1: import must precede all other statements: IDENT("import")`,
+		"include \"a.xsl\"\nimport \"b.xsl\"":  `test.lxt:2:1: import must precede all other statements: IDENT("import")`,
+		`import <a>`:                           `test.lxt:1:8: expected a string: XP("a")`,
+		`include ""`:                           `test.lxt:1:9: href cannot be empty: DQ("")`,
+	}
+
+	for input, expect := range tests {
+		_, err := Parse(context.Background(), strings.NewReader(input), "test.lxt")
+		if err == nil || err.Error() != expect {
+			t.Errorf("Parse(%q) gave error: %v\nexpected: %s", input, err, expect)
+		}
+	}
+}
+
+func TestParseModes(t *testing.T) {
+	input := `template <item> mode brief priority 2 <name>
+template <item> priority "-0.5" mode full ( x => <1> ) $x
+template </> {
+	apply-templates <item> mode brief
+	apply-templates mode full
+}
+`
+
+	expect := `<xsl:template match="item" mode="brief" priority="2">
+  <xsl:value-of select="name"></xsl:value-of>
+</xsl:template>
+<xsl:template match="item" mode="full" priority="-0.5">
+  <xsl:param name="x" select="1"></xsl:param>
+  <xsl:value-of select="$x"></xsl:value-of>
+</xsl:template>
+<xsl:template match="/">
+  <xsl:apply-templates select="item" mode="brief"></xsl:apply-templates>
+  <xsl:apply-templates mode="full"></xsl:apply-templates>
+</xsl:template>`
+
+	xsl := xslt.NewStylesheet()
+	if err := ParseFile(context.Background(), strings.NewReader(input), "test.lxt", xsl); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	data, err := xml.MarshalIndent(xsl.Body, "", "  ")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if got := string(data); got != expect {
+		t.Errorf("ParseFile gave:\n%s\nexpected:\n%s", got, expect)
+	}
+
+	tests := map[string]string{
+		`template mode m "x"`:                `test.lxt:1:10: expected xpath: IDENT("mode")`,
+		`template <x> mode "m" "x"`:          `test.lxt:1:19: expected identifier: DQ("m")`,
+		`template <x> mode a mode b "x"`:     `test.lxt:1:21: template mode already specified: IDENT("mode")`,
+		`template <x> priority 1 priority 2`: `test.lxt:1:25: template priority already specified: IDENT("priority")`,
+		`template <x> priority high "x"`:     `test.lxt:1:23: expected a number: IDENT("high")`,
+		`template <x> priority "high" "x"`:   `test.lxt:1:23: bad priority value: DQ("high"): strconv.ParseFloat: parsing "high": invalid syntax`,
+	}
+
+	for input, expect := range tests {
+		_, err := Parse(context.Background(), strings.NewReader(input), "test.lxt")
+		if err == nil || err.Error() != expect {
+			t.Errorf("Parse(%q) gave error: %v\nexpected: %s", input, err, expect)
+		}
+	}
+}
+
+func TestCheckModes(t *testing.T) {
+	input := `template <item> mode brief <name>
+template </> {
+	apply-templates <item> mode brief
+	apply-templates <item> mode full
+	foreach <x> { apply-templates mode full }
+	apply-templates <item>
+}
+`
+
+	file, err := Parse(context.Background(), strings.NewReader(input), "test.lxt")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	expect := []string{
+		`test.lxt:4:30: apply-templates mode "full" has no matching template`,
+	}
+
+	if got := messages(Check(file)); fmt.Sprint(got) != fmt.Sprint(expect) {
+		t.Errorf("Check gave %q, expected %q", got, expect)
+	}
+}
+
+func TestParseNamespaces(t *testing.T) {
+	input := `stylesheet ( exclude-result-prefixes => "my #default", extension-element-prefixes => "msxsl" )
+namespace my => "urn:my"
+namespace my => "urn:my"
+namespace "urn:default"
+namespace unused => "urn:unused"
+
+template </> {
+	tag xs:foo ;
+	<{ msxsl:node-set(.) }>
+}
+`
+
+	expect := `<xsl:stylesheet version="1.0" exclude-result-prefixes="my #default unused" extension-element-prefixes="msxsl" xmlns="urn:default" xmlns:msxsl="urn:schemas-microsoft-com:xslt" xmlns:my="urn:my" xmlns:unused="urn:unused" xmlns:xs="http://www.w3.org/2001/XMLSchema" xmlns:xsl="http://www.w3.org/1999/XSL/Transform">`
+
+	xsl := xslt.NewStylesheet()
+	xsl.Output = nil
+	if err := ParseFile(context.Background(), strings.NewReader(input), "test.lxt", xsl); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	data, err := xml.Marshal(xsl)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if got, _, _ := strings.Cut(string(data), "\n"); !strings.HasPrefix(got, expect) {
+		t.Errorf("ParseFile gave:\n%s\nexpected:\n%s", got, expect)
+	}
+
+	errTests := map[string]string{
+		"namespace my => \"urn:my\"\nnamespace my => \"urn:other\"":                  `test.lxt:2:1: namespace prefix "my" is already declared as "urn:my"`,
+		`namespace xml => "urn:x"`:                                                   `test.lxt:1:11: reserved namespace prefix: "xml"`,
+		`namespace xmlns => "urn:x"`:                                                 `test.lxt:1:11: reserved namespace prefix: "xmlns"`,
+		`stylesheet ( indent => "yes" )`:                                             `test.lxt:1:14: unknown stylesheet attribute: "indent"`,
+		`stylesheet ( exclude-result-prefixes => "nope" )`:                           `test.lxt:1:41: exclude-result-prefixes lists the undeclared namespace prefix "nope"`,
+		`stylesheet ( extension-element-prefixes => "#default" )`:                    `test.lxt:1:44: extension-element-prefixes lists #default, but no default namespace is declared`,
+		"stylesheet ( exclude-result-prefixes => \"my\" )\nnamespace h => \"urn:h\"": `test.lxt:1:41: exclude-result-prefixes lists the undeclared namespace prefix "my"`,
+	}
+
+	for input, expect := range errTests {
+		xsl := xslt.NewStylesheet()
+
+		err := ParseFile(context.Background(), strings.NewReader(input), "test.lxt", xsl)
+		if err == nil || err.Error() != expect {
+			t.Errorf("ParseFile(%q) gave error: %v\nexpected: %s", input, err, expect)
+		}
+	}
+}
+
+func TestParseStylesheetWithoutAttributes(t *testing.T) {
+	input := "stylesheet ;\ntemplate </> \"x\"\n"
+
+	_, err := Parse(context.Background(), strings.NewReader(input), "test.lxt")
+
+	expect := `test.lxt:1:12: expected a map of stylesheet attributes: OP(";")`
+	if err == nil || err.Error() != expect {
+		t.Errorf("Parse gave error: %v\nexpected: %s", err, expect)
+	}
+}
+
+func TestParseStylesheetVersion(t *testing.T) {
+	input := `stylesheet ( version => "2.0" )
+template </> group <item> by <@cat> <{ current-grouping-key() }>
+`
+
+	xsl := xslt.NewStylesheet()
+	xsl.SetAttr("version", "2.0")
+	if err := ParseFile(context.Background(), strings.NewReader(input), "test.lxt", xsl); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if got := xsl.Version(); got != xslt.XSLT20 {
+		t.Errorf("stylesheet version was %s, expected %s", got, xslt.XSLT20)
+	}
+
+	tests := []struct {
+		target, version string
+		expect          string
+	}{
+		{"1.0", "2.0", `test.lxt:1:25: stylesheet version "2.0" differs from the target, XSLT 1.0`},
+		{"2.0", "1.0", `test.lxt:1:25: stylesheet version "1.0" differs from the target, XSLT 2.0`},
+		{"3.0", "2.0", `test.lxt:1:25: stylesheet version "2.0" differs from the target, XSLT 3.0`},
+	}
+
+	for _, tt := range tests {
+		xsl := xslt.NewStylesheet()
+		xsl.SetAttr("version", tt.target)
+
+		input := fmt.Sprintf("stylesheet ( version => %q )\ntemplate </> group <item> by <@cat> <.>\n", tt.version)
+
+		err := ParseFile(context.Background(), strings.NewReader(input), "test.lxt", xsl)
+		if err == nil || err.Error() != tt.expect {
+			t.Errorf("target %s: ParseFile gave error: %v\nexpected: %s", tt.target, err, tt.expect)
+		}
+
+		// Only XSLT 1.0 lowers the group into Muenchian grouping, with a key.
+		if muenchian := len(xsl.Keys) > 0; muenchian != (tt.target == "1.0") {
+			t.Errorf("target %s: group was lowered for the stylesheet version, rather than the target", tt.target)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package parser
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/puellanivis/lxt/ast"
+	"github.com/puellanivis/lxt/tokenizer"
+	"github.com/puellanivis/lxt/xpath"
+	"github.com/puellanivis/lxt/xslt"
+)
+
+// interpolated returns the current back-quoted string token as an *ast.Interpolated.
+// Each `{xpath}` within the string is validated as an expression, while `{{` and `}}` are literal braces.
+func (r *Reader) interpolated(tok tokenizer.Token) (*ast.Interpolated, error) {
+	n := &ast.Interpolated{
+		ValuePos: r.pos,
+		EndPos:   r.last.End,
+	}
+
+	s := tok.Value
+
+	// Escape sequences are already replaced in the value, so positions after one are approximate.
+	at := func(i int) tokenizer.Position {
+		return tok.ValuePos.Advance([]byte(s[:i]))
+	}
+
+	var text strings.Builder
+	textStart := 0
+
+	flush := func(end int) {
+		if text.Len() > 0 {
+			n.Parts = append(n.Parts, &ast.String{
+				ValuePos: at(textStart),
+				Quote:    '`',
+				Value:    text.String(),
+				EndPos:   at(end),
+			})
+			text.Reset()
+		}
+	}
+
+	for i := 0; i < len(s); {
+		if text.Len() == 0 {
+			textStart = i
+		}
+
+		switch {
+		case strings.HasPrefix(s[i:], "{{"):
+			text.WriteByte('{')
+			i += 2
+
+		case strings.HasPrefix(s[i:], "}}"):
+			text.WriteByte('}')
+			i += 2
+
+		case s[i] == '{':
+			end := xslt.AVTExprEnd(s, i+1)
+			if end < 0 {
+				return nil, r.parseError("unterminated xpath in interpolated string")
+			}
+
+			flush(i)
+
+			raw := s[i+1 : end]
+			value := strings.TrimSpace(raw)
+			if value == "" {
+				return nil, r.parseError("empty xpath in interpolated string")
+			}
+
+			x := &ast.XPath{
+				ValuePos: at(i),
+				Value:    value,
+				EndPos:   at(end + 1),
+				ExprPos:  at(end - len(strings.TrimLeftFunc(raw, unicode.IsSpace))),
+			}
+			r.parseExpr(x, xpath.Parse)
+
+			n.Parts = append(n.Parts, x)
+			i = end + 1
+
+		case s[i] == '}':
+			return nil, r.parseError("unmatched '}' in interpolated string, literal braces are written as '{{' and '}}'")
+
+		default:
+			text.WriteByte(s[i])
+			i++
+		}
+	}
+
+	flush(len(s))
+
+	return n, nil
+}
@@ -0,0 +1,72 @@
+package parser
+
+import (
+	"context"
+
+	"github.com/puellanivis/lxt/ast"
+	"github.com/puellanivis/lxt/tokenizer"
+)
+
+// parseNamespace parses a namespace declaration: `namespace prefix => "uri"`, or `namespace "uri"`.
+// The current token is expected to be the `namespace` keyword.
+func (r *Reader) parseNamespace(ctx context.Context) (*ast.Namespace, error) {
+	ns := &ast.Namespace{
+		Keyword: r.pos,
+	}
+
+	tok, err := r.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if tok.Type == tokenizer.TokenTypeIdentifier {
+		ns.Prefix = r.ident(tok)
+
+		if err := r.nextMustBe(ctx, tokenizer.OperatorArrow); err != nil {
+			return nil, err
+		}
+		ns.Arrow = r.pos
+
+		tok, err = r.peak(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch tok.Type {
+	case tokenizer.TokenTypeDoubleQuote, tokenizer.TokenTypeSingleQuote:
+	default:
+		return nil, r.parseError("expected a namespace uri string")
+	}
+
+	if tok.Value == "" && ns.Prefix != nil {
+		return nil, r.parseError("namespace uri cannot be empty")
+	}
+
+	ns.URI = r.str(tok)
+	r.consume()
+
+	return ns, nil
+}
+
+// parseStylesheet parses the stylesheet directive: `stylesheet ( key => value, … )`.
+// The current token is expected to be the `stylesheet` keyword.
+func (r *Reader) parseStylesheet(ctx context.Context) (*ast.Stylesheet, error) {
+	decl := &ast.Stylesheet{
+		Keyword: r.pos,
+	}
+	r.consume()
+
+	m, err := r.parseMap(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if m == nil {
+		// Unlike output, there are no default stylesheet attributes to declare.
+		return nil, r.parseError("expected a map of stylesheet attributes")
+	}
+
+	decl.Attributes = m
+	return decl, nil
+}
@@ -0,0 +1,126 @@
+package parser
+
+import (
+	"context"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/puellanivis/breton/lib/files"
+
+	"github.com/puellanivis/lxt/ast"
+)
+
+// Uses tracks the LXT modules inlined through `use` directives while parsing the files of a single compilation.
+// Sharing one Uses between all of the files ensures that a module used by more than one of them is only inlined once.
+type Uses struct {
+	// stack is the chain of files currently being parsed, used to detect cycles.
+	stack []string
+
+	// done is the set of files that have already been inlined.
+	done map[string]bool
+}
+
+// NewUses returns a Uses for a new compilation, in which no modules have been inlined yet.
+func NewUses() *Uses {
+	return &Uses{
+		done: make(map[string]bool),
+	}
+}
+
+func (u *Uses) cycle(filename string) []string {
+	for i, name := range u.stack {
+		if name == filename {
+			return append(u.stack[i:len(u.stack):len(u.stack)], filename)
+		}
+	}
+
+	return nil
+}
+
+// cleanFilename returns the filename in the same form as resolveUse, so that a file is identified by a single name.
+func cleanFilename(name string) string {
+	switch name {
+	case "", "-", "/dev/stdin":
+		return name
+	}
+
+	if uri, err := url.Parse(name); err == nil && uri.IsAbs() {
+		return name
+	}
+
+	return filepath.Clean(name)
+}
+
+// resolveUse resolves the filename of a used module relative to the file containing the `use` directive.
+func resolveUse(from, name string) string {
+	if filepath.IsAbs(name) {
+		return filepath.Clean(name)
+	}
+
+	if uri, err := url.Parse(name); err == nil && uri.IsAbs() {
+		return name
+	}
+
+	switch from {
+	case "", "-", "/dev/stdin":
+		return filepath.Clean(name)
+	}
+
+	if base, err := url.Parse(from); err == nil && base.IsAbs() {
+		ref, err := url.Parse(name)
+		if err != nil {
+			return name
+		}
+
+		return base.ResolveReference(ref).String()
+	}
+
+	return filepath.Join(filepath.Dir(from), name)
+}
+
+func (r *Reader) parseUse(ctx context.Context) (*ast.Use, error) {
+	use := &ast.Use{
+		Keyword: r.pos,
+	}
+
+	href, err := r.parseHref(ctx)
+	if err != nil {
+		return nil, err
+	}
+	use.Href = href
+
+	if r.uses == nil {
+		// The source is being parsed on its own, without the modules it uses.
+		return use, nil
+	}
+
+	filename := resolveUse(r.filename, href.Value)
+
+	if cycle := r.uses.cycle(filename); cycle != nil {
+		return nil, r.parseErrorf("use cycle detected: %s", strings.Join(cycle, " -> "))
+	}
+
+	if r.uses.done[filename] {
+		return use, nil
+	}
+	r.uses.done[filename] = true
+
+	in, err := files.Open(ctx, filename)
+	if err != nil {
+		return nil, r.parseError("use", err)
+	}
+	defer in.Close()
+
+	sub := newReader(filename, in, r.target, r.uses, r.errs)
+
+	r.uses.stack = append(r.uses.stack, filename)
+	defer func() {
+		r.uses.stack = r.uses.stack[:len(r.uses.stack)-1]
+	}()
+
+	// Any errors in the used module are added directly to the shared error list.
+	use.File = sub.parse(ctx)
+
+	return use, nil
+}
@@ -0,0 +1,123 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/puellanivis/lxt/ast"
+	"github.com/puellanivis/lxt/xslt"
+)
+
+func TestResolveUse(t *testing.T) {
+	tests := []struct {
+		from, name string
+		expect     string
+	}{
+		{"main.lxt", "common.lxt", "common.lxt"},
+		{"lib/main.lxt", "common.lxt", "lib/common.lxt"},
+		{"lib/main.lxt", "../common.lxt", "common.lxt"},
+		{"/src/lib/main.lxt", "./sub/common.lxt", "/src/lib/sub/common.lxt"},
+		{"lib/main.lxt", "/abs/common.lxt", "/abs/common.lxt"},
+		{"-", "lib/common.lxt", "lib/common.lxt"},
+		{"https://example.com/lib/main.lxt", "common.lxt", "https://example.com/lib/common.lxt"},
+		{"lib/main.lxt", "https://example.com/common.lxt", "https://example.com/common.lxt"},
+	}
+
+	for _, tt := range tests {
+		if got := resolveUse(tt.from, tt.name); got != tt.expect {
+			t.Errorf("resolveUse(%q, %q) = %q, expected %q", tt.from, tt.name, got, tt.expect)
+		}
+	}
+}
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	for name, text := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0o644); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	return dir
+}
+
+func TestParseUsesShared(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a.lxt":      "use \"common.lxt\"\nsub a { call c }\n",
+		"b.lxt":      "use 'common.lxt'\nsub b { call c }\n",
+		"common.lxt": "sub c { \"c\" }\n",
+	})
+
+	// The last file names common.lxt in a different form, so that it must be cleaned to be recognized.
+	filenames := []string{
+		filepath.Join(dir, "a.lxt"),
+		filepath.Join(dir, "b.lxt"),
+		dir + "/./common.lxt",
+	}
+
+	uses := NewUses()
+	var inlined int
+
+	for i, filename := range filenames {
+		file, err := ParseUses(context.Background(), strings.NewReader(readFile(t, filename)), filename, xslt.XSLT10, uses)
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		ast.InspectFile(file, func(node ast.Node) bool {
+			if n, ok := node.(*ast.Use); ok && n.File != nil {
+				inlined++
+			}
+			return true
+		})
+
+		if i == len(filenames)-1 && len(file.Statements) != 0 {
+			t.Errorf("%s was already used, but was parsed again: %v", filename, file.Statements)
+		}
+	}
+
+	if inlined != 1 {
+		t.Errorf("common.lxt was inlined %d times, expected once", inlined)
+	}
+}
+
+func TestParseUsesCycle(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.lxt": "use \"main.lxt\"\nsub m { \"m\" }\n",
+	})
+
+	filename := dir + "/./main.lxt"
+
+	_, err := Parse(context.Background(), strings.NewReader(readFile(t, filename)), filename)
+
+	var errs ErrorList
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected an ErrorList, got %T: %v", err, err)
+	}
+
+	main := filepath.Join(dir, "main.lxt")
+	expect := fmt.Sprintf("%s:1:5: use cycle detected: %s -> %s: DQ(\"main.lxt\")", filename, main, main)
+
+	if len(errs) != 1 || errs[0].Error() != expect {
+		t.Errorf("Parse gave errors: %v\nexpected: %s", errs, expect)
+	}
+}
+
+func readFile(t *testing.T, filename string) string {
+	t.Helper()
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	return string(data)
+}
@@ -3,11 +3,20 @@ package parser
 import (
 	"context"
 
+	"github.com/puellanivis/lxt/ast"
 	"github.com/puellanivis/lxt/tokenizer"
 	"github.com/puellanivis/lxt/xslt"
 )
 
-func (r *Reader) parseParamList(ctx context.Context) ([]*xslt.Param, error) {
+func (r *Reader) parseParamList(ctx context.Context) (*ast.VariableList, error) {
+	return r.parseVariableList(ctx, ast.VarKindParam)
+}
+
+func (r *Reader) parseArgumentList(ctx context.Context) (*ast.VariableList, error) {
+	return r.parseVariableList(ctx, ast.VarKindArgument)
+}
+
+func (r *Reader) parseVariableList(ctx context.Context, kind ast.VarKind) (*ast.VariableList, error) {
 	tok, err := r.peak(ctx)
 	if err != nil {
 		return nil, err
@@ -16,14 +25,17 @@ func (r *Reader) parseParamList(ctx context.Context) ([]*xslt.Param, error) {
 	var end tokenizer.Token
 	switch tok.Type {
 	case tokenizer.TokenTypeBeginGroup:
-		r.consume()
 		end = endTokenFromStart(tok)
 
 	default:
 		return nil, r.parseError("expected start of grouping")
 	}
 
-	var params []*xslt.Param
+	list := &ast.VariableList{
+		Open:  r.pos,
+		Delim: tok.Value,
+	}
+	r.consume()
 
 	for {
 		tok, err := r.peakSkipComma(ctx)
@@ -32,80 +44,52 @@ func (r *Reader) parseParamList(ctx context.Context) ([]*xslt.Param, error) {
 		}
 
 		if tok.Type == tokenizer.TokenTypeEndGroup {
-			if tok != end {
-				return nil, r.parseErrorf("unexpected end param list token, was expecting: %s", end)
+			if !tok.Is(end) {
+				return nil, r.parseErrorf("unexpected end %s list token, was expecting: %s", kind, end)
 			}
 
+			list.Close = r.pos
 			r.consume()
-			return params, nil
+			return list, nil
 		}
 
-		param, err := r.parseParam(ctx, tokenizer.OperatorArrow)
+		v, err := r.parseVariable(ctx, tokenizer.OperatorArrow, kind)
 		if err != nil {
 			return nil, err
 		}
 
-		params = append(params, param)
+		list.List = append(list.List, v)
 	}
 }
 
-func (r *Reader) parseArgumentList(ctx context.Context) ([]*xslt.WithParam, error) {
-	tok, err := r.peak(ctx)
-	if err != nil {
-		return nil, err
+func (r *Reader) parseVariable(ctx context.Context, assignOp tokenizer.Token, kind ast.VarKind) (*ast.Variable, error) {
+	v := &ast.Variable{
+		Kind: kind,
+		Op:   assignOp.Value,
 	}
 
-	var end tokenizer.Token
-	switch tok.Type {
-	case tokenizer.TokenTypeBeginGroup:
-		r.consume()
-		end = endTokenFromStart(tok)
-
-	default:
-		return nil, r.parseError("expected group")
+	ident, err := r.peak(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	var args []*xslt.WithParam
-
-	for {
-		tok, err := r.peakSkipComma(ctx)
-
-		if tok.Type == tokenizer.TokenTypeEndGroup {
-			if tok != end {
-				return nil, r.parseErrorf("unexpected end argument list token, was expecting: %s", end)
-			}
-
-			r.consume()
-			return args, nil
-		}
+	// Only parameters and arguments in a list may be tunnelled, and these are assigned with an arrow.
+	if ident.Type == tokenizer.TokenTypeIdentifier && ident.Value == "tunnel" && assignOp.Is(tokenizer.OperatorArrow) {
+		keyword := r.ident(ident)
 
+		ident, err = r.read(ctx)
 		if err != nil {
 			return nil, err
 		}
 
-		arg, err := r.parseArgument(ctx, tokenizer.OperatorArrow)
-		if err != nil {
-			return nil, err
+		if ident.Is(assignOp) {
+			// This is not the keyword, but the name of the variable.
+			v.Name = keyword
+			return r.parseVariableValue(ctx, v)
 		}
 
-		args = append(args, arg)
-	}
-}
-
-func (r *Reader) parseArgument(ctx context.Context, assignOp tokenizer.Token) (*xslt.WithParam, error) {
-	v, err := r.parseVariable(ctx, assignOp)
-	return (*xslt.WithParam)(v), err
-}
-
-func (r *Reader) parseParam(ctx context.Context, assignOp tokenizer.Token) (*xslt.Param, error) {
-	v, err := r.parseVariable(ctx, assignOp)
-	return (*xslt.Param)(v), err
-}
-
-func (r *Reader) parseVariable(ctx context.Context, assignOp tokenizer.Token) (*xslt.Variable, error) {
-	ident, err := r.peak(ctx)
-	if err != nil {
-		return nil, err
+		r.require(xslt.XSLT20, "tunnel parameters", keyword)
+		v.Tunnel = keyword.NamePos
 	}
 
 	name := ident.Value
@@ -120,39 +104,44 @@ func (r *Reader) parseVariable(ctx context.Context, assignOp tokenizer.Token) (*
 		return nil, r.parseError("variable name cannot be empty")
 	}
 
-	if err := r.nextMustBe(ctx, assignOp); err != nil {
-		return nil, err
+	v.Name = &ast.Ident{
+		NamePos: r.pos,
+		Name:    name,
+		EndPos:  r.last.End,
 	}
+	r.checkName(v.Name)
 
-	val, err := r.read(ctx)
+	tok, err := r.read(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	switch val.Type {
-	case tokenizer.TokenTypeXPath, tokenizer.TokenTypeNumber:
-		r.consume()
-		return &xslt.Variable{
-			Name:   name,
-			Select: val.Value,
-		}, nil
-
-	case tokenizer.TokenTypeDoubleQuote, tokenizer.TokenTypeSingleQuote:
-		if val.Value == "" {
-			r.consume()
-			return &xslt.Variable{
-				Name: name,
-			}, nil
+	if tok.Type == tokenizer.TokenTypeIdentifier && tok.Value == "as" {
+		v.As, err = r.parseAs(ctx)
+		if err != nil {
+			return nil, err
 		}
+
+		r.require(xslt.XSLT20, "type annotations", v.As)
 	}
 
-	value, err := r.parseExpression(ctx)
+	if err := r.mustBe(ctx, assignOp); err != nil {
+		return nil, err
+	}
+
+	return r.parseVariableValue(ctx, v)
+}
+
+// parseVariableValue parses the value of a variable, where the assignment operator is expected to be the current token.
+func (r *Reader) parseVariableValue(ctx context.Context, v *ast.Variable) (*ast.Variable, error) {
+	v.Assign = r.pos
+	r.consume()
+
+	var err error
+	v.Value, err = r.parseExpression(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	return &xslt.Variable{
-		Name:  name,
-		Value: value,
-	}, nil
+	return v, nil
 }
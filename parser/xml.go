@@ -3,37 +3,60 @@ package parser
 import (
 	"context"
 
+	"github.com/puellanivis/lxt/ast"
 	"github.com/puellanivis/lxt/tokenizer"
-	"github.com/puellanivis/lxt/xslt"
 )
 
-func (r *Reader) parseTag(ctx context.Context) (*xslt.Element, error) {
+func (r *Reader) parseTag(ctx context.Context) (*ast.Tag, error) {
+	tag := &ast.Tag{
+		Keyword: r.pos,
+	}
+
 	name, err := r.read(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	if name.Type != tokenizer.TokenTypeIdentifier {
-		return nil, r.parseError("expected identifier")
+	switch name.Type {
+	case tokenizer.TokenTypeIdentifier:
+		if name.Value == "" {
+			return nil, r.parseError("tag cannot have empty name")
+		}
+
+		tag.Name = r.ident(name)
+
+	case tokenizer.TokenTypeXPath:
+		tag.Name = r.xpath(name)
+
+	default:
+		return nil, r.parseError("expected identifier or xpath")
 	}
-	r.consume()
 
-	if name.Value == "" {
-		return nil, r.parseError("tag cannot have empty name")
+	tok, err := r.read(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	body, err := r.parseExpression(ctx)
+	if tok.Type == tokenizer.TokenTypeIdentifier && tok.Value == "namespace" {
+		tag.Namespace, err = r.parseInNamespace(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tag.Body, err = r.parseExpression(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	return &xslt.Element{
-		Name: name.Value,
-		Body: body,
-	}, nil
+	return tag, nil
 }
 
-func (r *Reader) parseAttribs(ctx context.Context) ([]*xslt.Attribute, error) {
+func (r *Reader) parseAttribs(ctx context.Context) (*ast.Attribs, error) {
+	attribs := &ast.Attribs{
+		Keyword: r.pos,
+	}
+
 	tok, err := r.read(ctx)
 	if err != nil {
 		return nil, err
@@ -42,19 +65,20 @@ func (r *Reader) parseAttribs(ctx context.Context) ([]*xslt.Attribute, error) {
 	if tok.Type != tokenizer.TokenTypeBeginGroup || tok.Value != "(" {
 		return nil, r.parseError("unexpected token: expected '('")
 	}
+	attribs.Open = r.pos
+	attribs.Delim = tok.Value
 	r.consume()
 	end := endTokenFromStart(tok)
 
-	var attribs []*xslt.Attribute
-
 	for {
 		tok, err := r.peakSkipComma(ctx)
 
 		if tok.Type == tokenizer.TokenTypeEndGroup {
-			if tok != end {
+			if !tok.Is(end) {
 				return nil, r.parseErrorf("unexpected end argument list token, was expecting: %s", end)
 			}
 
+			attribs.Close = r.pos
 			r.consume()
 			return attribs, nil
 		}
@@ -63,26 +87,69 @@ func (r *Reader) parseAttribs(ctx context.Context) ([]*xslt.Attribute, error) {
 			return nil, err
 		}
 
+		attrib := new(ast.Attrib)
+
 		switch tok.Type {
-		case tokenizer.TokenTypeIdentifier:
-		case tokenizer.TokenTypeDoubleQuote, tokenizer.TokenTypeSingleQuote:
+		case tokenizer.TokenTypeIdentifier, tokenizer.TokenTypeDoubleQuote, tokenizer.TokenTypeSingleQuote:
+			attrib.Name = r.literal(tok)
+		case tokenizer.TokenTypeXPath:
+			attrib.Name = r.xpath(tok)
 		default:
 			return nil, r.parseError("expected identifier")
 		}
 
-		r.consume()
+		tok, err = r.read(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if tok.Type == tokenizer.TokenTypeIdentifier && tok.Value == "namespace" {
+			attrib.Namespace, err = r.parseInNamespace(ctx)
+			if err != nil {
+				return nil, err
+			}
+		}
+
 		if err := r.mustBe(ctx, tokenizer.OperatorArrow); err != nil {
 			return nil, err
 		}
+		attrib.Arrow = r.pos
 
-		val, err := r.parseExpression(ctx)
+		attrib.Value, err = r.parseExpression(ctx)
 		if err != nil {
 			return nil, err
 		}
 
-		attribs = append(attribs, &xslt.Attribute{
-			Name:  tok.Value,
-			Value: val,
-		})
+		attribs.List = append(attribs.List, attrib)
+	}
+}
+
+// parseInNamespace parses the namespace option of a tag or attribute, where the keyword is the current token.
+// It leaves the token following the option as the current token.
+func (r *Reader) parseInNamespace(ctx context.Context) (*ast.InNamespace, error) {
+	ns := &ast.InNamespace{
+		Keyword: r.pos,
+	}
+
+	uri, err := r.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	switch uri.Type {
+	case tokenizer.TokenTypeXPath:
+		ns.URI = r.xpath(uri)
+
+	case tokenizer.TokenTypeDoubleQuote, tokenizer.TokenTypeSingleQuote:
+		ns.URI = r.str(uri)
+
+	default:
+		return nil, r.parseError("expected a namespace string or xpath")
 	}
+
+	if _, err := r.read(ctx); err != nil {
+		return nil, err
+	}
+
+	return ns, nil
 }
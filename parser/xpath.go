@@ -0,0 +1,76 @@
+package parser
+
+import (
+	"errors"
+
+	"github.com/puellanivis/lxt/ast"
+	"github.com/puellanivis/lxt/tokenizer"
+	"github.com/puellanivis/lxt/xpath"
+	"github.com/puellanivis/lxt/xslt"
+)
+
+// xpath returns the current token as an *ast.XPath.
+// The XPath is validated as an expression, and any syntax error is added to the error list.
+func (r *Reader) xpath(tok tokenizer.Token) *ast.XPath {
+	return r.parseXPath(tok, xpath.Parse)
+}
+
+// pattern returns the current token as an *ast.XPath.
+// The XPath is validated as a pattern, and any syntax error is added to the error list.
+func (r *Reader) pattern(tok tokenizer.Token) *ast.XPath {
+	return r.parseXPath(tok, xpath.ParsePattern)
+}
+
+// keyUse returns the current token as an *ast.XPath.
+// The XPath is validated as the use expression of a key, and any syntax error is added to the error list.
+func (r *Reader) keyUse(tok tokenizer.Token) *ast.XPath {
+	return r.parseXPath(tok, xpath.ParseKeyUse)
+}
+
+func (r *Reader) parseXPath(tok tokenizer.Token, parse func(string) (xpath.Expr, error)) *ast.XPath {
+	x := &ast.XPath{
+		ValuePos: r.pos,
+		Value:    tok.Value,
+		EndPos:   r.last.End,
+		ExprPos:  tok.ValuePos,
+	}
+
+	r.parseExpr(x, parse)
+	return x
+}
+
+// parseExpr parses the value of the XPath into its Expr, and any syntax error is added to the error list.
+func (r *Reader) parseExpr(x *ast.XPath, parse func(string) (xpath.Expr, error)) {
+	expr, err := parse(x.Value)
+	if err != nil {
+		if r.target > xslt.XSLT10 {
+			// Only XPath 1.0 can be validated, so this may be valid XPath 2.0 syntax.
+			return
+		}
+
+		// The syntax error does not affect the structure of the LXT source, so parsing may continue.
+		r.errs.Add(xpathError(x, err))
+		return
+	}
+
+	x.Expr = expr
+}
+
+// xpathError converts an error from the xpath package into a positioned error.
+func xpathError(x *ast.XPath, err error) error {
+	var xerr *xpath.Error
+	if !errors.As(err, &xerr) {
+		return &tokenizer.Error{
+			Pos: x.Pos(),
+			End: x.End(),
+			Msg: "invalid xpath",
+			Err: err,
+		}
+	}
+
+	return &tokenizer.Error{
+		Pos: x.Offset(xerr.Offset),
+		End: x.Offset(len(x.Value)),
+		Msg: "invalid xpath: " + xerr.Msg,
+	}
+}
@@ -0,0 +1,239 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/puellanivis/lxt/ast"
+	"github.com/puellanivis/lxt/tokenizer"
+	"github.com/puellanivis/lxt/xslt"
+)
+
+// require adds an error for the construct beginning with the given keyword to the error list,
+// if the target version of XSLT is earlier than the given version.
+// The construct is otherwise well-formed, so parsing may continue.
+func (r *Reader) require(version xslt.Version, what string, keyword ast.Node) {
+	if r.target >= version {
+		return
+	}
+
+	r.errs.Add(&tokenizer.Error{
+		Pos: keyword.Pos(),
+		End: keyword.End(),
+		Msg: fmt.Sprintf("%s require XSLT %s or later, but the target is XSLT %s", what, version, r.target),
+	})
+}
+
+// parseAs parses a type annotation: `as xs:string`, or `as "xs:string*"`.
+// The current token is expected to be the `as` keyword.
+func (r *Reader) parseAs(ctx context.Context) (*ast.As, error) {
+	as := &ast.As{
+		Keyword: r.pos,
+	}
+
+	typ, err := r.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	switch typ.Type {
+	case tokenizer.TokenTypeIdentifier:
+	case tokenizer.TokenTypeDoubleQuote, tokenizer.TokenTypeSingleQuote:
+	default:
+		return nil, r.parseError("expected a type")
+	}
+
+	if typ.Value == "" {
+		return nil, r.parseError("type cannot be empty")
+	}
+
+	as.Type = r.literal(typ)
+	r.consume()
+
+	return as, nil
+}
+
+// parseSequence parses a sequence expression: `sequence <select>`.
+// The current token is expected to be the `sequence` keyword.
+func (r *Reader) parseSequence(ctx context.Context) (*ast.Sequence, error) {
+	r.require(xslt.XSLT20, "sequence expressions", r.ident(r.tok))
+
+	seq := &ast.Sequence{
+		Keyword: r.pos,
+	}
+
+	sel, err := r.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if sel.Type != tokenizer.TokenTypeXPath {
+		return nil, r.parseError("expected xpath")
+	}
+
+	seq.Select = r.xpath(sel)
+	r.consume()
+
+	return seq, nil
+}
+
+// parseAnalyzeString parses a regular expression match:
+// `analyze-string <select> "regex" flags "i" matching body non-matching body`.
+// The flags are optional, and either of the branches may be left out, but not both.
+// The current token is expected to be the `analyze-string` keyword.
+func (r *Reader) parseAnalyzeString(ctx context.Context) (*ast.AnalyzeString, error) {
+	r.require(xslt.XSLT20, "analyze-string expressions", r.ident(r.tok))
+
+	analyze := &ast.AnalyzeString{
+		Keyword: r.pos,
+	}
+
+	sel, err := r.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if sel.Type != tokenizer.TokenTypeXPath {
+		return nil, r.parseError("expected xpath")
+	}
+	analyze.Select = r.xpath(sel)
+
+	regex, err := r.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	switch regex.Type {
+	case tokenizer.TokenTypeDoubleQuote, tokenizer.TokenTypeSingleQuote:
+	default:
+		return nil, r.parseError("expected a regular expression string")
+	}
+
+	if regex.Value == "" {
+		return nil, r.parseError("regular expression cannot be empty")
+	}
+
+	analyze.Regex = r.str(regex)
+
+	tok, err := r.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if tok.Type == tokenizer.TokenTypeIdentifier && tok.Value == "flags" {
+		flags := &ast.Flags{
+			Keyword: r.pos,
+		}
+
+		val, err := r.read(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		switch val.Type {
+		case tokenizer.TokenTypeDoubleQuote, tokenizer.TokenTypeSingleQuote:
+		default:
+			return nil, r.parseError("expected a string")
+		}
+
+		flags.Value = r.str(val)
+		analyze.Flags = flags
+
+		tok, err = r.read(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if tok.Type == tokenizer.TokenTypeIdentifier && tok.Value == "matching" {
+		analyze.Matching, err = r.parseSubstring(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		tok, err = r.peak(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if tok.Type == tokenizer.TokenTypeIdentifier && tok.Value == "non-matching" {
+		analyze.NonMatching, err = r.parseSubstring(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if analyze.Matching == nil && analyze.NonMatching == nil {
+		return nil, r.parseError("expected a matching or non-matching branch")
+	}
+
+	return analyze, nil
+}
+
+// parseSubstring parses a branch of an analyze-string: `matching body` or `non-matching body`.
+// The current token is expected to be the keyword of the branch.
+func (r *Reader) parseSubstring(ctx context.Context) (*ast.Substring, error) {
+	sub := &ast.Substring{
+		Keyword: r.pos,
+	}
+	r.consume()
+
+	var err error
+	sub.Body, err = r.parseExpression(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return sub, nil
+}
+
+// parseResultDocument parses a secondary result document: `result-document "href" output ( key => value, … ) body`.
+// The href may also be an XPath, and the output option may be left out.
+// The current token is expected to be the `result-document` keyword.
+func (r *Reader) parseResultDocument(ctx context.Context) (*ast.ResultDocument, error) {
+	r.require(xslt.XSLT20, "result-document expressions", r.ident(r.tok))
+
+	doc := &ast.ResultDocument{
+		Keyword: r.pos,
+	}
+
+	href, err := r.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	switch href.Type {
+	case tokenizer.TokenTypeXPath:
+		doc.Href = r.xpath(href)
+
+	case tokenizer.TokenTypeDoubleQuote, tokenizer.TokenTypeSingleQuote:
+		doc.Href = r.str(href)
+
+	default:
+		return nil, r.parseError("expected an href string or xpath")
+	}
+
+	tok, err := r.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if tok.Type == tokenizer.TokenTypeIdentifier && tok.Value == "output" {
+		doc.Output, err = r.parseOutput(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if doc.Output.Attributes == nil {
+			return nil, r.parseError("expected start of grouping")
+		}
+	}
+
+	doc.Body, err = r.parseExpression(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
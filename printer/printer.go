@@ -0,0 +1,944 @@
+// Package printer implements the printing of LXT syntax trees as LXT source in a canonical style.
+package printer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/puellanivis/lxt/ast"
+	"github.com/puellanivis/lxt/tokenizer"
+)
+
+// maxFlatWidth is the longest that a block may be, in order to be printed on a single line.
+const maxFlatWidth = 72
+
+type printer struct {
+	buf    bytes.Buffer
+	indent int
+
+	// comments are the plain comments of the file that have not yet been printed, in source order.
+	comments []*ast.PlainComment
+}
+
+// Fprint writes the given file as LXT source to the io.Writer.
+func Fprint(w io.Writer, file *ast.File) error {
+	p := new(printer)
+	p.file(file)
+
+	_, err := w.Write(p.buf.Bytes())
+	return err
+}
+
+// Source returns the given file as LXT source.
+func Source(file *ast.File) []byte {
+	p := new(printer)
+	p.file(file)
+
+	return p.buf.Bytes()
+}
+
+func (p *printer) print(args ...string) {
+	for _, arg := range args {
+		p.buf.WriteString(arg)
+	}
+}
+
+func (p *printer) newline() {
+	p.buf.WriteByte('\n')
+	for i := 0; i < p.indent; i++ {
+		p.buf.WriteByte('\t')
+	}
+}
+
+// render returns what the given function prints, without adding it to the output.
+func (p *printer) render(fn func(p *printer)) string {
+	sub := &printer{
+		indent: p.indent,
+	}
+	fn(sub)
+
+	return sub.buf.String()
+}
+
+// commentBefore removes and returns the next pending comment, if it starts before the given position.
+// If the position is not valid, then any pending comment is returned.
+func (p *printer) commentBefore(pos ast.Pos) *ast.PlainComment {
+	if len(p.comments) == 0 {
+		return nil
+	}
+
+	c := p.comments[0]
+	if pos.IsValid() && !c.Pos().Before(pos) {
+		return nil
+	}
+
+	p.comments = p.comments[1:]
+	return c
+}
+
+// hasCommentBefore reports whether any pending comment starts before the given position.
+func (p *printer) hasCommentBefore(pos ast.Pos) bool {
+	return len(p.comments) > 0 && p.comments[0].Pos().Before(pos)
+}
+
+// trailingComments prints the pending comments that start within, or on the same line as the end of,
+// the expression ending at the given position, but before the next position, if it is valid.
+// It must only be called where a newline follows.
+func (p *printer) trailingComments(end, next ast.Pos) {
+	for len(p.comments) > 0 {
+		c := p.comments[0]
+		if !c.Pos().Before(end) && (c.Pos().Line != end.Line || next.IsValid() && !c.Pos().Before(next)) {
+			return
+		}
+
+		p.comments = p.comments[1:]
+		p.print(" ", c.Text)
+	}
+}
+
+// inlineComments prints the pending block comments that start before the given position, each preceded by a space,
+// so that they are kept next to the part of a construct that they followed, such as a key of a sort-by.
+// A line comment cannot be followed by anything on the same line, so it is left pending,
+// to be printed after the opening brace of the body that follows.
+func (p *printer) inlineComments(pos ast.Pos) {
+	for len(p.comments) > 0 {
+		c := p.comments[0]
+		if !c.Pos().Before(pos) || !strings.HasPrefix(c.Text, "/*") {
+			return
+		}
+
+		p.comments = p.comments[1:]
+		p.print(" ", c.Text)
+	}
+}
+
+func (p *printer) file(file *ast.File) {
+	p.comments = file.Comments
+
+	// last is the last statement or comment printed.
+	var last ast.Node
+
+	line := func(next ast.Node, blank bool) {
+		if last != nil {
+			p.newline()
+			if blank {
+				p.newline()
+			}
+		}
+
+		last = next
+	}
+
+	var prev ast.Node
+	for i, stmt := range file.Statements {
+		// Comments preceding a statement are kept with it,
+		// so any blank line before the statement is placed before its comments instead.
+		for c := p.commentBefore(stmt.Pos()); c != nil; c = p.commentBefore(stmt.Pos()) {
+			blank := blankInSource(last, c)
+			if last == prev && prev != nil {
+				blank = blank || blankBetween(prev, stmt)
+			}
+
+			line(c, blank)
+			p.print(c.Text)
+		}
+
+		blank := blankInSource(last, stmt)
+		if last == prev && prev != nil {
+			blank = blankBetween(prev, stmt)
+		}
+
+		line(stmt, blank)
+		p.statement(stmt)
+		p.trailingComments(stmt.End(), nextPos(file.Statements, i))
+
+		prev = stmt
+	}
+
+	for c := p.commentBefore(ast.Pos{}); c != nil; c = p.commentBefore(ast.Pos{}) {
+		line(c, blankInSource(last, c))
+		p.print(c.Text)
+	}
+
+	if last != nil {
+		p.newline()
+	}
+}
+
+// nextPos returns the position of the node following the i-th node in the list, if there is one.
+func nextPos(list []ast.Node, i int) ast.Pos {
+	if i+1 < len(list) {
+		return list[i+1].Pos()
+	}
+
+	return ast.Pos{}
+}
+
+// blankBetween reports whether a blank line should separate the two top-level statements.
+// Declarations of the same small kind are grouped together, unless they were separated in the source,
+// and doc comments are kept with the statement following them.
+func blankBetween(prev, next ast.Node) bool {
+	if _, ok := prev.(*ast.Comment); ok {
+		return false
+	}
+
+	if blankInSource(prev, next) {
+		return true
+	}
+
+	switch prev.(type) {
+	case *ast.Namespace, *ast.Import, *ast.Include, *ast.Use, *ast.Key, *ast.Variable:
+		return fmt.Sprintf("%T", prev) != fmt.Sprintf("%T", next)
+	}
+
+	return true
+}
+
+// blankInSource reports whether the two nodes were separated by a blank line in the source.
+func blankInSource(prev, next ast.Node) bool {
+	if prev == nil || next == nil {
+		return false
+	}
+
+	end, pos := prev.End(), next.Pos()
+	if !end.IsValid() || !pos.IsValid() {
+		return false
+	}
+
+	return pos.Line > end.Line+1
+}
+
+func (p *printer) statement(stmt ast.Node) {
+	switch n := stmt.(type) {
+	case *ast.Output:
+		if n.Attributes == nil {
+			p.print("output;")
+			return
+		}
+
+		p.print("output ")
+		p.mapping(n.Attributes)
+
+	case *ast.Namespace:
+		p.print("namespace ")
+		if n.Prefix != nil {
+			p.print(n.Prefix.Name, " => ")
+		}
+		p.print(quote(n.URI.Value))
+
+	case *ast.Stylesheet:
+		p.print("stylesheet ")
+		p.mapping(n.Attributes)
+
+	case *ast.Import:
+		p.print("import ", quote(n.Href.Value))
+
+	case *ast.Include:
+		p.print("include ", quote(n.Href.Value))
+
+	case *ast.Use:
+		p.print("use ", quote(n.Href.Value))
+
+	case *ast.Key:
+		p.print("key ", n.Name.Name, " ", xpath(n.Match.Value), " ", xpath(n.Use.Value))
+
+	case *ast.Sub:
+		p.print("sub ", n.Name.Name)
+		if n.Params != nil {
+			p.print(" ")
+			p.variableList(n.Params)
+		}
+		p.body(n.Body)
+
+	case *ast.Func:
+		p.print("func ", n.Name.Name)
+		if n.Params != nil {
+			p.print(" ")
+			p.funcParams(n.Params)
+		}
+		if n.As != nil {
+			p.print(" as ", literal(n.As.Type))
+		}
+		p.body(n.Body)
+
+	case *ast.Template:
+		p.print("template ", xpath(n.Match.Value))
+		if n.Mode != nil {
+			p.print(" mode ", n.Mode.Name.Name)
+		}
+		if n.Priority != nil {
+			p.print(" priority ")
+			p.expr(n.Priority.Value)
+		}
+		if n.Params != nil {
+			p.print(" ")
+			p.variableList(n.Params)
+		}
+		p.body(n.Body)
+
+	default:
+		p.expr(stmt)
+	}
+}
+
+// body prints the body of a definition or expression, preceded by a space.
+// Any block comments before the body are kept on the same line as what they followed.
+func (p *printer) body(n ast.Node) {
+	if n != nil {
+		p.inlineComments(n.Pos())
+	}
+
+	p.print(" ")
+	p.expr(n)
+}
+
+func (p *printer) expr(expr ast.Node) {
+	switch n := expr.(type) {
+	case nil:
+		p.print("{ }")
+
+	case *ast.Comment:
+		p.comment(n)
+
+	case *ast.Ident:
+		p.print(n.Name)
+
+	case *ast.String:
+		p.print(quote(n.Value))
+
+	case *ast.Interpolated:
+		p.print(interpolated(n))
+
+	case *ast.XPath:
+		p.print(xpath(n.Value))
+
+	case *ast.Number:
+		p.print(n.Value)
+
+	case *ast.Empty:
+		p.print(";")
+
+	case *ast.Group:
+		p.group(n)
+
+	case *ast.Variable:
+		p.print(n.Kind.String(), " ", variableName(n), " = ")
+		p.expr(n.Value)
+
+	case *ast.Text:
+		p.print("text ", quote(n.Value.Value))
+
+	case *ast.CopyOf:
+		p.print("copy-of ", xpath(n.Select.Value))
+
+	case *ast.ForEach:
+		p.print("foreach ", xpath(n.Select.Value))
+		if n.SortBy != nil {
+			p.print(" ")
+			p.sortBy(n.SortBy)
+		}
+		p.body(n.Body)
+
+	case *ast.GroupBy:
+		p.print("group ", xpath(n.Select.Value), " by ", xpath(n.Key.Value))
+		if n.SortBy != nil {
+			p.print(" ")
+			p.sortBy(n.SortBy)
+		}
+		p.body(n.Body)
+
+	case *ast.ApplyTemplates:
+		p.print("apply-templates")
+		if n.Select != nil {
+			p.print(" ", xpath(n.Select.Value))
+		}
+		if n.Mode != nil {
+			p.print(" mode ", n.Mode.Name.Name)
+		}
+		if n.SortBy != nil {
+			p.print(" ")
+			p.sortBy(n.SortBy)
+		}
+		if n.Args != nil {
+			p.print(" ")
+			p.variableList(n.Args)
+		}
+
+	case *ast.Choose:
+		for i, when := range n.Whens {
+			if i > 0 {
+				p.newline()
+			}
+
+			p.print("when ", xpath(when.Test.Value))
+			p.body(when.Body)
+		}
+
+		if n.Otherwise != nil {
+			p.newline()
+			p.print("otherwise")
+			p.body(n.Otherwise.Body)
+		}
+
+	case *ast.If:
+		p.print("if ", xpath(n.Test.Value))
+		p.body(n.Body)
+
+	case *ast.Call:
+		p.print("call ", n.Name.Name)
+		if n.Args != nil {
+			p.print(" ")
+			p.variableList(n.Args)
+		}
+
+	case *ast.Tag:
+		p.print("tag ", name(n.Name), inNamespace(n.Namespace))
+		p.body(n.Body)
+
+	case *ast.Attribs:
+		p.print("attribs ")
+
+		entries := make([]entry, len(n.List))
+		for i, attr := range n.List {
+			entries[i] = entry{name(attr.Name) + inNamespace(attr.Namespace), attr.Value}
+		}
+		p.entries(entries, n.Close)
+
+	case *ast.HTMLElement:
+		p.print(n.Tag)
+		if n.ID != "" {
+			p.print("#", n.ID)
+		}
+		for _, class := range n.Classes {
+			p.print(".", class)
+		}
+		if n.Class != nil {
+			p.print(" ", literal(n.Class))
+		}
+		p.body(n.Body)
+
+	case *ast.Sequence:
+		p.print("sequence ", xpath(n.Select.Value))
+
+	case *ast.Return:
+		p.print("return ", xpath(n.Select.Value))
+
+	case *ast.AnalyzeString:
+		p.print("analyze-string ", xpath(n.Select.Value), " ", quote(n.Regex.Value))
+		if n.Flags != nil {
+			p.print(" flags ", quote(n.Flags.Value.Value))
+		}
+		if n.Matching != nil {
+			p.print(" matching")
+			p.body(n.Matching.Body)
+		}
+		if n.NonMatching != nil {
+			p.print(" non-matching")
+			p.body(n.NonMatching.Body)
+		}
+
+	case *ast.ResultDocument:
+		p.print("result-document ")
+		p.expr(n.Href)
+		if n.Output != nil {
+			p.print(" output ")
+			p.mapping(n.Output.Attributes)
+		}
+		p.body(n.Body)
+
+	default:
+		panic(fmt.Sprintf("printer: unexpected expression: %T", expr))
+	}
+}
+
+func (p *printer) comment(n *ast.Comment) {
+	if !strings.Contains(n.Text, "\n") {
+		p.print("/** ", n.Text, " */")
+		return
+	}
+
+	p.print("/**")
+	for _, line := range strings.Split(n.Text, "\n") {
+		p.newline()
+		p.print(strings.TrimRight(" * "+line, " "))
+	}
+	p.newline()
+	p.print(" */")
+}
+
+func (p *printer) group(n *ast.Group) {
+	if n.Delim == "" {
+		// An implicit group of doc comments attached to an expression.
+		for i, child := range n.List {
+			if i > 0 {
+				p.newline()
+			}
+
+			p.expr(child)
+		}
+		return
+	}
+
+	list := withoutEmpty(n.List)
+
+	if len(list) == 0 && !p.hasCommentBefore(n.Close) {
+		p.print("{ }")
+		return
+	}
+
+	if flat, ok := p.flat(n, list); ok {
+		p.print(flat)
+		return
+	}
+
+	p.print("{")
+	p.indent++
+
+	// A comment following the opening brace on the same line is kept there,
+	// along with any line comment from before the brace, which cannot be kept inline.
+	first := n.Close
+	if len(list) > 0 {
+		first = list[0].Pos()
+	}
+	p.trailingComments(n.Open, first)
+
+	// last is the last expression or comment printed.
+	var last ast.Node
+
+	line := func(next ast.Node) {
+		if blankInSource(last, next) {
+			p.buf.WriteByte('\n')
+		}
+
+		p.newline()
+		last = next
+	}
+
+	for i, child := range list {
+		for c := p.commentBefore(child.Pos()); c != nil; c = p.commentBefore(child.Pos()) {
+			line(c)
+			p.print(c.Text)
+		}
+
+		line(child)
+		p.expr(child)
+
+		if i+1 < len(list) && needsSemicolon(child, list[i+1]) {
+			p.print(";")
+		}
+
+		p.trailingComments(child.End(), nextPos(list, i))
+	}
+
+	for c := p.commentBefore(n.Close); c != nil; c = p.commentBefore(n.Close) {
+		line(c)
+		p.print(c.Text)
+	}
+
+	p.indent--
+	p.newline()
+	p.print("}")
+}
+
+// withoutEmpty returns the list of expressions without any empty expressions,
+// which are only needed in the source to separate expressions that would otherwise run together.
+func withoutEmpty(list []ast.Node) []ast.Node {
+	var exprs []ast.Node
+
+	for _, n := range list {
+		if _, ok := n.(*ast.Empty); !ok {
+			exprs = append(exprs, n)
+		}
+	}
+
+	return exprs
+}
+
+// flat returns the group, with the given list of expressions, printed on a single line,
+// if it is simple and short enough to be.
+func (p *printer) flat(n *ast.Group, list []ast.Node) (string, bool) {
+	if p.hasCommentBefore(n.Close) {
+		return "", false
+	}
+
+	for _, child := range list {
+		if !isFlat(child) {
+			return "", false
+		}
+	}
+
+	s := p.render(func(p *printer) {
+		p.print("{")
+		for i, child := range list {
+			if i > 0 && needsSemicolon(list[i-1], child) {
+				p.print(";")
+			}
+
+			p.print(" ")
+			p.expr(child)
+		}
+		p.print(" }")
+	})
+
+	if len(s) > maxFlatWidth || strings.Contains(s, "\n") {
+		return "", false
+	}
+
+	return s, true
+}
+
+// isFlat reports whether the expression may be printed within a single-line block.
+func isFlat(n ast.Node) bool {
+	switch n := n.(type) {
+	case *ast.Ident, *ast.String, *ast.Interpolated, *ast.XPath, *ast.Number, *ast.Text, *ast.CopyOf, *ast.Sequence, *ast.Return:
+		return true
+
+	case *ast.Call:
+		return n.Args == nil
+
+	case *ast.Tag:
+		return isLeaf(n.Body)
+	case *ast.HTMLElement:
+		return isLeaf(n.Body)
+	}
+
+	return false
+}
+
+// isLeaf reports whether the expression is a single value.
+func isLeaf(n ast.Node) bool {
+	switch n.(type) {
+	case *ast.String, *ast.Interpolated, *ast.XPath, *ast.Number, *ast.Text:
+		return true
+	}
+
+	return false
+}
+
+// needsSemicolon reports whether a `;` is required between the two expressions,
+// so that the next expression is not parsed as a continuation of the previous one.
+func needsSemicolon(prev, next ast.Node) bool {
+	switch last := trailing(prev).(type) {
+	case *ast.Choose:
+		// A `when` following a chain without an `otherwise` would continue the chain.
+		_, ok := next.(*ast.Choose)
+		return ok && last.Otherwise == nil
+
+	case *ast.ApplyTemplates:
+		// An xpath following a bare `apply-templates` would be taken as its select.
+		_, ok := next.(*ast.XPath)
+		return ok && last.Select == nil && last.Mode == nil && last.SortBy == nil && last.Args == nil
+	}
+
+	return false
+}
+
+// trailing returns the innermost expression that the given expression ends with.
+func trailing(n ast.Node) ast.Node {
+	switch n := n.(type) {
+	case *ast.Variable:
+		return trailing(n.Value)
+	case *ast.ForEach:
+		return trailing(n.Body)
+	case *ast.GroupBy:
+		return trailing(n.Body)
+	case *ast.If:
+		return trailing(n.Body)
+	case *ast.Tag:
+		return trailing(n.Body)
+	case *ast.HTMLElement:
+		return trailing(n.Body)
+	case *ast.ResultDocument:
+		return trailing(n.Body)
+
+	case *ast.AnalyzeString:
+		if n.NonMatching != nil {
+			return trailing(n.NonMatching.Body)
+		}
+		return trailing(n.Matching.Body)
+
+	case *ast.Choose:
+		if n.Otherwise != nil {
+			return trailing(n.Otherwise.Body)
+		}
+		return n
+
+	case *ast.Group:
+		if n.Delim == "" && len(n.List) > 0 {
+			return trailing(n.List[len(n.List)-1])
+		}
+	}
+
+	return n
+}
+
+// entry is a `name => value` entry of a parenthesized list.
+type entry struct {
+	name  string
+	value ast.Node
+}
+
+// entries prints a list of entries which closes at the given position,
+// on a single line if they are simple and short enough,
+// and otherwise with one entry per line, and their arrows aligned.
+func (p *printer) entries(entries []entry, close ast.Pos) {
+	if len(entries) == 0 && !p.hasCommentBefore(close) {
+		p.print("( )")
+		return
+	}
+
+	flat := !p.hasCommentBefore(close)
+	for _, e := range entries {
+		if !isFlat(e.value) {
+			flat = false
+		}
+	}
+
+	if flat {
+		s := p.render(func(p *printer) {
+			p.print("( ")
+			for i, e := range entries {
+				if i > 0 {
+					p.print(", ")
+				}
+
+				p.print(e.name, " => ")
+				p.expr(e.value)
+			}
+			p.print(" )")
+		})
+
+		if len(s) <= maxFlatWidth && !strings.Contains(s, "\n") {
+			p.print(s)
+			return
+		}
+	}
+
+	width := 0
+	for _, e := range entries {
+		if len(e.name) > width {
+			width = len(e.name)
+		}
+	}
+
+	p.print("(")
+	p.indent++
+
+	for i, e := range entries {
+		for c := p.commentBefore(e.value.Pos()); c != nil; c = p.commentBefore(e.value.Pos()) {
+			p.newline()
+			p.print(c.Text)
+		}
+
+		p.newline()
+		p.print(e.name, strings.Repeat(" ", width-len(e.name)), " => ")
+		p.expr(e.value)
+		p.print(",")
+
+		var next ast.Pos
+		if i+1 < len(entries) {
+			next = entries[i+1].value.Pos()
+		}
+
+		p.trailingComments(e.value.End(), next)
+	}
+
+	for c := p.commentBefore(close); c != nil; c = p.commentBefore(close) {
+		p.newline()
+		p.print(c.Text)
+	}
+
+	p.indent--
+	p.newline()
+	p.print(")")
+}
+
+func (p *printer) variableList(n *ast.VariableList) {
+	entries := make([]entry, len(n.List))
+	for i, v := range n.List {
+		entries[i] = entry{variableName(v), v.Value}
+	}
+
+	p.entries(entries, n.Close)
+}
+
+// funcParams prints the parameters of a func, which have no values: `( $a as xs:string, $b )`.
+func (p *printer) funcParams(n *ast.VariableList) {
+	if len(n.List) == 0 {
+		p.print("( )")
+		return
+	}
+
+	p.print("( ")
+	for i, v := range n.List {
+		if i > 0 {
+			p.print(", ")
+		}
+
+		p.print("$", variableName(v))
+	}
+	p.print(" )")
+}
+
+// variableName returns the name of the variable, along with its tunnel keyword and type annotation, if any.
+func variableName(v *ast.Variable) string {
+	name := v.Name.Name
+
+	if v.Tunnel.IsValid() {
+		name = "tunnel " + name
+	}
+
+	if v.As != nil {
+		name += " as " + literal(v.As.Type)
+	}
+
+	return name
+}
+
+func (p *printer) mapping(n *ast.Map) {
+	entries := make([]entry, len(n.Entries))
+	for i, e := range n.Entries {
+		entries[i] = entry{literal(e.Key), e.Value}
+	}
+
+	p.entries(entries, n.Close)
+}
+
+func (p *printer) sortBy(n *ast.SortBy) {
+	p.print("sort-by (")
+
+	for i, key := range n.Keys {
+		if i > 0 {
+			p.print(",")
+		}
+
+		p.inlineComments(key.Select.Pos())
+		p.print(" ", xpath(key.Select.Value))
+
+		for _, mod := range key.Modifiers {
+			p.inlineComments(mod.Name.Pos())
+			p.print(" ", mod.Name.Name)
+			if mod.Value != nil {
+				p.print(" ", literal(mod.Value))
+			}
+		}
+	}
+
+	p.inlineComments(n.Close)
+	p.print(" )")
+}
+
+// literal returns the source of an *ast.Ident, *ast.String, or *ast.Number.
+func literal(n ast.Node) string {
+	switch n := n.(type) {
+	case *ast.Ident:
+		return n.Name
+	case *ast.String:
+		return quote(n.Value)
+	case *ast.Number:
+		return n.Value
+	}
+
+	panic(fmt.Sprintf("printer: unexpected literal: %T", n))
+}
+
+// name returns the name of a tag or attribute, which may be computed by an *ast.XPath.
+func name(n ast.Node) string {
+	if x, ok := n.(*ast.XPath); ok {
+		return xpath(x.Value)
+	}
+
+	return literal(n)
+}
+
+// inNamespace returns the namespace option of a tag or attribute, if it has one.
+func inNamespace(n *ast.InNamespace) string {
+	if n == nil {
+		return ""
+	}
+
+	return " namespace " + name(n.URI)
+}
+
+// IsIdent reports whether the string can be written as an identifier, rather than as a quoted string.
+func IsIdent(s string) bool {
+	if strings.HasPrefix(s, "$") || strings.HasPrefix(s, "@") {
+		return false
+	}
+
+	return tokenizer.IsIdent(s) && !strings.HasPrefix(s, ":") && !strings.HasSuffix(s, ":")
+}
+
+// interpolatedEscaper escapes the literal text of an interpolated string.
+var interpolatedEscaper = strings.NewReplacer(`\`, `\\`, "{", "{{", "}", "}}")
+
+// interpolated returns the interpolated string as a back-quoted string.
+func interpolated(n *ast.Interpolated) string {
+	var b strings.Builder
+
+	b.WriteByte('`')
+	for _, part := range n.Parts {
+		switch part := part.(type) {
+		case *ast.String:
+			b.WriteString(interpolatedEscaper.Replace(part.Value))
+		case *ast.XPath:
+			b.WriteString("{" + part.Value + "}")
+		}
+	}
+	b.WriteByte('`')
+
+	return b.String()
+}
+
+// quote returns the string as a quoted string literal.
+// Double quotes are used, unless the string contains double quotes but no single quotes.
+func quote(s string) string {
+	q := byte('"')
+	if strings.Contains(s, `"`) && !strings.Contains(s, "'") {
+		q = '\''
+	}
+
+	var b strings.Builder
+	b.WriteByte(q)
+
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\', q:
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	b.WriteByte(q)
+	return b.String()
+}
+
+// xpath returns the XPath in the shortest form that it can be written in:
+// a bare `$variable` or `@attribute`, a simple `<xpath>`, or a complex `<{ xpath }>`.
+func xpath(s string) string {
+	if tokenizer.IsSimpleXPath(s) {
+		if s[0] == '$' || s[0] == '@' {
+			return s
+		}
+
+		return "<" + s + ">"
+	}
+
+	return "<{ " + s + " }>"
+}
+
+// CanQuoteXPath reports whether the XPath can be written in LXT source at all.
+// A complex XPath cannot contain the `}>` that would end it.
+func CanQuoteXPath(s string) bool {
+	return tokenizer.IsSimpleXPath(s) || !strings.Contains(s, "}>")
+}
@@ -0,0 +1,294 @@
+package printer
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/puellanivis/lxt/parser"
+)
+
+func format(t *testing.T, input string) string {
+	t.Helper()
+
+	file, err := parser.ParseSource(context.Background(), strings.NewReader(input), "test.lxt")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	return string(Source(file))
+}
+
+func TestFormat(t *testing.T) {
+	input := `# leading comment
+import 'common.xsl'
+output ( method => html, indent => true )
+param title = 'Hi'
+param sub-title = "Sub"
+sub header ( level => <1> , really-long-parameter-name => "with a long default value" ) {
+  tag h1 $title   // trailing
+  div 'page' [ "a" ; "b" ]
+}
+// about the template
+template </> {
+	foreach <//item> sort-by ( <@date> desc ) ( call header )
+	attribs ( id => "x", class => { "a" $b } )
+	/* block */
+}
+`
+
+	expect := `# leading comment
+import "common.xsl"
+
+output ( method => html, indent => true )
+
+param title = "Hi"
+param sub-title = "Sub"
+
+sub header (
+	level                      => <1>,
+	really-long-parameter-name => "with a long default value",
+) {
+	tag h1 $title // trailing
+	div "page" { "a" "b" }
+}
+
+// about the template
+template </> {
+	foreach <//item> sort-by ( @date desc ) { call header }
+	attribs (
+		id    => "x",
+		class => { "a" $b },
+	)
+	/* block */
+}
+`
+
+	got := format(t, input)
+	if got != expect {
+		t.Fatalf("format gave:\n%s\nexpected:\n%s", got, expect)
+	}
+
+	if again := format(t, got); again != got {
+		t.Errorf("formatting is not idempotent, reformatting gave:\n%s", again)
+	}
+}
+
+func TestFormatSemicolons(t *testing.T) {
+	input := `sub a {
+	when $x "x"; when $y "y"
+	apply-templates; <.>
+}
+`
+
+	expect := `sub a {
+	when $x "x";
+	when $y "y"
+	apply-templates;
+	<.>
+}
+`
+
+	if got := format(t, input); got != expect {
+		t.Errorf("format gave:\n%s\nexpected:\n%s", got, expect)
+	}
+}
+
+func TestFormatXSLT20(t *testing.T) {
+	input := `sub row ( tunnel depth as xs:integer => <0> , label as 'xs:string?' => "" ) {
+	var total   as xs:integer = <{ sum(item) }>
+	sequence <{ $total + $depth }>
+	analyze-string $label '[0-9]+' flags "i" matching { tag num <.> } non-matching <.>
+	result-document <{ concat('out/', $label) }> output ( method => html ) { call row ( tunnel depth => <1> ) }
+}
+`
+
+	expect := `sub row ( tunnel depth as xs:integer => <0>, label as "xs:string?" => "" ) {
+	var total as xs:integer = <{ sum(item) }>
+	sequence <{ $total + $depth }>
+	analyze-string $label "[0-9]+" flags "i" matching { tag num <.> } non-matching <.>
+	result-document <{ concat('out/', $label) }> output ( method => html ) {
+		call row ( tunnel depth => <1> )
+	}
+}
+`
+
+	got := format(t, input)
+	if got != expect {
+		t.Fatalf("format gave:\n%s\nexpected:\n%s", got, expect)
+	}
+
+	if again := format(t, got); again != got {
+		t.Errorf("formatting is not idempotent, reformatting gave:\n%s", again)
+	}
+}
+
+func TestFormatFuncAndGroup(t *testing.T) {
+	input := `func my:double($n as xs:double,b) as xs:double {
+	var twice = <{ $n * 2 }>
+	return $twice
+}
+func my:one() { return <1> }
+template </> { group <item> by <@cat> sort-by(<@cat>) { tag cat { <{ current-grouping-key() }> } } }
+`
+
+	expect := `func my:double ( $n as xs:double, $b ) as xs:double {
+	var twice = <{ $n * 2 }>
+	return $twice
+}
+
+func my:one ( ) { return <1> }
+
+template </> {
+	group <item> by @cat sort-by ( @cat ) {
+		tag cat { <{ current-grouping-key() }> }
+	}
+}
+`
+
+	got := format(t, input)
+	if got != expect {
+		t.Fatalf("format gave:\n%s\nexpected:\n%s", got, expect)
+	}
+
+	if again := format(t, got); again != got {
+		t.Errorf("formatting is not idempotent, reformatting gave:\n%s", again)
+	}
+}
+
+func TestFormatKeys(t *testing.T) {
+	input := `key by-id <item> <@id>
+key   by-cat <item>   <@cat>
+template </> { <{ count(key('by-id', 'a')) }> }
+`
+
+	expect := `key by-id <item> @id
+key by-cat <item> @cat
+
+template </> { <{ count(key('by-id', 'a')) }> }
+`
+
+	got := format(t, input)
+	if got != expect {
+		t.Fatalf("format gave:\n%s\nexpected:\n%s", got, expect)
+	}
+}
+
+func TestFormatComputedNames(t *testing.T) {
+	input := `template </> {
+	tag <{ local-name() }>   namespace <{ namespace-uri() }> {
+		attribs ( <{ name(@*[1]) }> => <{ @*[1] }>, id namespace "urn:x" => "a", "b" => <b> )
+	}
+	tag $name "x"
+}
+`
+
+	expect := `template </> {
+	tag <{ local-name() }> namespace <{ namespace-uri() }> {
+		attribs (
+			<{ name(@*[1]) }>    => <{ @*[1] }>,
+			id namespace "urn:x" => "a",
+			"b"                  => <b>,
+		)
+	}
+	tag $name "x"
+}
+`
+
+	got := format(t, input)
+	if got != expect {
+		t.Fatalf("format gave:\n%s\nexpected:\n%s", got, expect)
+	}
+}
+
+func TestFormatInterpolated(t *testing.T) {
+	input := "template </> {\n" +
+		"\ttag a { attribs ( href => `/items/{ @id }.html` ) `{{{name}}}` }\n" +
+		"\tvar path = `C:\\\\{$dir}`\n" +
+		"\t$path\n" +
+		"}\n"
+
+	expect := "template </> {\n" +
+		"\ttag a {\n" +
+		"\t\tattribs ( href => `/items/{@id}.html` )\n" +
+		"\t\t`{{{name}}}`\n" +
+		"\t}\n" +
+		"\tvar path = `C:\\\\{$dir}`\n" +
+		"\t$path\n" +
+		"}\n"
+
+	got := format(t, input)
+	if got != expect {
+		t.Fatalf("format gave:\n%s\nexpected:\n%s", got, expect)
+	}
+
+	if again := format(t, got); again != got {
+		t.Errorf("formatting is not idempotent, reformatting gave:\n%s", again)
+	}
+}
+
+func TestFormatHTMLElements(t *testing.T) {
+	input := `template </> {
+	section#main.card.wide   { p "text"   br ; }
+	div   'note'   "aside"
+	img { attribs ( src => @src ) }
+}
+`
+
+	expect := `template </> {
+	section#main.card.wide {
+		p "text"
+		br ;
+	}
+	div "note" "aside"
+	img {
+		attribs ( src => @src )
+	}
+}
+`
+
+	got := format(t, input)
+	if got != expect {
+		t.Fatalf("format gave:\n%s\nexpected:\n%s", got, expect)
+	}
+
+	if again := format(t, got); again != got {
+		t.Errorf("formatting is not idempotent, reformatting gave:\n%s", again)
+	}
+}
+
+func TestFormatInlineComments(t *testing.T) {
+	input := `template </> {
+	foreach <x> sort-by ( /* by */ <@a> /* first */ desc, <@b> number /* last */ ) {
+		"a" "b"
+	}
+	if <x> /* test */ { // trailing
+		"b"
+	}
+	foreach <y> sort-by ( <@a> // line comment
+		desc ) {
+		"c"
+	}
+}
+`
+
+	expect := `template </> {
+	foreach <x> sort-by ( /* by */ @a /* first */ desc, @b number /* last */ ) { "a" "b" }
+	if <x> /* test */ { // trailing
+		"b"
+	}
+	foreach <y> sort-by ( @a desc ) { // line comment
+		"c"
+	}
+}
+`
+
+	got := format(t, input)
+	if got != expect {
+		t.Fatalf("format gave:\n%s\nexpected:\n%s", got, expect)
+	}
+
+	if again := format(t, got); again != got {
+		t.Errorf("formatting is not idempotent, reformatting gave:\n%s", again)
+	}
+}
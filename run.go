@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/puellanivis/breton/lib/files"
+	flag "github.com/puellanivis/breton/lib/gnuflag"
+	"github.com/puellanivis/breton/lib/os/process"
+
+	"github.com/puellanivis/lxt/engine"
+)
+
+// RunFlags are the flags of the `run` subcommand.
+var RunFlags struct {
+	Input string   `flag:",short=i" desc:"Specifies which URI to read the input XML document from."`
+	Param []string `flag:",short=p" desc:"Sets a top-level parameter of the stylesheet, given as name=value."`
+}
+
+// run compiles the LXT files given in args, and runs the resulting stylesheet against the input document.
+//
+//	lxt run -i input.xml style.lxt
+func run(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	fs.CopyFrom(flag.CommandLine, "output")
+	fs.CopyFrom(flag.CommandLine, "max-errors")
+	fs.CopyFrom(flag.CommandLine, "rebind")
+
+	if err := fs.Struct("", &RunFlags); err != nil {
+		panic(err)
+	}
+
+	if err := fs.Parse(args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		process.Exit(2)
+	}
+
+	if len(fs.Args()) < 1 && (RunFlags.Input == "" || RunFlags.Input == "-") {
+		fmt.Fprintln(os.Stderr, "run: the stylesheet and the input cannot both be read from stdin")
+		process.Exit(2)
+	}
+
+	xsl := compile(ctx, fs.Args())
+
+	proc, err := engine.New(xsl)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "engine.New:", err)
+		process.Exit(1)
+	}
+
+	for _, param := range RunFlags.Param {
+		name, value, ok := strings.Cut(param, "=")
+		if !ok {
+			fmt.Fprintf(os.Stderr, "bad param %q: expected name=value\n", param)
+			process.Exit(2)
+		}
+
+		proc.SetParam(name, value)
+	}
+
+	in, err := files.Open(ctx, RunFlags.Input)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "input:", err)
+		process.Exit(1)
+	}
+	defer in.Close()
+
+	out, err := getOutput(ctx, Flags.Output)
+	if err != nil {
+		panic(err)
+	}
+	defer func(out io.Closer) {
+		if err := out.Close(); err != nil {
+			fmt.Fprintln(os.Stderr, "output.Close:", err)
+			process.Exit(1)
+		}
+	}(out)
+
+	if err := proc.Transform(ctx, in, out); err != nil {
+		fmt.Fprintln(os.Stderr, "transform:", err)
+		process.Exit(1)
+	}
+}
@@ -0,0 +1,84 @@
+package tokenizer
+
+import (
+	"fmt"
+)
+
+// Position describes a position in an LXT source file.
+//
+// The Line and Column are both 1-based, and the Column counts bytes, not characters.
+// The Offset is the 0-based byte offset from the start of the file.
+type Position struct {
+	Filename string
+	Line     int
+	Column   int
+	Offset   int
+}
+
+// IsValid reports whether the position describes an actual location in a source file.
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+func (p Position) String() string {
+	if !p.IsValid() {
+		if p.Filename != "" {
+			return p.Filename
+		}
+
+		return "-"
+	}
+
+	s := fmt.Sprintf("%d:%d", p.Line, p.Column)
+	if p.Filename != "" {
+		s = p.Filename + ":" + s
+	}
+
+	return s
+}
+
+// Before reports whether the position p is before the position q.
+func (p Position) Before(q Position) bool {
+	return p.Offset < q.Offset
+}
+
+// Advance returns the position after the given text, which starts at position p.
+func (p Position) Advance(text []byte) Position {
+	for _, b := range text {
+		if b == '\n' {
+			p.Line++
+			p.Column = 0
+		}
+
+		p.Column++
+		p.Offset++
+	}
+
+	return p
+}
+
+// Error is an error describing a problem at a specific span of an LXT source file.
+type Error struct {
+	Pos Position
+	End Position
+
+	Msg string
+	Err error
+}
+
+func (e *Error) Error() string {
+	msg := e.Msg
+	if e.Err != nil {
+		msg = fmt.Sprintf("%s: %v", msg, e.Err)
+	}
+
+	if !e.Pos.IsValid() && e.Pos.Filename == "" {
+		return msg
+	}
+
+	return fmt.Sprintf("%s: %s", e.Pos, msg)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
@@ -18,6 +18,7 @@ const (
 	TokenTypeNumber
 	TokenTypeIdentifier
 	TokenTypeXPath
+	TokenTypeComment
 
 	TokenTypeBackQuote   = TokenType('`')
 	TokenTypeSingleQuote = TokenType('\'')
@@ -52,6 +53,8 @@ func (t TokenType) String() string {
 		return "DQ"
 	case TokenTypeXPath:
 		return "XP"
+	case TokenTypeComment:
+		return "COMMENT"
 	}
 
 	return fmt.Sprintf("UNKNOWN%d", int(t))
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"strings"
 	"unicode"
 	"unicode/utf8"
 )
@@ -13,34 +14,205 @@ import (
 type Reader struct {
 	S *bufio.Scanner
 
+	// Filename is used as the filename of all token positions.
+	Filename string
+
+	// KeepComments causes line and block comments to be collected into Comments, rather than discarded.
+	KeepComments bool
+	Comments     []Comment
+
+	// IDShorthand reports whether the identifier read so far may be followed by an id shorthand, as in `div#main`.
+	// If it is nil, or reports false, then a '#' ends the identifier, and begins a line comment.
+	IDShorthand func(name string) bool
+
 	lineno int
 	line   []byte
 
+	// col is the byte offset into the current source line of the start of line,
+	// and lineOffset is the byte offset into the source of the start of the current source line.
+	col        int
+	lineOffset int
+	nextOffset int
+
 	off int
+
+	// pending holds the leading part of a token that spans multiple lines,
+	// including the newlines, but excluding the current line.
+	pending []byte
+
+	// start is the position of the start of the token currently being read,
+	// and valueStart is the position of the start of its value, if different.
+	start      Position
+	valueStart Position
 }
 
 func (r *Reader) CurrentLine() int {
 	return r.lineno
 }
 
+// position returns the position of the reader within the source.
+//
+// Offsets assume that every line ends with a single newline byte.
+func (r *Reader) position() Position {
+	return Position{
+		Filename: r.Filename,
+		Line:     r.lineno,
+		Column:   r.col + r.off + 1,
+		Offset:   r.lineOffset + r.col + r.off,
+	}
+}
+
+// skip drops the first n bytes of the current line.
+func (r *Reader) skip(n int) {
+	r.line, r.off = r.line[n:], 0
+	r.col += n
+}
+
+// trimSpace drops any leading whitespace from the current line.
+func (r *Reader) trimSpace() {
+	trimmed := bytes.TrimLeftFunc(r.line, unicode.IsSpace)
+	r.skip(len(r.line) - len(trimmed))
+}
+
+func (r *Reader) scanLine() error {
+	if !r.S.Scan() {
+		if err := r.S.Err(); err != nil {
+			return err
+		}
+
+		return io.EOF
+	}
+
+	r.line = r.S.Bytes()
+	r.lineno++
+
+	r.col = 0
+	r.lineOffset = r.nextOffset
+	r.nextOffset += len(r.line) + 1
+
+	return nil
+}
+
+var (
+	lineComment     = []byte("//")
+	blockComment    = []byte("/*")
+	blockCommentEnd = []byte("*/")
+	docComment      = []byte("/**")
+	emptyComment    = []byte("/**/")
+)
+
+func isDocComment(line []byte) bool {
+	return bytes.HasPrefix(line, docComment) && !bytes.HasPrefix(line, emptyComment)
+}
+
+// Comment is a line or block comment, which is otherwise skipped by the Reader.
+type Comment struct {
+	Pos, End Position
+
+	// Text is the comment as written, including its delimiters.
+	Text string
+}
+
+// keepComment collects the comment that starts at the given position, and ends at the current position.
+func (r *Reader) keepComment(start Position, text string) {
+	if !r.KeepComments {
+		return
+	}
+
+	r.Comments = append(r.Comments, Comment{
+		Pos:  start,
+		End:  r.position(),
+		Text: text,
+	})
+}
+
 func (r *Reader) startNewToken() error {
-	for len(r.line) < 1 {
-		if !r.S.Scan() {
-			if err := r.S.Err(); err != nil {
+	for {
+		for len(r.line) < 1 {
+			if err := r.scanLine(); err != nil {
+				return err
+			}
+
+			r.trimSpace()
+		}
+
+		r.trimSpace()
+
+		switch {
+		case len(r.line) < 1:
+			continue
+
+		case r.line[0] == '#', bytes.HasPrefix(r.line, lineComment):
+			start := r.position()
+			text := bytes.TrimRightFunc(r.line, unicode.IsSpace)
+
+			r.skip(len(text))
+			r.keepComment(start, string(text))
+
+			r.line = nil
+			continue
+
+		case bytes.HasPrefix(r.line, blockComment) && !isDocComment(r.line):
+			start := r.position()
+
+			text, err := r.readBlockComment(len(blockComment))
+			if err != nil {
 				return err
 			}
 
-			return io.EOF
+			r.keepComment(start, "/*"+string(text)+"*/")
+			continue
 		}
 
-		r.line = bytes.TrimSpace(r.S.Bytes())
-		r.lineno++
+		return nil
 	}
+}
 
-	r.line = bytes.TrimSpace(r.line)
-	r.off = 0
+// readBlockComment reads until the end of a block comment, which may span multiple lines.
+// It returns the text of the comment, not including the delimiters.
+func (r *Reader) readBlockComment(start int) ([]byte, error) {
+	var text []byte
 
-	return nil
+	r.skip(start)
+	for {
+		if i := bytes.Index(r.line, blockCommentEnd); i >= 0 {
+			text = append(text, r.line[:i]...)
+			r.skip(i + len(blockCommentEnd))
+			return text, nil
+		}
+
+		text = append(append(text, r.line...), '\n')
+
+		if err := r.scanLine(); err != nil {
+			if err == io.EOF {
+				return nil, errors.New("unterminated block comment")
+			}
+
+			return nil, err
+		}
+	}
+}
+
+// cleanDocComment removes the leading whitespace and asterisks from each line of a doc comment,
+// as well as any leading or trailing blank lines.
+func cleanDocComment(in []byte) string {
+	lines := bytes.Split(in, []byte("\n"))
+
+	for i, line := range lines {
+		line = bytes.TrimSpace(line)
+		line = bytes.TrimPrefix(line, []byte("*"))
+		lines[i] = bytes.TrimSpace(line)
+	}
+
+	for len(lines) > 0 && len(lines[0]) < 1 {
+		lines = lines[1:]
+	}
+
+	for len(lines) > 0 && len(lines[len(lines)-1]) < 1 {
+		lines = lines[:len(lines)-1]
+	}
+
+	return string(bytes.Join(lines, []byte("\n")))
 }
 
 const errInvalidCharacter = "invalid character"
@@ -63,6 +235,42 @@ func (r *Reader) advance(n int) {
 	r.off += n
 }
 
+// continueLine moves the current token onto the next line,
+// keeping the part of the token already read, and a newline, as pending.
+// If there is no next line, then the current line is left as is,
+// so that the text of the token is not repeated by the pending bytes.
+func (r *Reader) continueLine() error {
+	// The pending bytes must be copied, because the scanner may overwrite them.
+	pending := append(r.pending, r.line...)
+	pending = append(pending, '\n')
+
+	if err := r.scanLine(); err != nil {
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+
+		return err
+	}
+
+	r.pending = pending
+	r.off = 0
+	return nil
+}
+
+// nextAcrossLines is like next(any), except that the end of a line is returned as a '\n',
+// and then reading continues onto the next line.
+func (r *Reader) nextAcrossLines() (rune, int, error) {
+	if r.off >= len(r.line) {
+		if err := r.continueLine(); err != nil {
+			return 0, 0, err
+		}
+
+		return '\n', 1, nil
+	}
+
+	return r.next(any)
+}
+
 func any(r rune) bool {
 	return true
 }
@@ -83,9 +291,14 @@ func (r *Reader) next(mustBe func(rune) bool) (rune, int, error) {
 }
 
 func (r *Reader) bytesSlice(s, e int) []byte {
-	length, text := r.off, r.line[s:r.off-e]
-	r.line, r.off = r.line[length:], 0
-	return text
+	text := r.line[:r.off]
+	if r.pending != nil {
+		text = append(r.pending, text...)
+		r.pending = nil
+	}
+
+	r.skip(r.off)
+	return text[s : len(text)-e]
 }
 
 func (r *Reader) bytes() []byte {
@@ -136,9 +349,9 @@ func unquote(in []byte) string {
 
 func (r *Reader) readQuote(quoteChar rune) (int, error) {
 	for {
-		char, sz, err := r.next(any)
+		char, sz, err := r.nextAcrossLines()
 		if err != nil {
-			return 0, err
+			return 0, fmt.Errorf("reading quote: %w", err)
 		}
 
 		switch char {
@@ -146,8 +359,8 @@ func (r *Reader) readQuote(quoteChar rune) (int, error) {
 			return sz, nil
 
 		case '\\':
-			if _, _, err := r.next(any); err != nil {
-				return 0, err
+			if _, _, err := r.nextAcrossLines(); err != nil {
+				return 0, fmt.Errorf("reading quote: %w", err)
 			}
 		}
 	}
@@ -155,7 +368,7 @@ func (r *Reader) readQuote(quoteChar rune) (int, error) {
 
 func (r *Reader) readBackQuote() (int, error) {
 	for {
-		char, sz, err := r.next(any)
+		char, sz, err := r.nextAcrossLines()
 		if err != nil {
 			return 0, fmt.Errorf("reading raw quote: %w", err)
 		}
@@ -224,6 +437,30 @@ func (r *Reader) readIdent() error {
 				return err
 			}
 
+		case char == '#':
+			// Where an id shorthand is allowed, a '#' immediately followed by a name continues the identifier, as in `div#main`,
+			// and a '#' followed by anything else that could continue a name, as in `li#2`, is a malformed id.
+			// Otherwise, it begins a line comment.
+			if r.IDShorthand == nil || !r.IDShorthand(string(r.line[:r.off])) {
+				return nil
+			}
+
+			next, _ := utf8.DecodeRune(r.line[r.off+sz:])
+
+			switch {
+			case identInitial(next):
+				r.advance(sz)
+
+			case identFollowing(next):
+				r.advance(sz)
+				r.next(any)
+
+				return errors.New("malformed id shorthand: an id must begin with a letter or underscore")
+
+			default:
+				return nil
+			}
+
 		case !identFollowing(char):
 			return nil
 
@@ -310,6 +547,38 @@ func is(test rune) func(rune) bool {
 	}
 }
 
+// IsSimpleXPath reports whether the XPath can be written in the short form `<xpath>`,
+// rather than requiring the complex form `<{ xpath }>`.
+func IsSimpleXPath(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	for i, char := range s {
+		if char == '$' || char == '@' {
+			rest := s[i+1:]
+			return IsIdent(rest) && !strings.HasPrefix(rest, ":") && !strings.HasSuffix(rest, ":") && !strings.Contains(rest, "::")
+		}
+
+		switch {
+		case char == ':':
+			// Only an axis separator `::` is allowed, which is checked at the first colon.
+			if i > 0 && s[i-1] == ':' {
+				continue
+			}
+
+			if !strings.HasPrefix(s[i:], "::") || strings.HasPrefix(s[i:], ":::") {
+				return false
+			}
+
+		case !simpleXPath(char):
+			return false
+		}
+	}
+
+	return true
+}
+
 func (r *Reader) readSimpleXPath() (int, error) {
 	for {
 		char, sz, err := r.next(any)
@@ -353,31 +622,47 @@ func (r *Reader) readSimpleXPath() (int, error) {
 
 func (r *Reader) readComplexXPath() (int, error) {
 	for {
-		char, sz, err := r.next(any)
+		char, sz, err := r.nextAcrossLines()
 		if err != nil {
-			return 0, err
+			return 0, fmt.Errorf("reading xpath: %w", err)
 		}
 
 		switch char {
 		case '}':
-			char, sz2, err := r.next(any)
-			if err != nil {
-				return 0, err
-			}
-
-			if char == '>' {
+			if char, sz2, _ := r.peak(); char == '>' {
+				r.advance(sz2)
 				return sz + sz2, nil
 			}
 
 		case '\\':
-			if _, _, err := r.next(any); err != nil {
-				return 0, err
+			if _, _, err := r.nextAcrossLines(); err != nil {
+				return 0, fmt.Errorf("reading xpath: %w", err)
 			}
 		}
 	}
 }
 
+// ReadToken reads the next token from the source.
+// The returned token is positioned even if an error is returned.
 func (r *Reader) ReadToken() (Token, error) {
+	r.start, r.valueStart, r.pending = Position{}, Position{}, nil
+
+	tok, err := r.readToken()
+	tok.Pos, tok.End = r.start, r.position()
+
+	if !tok.Pos.IsValid() {
+		tok.Pos = tok.End
+	}
+
+	tok.ValuePos = tok.Pos
+	if r.valueStart.IsValid() {
+		tok.ValuePos = r.valueStart
+	}
+
+	return tok, err
+}
+
+func (r *Reader) readToken() (Token, error) {
 	if err := r.startNewToken(); err != nil {
 		if err == io.EOF {
 			return EOF, io.EOF
@@ -389,6 +674,23 @@ func (r *Reader) ReadToken() (Token, error) {
 		}, err
 	}
 
+	r.start = r.position()
+
+	if isDocComment(r.line) {
+		text, err := r.readBlockComment(len(docComment))
+		if err != nil {
+			return Token{
+				Type:  TokenTypeError,
+				Value: "",
+			}, err
+		}
+
+		return Token{
+			Type:  TokenTypeComment,
+			Value: cleanDocComment(text),
+		}, nil
+	}
+
 	char, sz, err := r.next(any)
 	if err != nil {
 		return Token{
@@ -407,6 +709,8 @@ func (r *Reader) ReadToken() (Token, error) {
 		}, err
 
 	case '`':
+		// The value of an interpolated string is positioned, so that the positions of its XPaths can be found.
+		r.valueStart = r.position()
 		e, err := r.readBackQuote()
 
 		return Token{
@@ -432,14 +736,22 @@ func (r *Reader) ReadToken() (Token, error) {
 	case '<':
 		if ch, sz2, _ := r.peak(); ch == '{' {
 			r.advance(sz2)
+			r.valueStart = r.position()
 
 			e, err := r.readComplexXPath()
+
+			value := r.bytesSlice(sz+sz2, e)
+			trimmed := bytes.TrimLeftFunc(value, unicode.IsSpace)
+			r.valueStart = r.valueStart.Advance(value[:len(value)-len(trimmed)])
+
 			return Token{
 				Type:  TokenTypeXPath,
-				Value: string(bytes.TrimSpace(r.bytesSlice(sz+sz2, e))),
+				Value: string(bytes.TrimRightFunc(trimmed, unicode.IsSpace)),
 			}, err
 		}
 
+		r.valueStart = r.position()
+
 		e, err := r.readSimpleXPath()
 		return Token{
 			Type:  TokenTypeXPath,
@@ -68,3 +68,288 @@ ident·with·interpunkt
 		t.Errorf("final ReadToken was %s, but expected %s", got, expect)
 	}
 }
+
+func TestComments(t *testing.T) {
+	input := `
+# line comment
+ident1 // trailing line comment
+/* block
+   comment */ ident2 /**/
+/**
+ * doc comment
+ * over lines
+ */
+/** inline doc */ ident3
+div#main.card.wide #comment
+ident4# comment
+foo#bar
+ident5
+`
+
+	expectTokens := []string{
+		`IDENT("ident1")`,
+		`IDENT("ident2")`,
+		`COMMENT("doc comment\nover lines")`,
+		`COMMENT("inline doc")`,
+		`IDENT("ident3")`,
+		`IDENT("div#main.card.wide")`,
+		`IDENT("ident4")`,
+		`IDENT("foo")`,
+		`IDENT("ident5")`,
+	}
+
+	r := &Reader{
+		S:           bufio.NewScanner(strings.NewReader(input)),
+		IDShorthand: idShorthand,
+	}
+
+	for i, expect := range expectTokens {
+		got, err := r.ReadToken()
+		if err != nil {
+			t.Fatalf("token %d %s: unexpected error: %v", i, got, err)
+		}
+
+		if got.String() != expect {
+			t.Errorf("token %d was %s, but expected %s", i, got, expect)
+		}
+	}
+
+	got, err := r.ReadToken()
+	if err != nil && err != io.EOF {
+		t.Fatalf("final ReadToken gave error %q, but expected io.EOF", err)
+	}
+	if expect := `EOF("")`; got.String() != expect {
+		t.Errorf("final ReadToken was %s, but expected %s", got, expect)
+	}
+}
+
+func TestUnterminatedComment(t *testing.T) {
+	r := &Reader{
+		S: bufio.NewScanner(strings.NewReader("ident /* never\nends")),
+	}
+
+	if _, err := r.ReadToken(); err != nil {
+		t.Fatalf("first ReadToken gave unexpected error: %v", err)
+	}
+
+	if got, err := r.ReadToken(); err == nil || err == io.EOF {
+		t.Errorf("ReadToken was %s, %v, but expected an error", got, err)
+	}
+}
+
+// idShorthand allows an id shorthand only after a few HTML element names, and their class shorthand.
+func idShorthand(name string) bool {
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		name = name[:i]
+	}
+
+	switch name {
+	case "div", "li", "p":
+		return true
+	}
+
+	return false
+}
+
+func TestMalformedID(t *testing.T) {
+	tests := map[string]string{
+		`li#2 "x"`:  `IDENT("li#2")`,
+		"div#1main": `IDENT("div#1")`,
+		"p.a#-b":    `IDENT("p.a#-")`,
+	}
+
+	for input, expect := range tests {
+		r := &Reader{
+			S:           bufio.NewScanner(strings.NewReader(input)),
+			IDShorthand: idShorthand,
+		}
+
+		got, err := r.ReadToken()
+		if err == nil || err == io.EOF {
+			t.Errorf("ReadToken(%q) was %s, %v, but expected an error", input, got, err)
+		}
+
+		if got.String() != expect {
+			t.Errorf("ReadToken(%q) was %s, but expected %s", input, got, expect)
+		}
+	}
+}
+
+func TestPositions(t *testing.T) {
+	input := "ident \"str\"\n  /* c */ <a/b> $x\n\t<{ 1 }>"
+
+	type span struct {
+		line, col, off int
+		endCol, endOff int
+	}
+
+	expect := []span{
+		{1, 1, 0, 6, 5},
+		{1, 7, 6, 12, 11},
+		{2, 11, 22, 16, 27},
+		{2, 17, 28, 19, 30},
+		{3, 2, 32, 9, 39},
+	}
+
+	r := &Reader{
+		S:        bufio.NewScanner(strings.NewReader(input)),
+		Filename: "test.lxt",
+	}
+
+	for i, expect := range expect {
+		tok, err := r.ReadToken()
+		if err != nil {
+			t.Fatalf("token %d %s: unexpected error: %v", i, tok, err)
+		}
+
+		if tok.Pos.Filename != "test.lxt" {
+			t.Errorf("token %d %s has filename %q", i, tok, tok.Pos.Filename)
+		}
+
+		got := span{tok.Pos.Line, tok.Pos.Column, tok.Pos.Offset, tok.End.Column, tok.End.Offset}
+		if got != expect {
+			t.Errorf("token %d %s was at %v, expected %v", i, tok, got, expect)
+		}
+
+		if tok.End.Offset <= len(input) {
+			if s := input[tok.Pos.Offset:tok.End.Offset]; strings.TrimSpace(s) != s || s == "" {
+				t.Errorf("token %d %s spans %q", i, tok, s)
+			}
+		}
+	}
+}
+
+func TestMultiline(t *testing.T) {
+	input := "\"first  \n  second\" 'a\\\nb' «raw\n\tquote« <{ count(\n  item\n) }> after"
+	input = strings.ReplaceAll(input, "«", "`")
+
+	type span struct {
+		line, col int
+		endLine   int
+		endCol    int
+	}
+
+	expect := []struct {
+		tok  string
+		span span
+	}{
+		{`DQ("first  \n  second")`, span{1, 1, 2, 10}},
+		{`SQ("a\nb")`, span{2, 11, 3, 3}},
+		{"BQ(\"raw\\n\\tquote\")", span{3, 4, 4, 8}},
+		{`XP("count(\n  item\n)")`, span{4, 9, 6, 5}},
+		{`IDENT("after")`, span{6, 6, 6, 11}},
+	}
+
+	r := &Reader{
+		S: bufio.NewScanner(strings.NewReader(input)),
+	}
+
+	for i, expect := range expect {
+		tok, err := r.ReadToken()
+		if err != nil {
+			t.Fatalf("token %d %s: unexpected error: %v", i, tok, err)
+		}
+
+		if tok.String() != expect.tok {
+			t.Errorf("token %d was %s, but expected %s", i, tok, expect.tok)
+		}
+
+		got := span{tok.Pos.Line, tok.Pos.Column, tok.End.Line, tok.End.Column}
+		if got != expect.span {
+			t.Errorf("token %d %s was at %v, expected %v", i, tok, got, expect.span)
+		}
+
+		if s := input[tok.Pos.Offset:tok.End.Offset]; strings.TrimSpace(s) != s || s == "" {
+			t.Errorf("token %d %s spans %q", i, tok, s)
+		}
+	}
+}
+
+func TestUnterminatedString(t *testing.T) {
+	tests := map[string]string{
+		`"never ends`:      `DQ("never ends")`,
+		"'never\nends":     `SQ("never\nends")`,
+		"`never\n":         "BQ(\"never\")",
+		"`unterminated\n":  "BQ(\"unterminated\")",
+		"<{ never }":       `XP("never }")`,
+		"<{ x \n":          `XP("x")`,
+		"<{ a\n  b\n    c": `XP("a\n  b\n    c")`,
+	}
+
+	for input, expect := range tests {
+		r := &Reader{
+			S: bufio.NewScanner(strings.NewReader(input)),
+		}
+
+		got, err := r.ReadToken()
+		if err == nil || err == io.EOF {
+			t.Errorf("ReadToken(%q) was %s, %v, but expected an error", input, got, err)
+		}
+
+		if got.String() != expect {
+			t.Errorf("ReadToken(%q) was %s, but expected %s", input, got, expect)
+		}
+	}
+}
+
+func TestIsSimpleXPath(t *testing.T) {
+	tests := map[string]bool{
+		"item":                 true,
+		".":                    true,
+		"/":                    true,
+		"//item/*":             true,
+		"ancestor::div/@class": true,
+		"../@xml:lang":         true,
+		"$var":                 true,
+		"":                     false,
+		"a:b":                  false,
+		"a:::b":                false,
+		"item[1]":              false,
+		"@a/b":                 false,
+		"@":                    false,
+		"$a::b":                false,
+		"count(item)":          false,
+		"a | b":                false,
+		"self::node()":         false,
+	}
+
+	for xpath, expect := range tests {
+		if got := IsSimpleXPath(xpath); got != expect {
+			t.Errorf("IsSimpleXPath(%q) = %v, expected %v", xpath, got, expect)
+		}
+	}
+}
+
+func TestKeepComments(t *testing.T) {
+	input := "# hash\nsub /* inline */ name // line\n/* multi\n   line */ /** doc */\n"
+
+	r := &Reader{
+		S:            bufio.NewScanner(strings.NewReader(input)),
+		KeepComments: true,
+	}
+
+	for {
+		if _, err := r.ReadToken(); err != nil {
+			if err != io.EOF {
+				t.Fatal("unexpected error:", err)
+			}
+			break
+		}
+	}
+
+	expect := []string{"# hash", "/* inline */", "// line", "/* multi\n   line */"}
+
+	if len(r.Comments) != len(expect) {
+		t.Fatalf("got %d comments, expected %d: %v", len(r.Comments), len(expect), r.Comments)
+	}
+
+	for i, c := range r.Comments {
+		if c.Text != expect[i] {
+			t.Errorf("comment %d was %q, expected %q", i, c.Text, expect[i])
+		}
+
+		if s := input[c.Pos.Offset:c.End.Offset]; s != c.Text {
+			t.Errorf("comment %d %q spans %q", i, c.Text, s)
+		}
+	}
+}
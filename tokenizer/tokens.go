@@ -7,12 +7,27 @@ import (
 type Token struct {
 	Type  TokenType
 	Value string
+
+	// Pos is the position of the first character of the token,
+	// and End is the position immediately after the last character of the token.
+	Pos Position
+	End Position
+
+	// ValuePos is the position at which the Value begins in the source,
+	// for tokens whose value is taken verbatim from the source, such as XPaths and back-quoted strings.
+	// Otherwise, it is the same as Pos.
+	ValuePos Position
 }
 
 func (t Token) String() string {
 	return fmt.Sprintf("%s(%q)", t.Type, t.Value)
 }
 
+// Is reports whether the token has the same type and value as the given token, regardless of position.
+func (t Token) Is(match Token) bool {
+	return t.Type == match.Type && t.Value == match.Value
+}
+
 // Sentinel and error values.
 var (
 	Empty = Token{Type: TokenTypeEmpty}
@@ -0,0 +1,328 @@
+// Package xpath implements a parser for XPath 1.0 expressions, and XSLT 1.0 patterns.
+package xpath
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Expr is an XPath expression.
+//
+// Pos and End are byte offsets into the source of the expression,
+// with End being the offset just after the expression.
+type Expr interface {
+	Pos() int
+	End() int
+
+	// String returns the expression as XPath source.
+	String() string
+}
+
+// QName is a qualified name, made of an optional prefix and a local name.
+type QName struct {
+	Prefix string
+	Local  string
+}
+
+func (q QName) String() string {
+	if q.Prefix == "" {
+		return q.Local
+	}
+
+	return q.Prefix + ":" + q.Local
+}
+
+// BinaryExpr is an expression with a binary operator.
+// This includes the union operator `|`, and the boolean operators `and` and `or`.
+type BinaryExpr struct {
+	X     Expr
+	OpPos int
+	Op    string
+	Y     Expr
+}
+
+// NegExpr is a unary minus expression.
+type NegExpr struct {
+	Minus int
+	X     Expr
+}
+
+// FilterExpr is a primary expression filtered by one or more predicates.
+type FilterExpr struct {
+	X          Expr
+	Predicates []Expr
+	EndPos     int
+}
+
+// PathExpr is a relative location path evaluated from the result of a filter expression.
+type PathExpr struct {
+	Filter Expr
+	Path   *LocationPath
+}
+
+// LocationPath is a sequence of location steps.
+//
+// A `//` is represented by an abbreviated step on the descendant-or-self axis,
+// in the position at which it appears.
+type LocationPath struct {
+	StartPos int
+	Absolute bool
+	Steps    []*Step
+	EndPos   int
+}
+
+// Axis names an XPath axis.
+type Axis string
+
+// The axes of XPath 1.0.
+const (
+	AxisAncestor         Axis = "ancestor"
+	AxisAncestorOrSelf   Axis = "ancestor-or-self"
+	AxisAttribute        Axis = "attribute"
+	AxisChild            Axis = "child"
+	AxisDescendant       Axis = "descendant"
+	AxisDescendantOrSelf Axis = "descendant-or-self"
+	AxisFollowing        Axis = "following"
+	AxisFollowingSibling Axis = "following-sibling"
+	AxisNamespace        Axis = "namespace"
+	AxisParent           Axis = "parent"
+	AxisPreceding        Axis = "preceding"
+	AxisPrecedingSibling Axis = "preceding-sibling"
+	AxisSelf             Axis = "self"
+)
+
+var axes = map[string]Axis{
+	"ancestor":           AxisAncestor,
+	"ancestor-or-self":   AxisAncestorOrSelf,
+	"attribute":          AxisAttribute,
+	"child":              AxisChild,
+	"descendant":         AxisDescendant,
+	"descendant-or-self": AxisDescendantOrSelf,
+	"following":          AxisFollowing,
+	"following-sibling":  AxisFollowingSibling,
+	"namespace":          AxisNamespace,
+	"parent":             AxisParent,
+	"preceding":          AxisPreceding,
+	"preceding-sibling":  AxisPrecedingSibling,
+	"self":               AxisSelf,
+}
+
+// Step is a single location step.
+//
+// Abbrev is set if the step was written in an abbreviated form:
+// `name` for a child step, `@name` for an attribute step, `.`, `..`, or `//`.
+type Step struct {
+	StartPos   int
+	Axis       Axis
+	Test       NodeTest
+	Predicates []Expr
+	Abbrev     bool
+	EndPos     int
+}
+
+// NodeTest is either a *NameTest or a *TypeTest.
+type NodeTest interface {
+	String() string
+}
+
+// NameTest tests the name of a node.
+// A Local name of `*` matches any name.
+type NameTest struct {
+	Name QName
+}
+
+// TypeTest tests the type of a node: `node()`, `text()`, `comment()`, or `processing-instruction()`.
+// For `processing-instruction("name")`, the Literal holds the name.
+type TypeTest struct {
+	Type    string
+	Literal *Literal
+}
+
+// VariableRef is a reference to a variable or parameter.
+type VariableRef struct {
+	Dollar int
+	Name   QName
+	EndPos int
+}
+
+// Literal is a string literal.
+type Literal struct {
+	ValuePos int
+	Value    string
+	EndPos   int
+}
+
+// Number is a numeric literal.
+type Number struct {
+	ValuePos int
+	Value    float64
+	EndPos   int
+}
+
+// FunctionCall is a call to a function.
+type FunctionCall struct {
+	NamePos int
+	Name    QName
+	Args    []Expr
+	EndPos  int
+}
+
+// ParenExpr is a parenthesized expression.
+type ParenExpr struct {
+	Lparen int
+	X      Expr
+	Rparen int
+}
+
+func (x *BinaryExpr) Pos() int   { return x.X.Pos() }
+func (x *NegExpr) Pos() int      { return x.Minus }
+func (x *FilterExpr) Pos() int   { return x.X.Pos() }
+func (x *PathExpr) Pos() int     { return x.Filter.Pos() }
+func (x *LocationPath) Pos() int { return x.StartPos }
+func (x *VariableRef) Pos() int  { return x.Dollar }
+func (x *Literal) Pos() int      { return x.ValuePos }
+func (x *Number) Pos() int       { return x.ValuePos }
+func (x *FunctionCall) Pos() int { return x.NamePos }
+func (x *ParenExpr) Pos() int    { return x.Lparen }
+
+func (x *BinaryExpr) End() int   { return x.Y.End() }
+func (x *NegExpr) End() int      { return x.X.End() }
+func (x *FilterExpr) End() int   { return x.EndPos }
+func (x *PathExpr) End() int     { return x.Path.End() }
+func (x *LocationPath) End() int { return x.EndPos }
+func (x *VariableRef) End() int  { return x.EndPos }
+func (x *Literal) End() int      { return x.EndPos }
+func (x *Number) End() int       { return x.EndPos }
+func (x *FunctionCall) End() int { return x.EndPos }
+func (x *ParenExpr) End() int    { return x.Rparen + 1 }
+
+func (x *BinaryExpr) String() string {
+	if x.Op == "|" {
+		return x.X.String() + "|" + x.Y.String()
+	}
+
+	return x.X.String() + " " + x.Op + " " + x.Y.String()
+}
+
+func (x *NegExpr) String() string {
+	return "-" + x.X.String()
+}
+
+func (x *FilterExpr) String() string {
+	return x.X.String() + predicates(x.Predicates)
+}
+
+func (x *PathExpr) String() string {
+	path := x.Path.String()
+
+	if strings.HasPrefix(path, "//") {
+		return x.Filter.String() + path
+	}
+
+	return x.Filter.String() + "/" + path
+}
+
+func (x *LocationPath) String() string {
+	var b strings.Builder
+
+	if x.Absolute {
+		b.WriteByte('/')
+	}
+
+	for i, step := range x.Steps {
+		if step.isDoubleSlash() {
+			if i == 0 && x.Absolute {
+				// The `/` has already been written.
+				b.WriteByte('/')
+				continue
+			}
+
+			b.WriteString("//")
+			continue
+		}
+
+		if i > 0 && !x.Steps[i-1].isDoubleSlash() {
+			b.WriteByte('/')
+		}
+
+		b.WriteString(step.String())
+	}
+
+	return b.String()
+}
+
+func (s *Step) isDoubleSlash() bool {
+	return s.Abbrev && s.Axis == AxisDescendantOrSelf
+}
+
+func (s *Step) String() string {
+	if s.Abbrev {
+		switch s.Axis {
+		case AxisSelf:
+			return "."
+		case AxisParent:
+			return ".."
+		case AxisDescendantOrSelf:
+			return "//"
+		case AxisAttribute:
+			return "@" + s.Test.String() + predicates(s.Predicates)
+		}
+
+		return s.Test.String() + predicates(s.Predicates)
+	}
+
+	return string(s.Axis) + "::" + s.Test.String() + predicates(s.Predicates)
+}
+
+func (t *NameTest) String() string {
+	return t.Name.String()
+}
+
+func (t *TypeTest) String() string {
+	if t.Literal != nil {
+		return t.Type + "(" + t.Literal.String() + ")"
+	}
+
+	return t.Type + "()"
+}
+
+func (x *VariableRef) String() string {
+	return "$" + x.Name.String()
+}
+
+func (x *Literal) String() string {
+	if strings.ContainsRune(x.Value, '"') {
+		return "'" + x.Value + "'"
+	}
+
+	return `"` + x.Value + `"`
+}
+
+func (x *Number) String() string {
+	return strconv.FormatFloat(x.Value, 'f', -1, 64)
+}
+
+func (x *FunctionCall) String() string {
+	args := make([]string, len(x.Args))
+	for i, arg := range x.Args {
+		args[i] = arg.String()
+	}
+
+	return x.Name.String() + "(" + strings.Join(args, ", ") + ")"
+}
+
+func (x *ParenExpr) String() string {
+	return "(" + x.X.String() + ")"
+}
+
+func predicates(preds []Expr) string {
+	var b strings.Builder
+
+	for _, pred := range preds {
+		b.WriteByte('[')
+		b.WriteString(pred.String())
+		b.WriteByte(']')
+	}
+
+	return b.String()
+}
@@ -0,0 +1,384 @@
+package xpath
+
+import (
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokLParen
+	tokRParen
+	tokLBracket
+	tokRBracket
+	tokDot
+	tokDotDot
+	tokAt
+	tokComma
+	tokColonColon
+	tokNameTest
+	tokNodeType
+	tokOperator
+	tokFunctionName
+	tokAxisName
+	tokLiteral
+	tokNumber
+	tokVariable
+)
+
+func (k tokenKind) String() string {
+	switch k {
+	case tokEOF:
+		return "end of expression"
+	case tokNameTest:
+		return "name test"
+	case tokNodeType:
+		return "node type"
+	case tokOperator:
+		return "operator"
+	case tokFunctionName:
+		return "function name"
+	case tokAxisName:
+		return "axis name"
+	case tokLiteral:
+		return "string literal"
+	case tokNumber:
+		return "number"
+	case tokVariable:
+		return "variable reference"
+	}
+
+	return "punctuation"
+}
+
+type token struct {
+	kind  tokenKind
+	value string
+	pos   int
+	end   int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return t.kind.String()
+	case tokLiteral:
+		return fmt.Sprintf("%s %q", t.kind, t.value)
+	}
+
+	return fmt.Sprintf("%q", t.value)
+}
+
+var nodeTypes = map[string]bool{
+	"comment":                true,
+	"text":                   true,
+	"processing-instruction": true,
+	"node":                   true,
+}
+
+var operatorNames = map[string]bool{
+	"and": true,
+	"or":  true,
+	"mod": true,
+	"div": true,
+}
+
+type lexer struct {
+	src  string
+	off  int
+	toks []token
+}
+
+// lex splits the source into tokens, applying the disambiguation rules of XPath 1.0, section 3.7.
+func lex(src string) ([]token, error) {
+	l := &lexer{
+		src: src,
+	}
+
+	for {
+		tok, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+
+		l.toks = append(l.toks, tok)
+
+		if tok.kind == tokEOF {
+			return l.toks, nil
+		}
+	}
+}
+
+// operatorContext reports whether a `*` or name at this point must be an operator,
+// according to the preceding token.
+func (l *lexer) operatorContext() bool {
+	if len(l.toks) == 0 {
+		return false
+	}
+
+	switch prev := l.toks[len(l.toks)-1]; prev.kind {
+	case tokAt, tokColonColon, tokLParen, tokLBracket, tokComma, tokOperator:
+		return false
+	}
+
+	return true
+}
+
+func (l *lexer) peekRune(off int) rune {
+	if off >= len(l.src) {
+		return -1
+	}
+
+	r, _ := utf8.DecodeRuneInString(l.src[off:])
+	return r
+}
+
+func (l *lexer) skipSpace(off int) int {
+	for off < len(l.src) {
+		switch l.src[off] {
+		case ' ', '\t', '\r', '\n':
+			off++
+			continue
+		}
+		break
+	}
+
+	return off
+}
+
+func (l *lexer) next() (token, error) {
+	l.off = l.skipSpace(l.off)
+	start := l.off
+
+	tok := func(kind tokenKind, n int) (token, error) {
+		l.off += n
+		return token{
+			kind:  kind,
+			value: l.src[start:l.off],
+			pos:   start,
+			end:   l.off,
+		}, nil
+	}
+
+	if l.off >= len(l.src) {
+		return tok(tokEOF, 0)
+	}
+
+	c := l.src[l.off]
+	switch c {
+	case '(':
+		return tok(tokLParen, 1)
+	case ')':
+		return tok(tokRParen, 1)
+	case '[':
+		return tok(tokLBracket, 1)
+	case ']':
+		return tok(tokRBracket, 1)
+	case '@':
+		return tok(tokAt, 1)
+	case ',':
+		return tok(tokComma, 1)
+
+	case ':':
+		if l.peekRune(l.off+1) == ':' {
+			return tok(tokColonColon, 2)
+		}
+
+	case '.':
+		if l.peekRune(l.off+1) == '.' {
+			return tok(tokDotDot, 2)
+		}
+
+		if isDigit(l.peekRune(l.off + 1)) {
+			return l.number()
+		}
+
+		return tok(tokDot, 1)
+
+	case '/':
+		if l.peekRune(l.off+1) == '/' {
+			return tok(tokOperator, 2)
+		}
+		return tok(tokOperator, 1)
+
+	case '|', '+', '-', '=':
+		return tok(tokOperator, 1)
+
+	case '!':
+		if l.peekRune(l.off+1) == '=' {
+			return tok(tokOperator, 2)
+		}
+
+	case '<', '>':
+		if l.peekRune(l.off+1) == '=' {
+			return tok(tokOperator, 2)
+		}
+		return tok(tokOperator, 1)
+
+	case '*':
+		if l.operatorContext() {
+			return tok(tokOperator, 1)
+		}
+		return tok(tokNameTest, 1)
+
+	case '"', '\'':
+		end := l.off + 1
+		for end < len(l.src) && l.src[end] != c {
+			end++
+		}
+
+		if end >= len(l.src) {
+			return token{}, errorf(start, "unterminated string literal")
+		}
+
+		l.off = end + 1
+		return token{
+			kind:  tokLiteral,
+			value: l.src[start+1 : end],
+			pos:   start,
+			end:   l.off,
+		}, nil
+
+	case '$':
+		l.off++
+
+		name, ok := l.qname(false)
+		if !ok {
+			return token{}, errorf(start, "expected variable name after '$'")
+		}
+
+		return token{
+			kind:  tokVariable,
+			value: name,
+			pos:   start,
+			end:   l.off,
+		}, nil
+	}
+
+	if isDigit(rune(c)) {
+		return l.number()
+	}
+
+	if name, ok := l.qname(true); ok {
+		return l.classifyName(start, name)
+	}
+
+	r, _ := utf8.DecodeRuneInString(l.src[l.off:])
+	return token{}, errorf(start, "unexpected character %q", r)
+}
+
+func (l *lexer) number() (token, error) {
+	start := l.off
+
+	for isDigit(l.peekRune(l.off)) {
+		l.off++
+	}
+
+	if l.peekRune(l.off) == '.' {
+		l.off++
+
+		for isDigit(l.peekRune(l.off)) {
+			l.off++
+		}
+	}
+
+	return token{
+		kind:  tokNumber,
+		value: l.src[start:l.off],
+		pos:   start,
+		end:   l.off,
+	}, nil
+}
+
+// classifyName determines the kind of token of a name that has already been read.
+func (l *lexer) classifyName(start int, name string) (token, error) {
+	tok := token{
+		value: name,
+		pos:   start,
+		end:   l.off,
+	}
+
+	if l.operatorContext() {
+		if !operatorNames[name] {
+			return token{}, errorf(start, "expected operator, found %q", name)
+		}
+
+		tok.kind = tokOperator
+		return tok, nil
+	}
+
+	next := l.skipSpace(l.off)
+
+	switch {
+	case l.peekRune(next) == '(':
+		tok.kind = tokFunctionName
+		if nodeTypes[name] {
+			tok.kind = tokNodeType
+		}
+
+	case l.peekRune(next) == ':' && l.peekRune(next+1) == ':':
+		tok.kind = tokAxisName
+
+	default:
+		tok.kind = tokNameTest
+	}
+
+	return tok, nil
+}
+
+// qname reads a QName at the current offset.
+// If wildcard is true, then a name test of the form `prefix:*` is also accepted.
+func (l *lexer) qname(wildcard bool) (string, bool) {
+	start := l.off
+
+	if !l.ncname() {
+		return "", false
+	}
+
+	if l.peekRune(l.off) == ':' {
+		switch next := l.peekRune(l.off + 1); {
+		case next == '*' && wildcard:
+			l.off += 2
+
+		case isNameStart(next):
+			l.off++
+			l.ncname()
+		}
+	}
+
+	return l.src[start:l.off], true
+}
+
+func (l *lexer) ncname() bool {
+	r := l.peekRune(l.off)
+	if !isNameStart(r) {
+		return false
+	}
+
+	for isNameChar(r) {
+		l.off += utf8.RuneLen(r)
+		r = l.peekRune(l.off)
+	}
+
+	return true
+}
+
+func isDigit(r rune) bool {
+	return '0' <= r && r <= '9'
+}
+
+func isNameStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func isNameChar(r rune) bool {
+	switch r {
+	case '-', '.', '_', 0xB7:
+		return true
+	}
+
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.In(r, unicode.Mn, unicode.Mc)
+}
@@ -0,0 +1,568 @@
+package xpath
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Error is a syntax error in an XPath expression or pattern.
+// The Offset is the byte offset into the source at which the error was found.
+type Error struct {
+	Offset int
+	Msg    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("xpath: offset %d: %s", e.Offset, e.Msg)
+}
+
+func errorf(off int, f string, args ...interface{}) error {
+	return &Error{
+		Offset: off,
+		Msg:    fmt.Sprintf(f, args...),
+	}
+}
+
+type parser struct {
+	toks []token
+	i    int
+}
+
+// Parse parses the given source as an XPath 1.0 expression.
+// Any error returned is an *Error.
+func Parse(src string) (Expr, error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{
+		toks: toks,
+	}
+
+	if p.peek().kind == tokEOF {
+		return nil, errorf(0, "empty expression")
+	}
+
+	expr, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, p.unexpected(tok)
+	}
+
+	return expr, nil
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.i]
+}
+
+func (p *parser) next() token {
+	tok := p.toks[p.i]
+	if tok.kind != tokEOF {
+		p.i++
+	}
+	return tok
+}
+
+func (p *parser) isOp(ops ...string) bool {
+	tok := p.peek()
+	if tok.kind != tokOperator {
+		return false
+	}
+
+	for _, op := range ops {
+		if tok.value == op {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *parser) unexpected(tok token) error {
+	return errorf(tok.pos, "unexpected %s", tok)
+}
+
+func (p *parser) expect(kind tokenKind, what string) (token, error) {
+	tok := p.peek()
+	if tok.kind != kind {
+		return tok, errorf(tok.pos, "expected %s, found %s", what, tok)
+	}
+
+	return p.next(), nil
+}
+
+func (p *parser) expr() (Expr, error) {
+	return p.binary(0)
+}
+
+// precedence lists the binary operators, from the lowest precedence to the highest.
+var precedence = [][]string{
+	{"or"},
+	{"and"},
+	{"=", "!="},
+	{"<", ">", "<=", ">="},
+	{"+", "-"},
+	{"*", "div", "mod"},
+}
+
+func (p *parser) binary(level int) (Expr, error) {
+	if level >= len(precedence) {
+		return p.unary()
+	}
+
+	x, err := p.binary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isOp(precedence[level]...) {
+		op := p.next()
+
+		y, err := p.binary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+
+		x = &BinaryExpr{
+			X:     x,
+			OpPos: op.pos,
+			Op:    op.value,
+			Y:     y,
+		}
+	}
+
+	return x, nil
+}
+
+func (p *parser) unary() (Expr, error) {
+	if p.isOp("-") {
+		minus := p.next()
+
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+
+		return &NegExpr{
+			Minus: minus.pos,
+			X:     x,
+		}, nil
+	}
+
+	return p.union()
+}
+
+func (p *parser) union() (Expr, error) {
+	x, err := p.path()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isOp("|") {
+		op := p.next()
+
+		y, err := p.path()
+		if err != nil {
+			return nil, err
+		}
+
+		x = &BinaryExpr{
+			X:     x,
+			OpPos: op.pos,
+			Op:    op.value,
+			Y:     y,
+		}
+	}
+
+	return x, nil
+}
+
+func (p *parser) path() (Expr, error) {
+	switch tok := p.peek(); tok.kind {
+	case tokVariable, tokLParen, tokLiteral, tokNumber, tokFunctionName:
+	default:
+		return p.locationPath()
+	}
+
+	filter, err := p.filter()
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.isOp("/", "//") {
+		return filter, nil
+	}
+
+	path := &LocationPath{
+		StartPos: p.peek().pos,
+	}
+
+	if err := p.relativePath(path); err != nil {
+		return nil, err
+	}
+
+	return &PathExpr{
+		Filter: filter,
+		Path:   path,
+	}, nil
+}
+
+func (p *parser) filter() (Expr, error) {
+	x, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+
+	preds, err := p.predicates()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(preds) == 0 {
+		return x, nil
+	}
+
+	return &FilterExpr{
+		X:          x,
+		Predicates: preds,
+		EndPos:     p.toks[p.i-1].end,
+	}, nil
+}
+
+func (p *parser) primary() (Expr, error) {
+	tok := p.next()
+
+	switch tok.kind {
+	case tokVariable:
+		return &VariableRef{
+			Dollar: tok.pos,
+			Name:   splitQName(tok.value),
+			EndPos: tok.end,
+		}, nil
+
+	case tokLiteral:
+		return &Literal{
+			ValuePos: tok.pos,
+			Value:    tok.value,
+			EndPos:   tok.end,
+		}, nil
+
+	case tokNumber:
+		f, err := strconv.ParseFloat(tok.value, 64)
+		if err != nil {
+			return nil, errorf(tok.pos, "bad number %q", tok.value)
+		}
+
+		return &Number{
+			ValuePos: tok.pos,
+			Value:    f,
+			EndPos:   tok.end,
+		}, nil
+
+	case tokLParen:
+		x, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+
+		rparen, err := p.expect(tokRParen, "')'")
+		if err != nil {
+			return nil, err
+		}
+
+		return &ParenExpr{
+			Lparen: tok.pos,
+			X:      x,
+			Rparen: rparen.pos,
+		}, nil
+
+	case tokFunctionName:
+		return p.functionCall(tok)
+	}
+
+	return nil, p.unexpected(tok)
+}
+
+func (p *parser) functionCall(name token) (Expr, error) {
+	call := &FunctionCall{
+		NamePos: name.pos,
+		Name:    splitQName(name.value),
+	}
+
+	if _, err := p.expect(tokLParen, "'('"); err != nil {
+		return nil, err
+	}
+
+	if tok := p.peek(); tok.kind == tokRParen {
+		call.EndPos = p.next().end
+		return call, nil
+	}
+
+	for {
+		arg, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+
+		call.Args = append(call.Args, arg)
+
+		tok := p.next()
+		switch tok.kind {
+		case tokComma:
+			continue
+
+		case tokRParen:
+			call.EndPos = tok.end
+			return call, nil
+		}
+
+		return nil, errorf(tok.pos, "expected ',' or ')', found %s", tok)
+	}
+}
+
+func (p *parser) predicates() ([]Expr, error) {
+	var preds []Expr
+
+	for p.peek().kind == tokLBracket {
+		p.next()
+
+		pred, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := p.expect(tokRBracket, "']'"); err != nil {
+			return nil, err
+		}
+
+		preds = append(preds, pred)
+	}
+
+	return preds, nil
+}
+
+func (p *parser) locationPath() (Expr, error) {
+	path := &LocationPath{
+		StartPos: p.peek().pos,
+	}
+
+	switch {
+	case p.isOp("/"):
+		p.next()
+		path.Absolute = true
+		path.EndPos = path.StartPos + 1
+
+		if !p.startsStep() {
+			// The root node by itself.
+			return path, nil
+		}
+
+		if err := p.steps(path); err != nil {
+			return nil, err
+		}
+
+		return path, nil
+
+	case p.isOp("//"):
+		path.Absolute = true
+
+		if err := p.relativePath(path); err != nil {
+			return nil, err
+		}
+
+		return path, nil
+	}
+
+	if !p.startsStep() {
+		return nil, p.unexpected(p.peek())
+	}
+
+	if err := p.steps(path); err != nil {
+		return nil, err
+	}
+
+	return path, nil
+}
+
+// relativePath parses a relative location path that begins with a `/` or `//`.
+// A leading `/` is skipped, and a leading `//` is added as a step.
+func (p *parser) relativePath(path *LocationPath) error {
+	if p.isOp("/") {
+		p.next()
+	} else {
+		op := p.next()
+		path.Steps = append(path.Steps, doubleSlash(op))
+	}
+
+	return p.steps(path)
+}
+
+func doubleSlash(op token) *Step {
+	return &Step{
+		StartPos: op.pos,
+		Axis:     AxisDescendantOrSelf,
+		Test: &TypeTest{
+			Type: "node",
+		},
+		Abbrev: true,
+		EndPos: op.end,
+	}
+}
+
+func (p *parser) startsStep() bool {
+	switch p.peek().kind {
+	case tokNameTest, tokNodeType, tokAxisName, tokAt, tokDot, tokDotDot:
+		return true
+	}
+
+	return false
+}
+
+// steps parses a sequence of steps separated by `/` or `//` into the given path.
+func (p *parser) steps(path *LocationPath) error {
+	for {
+		step, err := p.step()
+		if err != nil {
+			return err
+		}
+
+		path.Steps = append(path.Steps, step)
+		path.EndPos = step.EndPos
+
+		switch {
+		case p.isOp("/"):
+			p.next()
+
+		case p.isOp("//"):
+			path.Steps = append(path.Steps, doubleSlash(p.next()))
+
+		default:
+			return nil
+		}
+	}
+}
+
+func (p *parser) step() (*Step, error) {
+	tok := p.peek()
+
+	step := &Step{
+		StartPos: tok.pos,
+		Axis:     AxisChild,
+		Abbrev:   true,
+	}
+
+	switch tok.kind {
+	case tokDot, tokDotDot:
+		p.next()
+
+		step.Axis = AxisSelf
+		if tok.kind == tokDotDot {
+			step.Axis = AxisParent
+		}
+
+		step.Test = &TypeTest{
+			Type: "node",
+		}
+		step.EndPos = tok.end
+
+		if p.peek().kind == tokLBracket {
+			return nil, errorf(p.peek().pos, "predicates are not allowed after %q", tok.value)
+		}
+
+		return step, nil
+
+	case tokAt:
+		p.next()
+		step.Axis = AxisAttribute
+
+	case tokAxisName:
+		p.next()
+
+		axis, ok := axes[tok.value]
+		if !ok {
+			return nil, errorf(tok.pos, "unknown axis %q", tok.value)
+		}
+
+		step.Axis = axis
+		step.Abbrev = false
+
+		if _, err := p.expect(tokColonColon, "'::'"); err != nil {
+			return nil, err
+		}
+	}
+
+	test, err := p.nodeTest()
+	if err != nil {
+		return nil, err
+	}
+	step.Test = test
+
+	step.Predicates, err = p.predicates()
+	if err != nil {
+		return nil, err
+	}
+
+	step.EndPos = p.toks[p.i-1].end
+
+	return step, nil
+}
+
+func (p *parser) nodeTest() (NodeTest, error) {
+	tok := p.next()
+
+	switch tok.kind {
+	case tokNameTest:
+		return &NameTest{
+			Name: splitQName(tok.value),
+		}, nil
+
+	case tokNodeType:
+		test := &TypeTest{
+			Type: tok.value,
+		}
+
+		if _, err := p.expect(tokLParen, "'('"); err != nil {
+			return nil, err
+		}
+
+		if tok.value == "processing-instruction" && p.peek().kind == tokLiteral {
+			lit := p.next()
+
+			test.Literal = &Literal{
+				ValuePos: lit.pos,
+				Value:    lit.value,
+				EndPos:   lit.end,
+			}
+		}
+
+		if _, err := p.expect(tokRParen, "')'"); err != nil {
+			return nil, err
+		}
+
+		return test, nil
+
+	case tokFunctionName:
+		return nil, errorf(tok.pos, "expected node test, found function call %q", tok.value)
+	}
+
+	return nil, errorf(tok.pos, "expected node test, found %s", tok)
+}
+
+func splitQName(s string) QName {
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		return QName{
+			Prefix: s[:i],
+			Local:  s[i+1:],
+		}
+	}
+
+	return QName{
+		Local: s,
+	}
+}
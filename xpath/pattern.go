@@ -0,0 +1,140 @@
+package xpath
+
+// ParsePattern parses the given source as an XSLT 1.0 pattern, as used by the match of a template.
+// Any error returned is an *Error.
+//
+// A pattern is an expression restricted to a union of location paths,
+// which may only use the child and attribute axes, and `//`,
+// and which may begin with a call to `id()` or `key()` with literal arguments.
+// A pattern may not refer to any variables, not even within its predicates.
+func ParsePattern(src string) (Expr, error) {
+	expr, err := Parse(src)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkPattern(expr); err != nil {
+		return nil, err
+	}
+
+	if err := checkVariables(expr, "a pattern"); err != nil {
+		return nil, err
+	}
+
+	return expr, nil
+}
+
+// ParseKeyUse parses the given source as the use expression of an XSLT 1.0 key.
+// Any error returned is an *Error.
+//
+// As with a pattern, the expression may not refer to any variables.
+func ParseKeyUse(src string) (Expr, error) {
+	expr, err := Parse(src)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkVariables(expr, "the use of a key"); err != nil {
+		return nil, err
+	}
+
+	return expr, nil
+}
+
+// checkVariables returns an error at the first variable reference within the expression.
+func checkVariables(expr Expr, where string) error {
+	var ref *VariableRef
+
+	Inspect(expr, func(expr Expr) bool {
+		if ref == nil {
+			ref, _ = expr.(*VariableRef)
+		}
+
+		return ref == nil
+	})
+
+	if ref != nil {
+		return errorf(ref.Pos(), "variable %s is not allowed in %s", ref, where)
+	}
+
+	return nil
+}
+
+func checkPattern(expr Expr) error {
+	switch x := expr.(type) {
+	case *BinaryExpr:
+		if x.Op != "|" {
+			return errorf(x.OpPos, "operator %q is not allowed in a pattern", x.Op)
+		}
+
+		if err := checkPattern(x.X); err != nil {
+			return err
+		}
+
+		return checkPattern(x.Y)
+
+	case *LocationPath:
+		return checkPatternSteps(x)
+
+	case *FunctionCall:
+		return checkIDKeyPattern(x)
+
+	case *PathExpr:
+		call, ok := x.Filter.(*FunctionCall)
+		if !ok {
+			return errorf(x.Pos(), "a pattern may only begin with a location path, id(), or key()")
+		}
+
+		if err := checkIDKeyPattern(call); err != nil {
+			return err
+		}
+
+		return checkPatternSteps(x.Path)
+	}
+
+	return errorf(expr.Pos(), "a pattern must be a location path, found %s", expr)
+}
+
+func checkIDKeyPattern(call *FunctionCall) error {
+	var nargs int
+
+	switch call.Name {
+	case QName{Local: "id"}:
+		nargs = 1
+	case QName{Local: "key"}:
+		nargs = 2
+	default:
+		return errorf(call.Pos(), "function %s() is not allowed in a pattern, only id() and key()", call.Name)
+	}
+
+	if len(call.Args) != nargs {
+		return errorf(call.Pos(), "%s() in a pattern takes %d literal arguments", call.Name, nargs)
+	}
+
+	for _, arg := range call.Args {
+		if _, ok := arg.(*Literal); !ok {
+			return errorf(arg.Pos(), "%s() in a pattern takes only literal arguments", call.Name)
+		}
+	}
+
+	return nil
+}
+
+func checkPatternSteps(path *LocationPath) error {
+	for _, step := range path.Steps {
+		switch step.Axis {
+		case AxisChild, AxisAttribute:
+		case AxisDescendantOrSelf:
+			if step.Abbrev {
+				// This is a `//`.
+				continue
+			}
+			fallthrough
+
+		default:
+			return errorf(step.StartPos, "the %s axis is not allowed in a pattern", step.Axis)
+		}
+	}
+
+	return nil
+}
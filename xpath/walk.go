@@ -0,0 +1,43 @@
+package xpath
+
+// Inspect traverses the given expression and all of its subexpressions depth-first, calling fn for each expression.
+// If fn returns false, then the subexpressions of that expression are not visited.
+func Inspect(expr Expr, fn func(expr Expr) bool) {
+	if expr == nil || !fn(expr) {
+		return
+	}
+
+	switch x := expr.(type) {
+	case *BinaryExpr:
+		Inspect(x.X, fn)
+		Inspect(x.Y, fn)
+
+	case *NegExpr:
+		Inspect(x.X, fn)
+
+	case *ParenExpr:
+		Inspect(x.X, fn)
+
+	case *FilterExpr:
+		Inspect(x.X, fn)
+		for _, pred := range x.Predicates {
+			Inspect(pred, fn)
+		}
+
+	case *PathExpr:
+		Inspect(x.Filter, fn)
+		Inspect(x.Path, fn)
+
+	case *LocationPath:
+		for _, step := range x.Steps {
+			for _, pred := range step.Predicates {
+				Inspect(pred, fn)
+			}
+		}
+
+	case *FunctionCall:
+		for _, arg := range x.Args {
+			Inspect(arg, fn)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package xpath
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	type test struct {
+		src    string
+		expect string
+	}
+
+	tests := []test{
+		{"/", "/"},
+		{"//item", "//item"},
+		{"@date", "@date"},
+		{"$title", "$title"},
+		{".", "."},
+		{"../@id", "../@id"},
+		{"*", "*"},
+		{"xsl:*", "xsl:*"},
+		{"a/b//c", "a/b//c"},
+		{"child::para[position() = 1]", "child::para[position() = 1]"},
+		{"count(item) * 2", "count(item) * 2"},
+		{"2*3", "2 * 3"},
+		{"a*b", "a * b"},
+		{"-1 - -x", "-1 - -x"},
+		{"a | b | @c", "a|b|@c"},
+		{"1 + 2 * 3 = 7 and not(false())", "1 + 2 * 3 = 7 and not(false())"},
+		{"$x//a[1]", "$x//a[1]"},
+		{"($x)[2]/b", "($x)[2]/b"},
+		{"text() | comment() | processing-instruction('pi')", `text()|comment()|processing-instruction("pi")`},
+		{"div div div", "div div div"},
+		{"concat('a', \"b\", 'c\"')", `concat("a", "b", 'c"')`},
+		{".5 + 1.", "0.5 + 1"},
+		{"ancestor-or-self::node()[@lang][1]", "ancestor-or-self::node()[@lang][1]"},
+	}
+
+	for _, tt := range tests {
+		expr, err := Parse(tt.src)
+		if err != nil {
+			t.Errorf("Parse(%q): unexpected error: %v", tt.src, err)
+			continue
+		}
+
+		if got := expr.String(); got != tt.expect {
+			t.Errorf("Parse(%q) = %q, expected %q", tt.src, got, tt.expect)
+		}
+
+		if expr.Pos() != 0 {
+			t.Errorf("Parse(%q).Pos() = %d, expected 0", tt.src, expr.Pos())
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	type test struct {
+		src    string
+		offset int
+	}
+
+	tests := []test{
+		{"", 0},
+		{"count(item", 10},
+		{"a[1", 3},
+		{"'abc", 0},
+		{"a b", 2},
+		{"a +", 3},
+		{"foo::bar", 0},
+		{"$", 0},
+		{"a # b", 2},
+		{"./[1]", 2},
+		{"..[1]", 2},
+	}
+
+	for _, tt := range tests {
+		_, err := Parse(tt.src)
+
+		var xerr *Error
+		if !errors.As(err, &xerr) {
+			t.Errorf("Parse(%q): expected an *Error, got %v", tt.src, err)
+			continue
+		}
+
+		if xerr.Offset != tt.offset {
+			t.Errorf("Parse(%q): error at offset %d, expected %d: %v", tt.src, xerr.Offset, tt.offset, err)
+		}
+	}
+}
+
+func TestParsePattern(t *testing.T) {
+	valid := []string{
+		"/",
+		"item",
+		"//item",
+		"a/b//c[@id]",
+		"@*",
+		"child::a | attribute::b",
+		"id('x')/a",
+		"key('k', 'v')//b",
+		"text()",
+		"node()",
+	}
+
+	for _, src := range valid {
+		if _, err := ParsePattern(src); err != nil {
+			t.Errorf("ParsePattern(%q): unexpected error: %v", src, err)
+		}
+	}
+
+	invalid := []string{
+		".",
+		"../a",
+		"ancestor::a",
+		"descendant-or-self::node()/a",
+		"a = b",
+		"$x",
+		"count(a)",
+		"key('k', $v)",
+		"$x/a",
+		"item[$x]",
+		"a/b[@id = $x]",
+		"a | b[c[. = $x]]",
+	}
+
+	for _, src := range invalid {
+		if _, err := ParsePattern(src); err == nil {
+			t.Errorf("ParsePattern(%q): expected an error", src)
+		}
+	}
+}
+
+func TestInspect(t *testing.T) {
+	expr, err := Parse("$a + count(item[@x = $b]) | $c/d[$d]")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var vars []string
+	Inspect(expr, func(expr Expr) bool {
+		if v, ok := expr.(*VariableRef); ok {
+			vars = append(vars, v.Name.String())
+		}
+		return true
+	})
+
+	expect := []string{"a", "b", "c", "d"}
+	if len(vars) != len(expect) {
+		t.Fatalf("found variables %v, expected %v", vars, expect)
+	}
+
+	for i := range expect {
+		if vars[i] != expect[i] {
+			t.Errorf("variable %d was %q, expected %q", i, vars[i], expect[i])
+		}
+	}
+}
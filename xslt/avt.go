@@ -0,0 +1,33 @@
+package xslt
+
+import (
+	"strings"
+)
+
+// avtEscaper escapes the braces of literal text within an attribute value template.
+var avtEscaper = strings.NewReplacer("{", "{{", "}", "}}")
+
+// EscapeAVT escapes the braces of the literal text, so that it can be used within an attribute value template.
+func EscapeAVT(s string) string {
+	return avtEscaper.Replace(s)
+}
+
+// AVTExprEnd returns the index of the '}' ending the expression of an attribute value template starting at index i,
+// skipping over any string literals, or -1 if the expression is not terminated.
+func AVTExprEnd(s string, i int) int {
+	for ; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '}':
+			return i
+
+		case '"', '\'':
+			end := strings.IndexByte(s[i+1:], c)
+			if end < 0 {
+				return -1
+			}
+			i += end + 1
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,27 @@
+package xslt
+
+import (
+	"testing"
+)
+
+func TestAVTExprEnd(t *testing.T) {
+	tests := map[string]int{
+		"{a}":              2,
+		"{concat('}', b)}": 15,
+		`{"}"}`:            4,
+		"{a":               -1,
+		"{'}":              -1,
+	}
+
+	for s, expect := range tests {
+		if got := AVTExprEnd(s, 1); got != expect {
+			t.Errorf("AVTExprEnd(%q, 1) = %d, expected %d", s, got, expect)
+		}
+	}
+}
+
+func TestEscapeAVT(t *testing.T) {
+	if got, expect := EscapeAVT("a {b} }c{"), "a {{b}} }}c{{"; got != expect {
+		t.Errorf("EscapeAVT gave %q, expected %q", got, expect)
+	}
+}
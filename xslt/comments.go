@@ -0,0 +1,22 @@
+package xslt
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+// Comment is an XML comment node emitted into the stylesheet itself.
+type Comment struct {
+	Body string
+}
+
+func (c *Comment) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
+	body := c.Body
+
+	// XML comments may not contain a double-hyphen, nor end with a hyphen.
+	for strings.Contains(body, "--") {
+		body = strings.ReplaceAll(body, "--", "- -")
+	}
+
+	return e.EncodeToken(xml.Comment(" " + body + " "))
+}
@@ -0,0 +1,1053 @@
+package xslt
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// NamespaceXSL is the namespace URI of XSLT elements.
+const NamespaceXSL = "http://www.w3.org/1999/XSL/Transform"
+
+// Location is the position of an element within an XSLT source document.
+type Location struct {
+	Line, Column int
+}
+
+func (l Location) String() string {
+	return fmt.Sprintf("%d:%d", l.Line, l.Column)
+}
+
+// Decoder reads an XSLT stylesheet into the types of this package.
+//
+// Any element that has no corresponding type, or which uses attributes that the type cannot represent,
+// is decoded as an *Unsupported, so that nothing in the source is lost.
+type Decoder struct {
+	d *xml.Decoder
+
+	// Locations maps each value decoded from an element to the location of that element in the source.
+	Locations map[interface{}]Location
+
+	xsl *Stylesheet
+
+	// rootNS are the namespaces declared on the stylesheet element, including any that were hoisted to it.
+	rootNS map[string]string
+
+	// seenStatement is set once any top-level element other than an import or comment has been decoded.
+	seenStatement bool
+}
+
+// NewDecoder returns a new Decoder that reads from the given io.Reader.
+func NewDecoder(r io.Reader) *Decoder {
+	d := xml.NewDecoder(r)
+	d.Strict = true
+
+	return &Decoder{
+		d:         d,
+		Locations: make(map[interface{}]Location),
+	}
+}
+
+// node is an element of the source document.
+type node struct {
+	loc Location
+
+	prefix, local string
+	space         string // the namespace URI
+
+	attrs []xml.Attr // with the prefix as the Name.Space
+	ns    []xml.Attr // the namespace declarations, with the prefix as the Name.Local
+
+	// children are each one of *node, xml.CharData, or xml.Comment.
+	children []interface{}
+
+	// preserve is set if whitespace-only text must be preserved, as by xml:space="preserve".
+	preserve bool
+
+	parent *node
+}
+
+func (n *node) qname() string {
+	if n.prefix == "" {
+		return n.local
+	}
+
+	return n.prefix + ":" + n.local
+}
+
+func (n *node) is(local string) bool {
+	return n.space == NamespaceXSL && n.local == local
+}
+
+func (n *node) lookup(prefix string) (string, bool) {
+	if prefix == "xml" {
+		return "http://www.w3.org/XML/1998/namespace", true
+	}
+
+	for ; n != nil; n = n.parent {
+		for _, ns := range n.ns {
+			if ns.Name.Local == prefix {
+				return ns.Value, true
+			}
+		}
+	}
+
+	return "", prefix == ""
+}
+
+// attr returns the value of the unprefixed attribute with the given name.
+func (n *node) attr(name string) string {
+	for _, attr := range n.attrs {
+		if attr.Name.Space == "" && attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+
+	return ""
+}
+
+// only reports whether the node has no attributes other than the given unprefixed names,
+// or xml:space, which is handled by the Decoder.
+func (n *node) only(names ...string) bool {
+outer:
+	for _, attr := range n.attrs {
+		if attr.Name.Space == "xml" && attr.Name.Local == "space" {
+			continue
+		}
+
+		if attr.Name.Space == "" {
+			for _, name := range names {
+				if attr.Name.Local == name {
+					continue outer
+				}
+			}
+		}
+
+		return false
+	}
+
+	return true
+}
+
+// attrName returns the name of the attribute as written, with its prefix.
+func attrName(attr xml.Attr) string {
+	if attr.Name.Space == "" {
+		return attr.Name.Local
+	}
+
+	return attr.Name.Space + ":" + attr.Name.Local
+}
+
+// parse reads the whole source document into a tree of nodes, returning the document element.
+func (d *Decoder) parse() (*node, error) {
+	var root, cur *node
+
+	for {
+		line, col := d.d.InputPos()
+
+		tok, err := d.d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			n := &node{
+				loc:    Location{Line: line, Column: col},
+				prefix: tok.Name.Space,
+				local:  tok.Name.Local,
+				parent: cur,
+			}
+
+			if cur != nil {
+				n.preserve = cur.preserve
+				cur.children = append(cur.children, n)
+			} else {
+				root = n
+			}
+
+			for _, attr := range tok.Attr {
+				switch {
+				case attr.Name.Space == "" && attr.Name.Local == "xmlns":
+					n.ns = append(n.ns, xml.Attr{Value: attr.Value})
+
+				case attr.Name.Space == "xmlns":
+					n.ns = append(n.ns, xml.Attr{Name: xml.Name{Local: attr.Name.Local}, Value: attr.Value})
+
+				default:
+					if attr.Name.Space == "xml" && attr.Name.Local == "space" {
+						n.preserve = attr.Value == "preserve"
+					}
+
+					n.attrs = append(n.attrs, attr)
+				}
+			}
+
+			uri, ok := n.lookup(n.prefix)
+			if !ok {
+				return nil, fmt.Errorf("%s: element <%s>: undeclared namespace prefix %q", n.loc, n.qname(), n.prefix)
+			}
+			n.space = uri
+
+			cur = n
+
+		case xml.EndElement:
+			cur = cur.parent
+
+		case xml.CharData:
+			if cur != nil {
+				cur.children = append(cur.children, tok.Copy())
+			}
+
+		case xml.Comment:
+			if cur != nil {
+				cur.children = append(cur.children, tok.Copy())
+			}
+		}
+	}
+
+	if root == nil {
+		return nil, errors.New("no document element")
+	}
+
+	return root, nil
+}
+
+// Decode reads an XSLT stylesheet.
+// A simplified stylesheet, which is a literal result element with an xsl:version attribute,
+// is decoded as a stylesheet with a single template matching "/".
+func (d *Decoder) Decode() (*Stylesheet, error) {
+	root, err := d.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	d.xsl = &Stylesheet{
+		XMLName: xmlName("xsl:stylesheet"),
+	}
+	d.rootNS = make(map[string]string)
+
+	if !root.is("stylesheet") && !root.is("transform") {
+		return d.simplified(root)
+	}
+
+	for _, attr := range root.attrs {
+		d.xsl.Attr = append(d.xsl.Attr, xml.Attr{
+			Name:  xmlName(attrName(attr)),
+			Value: attr.Value,
+		})
+	}
+
+	for _, ns := range root.ns {
+		d.declare(ns.Name.Local, ns.Value)
+	}
+
+	indentSet := false
+
+	for _, child := range root.children {
+		switch child := child.(type) {
+		case xml.CharData:
+			if !isSpace(child) {
+				return nil, fmt.Errorf("%s: text is not allowed at the top-level of a stylesheet", root.loc)
+			}
+
+		case xml.Comment:
+			c := comment(child)
+			if d.seenStatement {
+				d.xsl.Body = append(d.xsl.Body, c)
+			} else {
+				d.xsl.Start = append(d.xsl.Start, c)
+			}
+
+		case *node:
+			if child.is("import") && child.only("href") {
+				imp := &Import{
+					Href: child.attr("href"),
+				}
+				d.Locations[imp] = child.loc
+
+				d.xsl.Imports = append(d.xsl.Imports, imp)
+				continue
+			}
+
+			d.seenStatement = true
+
+			switch {
+			case child.is("include") && child.only("href"):
+				inc := &Include{
+					Href: child.attr("href"),
+				}
+				d.Locations[inc] = child.loc
+
+				d.xsl.Includes = append(d.xsl.Includes, inc)
+
+			case child.is("output"):
+				set, err := d.output(child)
+				if err != nil {
+					return nil, err
+				}
+				indentSet = indentSet || set
+
+			default:
+				d.xsl.Body = append(d.xsl.Body, d.topLevel(child))
+			}
+		}
+	}
+
+	if out := d.xsl.Output; out != nil && !indentSet && out.Method == "html" {
+		// The html output method indents by default.
+		out.Indent = true
+	}
+
+	return d.xsl, nil
+}
+
+// declare adds a namespace declaration to the stylesheet element.
+// It reports false if the prefix is already declared with a different namespace URI.
+func (d *Decoder) declare(prefix, uri string) bool {
+	if have, ok := d.rootNS[prefix]; ok {
+		return have == uri
+	}
+	d.rootNS[prefix] = uri
+
+	name := "xmlns"
+	if prefix != "" {
+		name += ":" + prefix
+	}
+
+	d.xsl.Attr = append(d.xsl.Attr, xml.Attr{
+		Name:  xmlName(name),
+		Value: uri,
+	})
+
+	return true
+}
+
+// hoist moves the namespace declarations of a node onto the stylesheet element.
+// It reports false if any of them conflict with a declaration already on the stylesheet element.
+func (d *Decoder) hoist(n *node) bool {
+	for _, ns := range n.ns {
+		if have, ok := d.rootNS[ns.Name.Local]; ok && have != ns.Value {
+			return false
+		}
+	}
+
+	for _, ns := range n.ns {
+		d.declare(ns.Name.Local, ns.Value)
+	}
+
+	return true
+}
+
+func (d *Decoder) simplified(root *node) (*Stylesheet, error) {
+	version := ""
+	for i, attr := range root.attrs {
+		if attr.Name.Local == "version" {
+			if uri, _ := root.lookup(attr.Name.Space); uri == NamespaceXSL {
+				version = attr.Value
+				root.attrs = append(root.attrs[:i:i], root.attrs[i+1:]...)
+				break
+			}
+		}
+	}
+
+	if version == "" {
+		return nil, fmt.Errorf("%s: document element <%s> is not an XSLT stylesheet", root.loc, root.qname())
+	}
+
+	d.xsl.Attr = append(d.xsl.Attr, xml.Attr{
+		Name:  xmlName("version"),
+		Value: version,
+	})
+
+	for _, ns := range root.ns {
+		d.declare(ns.Name.Local, ns.Value)
+	}
+
+	tmpl := &Template{
+		Match: "/",
+		Body:  Group{d.instruction(root)},
+	}
+	d.Locations[tmpl] = root.loc
+
+	d.xsl.Body = append(d.xsl.Body, tmpl)
+	return d.xsl, nil
+}
+
+func (d *Decoder) unsupported(n *node) *Unsupported {
+	u := &Unsupported{
+		Name: n.qname(),
+	}
+	d.Locations[u] = n.loc
+
+	var encode func(n *node)
+	encode = func(n *node) {
+		start := xml.StartElement{
+			Name: xmlName(n.qname()),
+		}
+
+		for _, ns := range n.ns {
+			name := "xmlns"
+			if ns.Name.Local != "" {
+				name += ":" + ns.Name.Local
+			}
+
+			start.Attr = append(start.Attr, xml.Attr{Name: xmlName(name), Value: ns.Value})
+		}
+
+		for _, attr := range n.attrs {
+			start.Attr = append(start.Attr, xml.Attr{Name: xmlName(attrName(attr)), Value: attr.Value})
+		}
+
+		u.Tokens = append(u.Tokens, start)
+
+		for _, child := range n.children {
+			switch child := child.(type) {
+			case *node:
+				encode(child)
+			case xml.CharData:
+				u.Tokens = append(u.Tokens, child)
+			case xml.Comment:
+				u.Tokens = append(u.Tokens, child)
+			}
+		}
+
+		u.Tokens = append(u.Tokens, start.End())
+	}
+
+	encode(n)
+	return u
+}
+
+func (d *Decoder) topLevel(n *node) interface{} {
+	if !d.hoist(n) {
+		return d.unsupported(n)
+	}
+
+	switch {
+	case n.is("template") && n.only("name", "match", "mode", "priority"):
+		if n.attr("name") == "" && n.attr("match") == "" {
+			break
+		}
+
+		tmpl := &Template{
+			Name:     n.attr("name"),
+			Match:    n.attr("match"),
+			Mode:     n.attr("mode"),
+			Priority: n.attr("priority"),
+		}
+
+		// Comments among the leading params are kept at the start of the body.
+		var comments []interface{}
+
+		children := n.children
+		for len(children) > 0 {
+			child, ok := children[0].(*node)
+			if !ok {
+				if text, ok := children[0].(xml.CharData); ok && !isSpace(text) {
+					break
+				}
+
+				if c, ok := children[0].(xml.Comment); ok {
+					comments = append(comments, c)
+				}
+
+				children = children[1:]
+				continue
+			}
+
+			if !child.is("param") {
+				break
+			}
+
+			param, ok := d.variable(child)
+			if !ok {
+				return d.unsupported(n)
+			}
+
+			tmpl.Params = append(tmpl.Params, (*Param)(param))
+			children = children[1:]
+		}
+
+		tmpl.Body = d.body(n, append(comments, children...))
+
+		d.Locations[tmpl] = n.loc
+		return tmpl
+
+	case n.is("key") && n.only("name", "match", "use"):
+		key := &Key{
+			Name:  n.attr("name"),
+			Match: n.attr("match"),
+			Use:   n.attr("use"),
+		}
+
+		d.Locations[key] = n.loc
+		return key
+
+	case n.is("variable"), n.is("param"):
+		v, ok := d.variable(n)
+		if !ok {
+			break
+		}
+
+		if n.is("param") {
+			return (*Param)(v)
+		}
+		return v
+	}
+
+	return d.unsupported(n)
+}
+
+func (d *Decoder) output(n *node) (indentSet bool, err error) {
+	if !n.only("method", "version", "encoding", "omit-xml-declaration", "standalone",
+		"doctype-public", "doctype-system", "cdata-section-elements", "indent", "media-type") {
+		d.xsl.Body = append(d.xsl.Body, d.unsupported(n))
+		return false, nil
+	}
+
+	out := d.xsl.Output
+	if out == nil {
+		out = &Output{
+			XMLName: xmlName("xsl:output"),
+		}
+		d.xsl.Output = out
+		d.Locations[out] = n.loc
+	}
+
+	for _, attr := range n.attrs {
+		v := attr.Value
+
+		switch attr.Name.Local {
+		case "method":
+			out.Method = v
+		case "version":
+			out.Version = v
+		case "encoding":
+			out.Encoding = v
+		case "media-type":
+			out.MediaType = v
+
+		case "doctype-public":
+			out.DoctypePublic = v
+		case "doctype-system":
+			out.DoctypeSystem = v
+
+		case "cdata-section-elements":
+			out.CDATASectionElements = append(out.CDATASectionElements, strings.Fields(v)...)
+
+		case "omit-xml-declaration":
+			if out.OmitXMLDeclaration, err = parseBool(n, attr); err != nil {
+				return false, err
+			}
+
+		case "standalone":
+			if out.Standalone, err = parseBool(n, attr); err != nil {
+				return false, err
+			}
+
+		case "indent":
+			b, err := parseBool(n, attr)
+			if err != nil {
+				return false, err
+			}
+			out.Indent = *b
+			indentSet = true
+		}
+	}
+
+	return indentSet, nil
+}
+
+func parseBool(n *node, attr xml.Attr) (*BoolVal, error) {
+	switch attr.Value {
+	case "yes":
+		return Bool(true), nil
+	case "no":
+		return Bool(false), nil
+	}
+
+	return nil, fmt.Errorf("%s: <%s>: attribute %s must be either yes or no, not %q", n.loc, n.qname(), attrName(attr), attr.Value)
+}
+
+func isSpace(text xml.CharData) bool {
+	return strings.TrimSpace(string(text)) == ""
+}
+
+func comment(c xml.Comment) *Comment {
+	return &Comment{
+		Body: strings.TrimSpace(string(c)),
+	}
+}
+
+// body decodes the given children of the node as a sequence of instructions.
+func (d *Decoder) body(n *node, children []interface{}) Group {
+	var body Group
+
+	for _, child := range children {
+		switch child := child.(type) {
+		case xml.CharData:
+			if isSpace(child) && !n.preserve {
+				continue
+			}
+
+			body = append(body, &Text{
+				Body: string(child),
+			})
+
+		case xml.Comment:
+			body = append(body, comment(child))
+
+		case *node:
+			body = append(body, d.instruction(child))
+		}
+	}
+
+	return body
+}
+
+// elements returns the element children of the node,
+// or false if it has any text that is not whitespace.
+func elements(n *node) ([]*node, bool) {
+	var elems []*node
+
+	for _, child := range n.children {
+		switch child := child.(type) {
+		case *node:
+			elems = append(elems, child)
+
+		case xml.CharData:
+			if !isSpace(child) {
+				return nil, false
+			}
+		}
+	}
+
+	return elems, true
+}
+
+// instruction decodes an element within a template body.
+func (d *Decoder) instruction(n *node) interface{} {
+	if !d.hoist(n) {
+		return d.unsupported(n)
+	}
+
+	if n.space != NamespaceXSL {
+		return d.literal(n)
+	}
+
+	var instr interface{}
+
+	switch n.local {
+	case "text":
+		instr = d.text(n)
+	case "value-of":
+		instr = d.valueOf(n)
+
+	case "copy-of":
+		if n.only("select") && len(n.children) == 0 {
+			instr = &CopyOf{
+				Select: n.attr("select"),
+			}
+		}
+
+	case "variable":
+		if v, ok := d.variable(n); ok {
+			instr = v
+		}
+
+	case "if":
+		if n.only("test") {
+			instr = &If{
+				Test: n.attr("test"),
+				Body: d.body(n, n.children),
+			}
+		}
+
+	case "choose":
+		instr = d.choose(n)
+
+	case "for-each":
+		instr = d.forEach(n)
+	case "apply-templates":
+		instr = d.applyTemplates(n)
+
+	case "call-template":
+		instr = d.callTemplate(n)
+
+	case "element":
+		if n.only("name", "namespace") {
+			instr = &Element{
+				Name:      n.attr("name"),
+				Namespace: n.attr("namespace"),
+				Body:      d.body(n, n.children),
+			}
+		}
+
+	case "attribute":
+		if n.only("name", "namespace") {
+			instr = &Attribute{
+				Name:      n.attr("name"),
+				Namespace: n.attr("namespace"),
+				Value:     d.body(n, n.children),
+			}
+		}
+	}
+
+	if instr == nil {
+		return d.unsupported(n)
+	}
+
+	d.Locations[instr] = n.loc
+	return instr
+}
+
+func (d *Decoder) text(n *node) interface{} {
+	if !n.only("disable-output-escaping") {
+		return nil
+	}
+
+	var b strings.Builder
+	for _, child := range n.children {
+		text, ok := child.(xml.CharData)
+		if !ok {
+			return nil
+		}
+
+		b.Write(text)
+	}
+
+	text := &Text{
+		Body: b.String(),
+	}
+
+	var ok bool
+	if text.DisableOutputEscaping, ok = boolAttr(n, "disable-output-escaping"); !ok {
+		return nil
+	}
+
+	return text
+}
+
+// boolAttr returns the value of an optional yes/no attribute,
+// or false if the attribute has any other value.
+func boolAttr(n *node, name string) (*BoolVal, bool) {
+	for _, attr := range n.attrs {
+		if attr.Name.Space == "" && attr.Name.Local == name {
+			b, err := parseBool(n, attr)
+			return b, err == nil
+		}
+	}
+
+	return nil, true
+}
+
+func (d *Decoder) valueOf(n *node) interface{} {
+	if !n.only("select", "disable-output-escaping") || len(n.children) > 0 {
+		return nil
+	}
+
+	v := &ValueOf{
+		Select: n.attr("select"),
+	}
+
+	var ok bool
+	if v.DisableOutputEscaping, ok = boolAttr(n, "disable-output-escaping"); !ok {
+		return nil
+	}
+
+	return v
+}
+
+// variable decodes an xsl:variable, xsl:param, or xsl:with-param.
+func (d *Decoder) variable(n *node) (*Variable, bool) {
+	if !n.only("name", "select") || n.attr("name") == "" {
+		return nil, false
+	}
+
+	v := &Variable{
+		Name:   n.attr("name"),
+		Select: n.attr("select"),
+	}
+	d.Locations[v] = n.loc
+
+	if body := d.body(n, n.children); len(body) > 0 {
+		v.Value = body
+	}
+
+	return v, true
+}
+
+func (d *Decoder) choose(n *node) interface{} {
+	elems, ok := elements(n)
+	if !ok || !n.only() {
+		return nil
+	}
+
+	choose := new(Choose)
+
+	for _, elem := range elems {
+		switch {
+		case elem.is("when") && elem.only("test") && choose.Otherwise == nil:
+			when := &When{
+				Test: elem.attr("test"),
+				Body: d.body(elem, elem.children),
+			}
+			d.Locations[when] = elem.loc
+
+			choose.Whens = append(choose.Whens, when)
+
+		case elem.is("otherwise") && elem.only() && choose.Otherwise == nil:
+			choose.Otherwise = &Otherwise{
+				Body: d.body(elem, elem.children),
+			}
+			d.Locations[choose.Otherwise] = elem.loc
+
+		default:
+			return nil
+		}
+	}
+
+	if len(choose.Whens) < 1 {
+		return nil
+	}
+
+	return choose
+}
+
+// sorts decodes the leading xsl:sort elements of the node, returning the children that follow them.
+func (d *Decoder) sorts(n *node) ([]*Sort, []interface{}, bool) {
+	var sorts []*Sort
+
+	children := n.children
+	for len(children) > 0 {
+		switch child := children[0].(type) {
+		case xml.Comment:
+		case xml.CharData:
+			if !isSpace(child) {
+				return sorts, children, true
+			}
+
+		case *node:
+			if !child.is("sort") {
+				return sorts, children, true
+			}
+
+			if !child.only("select", "lang", "data-type", "order", "case-order") || len(child.children) > 0 {
+				return nil, nil, false
+			}
+
+			sort := &Sort{
+				Select:    child.attr("select"),
+				Lang:      child.attr("lang"),
+				DataType:  child.attr("data-type"),
+				Order:     child.attr("order"),
+				CaseOrder: child.attr("case-order"),
+			}
+			d.Locations[sort] = child.loc
+
+			sorts = append(sorts, sort)
+		}
+
+		children = children[1:]
+	}
+
+	return sorts, children, true
+}
+
+func (d *Decoder) withParams(elems []*node) ([]*WithParam, bool) {
+	var params []*WithParam
+
+	for _, elem := range elems {
+		if !elem.is("with-param") {
+			return nil, false
+		}
+
+		v, ok := d.variable(elem)
+		if !ok {
+			return nil, false
+		}
+
+		params = append(params, (*WithParam)(v))
+	}
+
+	return params, true
+}
+
+func (d *Decoder) forEach(n *node) interface{} {
+	if !n.only("select") {
+		return nil
+	}
+
+	sorts, children, ok := d.sorts(n)
+	if !ok {
+		return nil
+	}
+
+	return &ForEach{
+		Select: n.attr("select"),
+		Sort:   sorts,
+		Body:   d.body(n, children),
+	}
+}
+
+func (d *Decoder) applyTemplates(n *node) interface{} {
+	if !n.only("select", "mode") {
+		return nil
+	}
+
+	elems, ok := elements(n)
+	if !ok {
+		return nil
+	}
+
+	var sortElems, paramElems []*node
+	for _, elem := range elems {
+		if elem.is("sort") {
+			sortElems = append(sortElems, elem)
+			continue
+		}
+
+		paramElems = append(paramElems, elem)
+	}
+
+	sorts, _, ok := d.sorts(&node{children: nodes(sortElems)})
+	if !ok {
+		return nil
+	}
+
+	params, ok := d.withParams(paramElems)
+	if !ok {
+		return nil
+	}
+
+	return &ApplyTemplates{
+		Select:     n.attr("select"),
+		Mode:       n.attr("mode"),
+		Sort:       sorts,
+		WithParams: params,
+	}
+}
+
+func nodes(elems []*node) []interface{} {
+	children := make([]interface{}, len(elems))
+	for i, elem := range elems {
+		children[i] = elem
+	}
+
+	return children
+}
+
+func (d *Decoder) callTemplate(n *node) interface{} {
+	if !n.only("name") || n.attr("name") == "" {
+		return nil
+	}
+
+	elems, ok := elements(n)
+	if !ok {
+		return nil
+	}
+
+	params, ok := d.withParams(elems)
+	if !ok {
+		return nil
+	}
+
+	return &CallTemplate{
+		Name:       n.attr("name"),
+		WithParams: params,
+	}
+}
+
+// literal decodes a literal result element into an equivalent xsl:element,
+// with an xsl:attribute for each of its attributes.
+func (d *Decoder) literal(n *node) interface{} {
+	var body Group
+
+	for _, attr := range n.attrs {
+		if uri, _ := n.lookup(attr.Name.Space); uri == NamespaceXSL {
+			// Attributes such as xsl:use-attribute-sets have no equivalent on xsl:element.
+			return d.unsupported(n)
+		}
+
+		val, ok := avt(attr.Value)
+		if !ok {
+			return d.unsupported(n)
+		}
+
+		a := &Attribute{
+			Name:  attrName(attr),
+			Value: val,
+		}
+		d.Locations[a] = n.loc
+
+		body = append(body, a)
+	}
+
+	elem := &Element{
+		Name: n.qname(),
+		Body: append(body, d.body(n, n.children)...),
+	}
+	d.Locations[elem] = n.loc
+
+	return elem
+}
+
+// avt splits an attribute value template into a sequence of xsl:text and xsl:value-of instructions.
+// It reports false if the attribute value template is malformed.
+func avt(s string) (interface{}, bool) {
+	if !strings.ContainsAny(s, "{}") {
+		return &Text{Body: s}, true
+	}
+
+	var group Group
+	var text strings.Builder
+
+	flush := func() {
+		if text.Len() > 0 {
+			group = append(group, &Text{Body: text.String()})
+			text.Reset()
+		}
+	}
+
+	for i := 0; i < len(s); {
+		switch {
+		case strings.HasPrefix(s[i:], "{{"):
+			text.WriteByte('{')
+			i += 2
+
+		case strings.HasPrefix(s[i:], "}}"):
+			text.WriteByte('}')
+			i += 2
+
+		case s[i] == '{':
+			end := AVTExprEnd(s, i+1)
+			if end < 0 {
+				return nil, false
+			}
+
+			flush()
+			group = append(group, &ValueOf{Select: strings.TrimSpace(s[i+1 : end])})
+			i = end + 1
+
+		case s[i] == '}':
+			return nil, false
+
+		default:
+			text.WriteByte(s[i])
+			i++
+		}
+	}
+	flush()
+
+	if len(group) == 1 {
+		return group[0], true
+	}
+
+	return group, true
+}
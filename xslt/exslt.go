@@ -0,0 +1,69 @@
+package xslt
+
+import (
+	"encoding/xml"
+	"errors"
+)
+
+// NamespaceEXSLTFunctions is the namespace of the EXSLT functions module,
+// which allows stylesheet functions to be defined in XSLT 1.0.
+const NamespaceEXSLTFunctions = "http://exslt.org/functions"
+
+// EXSLTFunction is a stylesheet function defined with the EXSLT functions module.
+// The Prefix is that declared for NamespaceEXSLTFunctions, which must also be an extension element prefix.
+type EXSLTFunction struct {
+	Prefix string
+	Name   string `xml:"name,attr"`
+
+	Params []*Param
+
+	Body interface{}
+}
+
+func (f *EXSLTFunction) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
+	if f.Prefix == "" || f.Name == "" {
+		return errors.New("func:function must have a prefix and a name")
+	}
+
+	start := xmlStartElement(f.Prefix+":function",
+		xmlAttr("name", f.Name),
+	)
+
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+
+	for _, param := range f.Params {
+		if err := e.Encode(param); err != nil {
+			return err
+		}
+	}
+
+	if err := e.Encode(f.Body); err != nil {
+		return err
+	}
+
+	return e.EncodeToken(start.End())
+}
+
+// EXSLTResult is the result of an EXSLTFunction.
+type EXSLTResult struct {
+	Prefix string
+	Select string `xml:"select,attr"`
+}
+
+func (r *EXSLTResult) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
+	if r.Prefix == "" {
+		return errors.New("func:result must have a prefix")
+	}
+
+	start := xmlStartElement(r.Prefix+":result",
+		xmlAttr("select", r.Select),
+	)
+
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+
+	return e.EncodeToken(start.End())
+}
@@ -0,0 +1,89 @@
+package xslt
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// LiteralElement is a literal result element, which is output as written, rather than by an xsl:element.
+//
+// The value of each of its attributes is written as an attribute value template,
+// and so must be either nil, a *Text, a *ValueOf, or a Group of these, without any output escaping disabled.
+type LiteralElement struct {
+	Name  string
+	Attrs []*Attribute
+
+	Body interface{}
+}
+
+// AVT returns the attribute value template equivalent to the given value, and whether there is one.
+// The value must be either nil, a *Text, a *ValueOf, or a Group of these, without any output escaping disabled.
+func AVT(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case nil:
+		return "", true
+
+	case *Text:
+		if v.DisableOutputEscaping != nil {
+			return "", false
+		}
+		return avtEscaper.Replace(v.Body), true
+
+	case *ValueOf:
+		if v.DisableOutputEscaping != nil {
+			return "", false
+		}
+		return "{" + v.Select + "}", true
+
+	case Group:
+		var b strings.Builder
+
+		for _, child := range v {
+			s, ok := AVT(child)
+			if !ok {
+				return "", false
+			}
+
+			b.WriteString(s)
+		}
+
+		return b.String(), true
+	}
+
+	return "", false
+}
+
+func (el *LiteralElement) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
+	if el.Name == "" {
+		return errors.New("literal result element must have a name")
+	}
+
+	// Unlike the attributes of instructions, empty attributes are still output.
+	start := xml.StartElement{
+		Name: xmlName(el.Name),
+	}
+
+	for _, attr := range el.Attrs {
+		val, ok := AVT(attr.Value)
+		if !ok {
+			return fmt.Errorf("attribute %q of literal result element %q has no attribute value template", attr.Name, el.Name)
+		}
+
+		start.Attr = append(start.Attr, xml.Attr{
+			Name:  xmlName(attr.Name),
+			Value: val,
+		})
+	}
+
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+
+	if err := e.Encode(el.Body); err != nil {
+		return err
+	}
+
+	return e.EncodeToken(start.End())
+}
@@ -7,22 +7,24 @@ import (
 
 type ApplyTemplates struct {
 	Select string `xml:"select,attr,omitempty"`
+	Mode   string `xml:"mode,attr,omitempty"`
 
-	Sort       interface{}
+	Sort       []*Sort
 	WithParams []*WithParam
 }
 
 func (a *ApplyTemplates) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
 	start := xmlStartElement("xsl:apply-templates",
 		xmlAttr("select", a.Select),
+		xmlAttr("mode", a.Mode),
 	)
 
 	if err := e.EncodeToken(start); err != nil {
 		return err
 	}
 
-	if a.Sort != nil {
-		if err := e.Encode(a.Sort); err != nil {
+	for _, sort := range a.Sort {
+		if err := e.Encode(sort); err != nil {
 			return err
 		}
 	}
@@ -39,7 +41,7 @@ func (a *ApplyTemplates) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
 type ForEach struct {
 	Select string `xml:"select,attr"`
 
-	Sort interface{}
+	Sort []*Sort
 	Body interface{}
 }
 
@@ -56,8 +58,8 @@ func (f *ForEach) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
 		return err
 	}
 
-	if f.Sort != nil {
-		if err := e.Encode(f.Sort); err != nil {
+	for _, sort := range f.Sort {
+		if err := e.Encode(sort); err != nil {
 			return err
 		}
 	}
@@ -68,3 +70,27 @@ func (f *ForEach) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
 
 	return e.EncodeToken(start.End())
 }
+
+type Sort struct {
+	Select    string `xml:"select,attr,omitempty"`
+	Lang      string `xml:"lang,attr,omitempty"`
+	DataType  string `xml:"data-type,attr,omitempty"`
+	Order     string `xml:"order,attr,omitempty"`
+	CaseOrder string `xml:"case-order,attr,omitempty"`
+}
+
+func (s *Sort) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
+	start := xmlStartElement("xsl:sort",
+		xmlAttr("select", s.Select),
+		xmlAttr("lang", s.Lang),
+		xmlAttr("data-type", s.DataType),
+		xmlAttr("order", s.Order),
+		xmlAttr("case-order", s.CaseOrder),
+	)
+
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+
+	return e.EncodeToken(start.End())
+}
@@ -0,0 +1,412 @@
+package xslt
+
+import (
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/puellanivis/lxt/xpath"
+)
+
+// KnownNamespaces are namespaces that are declared on a stylesheet automatically,
+// if their prefix is used within it, but is not otherwise declared.
+var KnownNamespaces = map[string]string{
+	"xs":      "http://www.w3.org/2001/XMLSchema",
+	"msxsl":   "urn:schemas-microsoft-com:xslt",
+	"install": "http://www.microsoft.com/support",
+}
+
+// nsAttr returns the name of the attribute declaring the given prefix, or the default namespace if the prefix is empty.
+func nsAttr(prefix string) string {
+	if prefix == "" {
+		return "xmlns"
+	}
+
+	return "xmlns:" + prefix
+}
+
+// AttrValue returns the value of the attribute of the stylesheet element with the given name, if it is set.
+func (s *Stylesheet) AttrValue(name string) (string, bool) {
+	for _, attr := range s.Attr {
+		if attr.Name.Local == name {
+			return attr.Value, true
+		}
+	}
+
+	return "", false
+}
+
+// SetAttr sets the attribute of the stylesheet element with the given name, replacing any previous value.
+func (s *Stylesheet) SetAttr(name, value string) {
+	for i, attr := range s.Attr {
+		if attr.Name.Local == name {
+			s.Attr[i].Value = value
+			return
+		}
+	}
+
+	s.Attr = append(s.Attr, xml.Attr{
+		Name:  xmlName(name),
+		Value: value,
+	})
+}
+
+// Version returns the version of XSLT given on the stylesheet element, or XSLT 1.0 if it is not valid.
+func (s *Stylesheet) Version() Version {
+	v, _ := s.AttrValue("version")
+
+	version, err := ParseVersion(v)
+	if err != nil {
+		return XSLT10
+	}
+
+	return version
+}
+
+// AddPrefix adds the namespace prefix to the whitespace-separated list of prefixes in the given attribute
+// of the stylesheet element, such as extension-element-prefixes, unless it is already listed.
+func (s *Stylesheet) AddPrefix(name, prefix string) {
+	list, _ := s.AttrValue(name)
+
+	prefixes := strings.Fields(list)
+	for _, p := range prefixes {
+		if p == prefix {
+			return
+		}
+	}
+
+	s.SetAttr(name, strings.Join(append(prefixes, prefix), " "))
+}
+
+// PrefixOf returns a prefix declared for the given namespace URI, and whether there is one.
+// If more than one prefix is declared for the namespace, then the first in sorted order is returned.
+func (s *Stylesheet) PrefixOf(uri string) (string, bool) {
+	var prefixes []string
+
+	for prefix, u := range s.Namespaces() {
+		if u == uri && prefix != "" {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+
+	if len(prefixes) == 0 {
+		return "", false
+	}
+
+	sort.Strings(prefixes)
+	return prefixes[0], true
+}
+
+// Declare declares the namespace with the given prefix on the stylesheet element.
+// An empty prefix declares the default namespace.
+// It is an error to declare a prefix that is already declared with a different namespace URI.
+func (s *Stylesheet) Declare(prefix, uri string) error {
+	name := nsAttr(prefix)
+
+	if have, ok := s.AttrValue(name); ok {
+		if have != uri {
+			return fmt.Errorf("namespace prefix %q is already declared as %q", prefix, have)
+		}
+
+		return nil
+	}
+
+	s.SetAttr(name, uri)
+	return nil
+}
+
+// Namespaces returns the namespaces declared on the stylesheet element, keyed by prefix,
+// including any known namespaces that are used but not declared.
+func (s *Stylesheet) Namespaces() map[string]string {
+	namespaces := make(map[string]string)
+
+	for _, attr := range s.Attr {
+		switch name := attr.Name.Local; {
+		case name == "xmlns":
+			namespaces[""] = attr.Value
+
+		case strings.HasPrefix(name, "xmlns:"):
+			namespaces[strings.TrimPrefix(name, "xmlns:")] = attr.Value
+		}
+	}
+
+	for _, attr := range s.implicitNamespaces() {
+		namespaces[strings.TrimPrefix(attr.Name.Local, "xmlns:")] = attr.Value
+	}
+
+	return namespaces
+}
+
+// implicitNamespaces returns the declarations of the known namespaces that are used but not declared.
+func (s *Stylesheet) implicitNamespaces() []xml.Attr {
+	var attrs []xml.Attr
+
+	for _, prefix := range s.UsedPrefixes() {
+		uri, ok := KnownNamespaces[prefix]
+		if !ok {
+			continue
+		}
+
+		if _, ok := s.AttrValue(nsAttr(prefix)); ok {
+			continue
+		}
+
+		attrs = append(attrs, xml.Attr{
+			Name:  xmlName(nsAttr(prefix)),
+			Value: uri,
+		})
+	}
+
+	return attrs
+}
+
+// UsedPrefixes returns the namespace prefixes used within the stylesheet, in sorted order.
+// This includes the prefixes of the names of elements, attributes, templates, modes, and variables,
+// and those of any names, functions, or variables within its XPaths.
+func (s *Stylesheet) UsedPrefixes() []string {
+	used := make(map[string]bool)
+
+	qname := func(names ...string) {
+		for _, name := range names {
+			if prefix, _, ok := strings.Cut(name, ":"); ok {
+				used[prefix] = true
+			}
+		}
+	}
+
+	expr := func(exprs ...string) {
+		for _, x := range exprs {
+			if x != "" {
+				xpathPrefixes(x, xpath.Parse, used)
+			}
+		}
+	}
+
+	// The names and namespaces of xsl:element and xsl:attribute are attribute value templates.
+	avtExpr := func(values ...string) {
+		for _, v := range values {
+			parts, _ := avt(v)
+
+			Walk(parts, func(node interface{}) bool {
+				if v, ok := node.(*ValueOf); ok {
+					expr(v.Select)
+				}
+				return true
+			})
+		}
+	}
+
+	avtName := func(name string) {
+		if strings.ContainsAny(name, "{}") {
+			avtExpr(name)
+			return
+		}
+
+		qname(name)
+	}
+
+	for _, name := range []string{"exclude-result-prefixes", "extension-element-prefixes"} {
+		prefixes, _ := s.AttrValue(name)
+
+		for _, prefix := range strings.Fields(prefixes) {
+			if !strings.HasPrefix(prefix, "#") {
+				used[prefix] = true
+			}
+		}
+	}
+
+	if s.Output != nil {
+		qname(s.Output.CDATASectionElements...)
+		qname(s.Output.Method)
+	}
+
+	Walk(s, func(node interface{}) bool {
+		switch n := node.(type) {
+		case *Key:
+			qname(n.Name)
+			xpathPrefixes(n.Match, xpath.ParsePattern, used)
+			expr(n.Use)
+
+		case *Template:
+			qname(n.Name, n.Mode)
+			if n.Match != "" {
+				xpathPrefixes(n.Match, xpath.ParsePattern, used)
+			}
+
+		case *CallTemplate:
+			qname(n.Name)
+
+		case *ApplyTemplates:
+			qname(n.Mode)
+			expr(n.Select)
+
+		case *ForEach:
+			expr(n.Select)
+
+		case *Sort:
+			expr(n.Select)
+
+		case *If:
+			expr(n.Test)
+
+		case *When:
+			expr(n.Test)
+
+		case *ValueOf:
+			expr(n.Select)
+
+		case *CopyOf:
+			expr(n.Select)
+
+		case *Element:
+			avtName(n.Name)
+			avtExpr(n.Namespace)
+
+		case *LiteralElement:
+			qname(n.Name)
+
+		case *Attribute:
+			avtName(n.Name)
+			avtExpr(n.Namespace)
+
+		case *Param:
+			qname(n.Name)
+			expr(n.Select)
+			lexicalPrefixes(n.As, used)
+
+		case *Variable:
+			qname(n.Name)
+			expr(n.Select)
+			lexicalPrefixes(n.As, used)
+
+		case *WithParam:
+			qname(n.Name)
+			expr(n.Select)
+			lexicalPrefixes(n.As, used)
+
+		case *Function:
+			qname(n.Name)
+			lexicalPrefixes(n.As, used)
+
+		case *EXSLTFunction:
+			used[n.Prefix] = true
+			qname(n.Name)
+
+		case *EXSLTResult:
+			used[n.Prefix] = true
+			expr(n.Select)
+
+		case *Sequence:
+			expr(n.Select)
+
+		case *ForEachGroup:
+			expr(n.Select, n.GroupBy, n.GroupAdjacent)
+			for _, pattern := range []string{n.GroupStartingWith, n.GroupEndingWith} {
+				if pattern != "" {
+					xpathPrefixes(pattern, xpath.ParsePattern, used)
+				}
+			}
+
+		case *AnalyzeString:
+			expr(n.Select)
+		}
+
+		return true
+	})
+
+	var prefixes []string
+	for prefix := range used {
+		prefixes = append(prefixes, prefix)
+	}
+
+	sort.Strings(prefixes)
+	return prefixes
+}
+
+// xpathPrefixes adds the prefixes of the names, functions, and variables of the XPath to the given set.
+// An XPath that cannot be parsed, such as one using XPath 2.0 syntax, is scanned for prefixes with lexicalPrefixes.
+func xpathPrefixes(s string, parse func(string) (xpath.Expr, error), used map[string]bool) {
+	expr, err := parse(s)
+	if err != nil {
+		lexicalPrefixes(s, used)
+		return
+	}
+
+	add := func(name xpath.QName) {
+		if name.Prefix != "" {
+			used[name.Prefix] = true
+		}
+	}
+
+	xpath.Inspect(expr, func(expr xpath.Expr) bool {
+		switch x := expr.(type) {
+		case *xpath.VariableRef:
+			add(x.Name)
+
+		case *xpath.FunctionCall:
+			add(x.Name)
+
+		case *xpath.LocationPath:
+			for _, step := range x.Steps {
+				if test, ok := step.Test.(*xpath.NameTest); ok {
+					add(test.Name)
+				}
+			}
+		}
+
+		return true
+	})
+}
+
+var (
+	stringLiteral = regexp.MustCompile(`"[^"]*"|'[^']*'`)
+	prefixedName  = regexp.MustCompile(`([A-Za-z_][-.\w]*):[A-Za-z_*]`)
+)
+
+// lexicalPrefixes adds the prefixes of any prefixed names outside of string literals to the given set.
+// It is used for sequence types, and for XPaths that cannot be parsed.
+func lexicalPrefixes(s string, used map[string]bool) {
+	s = stringLiteral.ReplaceAllString(s, "")
+
+	for _, match := range prefixedName.FindAllStringSubmatch(s, -1) {
+		used[match[1]] = true
+	}
+}
+
+// MarshalXML encodes the stylesheet, with its namespace declarations sorted by prefix, after all other attributes.
+func (s *Stylesheet) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
+	var attrs, namespaces []xml.Attr
+
+	for _, attr := range s.Attr {
+		if name := attr.Name.Local; name == "xmlns" || strings.HasPrefix(name, "xmlns:") {
+			namespaces = append(namespaces, attr)
+			continue
+		}
+
+		attrs = append(attrs, attr)
+	}
+
+	namespaces = append(namespaces, s.implicitNamespaces()...)
+	sort.SliceStable(namespaces, func(i, j int) bool {
+		return namespaces[i].Name.Local < namespaces[j].Name.Local
+	})
+
+	start := xml.StartElement{
+		Name: s.XMLName,
+		Attr: append(attrs, namespaces...),
+	}
+
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+
+	for _, v := range []interface{}{s.Start, s.Imports, s.Includes, s.Output, s.Keys, s.Body} {
+		if err := e.Encode(v); err != nil {
+			return err
+		}
+	}
+
+	return e.EncodeToken(start.End())
+}
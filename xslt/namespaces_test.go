@@ -0,0 +1,139 @@
+package xslt
+
+import (
+	"encoding/xml"
+	"reflect"
+	"testing"
+)
+
+func TestDeclare(t *testing.T) {
+	s := NewStylesheet()
+
+	if err := s.Declare("my", "urn:my"); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := s.Declare("my", "urn:my"); err != nil {
+		t.Error("redeclaring the same namespace gave unexpected error:", err)
+	}
+
+	expectErr := `namespace prefix "my" is already declared as "urn:my"`
+	if err := s.Declare("my", "urn:other"); err == nil || err.Error() != expectErr {
+		t.Errorf("Declare gave error: %v\nexpected: %s", err, expectErr)
+	}
+
+	if err := s.Declare("", "urn:default"); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	expect := map[string]string{
+		"":    "urn:default",
+		"my":  "urn:my",
+		"xsl": NamespaceXSL,
+	}
+
+	if got := s.Namespaces(); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Namespaces gave %v, expected %v", got, expect)
+	}
+}
+
+func TestKnownNamespaces(t *testing.T) {
+	s := NewStylesheet()
+
+	if err := s.Declare("xs", "urn:not-schema"); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	s.Body = append(s.Body,
+		&Variable{Name: "a", As: "xs:integer", Select: "1"},
+		&ValueOf{Select: "msxsl:node-set($a)"},
+	)
+
+	got := s.Namespaces()
+
+	// A known namespace that is declared explicitly keeps its declared URI.
+	if uri := got["xs"]; uri != "urn:not-schema" {
+		t.Errorf("xs was declared as %q, expected %q", uri, "urn:not-schema")
+	}
+
+	if uri := got["msxsl"]; uri != KnownNamespaces["msxsl"] {
+		t.Errorf("msxsl was declared as %q, expected %q", uri, KnownNamespaces["msxsl"])
+	}
+
+	// A known namespace that is not used is not declared.
+	if uri, ok := got["install"]; ok {
+		t.Errorf("install was declared as %q, but it is not used", uri)
+	}
+}
+
+func TestUsedPrefixes(t *testing.T) {
+	s := NewStylesheet()
+	s.SetAttr("exclude-result-prefixes", "ex #default")
+
+	s.Keys = append(s.Keys, &Key{Name: "k:key", Match: "m:item", Use: "u:id(.)"})
+	s.Body = append(s.Body,
+		&Template{Match: "t:a | b", Mode: "mode:x"},
+		&Element{Name: "{e:name()}", Namespace: "urn:x"},
+		&LiteralElement{Name: "lit:p"},
+		&Sequence{Select: "for $i in 1 to 3 return seq:f($i)"},
+		&ValueOf{Select: "'str:ing' | $v:var"},
+	)
+
+	expect := []string{"e", "ex", "k", "lit", "m", "mode", "seq", "t", "u", "v"}
+
+	if got := s.UsedPrefixes(); !reflect.DeepEqual(got, expect) {
+		t.Errorf("UsedPrefixes gave %v, expected %v", got, expect)
+	}
+}
+
+func TestAddPrefix(t *testing.T) {
+	s := NewStylesheet()
+
+	s.AddPrefix("exclude-result-prefixes", "a")
+	s.AddPrefix("exclude-result-prefixes", "b")
+	s.AddPrefix("exclude-result-prefixes", "a")
+
+	if got, _ := s.AttrValue("exclude-result-prefixes"); got != "a b" {
+		t.Errorf("exclude-result-prefixes was %q, expected %q", got, "a b")
+	}
+}
+
+func TestPrefixOf(t *testing.T) {
+	s := NewStylesheet()
+
+	for _, prefix := range []string{"fn", "func", ""} {
+		if err := s.Declare(prefix, "http://exslt.org/functions"); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	if prefix, ok := s.PrefixOf("http://exslt.org/functions"); !ok || prefix != "fn" {
+		t.Errorf("PrefixOf gave %q, %t, expected %q, true", prefix, ok, "fn")
+	}
+
+	if prefix, ok := s.PrefixOf("urn:undeclared"); ok {
+		t.Errorf("PrefixOf gave %q for an undeclared namespace", prefix)
+	}
+}
+
+func TestMarshalNamespaces(t *testing.T) {
+	s := NewStylesheet()
+	s.Output = nil
+
+	for _, prefix := range []string{"z", "a"} {
+		if err := s.Declare(prefix, "urn:"+prefix); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+	s.SetAttr("exclude-result-prefixes", "a z")
+
+	data, err := xml.Marshal(s)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	expect := `<xsl:stylesheet version="1.0" exclude-result-prefixes="a z" xmlns:a="urn:a" xmlns:xsl="http://www.w3.org/1999/XSL/Transform" xmlns:z="urn:z"></xsl:stylesheet>`
+	if got := string(data); got != expect {
+		t.Errorf("MarshalXML gave:\n%s\nexpected:\n%s", got, expect)
+	}
+}
@@ -0,0 +1,24 @@
+package xslt
+
+import (
+	"encoding/xml"
+)
+
+// Unsupported is an element read from an XSLT stylesheet that has no corresponding type in this package.
+// It holds the tokens of the element as they were read, so that it can be marshalled back unchanged.
+type Unsupported struct {
+	// Name is the qualified name of the element as written, such as "xsl:number".
+	Name string
+
+	Tokens []xml.Token
+}
+
+func (u *Unsupported) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
+	for _, tok := range u.Tokens {
+		if err := e.EncodeToken(tok); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
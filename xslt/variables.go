@@ -8,6 +8,8 @@ import (
 type variable = struct {
 	Name   string
 	Select string
+	As     string
+	Tunnel *BoolVal
 	Value  interface{}
 }
 
@@ -16,9 +18,15 @@ func marshalVariable(e *xml.Encoder, tagName string, v variable) error {
 		return errors.New("Variable cannot have empty name")
 	}
 
+	if v.Tunnel != nil && tagName == "xsl:variable" {
+		return errors.New("xsl:variable cannot be a tunnel parameter")
+	}
+
 	start := xmlStartElement(tagName,
 		xmlAttr("name", v.Name),
 		xmlAttr("select", v.Select),
+		xmlAttr("as", v.As),
+		xmlAttr("tunnel", v.Tunnel.String()),
 	)
 
 	if err := e.EncodeToken(start); err != nil {
@@ -38,7 +46,11 @@ type Param struct {
 	Name   string `xml:"name,attr"`
 	Select string `xml:"select,attr,omitempty"`
 
-	Value interface{} `xml:",omitempty`
+	// As and Tunnel require XSLT 2.0.
+	As     string   `xml:"as,attr,omitempty"`
+	Tunnel *BoolVal `xml:"tunnel,attr,omitempty"`
+
+	Value interface{} `xml:",omitempty"`
 }
 
 func (p *Param) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
@@ -49,7 +61,12 @@ type Variable struct {
 	Name   string `xml:"name,attr"`
 	Select string `xml:"select,attr,omitempty"`
 
-	Value interface{} `xml:",omitempty`
+	// As requires XSLT 2.0.
+	// A variable cannot be tunnelled, but Tunnel is kept so that a Variable converts to a Param or WithParam.
+	As     string   `xml:"as,attr,omitempty"`
+	Tunnel *BoolVal `xml:"tunnel,attr,omitempty"`
+
+	Value interface{} `xml:",omitempty"`
 }
 
 func (v *Variable) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
@@ -60,7 +77,11 @@ type WithParam struct {
 	Name   string `xml:"name,attr"`
 	Select string `xml:"select,attr,omitempty"`
 
-	Value interface{} `xml:",omitempty`
+	// As and Tunnel require XSLT 2.0.
+	As     string   `xml:"as,attr,omitempty"`
+	Tunnel *BoolVal `xml:"tunnel,attr,omitempty"`
+
+	Value interface{} `xml:",omitempty"`
 }
 
 func (p *WithParam) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
@@ -0,0 +1,45 @@
+package xslt
+
+import (
+	"fmt"
+)
+
+// Version is a version of XSLT that a stylesheet may target.
+type Version int
+
+// Versions of XSLT.
+const (
+	XSLT10 Version = 10
+	XSLT20 Version = 20
+	XSLT30 Version = 30
+)
+
+// LatestVersion is the latest version of XSLT that may be targeted.
+const LatestVersion = XSLT30
+
+func (v Version) String() string {
+	switch v {
+	case XSLT10:
+		return "1.0"
+	case XSLT20:
+		return "2.0"
+	case XSLT30:
+		return "3.0"
+	}
+
+	return fmt.Sprintf("Version(%d)", int(v))
+}
+
+// ParseVersion returns the Version named by the given string, such as "2.0".
+func ParseVersion(s string) (Version, error) {
+	switch s {
+	case "1.0":
+		return XSLT10, nil
+	case "2.0":
+		return XSLT20, nil
+	case "3.0":
+		return XSLT30, nil
+	}
+
+	return 0, fmt.Errorf("unsupported XSLT version: %q", s)
+}
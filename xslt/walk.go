@@ -0,0 +1,119 @@
+package xslt
+
+// Walk traverses the given node and all of its children depth-first, calling fn for each node.
+// If fn returns false, then the children of that node are not visited.
+func Walk(node interface{}, fn func(node interface{}) bool) {
+	if node == nil || !fn(node) {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Stylesheet:
+		Walk(n.Start, fn)
+		Walk(n.Imports, fn)
+		Walk(n.Includes, fn)
+		if n.Output != nil {
+			Walk(n.Output, fn)
+		}
+		Walk(n.Keys, fn)
+		Walk(n.Body, fn)
+
+	case Group:
+		for _, child := range n {
+			Walk(child, fn)
+		}
+
+	case []*Attribute:
+		for _, child := range n {
+			Walk(child, fn)
+		}
+
+	case *Template:
+		for _, param := range n.Params {
+			Walk(param, fn)
+		}
+		Walk(n.Body, fn)
+
+	case *CallTemplate:
+		for _, param := range n.WithParams {
+			Walk(param, fn)
+		}
+
+	case *ApplyTemplates:
+		for _, sort := range n.Sort {
+			Walk(sort, fn)
+		}
+		for _, param := range n.WithParams {
+			Walk(param, fn)
+		}
+
+	case *ForEach:
+		for _, sort := range n.Sort {
+			Walk(sort, fn)
+		}
+		Walk(n.Body, fn)
+
+	case *If:
+		Walk(n.Body, fn)
+
+	case *Choose:
+		for _, when := range n.Whens {
+			Walk(when, fn)
+		}
+		if n.Otherwise != nil {
+			Walk(n.Otherwise, fn)
+		}
+
+	case *When:
+		Walk(n.Body, fn)
+
+	case *Otherwise:
+		Walk(n.Body, fn)
+
+	case *Element:
+		Walk(n.Body, fn)
+
+	case *LiteralElement:
+		for _, attr := range n.Attrs {
+			Walk(attr, fn)
+		}
+		Walk(n.Body, fn)
+
+	case *Attribute:
+		Walk(n.Value, fn)
+
+	case *Param:
+		Walk(n.Value, fn)
+
+	case *Variable:
+		Walk(n.Value, fn)
+
+	case *WithParam:
+		Walk(n.Value, fn)
+
+	case *Function:
+		for _, param := range n.Params {
+			Walk(param, fn)
+		}
+		Walk(n.Body, fn)
+
+	case *EXSLTFunction:
+		for _, param := range n.Params {
+			Walk(param, fn)
+		}
+		Walk(n.Body, fn)
+
+	case *ForEachGroup:
+		for _, sort := range n.Sort {
+			Walk(sort, fn)
+		}
+		Walk(n.Body, fn)
+
+	case *AnalyzeString:
+		Walk(n.Matching, fn)
+		Walk(n.NonMatching, fn)
+
+	case *ResultDocument:
+		Walk(n.Body, fn)
+	}
+}
@@ -21,6 +21,9 @@ type Stylesheet struct {
 
 	Output *Output
 
+	// Keys are the xsl:key declarations, which are output before the templates of the Body.
+	Keys Group
+
 	Body Group
 }
 
@@ -29,16 +32,53 @@ func NewStylesheet() *Stylesheet {
 		XMLName: xmlName("xsl:stylesheet"),
 		Attr: []xml.Attr{
 			{Name: xmlName("version"), Value: "1.0"},
-			{Name: xmlName("xmlns:install"), Value: "http://www.microsoft.com/support"},
-			{Name: xmlName("xmlns:msxsl"), Value: "urn:schemas-microsoft-com:xslt"},
-			{Name: xmlName("xmlns:xs"), Value: "http://www.w3.org/2001/XMLSchema"},
-			{Name: xmlName("xmlns:xsl"), Value: "http://www.w3.org/1999/XSL/Transform"},
+			{Name: xmlName("xmlns:xsl"), Value: NamespaceXSL},
 		},
 
 		Output: NewOutput(),
 	}
 }
 
+type Import struct {
+	Href string `xml:"href,attr"`
+}
+
+func (i *Import) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
+	if i.Href == "" {
+		return errors.New("xsl:import must have an href")
+	}
+
+	start := xmlStartElement("xsl:import",
+		xmlAttr("href", i.Href),
+	)
+
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+
+	return e.EncodeToken(start.End())
+}
+
+type Include struct {
+	Href string `xml:"href,attr"`
+}
+
+func (i *Include) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
+	if i.Href == "" {
+		return errors.New("xsl:include must have an href")
+	}
+
+	start := xmlStartElement("xsl:include",
+		xmlAttr("href", i.Href),
+	)
+
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+
+	return e.EncodeToken(start.End())
+}
+
 type Output struct {
 	XMLName xml.Name `name:"xsl:output"`
 
@@ -71,9 +111,35 @@ func NewOutput() *Output {
 
 type Group []interface{}
 
+type Key struct {
+	Name  string `xml:"name,attr"`
+	Match string `xml:"match,attr"`
+	Use   string `xml:"use,attr"`
+}
+
+func (k *Key) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
+	if k.Name == "" || k.Match == "" || k.Use == "" {
+		return errors.New("xsl:key must have a name, a match, and a use")
+	}
+
+	start := xmlStartElement("xsl:key",
+		xmlAttr("name", k.Name),
+		xmlAttr("match", k.Match),
+		xmlAttr("use", k.Use),
+	)
+
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+
+	return e.EncodeToken(start.End())
+}
+
 type Template struct {
-	Name  string `xml:"name,attr,omitempty"`
-	Match string `xml:"match,attr,omitempty"`
+	Name     string `xml:"name,attr,omitempty"`
+	Match    string `xml:"match,attr,omitempty"`
+	Mode     string `xml:"mode,attr,omitempty"`
+	Priority string `xml:"priority,attr,omitempty"`
 
 	Params []*Param
 
@@ -85,9 +151,15 @@ func (t *Template) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
 		return errors.New("xsl:template must have at least a name or a match")
 	}
 
+	if t.Match == "" && (t.Mode != "" || t.Priority != "") {
+		return errors.New("xsl:template without a match cannot have a mode or priority")
+	}
+
 	start := xmlStartElement("xsl:template",
 		xmlAttr("name", t.Name),
 		xmlAttr("match", t.Match),
+		xmlAttr("mode", t.Mode),
+		xmlAttr("priority", t.Priority),
 	)
 
 	if err := e.EncodeToken(start); err != nil {
@@ -136,7 +208,8 @@ func (c *CallTemplate) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
 }
 
 type Attribute struct {
-	Name string `xml:"name,attr"`
+	Name      string `xml:"name,attr"`
+	Namespace string `xml:"namespace,attr"`
 
 	Value interface{}
 }
@@ -148,6 +221,7 @@ func (a *Attribute) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
 
 	start := xmlStartElement("xsl:attribute",
 		xmlAttr("name", a.Name),
+		xmlAttr("namespace", a.Namespace),
 	)
 
 	if err := e.EncodeToken(start); err != nil {
@@ -162,7 +236,8 @@ func (a *Attribute) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
 }
 
 type Element struct {
-	Name string `xml:"name,attr"`
+	Name      string `xml:"name,attr"`
+	Namespace string `xml:"namespace,attr"`
 
 	Body interface{}
 }
@@ -174,6 +249,7 @@ func (el *Element) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
 
 	start := xmlStartElement("xsl:element",
 		xmlAttr("name", el.Name),
+		xmlAttr("namespace", el.Namespace),
 	)
 
 	if err := e.EncodeToken(start); err != nil {
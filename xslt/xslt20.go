@@ -0,0 +1,231 @@
+package xslt
+
+import (
+	"encoding/xml"
+	"errors"
+)
+
+// The types in this file are instructions and declarations that require XSLT 2.0 or later.
+
+// Function is a stylesheet function, which may be called from XPath by its name, which must have a prefix.
+type Function struct {
+	Name string `xml:"name,attr"`
+	As   string `xml:"as,attr,omitempty"`
+
+	Params []*Param
+
+	Body interface{}
+}
+
+func (f *Function) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
+	if f.Name == "" {
+		return errors.New("xsl:function must have a name")
+	}
+
+	start := xmlStartElement("xsl:function",
+		xmlAttr("name", f.Name),
+		xmlAttr("as", f.As),
+	)
+
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+
+	for _, param := range f.Params {
+		if err := e.Encode(param); err != nil {
+			return err
+		}
+	}
+
+	if err := e.Encode(f.Body); err != nil {
+		return err
+	}
+
+	return e.EncodeToken(start.End())
+}
+
+// Sequence adds the selected items to the result, such as the result of a Function.
+type Sequence struct {
+	Select string `xml:"select,attr"`
+}
+
+func (s *Sequence) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
+	if s.Select == "" {
+		return errors.New("xsl:sequence must have a select")
+	}
+
+	start := xmlStartElement("xsl:sequence",
+		xmlAttr("select", s.Select),
+	)
+
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+
+	return e.EncodeToken(start.End())
+}
+
+// ForEachGroup loops over the groups of the selected items.
+// Exactly one of the GroupBy, GroupAdjacent, GroupStartingWith, or GroupEndingWith must be given.
+type ForEachGroup struct {
+	Select string `xml:"select,attr"`
+
+	GroupBy           string `xml:"group-by,attr,omitempty"`
+	GroupAdjacent     string `xml:"group-adjacent,attr,omitempty"`
+	GroupStartingWith string `xml:"group-starting-with,attr,omitempty"`
+	GroupEndingWith   string `xml:"group-ending-with,attr,omitempty"`
+
+	Sort []*Sort
+	Body interface{}
+}
+
+func (f *ForEachGroup) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
+	if f.Select == "" {
+		return errors.New("xsl:for-each-group must have a select")
+	}
+
+	var n int
+	for _, attr := range []string{f.GroupBy, f.GroupAdjacent, f.GroupStartingWith, f.GroupEndingWith} {
+		if attr != "" {
+			n++
+		}
+	}
+
+	if n != 1 {
+		return errors.New("xsl:for-each-group must have exactly one grouping attribute")
+	}
+
+	start := xmlStartElement("xsl:for-each-group",
+		xmlAttr("select", f.Select),
+		xmlAttr("group-by", f.GroupBy),
+		xmlAttr("group-adjacent", f.GroupAdjacent),
+		xmlAttr("group-starting-with", f.GroupStartingWith),
+		xmlAttr("group-ending-with", f.GroupEndingWith),
+	)
+
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+
+	for _, sort := range f.Sort {
+		if err := e.Encode(sort); err != nil {
+			return err
+		}
+	}
+
+	if err := e.Encode(f.Body); err != nil {
+		return err
+	}
+
+	return e.EncodeToken(start.End())
+}
+
+// AnalyzeString matches a string against a regular expression.
+// The Regex and Flags are attribute value templates.
+type AnalyzeString struct {
+	Select string `xml:"select,attr"`
+	Regex  string `xml:"regex,attr"`
+	Flags  string `xml:"flags,attr,omitempty"`
+
+	// Matching and NonMatching are the bodies for the matching and non-matching substrings.
+	// At least one of them must be given.
+	Matching    interface{}
+	NonMatching interface{}
+}
+
+func (a *AnalyzeString) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
+	if a.Select == "" || a.Regex == "" {
+		return errors.New("xsl:analyze-string must have a select and a regex")
+	}
+
+	if a.Matching == nil && a.NonMatching == nil {
+		return errors.New("xsl:analyze-string must have a matching or a non-matching substring")
+	}
+
+	start := xmlStartElement("xsl:analyze-string",
+		xmlAttr("select", a.Select),
+		xmlAttr("regex", a.Regex),
+		xmlAttr("flags", a.Flags),
+	)
+
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+
+	branches := []struct {
+		name string
+		body interface{}
+	}{
+		{"xsl:matching-substring", a.Matching},
+		{"xsl:non-matching-substring", a.NonMatching},
+	}
+
+	for _, branch := range branches {
+		if branch.body == nil {
+			continue
+		}
+
+		start := xmlStartElement(branch.name)
+
+		if err := e.EncodeToken(start); err != nil {
+			return err
+		}
+
+		if err := e.Encode(branch.body); err != nil {
+			return err
+		}
+
+		if err := e.EncodeToken(start.End()); err != nil {
+			return err
+		}
+	}
+
+	return e.EncodeToken(start.End())
+}
+
+// ResultDocument writes its body to a secondary result document.
+// The Href and the serialization attributes are attribute value templates.
+type ResultDocument struct {
+	Href   string `xml:"href,attr,omitempty"`
+	Format string `xml:"format,attr,omitempty"`
+
+	Method    string `xml:"method,attr,omitempty"`
+	Version   string `xml:"version,attr,omitempty"`
+	Encoding  string `xml:"encoding,attr,omitempty"`
+	MediaType string `xml:"media-type,attr,omitempty"`
+
+	OmitXMLDeclaration *BoolVal `xml:"omit-xml-declaration,attr,omitempty"`
+	Standalone         *BoolVal `xml:"standalone,attr,omitempty"`
+	Indent             *BoolVal `xml:"indent,attr,omitempty"`
+
+	DoctypePublic string `xml:"doctype-public,attr,omitempty"`
+	DoctypeSystem string `xml:"doctype-system,attr,omitempty"`
+
+	Body interface{}
+}
+
+func (r *ResultDocument) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
+	start := xmlStartElement("xsl:result-document",
+		xmlAttr("href", r.Href),
+		xmlAttr("format", r.Format),
+		xmlAttr("method", r.Method),
+		xmlAttr("version", r.Version),
+		xmlAttr("encoding", r.Encoding),
+		xmlAttr("media-type", r.MediaType),
+		xmlAttr("omit-xml-declaration", r.OmitXMLDeclaration.String()),
+		xmlAttr("standalone", r.Standalone.String()),
+		xmlAttr("indent", r.Indent.String()),
+		xmlAttr("doctype-public", r.DoctypePublic),
+		xmlAttr("doctype-system", r.DoctypeSystem),
+	)
+
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+
+	if err := e.Encode(r.Body); err != nil {
+		return err
+	}
+
+	return e.EncodeToken(start.End())
+}